@@ -2,6 +2,7 @@ package main
 
 import (
 	"authentication/data"
+	"authentication/internal/rbac"
 	"errors"
 	"fmt"
 	"log"
@@ -45,6 +46,7 @@ func (app *Config) GoogleCallbackHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	var userID int
+	role := string(rbac.DefaultRole)
 	user, err := app.Models.User.GetByGoogleID(userInfo.ID)
 	if err != nil {
 		log.Printf("User with Google ID %s not found, creating new user", userInfo.ID)
@@ -68,7 +70,12 @@ func (app *Config) GoogleCallbackHandler(w http.ResponseWriter, r *http.Request)
 			return
 		}
 	} else {
+		if user.Active == 0 {
+			http.Error(w, "Account is suspended", http.StatusForbidden)
+			return
+		}
 		userID = user.ID
+		role = user.Role
 	}
 
 	atExp := time.Now().Add(accessTokenTime)
@@ -77,6 +84,7 @@ func (app *Config) GoogleCallbackHandler(w http.ResponseWriter, r *http.Request)
 	tokenPair, err :=
 		app.TokenService.GenerateTokenPair(
 			int64(userID),
+			role,
 			atExp,
 			rtExp,
 		)
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"authentication/data"
+	"authentication/internal/rbac"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultUsersPageSize = 20
+	maxUsersPageSize     = 100
+)
+
+// ListUsers 管理后台：按邮箱 / 姓名搜索用户并分页
+// GET /admin/users?q=&role=&active=0|1&page=1&pageSize=20
+func (app *Config) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := data.UserFilter{
+		Query:    query.Get("q"),
+		Role:     query.Get("role"),
+		Page:     1,
+		PageSize: defaultUsersPageSize,
+	}
+
+	if filter.Role != "" && !rbac.Role(filter.Role).Valid() {
+		app.errorJSON(w, errors.New("unknown role"), http.StatusBadRequest)
+		return
+	}
+
+	if raw := query.Get("active"); raw != "" {
+		active, err := strconv.Atoi(raw)
+		if err != nil || (active != 0 && active != 1) {
+			app.errorJSON(w, errors.New("active must be 0 or 1"), http.StatusBadRequest)
+			return
+		}
+		filter.Active = &active
+	}
+
+	if raw := query.Get("page"); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil || page < 1 {
+			app.errorJSON(w, errors.New("page must be a positive number"), http.StatusBadRequest)
+			return
+		}
+		filter.Page = page
+	}
+
+	if raw := query.Get("pageSize"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 || size > maxUsersPageSize {
+			app.errorJSON(w, fmt.Errorf("pageSize must be between 1 and %d", maxUsersPageSize), http.StatusBadRequest)
+			return
+		}
+		filter.PageSize = size
+	}
+
+	users, total, err := app.Models.User.Search(filter)
+	if err != nil {
+		log.Printf("Error searching users: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if users == nil {
+		users = []*data.User{}
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data: map[string]any{
+			"users":    users,
+			"page":     filter.Page,
+			"pageSize": filter.PageSize,
+			"total":    total,
+		},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetUser 管理后台：查看单个用户
+func (app *Config) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  user,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// ChangeUserRole 修改用户角色。旧 token 会被作废，用户重新登录后拿到新角色。
+func (app *Config) ChangeUserRole(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var requestPayload struct {
+		Role string `json:"role"`
+	}
+
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	role := rbac.Role(requestPayload.Role)
+	if !role.Valid() {
+		app.errorJSON(w, errors.New("role must be one of renter, landlord, moderator, admin"), http.StatusBadRequest)
+		return
+	}
+
+	if app.isSelf(r, user.ID) {
+		app.errorJSON(w, errors.New("you cannot change your own role"), http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Models.User.SetRole(user.ID, string(role)); err != nil {
+		log.Printf("Error changing role of user %d: %v", user.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.auditAdminAction(r, fmt.Sprintf("changed role of user %d from %s to %s", user.ID, user.Role, role))
+	user.Role = string(role)
+
+	message := "Role updated"
+	if err := app.TokenService.RevokeUser(int64(user.ID), refreshTokenTime); err != nil {
+		log.Printf("Could not revoke tokens of user %d: %v", user.ID, err)
+		message = "Role updated; it takes effect at the user's next login"
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    user,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// DeactivateUser 停用账号并强制下线
+func (app *Config) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	app.setUserActive(w, r, 0)
+}
+
+// ReactivateUser 恢复被停用的账号
+func (app *Config) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	app.setUserActive(w, r, 1)
+}
+
+func (app *Config) setUserActive(w http.ResponseWriter, r *http.Request, active int) {
+	user, ok := app.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if active == 0 && app.isSelf(r, user.ID) {
+		app.errorJSON(w, errors.New("you cannot deactivate your own account"), http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Models.User.SetActive(user.ID, active); err != nil {
+		log.Printf("Error setting active=%d for user %d: %v", active, user.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	user.Active = active
+
+	message := "Account reactivated"
+	if active == 0 {
+		message = "Account deactivated"
+		if err := app.TokenService.RevokeUser(int64(user.ID), refreshTokenTime); err != nil {
+			log.Printf("Could not revoke tokens of user %d: %v", user.ID, err)
+			message = "Account deactivated; existing sessions end when their tokens expire"
+		}
+	}
+
+	app.auditAdminAction(r, fmt.Sprintf("set user %d active=%d", user.ID, active))
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    user,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// ForceLogout 作废用户当前所有 token，下次请求时需要重新登录
+func (app *Config) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.TokenService.RevokeUser(int64(user.ID), refreshTokenTime); err != nil {
+		log.Printf("Could not revoke tokens of user %d: %v", user.ID, err)
+		app.errorJSON(w, errors.New("session store unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	app.auditAdminAction(r, fmt.Sprintf("forced logout of user %d", user.ID))
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("User %d has been logged out everywhere", user.ID),
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// userFromURL 读取 URL 中的 {id} 并加载用户，失败时直接写出错误响应
+func (app *Config) userFromURL(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid user ID"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := app.Models.User.GetOne(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// isSelf 判断目标用户是否就是当前管理员
+func (app *Config) isSelf(r *http.Request, userID int) bool {
+	id, ok := rbac.FromContext(r.Context())
+	return ok && id.UserID == int64(userID)
+}
+
+// auditAdminAction 把管理操作记到 logger-service
+func (app *Config) auditAdminAction(r *http.Request, action string) {
+	actor := int64(0)
+	if id, ok := rbac.FromContext(r.Context()); ok {
+		actor = id.UserID
+	}
+
+	go func() {
+		err := app.logRequest("admin", fmt.Sprintf("admin %d %s", actor, action))
+		if err != nil {
+			log.Printf("Failed to send admin audit log: %v", err)
+		}
+	}()
+}
@@ -34,6 +34,12 @@ func (app *Config) Authenticate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.Active == 0 {
+		log.Printf("Login attempt by suspended user %s", user.Email)
+		app.errorJSON(w, errors.New("account is suspended"), http.StatusForbidden)
+		return
+	}
+
 	go func() {
 		err := app.logRequest("authentication", fmt.Sprintf("%s logged in", user.Email))
 		if err != nil {
@@ -46,6 +52,7 @@ func (app *Config) Authenticate(w http.ResponseWriter, r *http.Request) {
 
 	tokenPair, err := app.TokenService.GenerateTokenPair(
 		int64(user.ID),
+		user.Role,
 		atExp,
 		rtExp,
 	)
@@ -65,6 +72,7 @@ func (app *Config) Authenticate(w http.ResponseWriter, r *http.Request) {
 			FirstName: user.FirstName,
 			LastName:  user.LastName,
 			Email:     user.Email,
+			Role:      user.Role,
 		},
 	}
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"authentication/internal/rbac"
 	"errors"
 	"log"
 	"net/http"
@@ -26,7 +27,7 @@ func (app *Config) Profile(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		newAT, refreshErr := app.TokenService.Refresh(rtCookie.Value, time.Now().Add(accessTokenTime))
+		newAT, refreshErr := app.TokenService.Refresh(rtCookie.Value, time.Now().Add(accessTokenTime), app.currentRole)
 		if refreshErr != nil {
 			log.Printf("refresh token invalid")
 			app.errorJSON(w, errors.New("refresh token invalid"), http.StatusUnauthorized)
@@ -59,8 +60,23 @@ func (app *Config) Profile(w http.ResponseWriter, r *http.Request) {
 			"email":      user.Email,
 			"first_name": user.FirstName,
 			"last_name":  user.LastName,
+			"role":       user.Role,
+			// 前端用来决定显示哪些入口
+			"permissions": rbac.Role(user.Role).Permissions(),
 		},
 	}
 
 	app.writeJSON(w, http.StatusOK, payload)
 }
+
+// currentRole 返回用户在数据库中的当前角色，供刷新 access token 使用；账号停用或不存在时返回错误
+func (app *Config) currentRole(userID int64) (string, error) {
+	user, err := app.Models.User.GetOne(int(userID))
+	if err != nil {
+		return "", errors.New("user not found")
+	}
+	if user.Active == 0 {
+		return "", errors.New("account deactivated")
+	}
+	return user.Role, nil
+}
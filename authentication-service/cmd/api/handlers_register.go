@@ -2,6 +2,7 @@ package main
 
 import (
 	"authentication/data"
+	"authentication/internal/rbac"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -20,6 +21,7 @@ func (app *Config) Register(w http.ResponseWriter, r *http.Request) {
 		FirstName        string `json:"first_name"`
 		LastName         string `json:"last_name"`
 		VerificationCode string `json:"verification_code"`
+		Role             string `json:"role"` // renter（默认）或 landlord
 	}
 
 	err := app.readJSON(w, r, &requestPayload)
@@ -38,6 +40,16 @@ func (app *Config) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 注册时只能选择租客或房东，moderator / admin 由管理员分配
+	role := rbac.Role(requestPayload.Role)
+	if role == "" {
+		role = rbac.DefaultRole
+	}
+	if role != rbac.RoleRenter && role != rbac.RoleLandlord {
+		app.errorJSON(w, errors.New("role must be renter or landlord"), http.StatusBadRequest)
+		return
+	}
+
 	// Verify the verification code
 	isValid, err := app.MailService.VerifyCode(requestPayload.Email, requestPayload.VerificationCode)
 	if err != nil || !isValid {
@@ -52,6 +64,7 @@ func (app *Config) Register(w http.ResponseWriter, r *http.Request) {
 		LastName:  requestPayload.LastName,
 		Password:  requestPayload.Password,
 		Active:    1,
+		Role:      string(role),
 	}
 
 	log.Printf("Inserting user: %+v", user)
@@ -77,6 +90,7 @@ func (app *Config) Register(w http.ResponseWriter, r *http.Request) {
 
 	tokenPair, err := app.TokenService.GenerateTokenPair(
 		int64(user.ID),
+		user.Role,
 		atExp,
 		rtExp,
 	)
@@ -96,6 +110,7 @@ func (app *Config) Register(w http.ResponseWriter, r *http.Request) {
 			"email":      user.Email,
 			"first_name": user.FirstName,
 			"last_name":  user.LastName,
+			"role":       user.Role,
 		},
 	}
 
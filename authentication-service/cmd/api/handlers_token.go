@@ -18,6 +18,7 @@ type userData struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Email     string `json:"email"`
+	Role      string `json:"role"`
 }
 
 // Token expiration constants
@@ -46,6 +46,11 @@ func failOnError(err error, msg string) {
 
 // main 函数是应用入口
 func main() {
+	// authApp migrate ... 只执行迁移命令，不启动服务
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(os.Args[2:]))
+	}
+
 	log.Println("Starting authentication service")
 
 	// 连接数据库
@@ -54,6 +59,11 @@ func main() {
 		log.Panic("Can't connect to Postgres!") // 如果连接失败，直接终止程序
 	}
 
+	// 执行数据库迁移
+	if err := migrateOnStartup(pgConn); err != nil {
+		log.Panicf("Can't migrate the database: %v", err)
+	}
+
 	redisClient := connectToRedis()
 	var refreshStore *store.RefreshStore
 	if redisClient != nil {
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"authentication/migrations"
+	"database/sql"
+	"migrate"
+	"os"
+)
+
+// serviceName 用来区分 schema_history 中属于本服务的记录
+const serviceName = "authentication-service"
+
+// migrateOnStartup 在启动 HTTP 服务前执行未完成的迁移。
+// 设置 MIGRATE_ON_START=false 时跳过，改用 migrate 子命令手动管理。
+func migrateOnStartup(db *sql.DB) error {
+	return migrate.OnStartup(db, serviceName, migrations.FS, 1)
+}
+
+// runMigrateCommand 实现 `authApp migrate ...` 子命令，返回进程退出码
+func runMigrateCommand(args []string) int {
+	return migrate.Command("authApp", serviceName, migrations.FS, func() (*sql.DB, error) {
+		return openDB(os.Getenv("DSN"))
+	}, args)
+}
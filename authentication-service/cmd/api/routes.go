@@ -3,6 +3,7 @@ package main
 // 导入标准库中的 net/http
 // http 包提供了 HTTP 服务器和客户端的基础能力
 import (
+	"authentication/internal/rbac"
 	"net/http"
 
 	// chi 是一个轻量级的 HTTP 路由库
@@ -75,6 +76,16 @@ func (app *Config) routes() http.Handler {
 		r.Get("/profile", app.Profile)          // GET /auth/profile
 	})
 
+	// 管理后台：用户、角色与账号状态（RBAC 中间件按权限放行）
+	mux.Route("/admin/users", func(r chi.Router) {
+		r.With(rbac.Require(app.TokenService, rbac.PermUsersRead)).Get("/", app.ListUsers)
+		r.With(rbac.Require(app.TokenService, rbac.PermUsersRead)).Get("/{id}", app.GetUser)
+		r.With(rbac.Require(app.TokenService, rbac.PermUsersAssignRole)).Put("/{id}/role", app.ChangeUserRole)
+		r.With(rbac.Require(app.TokenService, rbac.PermUsersManage)).Post("/{id}/deactivate", app.DeactivateUser)
+		r.With(rbac.Require(app.TokenService, rbac.PermUsersManage)).Post("/{id}/reactivate", app.ReactivateUser)
+		r.With(rbac.Require(app.TokenService, rbac.PermUsersManage)).Post("/{id}/logout", app.ForceLogout)
+	})
+
 	// OAuth routes
 	mux.Route("/oauth", func(r chi.Router) {
 		r.Get("/google/login", app.GoogleLoginHandler)        // GET /oauth/google/login
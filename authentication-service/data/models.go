@@ -45,6 +45,7 @@ type User struct {
 	LastName  string    `json:"last_name,omitempty"`  // 可选，姓氏
 	Password  string    `json:"-"`                    // 密码，json "-" 表示不会被序列化
 	Active    int       `json:"active"`               // 激活状态
+	Role      string    `json:"role"`                 // 角色：renter / landlord / moderator / admin
 	CreatedAt time.Time `json:"created_at"`           // 创建时间
 	UpdatedAt time.Time `json:"updated_at"`           // 更新时间
 }
@@ -61,7 +62,7 @@ func (u *User) GetAll() ([]*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel() // 函数结束时释放资源，防止泄漏
 
-	query := `select id, coalesce(google_id, ''), email, first_name, last_name, password, user_active, created_at, updated_at
+	query := `select id, coalesce(google_id, ''), email, first_name, last_name, password, user_active, role, created_at, updated_at
 	from users order by last_name`
 
 	// QueryContext 用 ctx 执行 SQL 查询
@@ -86,6 +87,7 @@ func (u *User) GetAll() ([]*User, error) {
 			&user.LastName,
 			&user.Password,
 			&user.Active,
+			&user.Role,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -104,7 +106,7 @@ func (u *User) GetByEmail(email string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, coalesce(google_id, ''), email, first_name, last_name, password, user_active, created_at, updated_at from users where email = $1`
+	query := `select id, coalesce(google_id, ''), email, first_name, last_name, password, user_active, role, created_at, updated_at from users where email = $1`
 
 	var user User
 	// QueryRowContext 返回单行数据
@@ -118,6 +120,7 @@ func (u *User) GetByEmail(email string) (*User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.Active,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -129,6 +132,101 @@ func (u *User) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// =====================
+// 搜索 / 分页用户（管理后台）
+// =====================
+
+// UserFilter 是管理后台搜索用户的条件，零值表示不过滤
+type UserFilter struct {
+	Query    string // 匹配邮箱或姓名（不区分大小写）
+	Role     string
+	Active   *int
+	Page     int // 从 1 开始
+	PageSize int
+}
+
+// Search 按条件分页返回用户（按 ID 排序）以及符合条件的总数
+func (u *User) Search(f UserFilter) ([]*User, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	where := `where ($1 = '' or email ilike '%' || $1 || '%' or (first_name || ' ' || last_name) ilike '%' || $1 || '%')
+		and ($2 = '' or role = $2)
+		and ($3::int is null or user_active = $3)`
+
+	var total int
+	err := db.QueryRowContext(ctx, `select count(*) from users `+where, f.Query, f.Role, f.Active).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `select id, coalesce(google_id, ''), email, first_name, last_name, coalesce(password, ''), user_active, role, created_at, updated_at
+		from users ` + where + `
+		order by id
+		limit $4 offset $5`
+
+	rows, err := db.QueryContext(ctx, query, f.Query, f.Role, f.Active, f.PageSize, (f.Page-1)*f.PageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.GoogleID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Password,
+			&user.Active,
+			&user.Role,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, &user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// SetRole 修改用户角色
+func (u *User) SetRole(id int, role string) error {
+	return updateUserColumn(id, "role", role)
+}
+
+// SetActive 停用（0）或恢复（1）用户账号
+func (u *User) SetActive(id int, active int) error {
+	return updateUserColumn(id, "user_active", active)
+}
+
+// updateUserColumn 更新单个字段，用户不存在时返回 sql.ErrNoRows
+func updateUserColumn(id int, column string, value any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update users set ` + column + ` = $1, updated_at = $2 where id = $3`
+	res, err := db.ExecContext(ctx, stmt, value, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
 // =====================
 // 根据 ID 获取用户
 // =====================
@@ -136,7 +234,7 @@ func (u *User) GetOne(id int) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, coalesce(google_id, ''), email, first_name, last_name, password, user_active, created_at, updated_at from users where id = $1`
+	query := `select id, coalesce(google_id, ''), email, first_name, last_name, password, user_active, role, created_at, updated_at from users where id = $1`
 
 	var user User
 	row := db.QueryRowContext(ctx, query, id)
@@ -149,6 +247,7 @@ func (u *User) GetOne(id int) (*User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.Active,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -164,7 +263,7 @@ func (u *User) GetByGoogleID(googleID string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, google_id, email, first_name, last_name, coalesce(password, ''), user_active, created_at, updated_at from users where google_id = $1`
+	query := `select id, google_id, email, first_name, last_name, coalesce(password, ''), user_active, role, created_at, updated_at from users where google_id = $1`
 	var user User
 	row := db.QueryRowContext(ctx, query, googleID)
 
@@ -176,6 +275,7 @@ func (u *User) GetByGoogleID(googleID string) (*User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.Active,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -276,8 +376,14 @@ func (u *User) Insert(user User) (int, error) {
 	}
 
 	var newID int
-	stmt := `insert into users (email, google_id, first_name, last_name, password, user_active, created_at, updated_at)
-		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+	// 未指定角色的新用户默认是租客
+	role := user.Role
+	if role == "" {
+		role = "renter"
+	}
+
+	stmt := `insert into users (email, google_id, first_name, last_name, password, user_active, role, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
 
 	// 返回新插入行的 ID
 	//queryrowcontext以具体的值替换占位符$1...
@@ -288,6 +394,7 @@ func (u *User) Insert(user User) (int, error) {
 		user.LastName,
 		hashedPassword,
 		user.Active,
+		role,
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
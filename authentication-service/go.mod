@@ -23,3 +23,7 @@ require (
 	golang.org/x/oauth2 v0.34.0 // indirect
 	golang.org/x/text v0.32.0 // indirect
 )
+
+require migrate v0.0.0
+
+replace migrate => ../migrate
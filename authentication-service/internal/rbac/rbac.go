@@ -0,0 +1,149 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Role 是用户的角色，写在 access token 的 role claim 里
+type Role string
+
+const (
+	RoleRenter    Role = "renter"
+	RoleLandlord  Role = "landlord"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// DefaultRole 是新用户的角色
+const DefaultRole = RoleRenter
+
+// Permission 是一项可以授予角色的能力
+type Permission string
+
+const (
+	PermFavoritesManage Permission = "favorites:manage" // 收藏
+	PermListingsReport  Permission = "listings:report"  // 举报房源
+	PermListingsCreate  Permission = "listings:create"  // 发布房源
+	PermContentModerate Permission = "content:moderate" // 审核房源 / 处理举报
+	PermUsersRead       Permission = "users:read"       // 查看用户列表
+	PermUsersManage     Permission = "users:manage"     // 停用 / 恢复账号、强制下线
+	PermUsersAssignRole Permission = "users:assign_role"
+)
+
+// rolePermissions 每个角色在上一级的基础上增加权限
+var rolePermissions = map[Role][]Permission{
+	RoleRenter: {
+		PermFavoritesManage,
+		PermListingsReport,
+	},
+	RoleLandlord: {
+		PermFavoritesManage,
+		PermListingsReport,
+		PermListingsCreate,
+	},
+	RoleModerator: {
+		PermFavoritesManage,
+		PermListingsReport,
+		PermListingsCreate,
+		PermContentModerate,
+		PermUsersRead,
+	},
+	RoleAdmin: {
+		PermFavoritesManage,
+		PermListingsReport,
+		PermListingsCreate,
+		PermContentModerate,
+		PermUsersRead,
+		PermUsersManage,
+		PermUsersAssignRole,
+	},
+}
+
+// Valid 判断角色名是否存在
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can 判断角色是否拥有某项权限
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions 返回角色的全部权限
+func (r Role) Permissions() []Permission {
+	return append([]Permission(nil), rolePermissions[r]...)
+}
+
+// Identity 是从 access token 中解析出的调用者
+type Identity struct {
+	UserID int64
+	Role   Role
+}
+
+// Verifier 校验 access token 并返回调用者身份（由 token.Service 实现）
+type Verifier interface {
+	Identify(accessToken string) (*Identity, error)
+}
+
+type contextKey struct{}
+
+// FromContext 取出 Require 中间件放进 context 的调用者身份
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(*Identity)
+	return id, ok
+}
+
+// Require 返回一个中间件：调用者必须持有有效的 access token，
+// 并且其角色拥有全部 perms 权限，否则返回 401 / 403
+func Require(v Verifier, perms ...Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := ""
+			if c, err := r.Cookie("access_token"); err == nil {
+				raw = c.Value
+			}
+			if h := r.Header.Get("Authorization"); raw == "" && strings.HasPrefix(h, "Bearer ") {
+				raw = strings.TrimPrefix(h, "Bearer ")
+			}
+			if raw == "" {
+				deny(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+
+			id, err := v.Identify(raw)
+			if err != nil {
+				deny(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			for _, p := range perms {
+				if !id.Role.Can(p) {
+					deny(w, http.StatusForbidden, "missing permission "+string(p))
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), contextKey{}, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// deny 写出与各服务 jsonResponse 相同格式的错误
+func deny(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":   true,
+		"message": message,
+	})
+}
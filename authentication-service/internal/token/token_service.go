@@ -1,10 +1,12 @@
 package token
 
 import (
+	"authentication/internal/rbac"
 	"authentication/internal/store"
 	"authentication/internal/utils"
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"strconv"
 	"time"
@@ -26,6 +28,17 @@ type TokenPair struct {
 	RefreshToken string
 }
 
+// tokenClaims 是 access / refresh token 共用的 claims，role 决定调用者的权限
+type tokenClaims struct {
+	Role string `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// revokedKey 是 redis 中记录用户 token 作废时间点的 key
+func revokedKey(userID int64) string {
+	return fmt.Sprintf("revoked_before:%d", userID)
+}
+
 func NewService(refreshStore *store.RefreshStore, accessSecret string, refreshSecret string) *Service {
 	return &Service{
 		refreshStore:  refreshStore,
@@ -34,7 +47,7 @@ func NewService(refreshStore *store.RefreshStore, accessSecret string, refreshSe
 	}
 }
 
-func (s *Service) GenerateTokenPair(userID int64, atExp, rtExp time.Time) (*TokenPair, error) {
+func (s *Service) GenerateTokenPair(userID int64, role string, atExp, rtExp time.Time) (*TokenPair, error) {
 	// 生成 jti
 	var jti string
 	if s.refreshStore != nil {
@@ -52,14 +65,8 @@ func (s *Service) GenerateTokenPair(userID int64, atExp, rtExp time.Time) (*Toke
 		}
 	}
 
-	// 生成 Access Token
-
-	atClaims := jwt.MapClaims{
-		"sub": strconv.FormatInt(userID, 10),
-		"exp": atExp.Unix(),
-	}
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	atStr, err := at.SignedString(s.accessSecret)
+	// 生成 Access Token（带 role claim）
+	atStr, err := s.signAccessToken(userID, role, atExp)
 	if err != nil {
 		return nil, err
 	}
@@ -81,9 +88,11 @@ func (s *Service) GenerateTokenPair(userID int64, atExp, rtExp time.Time) (*Toke
 		log.Printf("generating refresh token with exp: %v", rtExp)
 		rtClaims := jwt.MapClaims{
 			// convert int64 to string
-			"sub": strconv.FormatInt(userID, 10),
-			"exp": rtExp.Unix(),
-			"jti": jti,
+			"sub":  strconv.FormatInt(userID, 10),
+			"exp":  rtExp.Unix(),
+			"iat":  time.Now().Unix(),
+			"jti":  jti,
+			"role": role,
 		}
 		rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
 		rtStr, err = rt.SignedString(s.refreshSecret)
@@ -98,8 +107,10 @@ func (s *Service) GenerateTokenPair(userID int64, atExp, rtExp time.Time) (*Toke
 	}, nil
 }
 
-// return new access token
-func (s *Service) Refresh(refreshToken string, atExp time.Time) (string, error) {
+// Refresh 校验 refresh token 并签发新的 access token。
+// currentRole 按数据库返回用户当前的角色，账号停用时返回错误；
+// 不沿用 refresh token 里签发时的 role，角色变更立即生效
+func (s *Service) Refresh(refreshToken string, atExp time.Time, currentRole func(userID int64) (string, error)) (string, error) {
 	// 1. 如果系统不支持 refresh
 	if s.refreshStore == nil {
 		return "", errors.New("refresh token not supported")
@@ -107,7 +118,7 @@ func (s *Service) Refresh(refreshToken string, atExp time.Time) (string, error)
 
 	// 2. 解析并校验 JWT
 	//自动识别sub, exp, jti等标准字段到RegisteredClaims
-	claims := &jwt.RegisteredClaims{}
+	claims := &tokenClaims{}
 
 	// 自动用token.Valid判断签名和过期时间
 	token, err := jwt.ParseWithClaims(refreshToken, claims, func(t *jwt.Token) (any, error) {
@@ -148,23 +159,46 @@ func (s *Service) Refresh(refreshToken string, atExp time.Time) (string, error)
 		log.Printf("jti does not exist")
 		return "", errors.New("refresh token already used or revoked")
 	}
-	// generate new at
-	atClaims := jwt.MapClaims{
-		"sub": strconv.FormatInt(userID, 10),
-		"exp": atExp.Unix(),
+
+	// 管理员强制下线后，之前签发的 refresh token 全部失效
+	if s.isRevoked(userID, claims.IssuedAt) {
+		log.Printf("refresh token revoked for user %d", userID)
+		return "", errors.New("refresh token already used or revoked")
 	}
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	atStr, err := at.SignedString(s.accessSecret)
 
+	role, err := currentRole(userID)
 	if err != nil {
+		log.Printf("refresh refused for user %d: %v", userID, err)
 		return "", err
 	}
 
-	return atStr, nil
+	// generate new at
+	return s.signAccessToken(userID, role, atExp)
+}
+
+// signAccessToken 签发带 role claim 的 access token
+func (s *Service) signAccessToken(userID int64, role string, atExp time.Time) (string, error) {
+	atClaims := jwt.MapClaims{
+		"sub":  strconv.FormatInt(userID, 10),
+		"exp":  atExp.Unix(),
+		"iat":  time.Now().Unix(),
+		"role": role,
+	}
+	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
+	return at.SignedString(s.accessSecret)
 }
 
 func (s *Service) ValidateAccessToken(accessToken string) (int64, error) {
-	claims := &jwt.RegisteredClaims{}
+	id, err := s.Identify(accessToken)
+	if err != nil {
+		return 0, err
+	}
+	return id.UserID, nil
+}
+
+// Identify 校验 access token 并返回用户 ID 和角色，实现 rbac.Verifier
+func (s *Service) Identify(accessToken string) (*rbac.Identity, error) {
+	claims := &tokenClaims{}
 
 	token, err := jwt.ParseWithClaims(accessToken, claims, func(t *jwt.Token) (any, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -174,19 +208,70 @@ func (s *Service) ValidateAccessToken(accessToken string) (int64, error) {
 	})
 
 	if err != nil || !token.Valid {
-		return 0, errors.New("invalid access token")
+		return nil, errors.New("invalid access token")
 	}
 
 	// 检查是否过期
 	if claims.ExpiresAt == nil || time.Now().After(claims.ExpiresAt.Time) {
 		log.Printf("access token expired")
-		return 0, errors.New("access token expired")
+		return nil, errors.New("access token expired")
 	}
 
 	// 解析 subject
 	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
 	if err != nil {
-		return 0, errors.New("invalid subject in token")
+		return nil, errors.New("invalid subject in token")
 	}
-	return userID, nil
+
+	if s.isRevoked(userID, claims.IssuedAt) {
+		return nil, errors.New("access token revoked")
+	}
+
+	// 角色上线前签发的 token 没有 role claim，按默认角色处理
+	role := rbac.Role(claims.Role)
+	if !role.Valid() {
+		role = rbac.DefaultRole
+	}
+
+	return &rbac.Identity{UserID: userID, Role: role}, nil
+}
+
+// RevokeUser 作废用户此刻之前签发的全部 token（强制下线）。
+// ttl 取 refresh token 的最长有效期，过期后旧 token 本身已失效。
+func (s *Service) RevokeUser(userID int64, ttl time.Duration) error {
+	if s.refreshStore == nil {
+		return errors.New("token revocation requires redis")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), utils.RedisTimeout)
+	defer cancel()
+
+	return s.refreshStore.SavePair(ctx, revokedKey(userID), strconv.FormatInt(time.Now().Unix(), 10), ttl)
+}
+
+// isRevoked 判断签发时间早于用户作废时间点的 token。没有 iat 的旧 token 视为被作废。
+// 查询 redis 失败时无法确认，同样视为被作废（与 broker 一致）。
+func (s *Service) isRevoked(userID int64, issuedAt *jwt.NumericDate) bool {
+	if s.refreshStore == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), utils.RedisTimeout)
+	defer cancel()
+
+	value, err := s.refreshStore.GetValue(ctx, revokedKey(userID))
+	if err != nil {
+		log.Printf("Error checking token revocation of user %d: %v", userID, err)
+		return true
+	}
+	if value == "" {
+		return false
+	}
+
+	cutoff, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return true
+	}
+
+	return issuedAt == nil || issuedAt.Unix() < cutoff
 }
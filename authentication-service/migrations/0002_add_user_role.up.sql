@@ -0,0 +1,4 @@
+-- renter | landlord | moderator | admin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'renter';
+
+CREATE INDEX IF NOT EXISTS idx_users_role ON users(role);
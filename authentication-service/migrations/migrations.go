@@ -0,0 +1,9 @@
+// Package migrations 打包认证服务的 schema 迁移文件
+package migrations
+
+import "embed"
+
+// FS 包含所有 <version>_<name>.(up|down).sql 文件
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultFeedItems = 30
+	maxFeedItems     = 100
+	// feedCacheTTL is how long fetched listings are reused for every feed
+	// format and client asking with the same filters
+	feedCacheTTL = time.Minute
+	// feedMaxAge is what clients are told to cache a feed for
+	feedMaxAge = 5 * time.Minute
+	// maxCachedFeeds bounds the feed cache; it is emptied when full
+	maxCachedFeeds = 200
+)
+
+// feedFilters are the listing search parameters passed on to post-service
+var feedFilters = []string{
+	"neighborhood", "type", "minPrice", "maxPrice", "minBedrooms", "maxBedrooms",
+	"minBathrooms", "availableFrom", "availableTo", "keywords",
+}
+
+// feedListing is the part of a post-service listing a feed shows
+type feedListing struct {
+	ID            string  `json:"id"`
+	Title         string  `json:"title"`
+	Price         float64 `json:"price"`
+	Location      string  `json:"location"`
+	Neighborhood  string  `json:"neighborhood"`
+	Type          string  `json:"type"`
+	ImageURL      string  `json:"imageUrl"`
+	Description   string  `json:"description"`
+	Bedrooms      int     `json:"bedrooms"`
+	Bathrooms     int     `json:"bathrooms"`
+	CreatedAt     int64   `json:"createdAt"` // Unix milliseconds
+	UpdatedAt     int64   `json:"updatedAt"`
+	AvailableFrom int64   `json:"availableFrom"`
+	Version       int     `json:"version"`
+	Author        struct {
+		Name string `json:"name"`
+	} `json:"author"`
+}
+
+func (l *feedListing) modified() time.Time {
+	return time.UnixMilli(max(l.CreatedAt, l.UpdatedAt)).UTC()
+}
+
+// summary is the one-line description of a listing used by every format
+func (l *feedListing) summary() string {
+	parts := []string{
+		fmt.Sprintf("$%.0f/mo", l.Price),
+		fmt.Sprintf("%dBR/%dBA", l.Bedrooms, l.Bathrooms),
+	}
+	if l.Neighborhood != "" {
+		parts = append(parts, l.Neighborhood)
+	}
+	if l.AvailableFrom > 0 {
+		parts = append(parts, "available "+time.UnixMilli(l.AvailableFrom).UTC().Format("Jan 2, 2006"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// feedImage is a listing's main image as a feed enclosure. Images stored
+// inline as data URIs are served from /feeds/listings/{id}/image.
+type feedImage struct {
+	URL    string
+	Type   string
+	Length int // 0 when unknown
+}
+
+func (app *Config) feedImage(l *feedListing) *feedImage {
+	switch {
+	case strings.HasPrefix(l.ImageURL, "http://"), strings.HasPrefix(l.ImageURL, "https://"):
+		imageType := mime.TypeByExtension(path.Ext(strings.SplitN(l.ImageURL, "?", 2)[0]))
+		if !strings.HasPrefix(imageType, "image/") {
+			imageType = "image/jpeg"
+		}
+		return &feedImage{URL: l.ImageURL, Type: imageType}
+	case strings.HasPrefix(l.ImageURL, "data:image/"):
+		imageType, encoded, ok := parseDataURI(l.ImageURL)
+		if !ok {
+			return nil
+		}
+		return &feedImage{
+			URL:    fmt.Sprintf("%s/feeds/listings/%s/image", app.PublicURL, l.ID),
+			Type:   imageType,
+			Length: len(encoded)*3/4 - strings.Count(encoded, "="),
+		}
+	}
+	return nil
+}
+
+// parseDataURI splits a base64 data URI into its media type and payload
+func parseDataURI(uri string) (mediaType, encoded string, ok bool) {
+	header, encoded, found := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(header, ";base64"), encoded, true
+}
+
+type feedCacheEntry struct {
+	listings []feedListing
+	fetched  time.Time
+}
+
+// listingFeedCache holds recently fetched listings by filter query
+var listingFeedCache = struct {
+	sync.Mutex
+	entries map[string]feedCacheEntry
+}{entries: map[string]feedCacheEntry{}}
+
+// feedError is an error post-service answered a feed request with
+type feedError struct {
+	status  int
+	message string
+}
+
+func (e *feedError) Error() string { return e.message }
+
+// feedListings returns the newest published listings matching filters,
+// from the cache when it is fresh
+func feedListings(filters url.Values) ([]feedListing, error) {
+	key := filters.Encode()
+
+	listingFeedCache.Lock()
+	entry, ok := listingFeedCache.entries[key]
+	listingFeedCache.Unlock()
+	if ok && time.Since(entry.fetched) < feedCacheTTL {
+		return entry.listings, nil
+	}
+
+	endpoint := "http://post-service/posts"
+	if key != "" {
+		endpoint += "?" + key
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		Error   bool          `json:"error"`
+		Message string        `json:"message"`
+		Data    []feedListing `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+	if payload.Error {
+		return nil, &feedError{status: resp.StatusCode, message: payload.Message}
+	}
+
+	listingFeedCache.Lock()
+	if len(listingFeedCache.entries) >= maxCachedFeeds {
+		listingFeedCache.entries = map[string]feedCacheEntry{}
+	}
+	listingFeedCache.entries[key] = feedCacheEntry{listings: payload.Data, fetched: time.Now()}
+	listingFeedCache.Unlock()
+
+	return payload.Data, nil
+}
+
+// ListingFeedREST serves the newest published listings as RSS 2.0
+// (/feeds/listings.rss), Atom (.atom) or JSON Feed (.json). The listing
+// search parameters filter them and ?limit= sets how many are included.
+// Responses carry an ETag and Last-Modified so pollers get 304s while
+// nothing changed.
+func (app *Config) ListingFeedREST(w http.ResponseWriter, r *http.Request) {
+	format := strings.TrimPrefix(path.Ext(r.URL.Path), ".")
+
+	query := r.URL.Query()
+	filters := url.Values{}
+	for _, name := range feedFilters {
+		if values := query[name]; len(values) > 0 {
+			filters[name] = values
+		}
+	}
+
+	limit := defaultFeedItems
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			app.errorJSON(w, errors.New("limit must be a positive number"), http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxFeedItems)
+	}
+
+	listings, err := feedListings(filters)
+	var fe *feedError
+	if errors.As(err, &fe) {
+		app.errorJSON(w, fe, fe.status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching listings for %s feed: %v", format, err)
+		app.errorJSON(w, errors.New("post service unavailable"), http.StatusBadGateway)
+		return
+	}
+	if len(listings) > limit {
+		listings = listings[:limit]
+	}
+
+	// The validators cover everything the document is built from
+	var lastModified time.Time
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s|%s|%d", format, filters.Encode(), limit)
+	for i := range listings {
+		if m := listings[i].modified(); m.After(lastModified) {
+			lastModified = m
+		}
+		fmt.Fprintf(hash, "|%s:%d", listings[i].ID, listings[i].Version)
+	}
+	etag := `"feed-` + hex.EncodeToString(hash.Sum(nil))[:32] + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(feedMaxAge.Seconds())))
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	title := "DWELL listings"
+	if n := filters["neighborhood"]; len(n) > 0 {
+		title += " in " + strings.Join(n, ", ")
+	}
+	selfURL := app.PublicURL + r.URL.RequestURI()
+	homeURL := app.PublicURL + "/posts"
+	if len(filters) > 0 {
+		homeURL += "?" + filters.Encode()
+	}
+
+	var body []byte
+	switch format {
+	case "rss":
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		body, err = app.rssFeed(title, selfURL, homeURL, lastModified, listings)
+	case "atom":
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		body, err = app.atomFeed(title, selfURL, homeURL, lastModified, listings)
+	default:
+		w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+		body, err = app.jsonFeed(title, selfURL, homeURL, listings)
+	}
+	if err != nil {
+		log.Printf("Error rendering %s feed: %v", format, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// notModified applies If-None-Match, or If-Modified-Since when there is no
+// If-None-Match
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
+
+// listingURL is where a feed item links to
+func (app *Config) listingURL(l *feedListing) string {
+	return app.PublicURL + "/posts/" + l.ID
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	TTL           int       `xml:"ttl"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Categories  []string      `xml:"category"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+func (app *Config) rssFeed(title, selfURL, homeURL string, updated time.Time, listings []feedListing) ([]byte, error) {
+	channel := rssChannel{
+		Title:       title,
+		Link:        homeURL,
+		Description: "The newest rental listings on DWELL",
+		Self:        atomLink{Href: selfURL, Rel: "self", Type: "application/rss+xml"},
+		TTL:         int(feedMaxAge.Minutes()),
+		Items:       []rssItem{},
+	}
+	if !updated.IsZero() {
+		channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+
+	for i := range listings {
+		l := &listings[i]
+		item := rssItem{
+			Title:       l.Title,
+			Link:        app.listingURL(l),
+			Description: l.summary() + "\n\n" + l.Description,
+			GUID:        rssGUID{IsPermaLink: true, Value: app.listingURL(l)},
+			PubDate:     time.UnixMilli(l.CreatedAt).UTC().Format(time.RFC1123Z),
+			Categories:  nonEmpty(l.Type, l.Neighborhood),
+		}
+		if img := app.feedImage(l); img != nil {
+			item.Enclosure = &rssEnclosure{URL: img.URL, Length: img.Length, Type: img.Type}
+		}
+		channel.Items = append(channel.Items, item)
+	}
+
+	return marshalXML(rssDocument{Version: "2.0", AtomNS: "http://www.w3.org/2005/Atom", Channel: channel})
+}
+
+type atomDocument struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int    `xml:"length,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Links      []atomLink     `xml:"link"`
+	Author     *atomAuthor    `xml:"author,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary"`
+	Content    string         `xml:"content"`
+}
+
+func (app *Config) atomFeed(title, selfURL, homeURL string, updated time.Time, listings []feedListing) ([]byte, error) {
+	if updated.IsZero() {
+		updated = time.Now().UTC()
+	}
+
+	feed := atomDocument{
+		Title:   title,
+		ID:      selfURL,
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: selfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: homeURL, Rel: "alternate"},
+		},
+		Author: atomAuthor{Name: "DWELL"},
+	}
+
+	for i := range listings {
+		l := &listings[i]
+		entry := atomEntry{
+			Title:     l.Title,
+			ID:        app.listingURL(l),
+			Published: time.UnixMilli(l.CreatedAt).UTC().Format(time.RFC3339),
+			Updated:   l.modified().Format(time.RFC3339),
+			Links:     []atomLink{{Href: app.listingURL(l), Rel: "alternate"}},
+			Summary:   l.summary(),
+			Content:   l.Description,
+		}
+		if l.Author.Name != "" {
+			entry.Author = &atomAuthor{Name: l.Author.Name}
+		}
+		for _, term := range nonEmpty(l.Type, l.Neighborhood) {
+			entry.Categories = append(entry.Categories, atomCategory{Term: term})
+		}
+		if img := app.feedImage(l); img != nil {
+			entry.Links = append(entry.Links, atomLink{Href: img.URL, Rel: "enclosure", Type: img.Type, Length: img.Length})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return marshalXML(feed)
+}
+
+type jsonFeedDocument struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	Summary       string               `json:"summary"`
+	ContentText   string               `json:"content_text"`
+	Image         string               `json:"image,omitempty"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Tags          []string             `json:"tags,omitempty"`
+	Authors       []jsonFeedAuthor     `json:"authors,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Size     int    `json:"size_in_bytes,omitempty"`
+}
+
+func (app *Config) jsonFeed(title, selfURL, homeURL string, listings []feedListing) ([]byte, error) {
+	feed := jsonFeedDocument{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       title,
+		HomePageURL: homeURL,
+		FeedURL:     selfURL,
+		Items:       []jsonFeedItem{},
+	}
+
+	for i := range listings {
+		l := &listings[i]
+		item := jsonFeedItem{
+			ID:            l.ID,
+			URL:           app.listingURL(l),
+			Title:         l.Title,
+			Summary:       l.summary(),
+			ContentText:   l.Description,
+			DatePublished: time.UnixMilli(l.CreatedAt).UTC().Format(time.RFC3339),
+			DateModified:  l.modified().Format(time.RFC3339),
+			Tags:          nonEmpty(l.Type, l.Neighborhood),
+		}
+		if l.Author.Name != "" {
+			item.Authors = []jsonFeedAuthor{{Name: l.Author.Name}}
+		}
+		if img := app.feedImage(l); img != nil {
+			item.Image = img.URL
+			item.Attachments = []jsonFeedAttachment{{URL: img.URL, MimeType: img.Type, Size: img.Length}}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	return json.MarshalIndent(feed, "", "\t")
+}
+
+func marshalXML(v any) ([]byte, error) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// ListingImageREST serves a published listing's main image for feed
+// enclosures. Inline data URI images are decoded; linked images are
+// redirected to.
+func (app *Config) ListingImageREST(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://post-service/posts/%d", id))
+	if err != nil {
+		app.errorJSON(w, errors.New("post service unavailable"), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		Error bool        `json:"error"`
+		Data  feedListing `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil || payload.Error {
+		app.errorJSON(w, errors.New("image not found"), http.StatusNotFound)
+		return
+	}
+	listing := payload.Data
+
+	if strings.HasPrefix(listing.ImageURL, "http://") || strings.HasPrefix(listing.ImageURL, "https://") {
+		http.Redirect(w, r, listing.ImageURL, http.StatusFound)
+		return
+	}
+
+	imageType, encoded, ok := parseDataURI(listing.ImageURL)
+	if !ok || !strings.HasPrefix(imageType, "image/") {
+		app.errorJSON(w, errors.New("image not found"), http.StatusNotFound)
+		return
+	}
+	image, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		app.errorJSON(w, errors.New("image not found"), http.StatusNotFound)
+		return
+	}
+
+	etag := fmt.Sprintf(`"image-%d-v%d"`, id, listing.Version)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	if notModified(r, etag, time.Time{}) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", imageType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(image)
+}
@@ -5,9 +5,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"html/template"
+	"io"
 	"log"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -147,10 +152,10 @@ func (app *Config) HandleSubmission(w http.ResponseWriter, r *http.Request) {
 		app.createPost(w, requestPayload.Post)
 
 	case "update-post":
-		app.updatePost(w, requestPayload.Post)
+		app.updatePost(w, r, requestPayload.Post)
 
 	case "delete-post":
-		app.deletePost(w, requestPayload.DeletePost)
+		app.deletePost(w, r, requestPayload.DeletePost)
 
 	default:
 		app.errorJSON(w, errors.New("unknown action"))
@@ -253,6 +258,9 @@ func (app *Config) forwardToAuthService(
 		for _, c := range r.Cookies() {
 			req.AddCookie(c)
 		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
 	}
 
 	client := &http.Client{}
@@ -309,38 +317,59 @@ func (app *Config) logout(w http.ResponseWriter, r *http.Request) {
 // Post service handlers
 func (app *Config) getAllPosts(w http.ResponseWriter) {
 	log.Printf("Forwarding get all posts request")
-	app.forwardToPostService(w, "GET", "http://post-service/posts", nil)
+	app.forwardToPostService(w, nil, "GET", "http://post-service/posts", nil)
 }
 
 func (app *Config) createPost(w http.ResponseWriter, p PostPayload) {
 	log.Printf("Forwarding create post request")
-	app.forwardToPostService(w, "POST", "http://post-service/posts", p)
+	app.forwardToPostService(w, nil, "POST", "http://post-service/posts", p)
 }
 
-func (app *Config) updatePost(w http.ResponseWriter, p PostPayload) {
+func (app *Config) updatePost(w http.ResponseWriter, r *http.Request, p PostPayload) {
 	log.Printf("Forwarding update post request for ID: %d", p.ID)
 	url := "http://post-service/posts/" + strconv.Itoa(p.ID)
-	app.forwardToPostService(w, "PUT", url, p)
+	app.forwardToPostService(w, r, "PUT", url, p)
 }
 
-func (app *Config) deletePost(w http.ResponseWriter, p DeletePostPayload) {
+func (app *Config) deletePost(w http.ResponseWriter, r *http.Request, p DeletePostPayload) {
 	log.Printf("Forwarding delete post request for ID: %d", p.ID)
 	url := "http://post-service/posts/" + strconv.Itoa(p.ID)
 	body := map[string]int{"authorId": p.AuthorID}
-	app.forwardToPostService(w, "DELETE", url, body)
+	app.forwardToPostService(w, r, "DELETE", url, body)
 }
 
 // RESTful API handlers for posts
 func (app *Config) GetAllPostsREST(w http.ResponseWriter, r *http.Request) {
 	log.Printf("RESTful: GET all posts")
-	app.forwardToPostService(w, "GET", "http://post-service/posts", nil)
+	url := "http://post-service/posts"
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
+	app.forwardToPostService(w, r, "GET", url, nil)
+}
+
+func (app *Config) SetPostStatusREST(w http.ResponseWriter, r *http.Request) {
+	if !app.requireIdentity(w, r) {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	log.Printf("RESTful: PUT post status: %s", id)
+	var payload struct {
+		Status string `json:"status"`
+	}
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	app.forwardToPostService(w, r, "PUT", "http://post-service/posts/"+id+"/status", payload)
 }
 
 func (app *Config) GetPostByIDREST(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	ensureVisitorSession(w, r)
 	log.Printf("RESTful: GET post by ID: %s", id)
 	url := "http://post-service/posts/" + id
-	app.forwardToPostService(w, "GET", url, nil)
+	app.forwardToPostService(w, r, "GET", url, nil)
 }
 
 func (app *Config) CreatePostREST(w http.ResponseWriter, r *http.Request) {
@@ -355,11 +384,17 @@ func (app *Config) CreatePostREST(w http.ResponseWriter, r *http.Request) {
 	if post.AuthorID == 0 {
 		log.Println("WARNING: AuthorID is 0!")
 	}
-	app.forwardToPostService(w, "POST", "http://post-service/posts", post)
+	app.forwardToPostService(w, r, "POST", "http://post-service/posts", post)
 }
 
+// UpdatePostREST forwards a full update; post-service takes the author from
+// the caller's identity, so they must be logged in
 func (app *Config) UpdatePostREST(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !app.requireIdentity(w, r) {
+		return
+	}
+
 	var post PostPayload
 	if err := app.readJSON(w, r, &post); err != nil {
 		app.errorJSON(w, err)
@@ -367,24 +402,426 @@ func (app *Config) UpdatePostREST(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("RESTful: UPDATE post ID: %s", id)
 	url := "http://post-service/posts/" + id
-	app.forwardToPostService(w, "PUT", url, post)
+	app.forwardToPostService(w, r, "PUT", url, post)
 }
 
+// PatchPostREST forwards a JSON Merge Patch; If-Match is passed through and
+// the caller must be logged in so post-service can check ownership
+func (app *Config) PatchPostREST(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !app.requireIdentity(w, r) {
+		return
+	}
+
+	var patch json.RawMessage
+	if err := app.readJSON(w, r, &patch); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	log.Printf("RESTful: PATCH post ID: %s", id)
+	url := "http://post-service/posts/" + id
+	app.forwardToPostService(w, r, "PATCH", url, patch)
+}
+
+// DeletePostREST forwards a delete for the logged-in caller. The body is
+// optional now that the author comes from the caller's identity.
 func (app *Config) DeletePostREST(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !app.requireIdentity(w, r) {
+		return
+	}
+
 	var body struct {
-		AuthorID int `json:"authorId"`
+		AuthorID int `json:"authorId,omitempty"`
 	}
-	if err := app.readJSON(w, r, &body); err != nil {
+	if err := app.readJSON(w, r, &body); err != nil && !errors.Is(err, io.EOF) {
 		app.errorJSON(w, err)
 		return
 	}
 	log.Printf("RESTful: DELETE post ID: %s", id)
 	url := "http://post-service/posts/" + id
-	app.forwardToPostService(w, "DELETE", url, body)
+	app.forwardToPostService(w, r, "DELETE", url, body)
+}
+
+// GetPostHistoryREST returns a post's revision history (author or moderator only)
+func (app *Config) GetPostHistoryREST(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !app.requireIdentity(w, r) {
+		return
+	}
+	log.Printf("RESTful: GET history for post ID: %s", id)
+	url := "http://post-service/posts/" + id + "/history"
+	app.forwardToPostService(w, r, "GET", url, nil)
+}
+
+// RestorePostRevisionREST restores a post to one of its revisions
+func (app *Config) RestorePostRevisionREST(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	revisionID := chi.URLParam(r, "revisionId")
+	if !app.requireIdentity(w, r) {
+		return
+	}
+	log.Printf("RESTful: RESTORE post ID: %s to revision %s", id, revisionID)
+	url := "http://post-service/posts/" + id + "/history/" + revisionID + "/restore"
+	app.forwardToPostService(w, r, "POST", url, nil)
+}
+
+// GetPostPriceHistoryREST returns the asking prices a post has had
+func (app *Config) GetPostPriceHistoryREST(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	log.Printf("RESTful: GET price history for post ID: %s", id)
+	url := "http://post-service/posts/" + id + "/price-history"
+	app.forwardToPostService(w, r, "GET", url, nil)
+}
+
+// GetPostsByAuthorREST returns an author's posts; the author also gets
+// per-listing view, favorite and contact totals
+func (app *Config) GetPostsByAuthorREST(w http.ResponseWriter, r *http.Request) {
+	authorID := chi.URLParam(r, "authorId")
+	log.Printf("RESTful: GET posts by author: %s", authorID)
+	url := "http://post-service/posts/author/" + authorID
+	app.forwardToPostService(w, r, "GET", url, nil)
+}
+
+// GetAuthorAnalyticsREST returns the daily analytics of an author's listings
+func (app *Config) GetAuthorAnalyticsREST(w http.ResponseWriter, r *http.Request) {
+	authorID := chi.URLParam(r, "authorId")
+	if !app.requireIdentity(w, r) {
+		return
+	}
+	log.Printf("RESTful: GET analytics for author: %s", authorID)
+	url := "http://post-service/posts/author/" + authorID + "/analytics"
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
+	app.forwardToPostService(w, r, "GET", url, nil)
+}
+
+// RecordContactClickREST counts a click on a listing's contact button
+func (app *Config) RecordContactClickREST(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ensureVisitorSession(w, r)
+	log.Printf("RESTful: contact click on post ID: %s", id)
+	url := "http://post-service/posts/" + id + "/contact-click"
+	app.forwardToPostService(w, r, "POST", url, nil)
+}
+
+// GetPostMatchesREST returns why a post was flagged and the listings it
+// matched (admin only)
+func (app *Config) GetPostMatchesREST(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !app.requireIdentity(w, r) {
+		return
+	}
+	log.Printf("RESTful: GET screening matches for post ID: %s", id)
+	url := "http://post-service/posts/" + id + "/matches"
+	app.forwardToPostService(w, r, "GET", url, nil)
+}
+
+// GetPendingScreeningsREST lists posts held for review (admin only)
+func (app *Config) GetPendingScreeningsREST(w http.ResponseWriter, r *http.Request) {
+	if !app.requireIdentity(w, r) {
+		return
+	}
+	log.Printf("RESTful: GET pending screenings")
+	app.forwardToPostService(w, r, "GET", "http://post-service/admin/screenings", nil)
+}
+
+// ReviewScreeningREST approves or rejects a held post (admin only)
+func (app *Config) ReviewScreeningREST(w http.ResponseWriter, r *http.Request) {
+	postID := chi.URLParam(r, "postId")
+	decision := chi.URLParam(r, "decision")
+	if !app.requireIdentity(w, r) {
+		return
+	}
+	log.Printf("RESTful: %s screening of post ID: %s", decision, postID)
+	url := "http://post-service/admin/screenings/" + postID + "/" + decision
+	app.forwardToPostService(w, r, "POST", url, nil)
+}
+
+// ReportPostREST files a user report against a listing
+func (app *Config) ReportPostREST(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !app.requireIdentity(w, r) {
+		return
+	}
+
+	var body json.RawMessage
+	if err := app.readJSON(w, r, &body); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	log.Printf("RESTful: REPORT post ID: %s", id)
+	url := "http://post-service/posts/" + id + "/reports"
+	app.forwardToPostService(w, r, "POST", url, body)
+}
+
+// AdminPostServiceREST forwards an admin moderation request to the same path
+// on post-service; post-service checks the caller's role
+func (app *Config) AdminPostServiceREST(w http.ResponseWriter, r *http.Request) {
+	if !app.requireIdentity(w, r) {
+		return
+	}
+
+	var body any
+	if r.Method == http.MethodPost {
+		var raw json.RawMessage
+		if err := app.readJSON(w, r, &raw); err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+		body = raw
+	}
+
+	url := "http://post-service" + r.URL.Path
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
+	log.Printf("RESTful: admin %s %s", r.Method, r.URL.Path)
+	app.forwardToPostService(w, r, r.Method, url, body)
+}
+
+// SavedSearchesREST forwards the caller's saved search requests to
+// post-service, which only shows each user their own searches
+func (app *Config) SavedSearchesREST(w http.ResponseWriter, r *http.Request) {
+	if !app.requireIdentity(w, r) {
+		return
+	}
+
+	var body any
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		var raw json.RawMessage
+		if err := app.readJSON(w, r, &raw); err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+		body = raw
+	}
+
+	log.Printf("RESTful: saved searches %s %s", r.Method, r.URL.Path)
+	app.forwardToPostService(w, r, r.Method, "http://post-service"+r.URL.Path, body)
+}
+
+// unsubscribePage is shown when the unsubscribe link of a search alert is
+// opened. Mail scanners follow links, so the page only asks; the form POSTs
+// back to the same URL to turn the alerts off.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Search alerts</title></head>
+<body>
+{{if .Error}}<p>{{.Error}}</p>
+{{else if .Done}}<p>You will no longer get alerts for &ldquo;{{.Name}}&rdquo;.</p>
+{{else if not .Subscribed}}<p>Alerts for &ldquo;{{.Name}}&rdquo; are already off.</p>
+{{else}}<p>Stop getting alerts for your saved search &ldquo;{{.Name}}&rdquo;?</p>
+<form method="post"><button type="submit">Unsubscribe</button></form>
+{{end}}</body>
+</html>
+`))
+
+// unsubscribeView is what unsubscribePage shows
+type unsubscribeView struct {
+	Name       string
+	Subscribed bool
+	Done       bool
+	Error      string
+}
+
+// ConfirmUnsubscribeSavedSearchREST shows the page the unsubscribe link of
+// search alerts opens. It doesn't change anything.
+func (app *Config) ConfirmUnsubscribeSavedSearchREST(w http.ResponseWriter, r *http.Request) {
+	url := "http://post-service/saved-searches/unsubscribe/" + chi.URLParam(r, "token")
+
+	var view unsubscribeView
+	status, err := savedSearchUnsubscribe(http.MethodGet, url, &view)
+	if err != nil {
+		view.Error = err.Error()
+	}
+	renderUnsubscribePage(w, status, view)
+}
+
+// UnsubscribeSavedSearchREST turns the alerts of a saved search off. The
+// confirmation form gets a page back; one-click unsubscribes from mail
+// clients (RFC 8058) and API callers get JSON.
+func (app *Config) UnsubscribeSavedSearchREST(w http.ResponseWriter, r *http.Request) {
+	url := "http://post-service/saved-searches/unsubscribe/" + chi.URLParam(r, "token")
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		app.forwardToPostService(w, nil, http.MethodPost, url, nil)
+		return
+	}
+
+	view := unsubscribeView{Done: true}
+	status, err := savedSearchUnsubscribe(http.MethodPost, url, &view)
+	if err != nil {
+		view.Error = err.Error()
+	}
+	renderUnsubscribePage(w, status, view)
+}
+
+// savedSearchUnsubscribe calls post-service's unsubscribe endpoint and
+// fills view with the search it names
+func savedSearchUnsubscribe(method, url string, view *unsubscribeView) (int, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return http.StatusBadGateway, errors.New("alerts can't be changed right now, please try again later")
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+		Data    struct {
+			Name       string `json:"name"`
+			Subscribed bool   `json:"subscribed"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return http.StatusBadGateway, err
+	}
+	if payload.Error {
+		return resp.StatusCode, errors.New(payload.Message)
+	}
+
+	view.Name, view.Subscribed = payload.Data.Name, payload.Data.Subscribed
+	return resp.StatusCode, nil
+}
+
+func renderUnsubscribePage(w http.ResponseWriter, status int, view unsubscribeView) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := unsubscribePage.Execute(w, view); err != nil {
+		log.Printf("Error rendering unsubscribe page: %v", err)
+	}
+}
+
+// ConversationsREST forwards the caller's messaging requests to
+// post-service, which only shows each user their own conversations
+func (app *Config) ConversationsREST(w http.ResponseWriter, r *http.Request) {
+	if !app.requireIdentity(w, r) {
+		return
+	}
+	app.forwardCallerRequest(w, r, "conversations")
+}
+
+// ViewingsREST forwards viewing slot and booking requests to post-service.
+// Anyone can see a listing's slots; everything else needs a signed-in caller.
+func (app *Config) ViewingsREST(w http.ResponseWriter, r *http.Request) {
+	public := r.Method == http.MethodGet && chi.URLParam(r, "id") != ""
+	if !public && !app.requireIdentity(w, r) {
+		return
+	}
+	app.forwardCallerRequest(w, r, "viewings")
+}
+
+// ApplicationsREST forwards rental application requests, documents
+// included, to post-service
+func (app *Config) ApplicationsREST(w http.ResponseWriter, r *http.Request) {
+	if !app.requireIdentity(w, r) {
+		return
+	}
+	app.forwardCallerRequest(w, r, "applications")
+}
+
+// ReviewsREST forwards review requests to post-service. Reading reviews is
+// public; writing, replying and reporting need a signed-in caller.
+func (app *Config) ReviewsREST(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !app.requireIdentity(w, r) {
+		return
+	}
+	app.forwardCallerRequest(w, r, "reviews")
+}
+
+// AvailabilityREST forwards availability calendar requests to post-service.
+// Reading a listing's availability is public.
+func (app *Config) AvailabilityREST(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !app.requireIdentity(w, r) {
+		return
+	}
+	app.forwardCallerRequest(w, r, "availability")
+}
+
+// NeighborhoodsREST forwards the public neighborhood boundaries and stats
+// to post-service
+func (app *Config) NeighborhoodsREST(w http.ResponseWriter, r *http.Request) {
+	app.forwardCallerRequest(w, r, "neighborhoods")
+}
+
+// MarketStatsREST forwards the public rental market statistics to
+// post-service
+func (app *Config) MarketStatsREST(w http.ResponseWriter, r *http.Request) {
+	app.forwardCallerRequest(w, r, "market stats")
+}
+
+// RoommatesREST forwards roommate finder requests to post-service
+func (app *Config) RoommatesREST(w http.ResponseWriter, r *http.Request) {
+	if !app.requireIdentity(w, r) {
+		return
+	}
+	app.forwardCallerRequest(w, r, "roommates")
+}
+
+// forwardCallerRequest passes the request's path, query and JSON body on to
+// post-service along with the caller's identity
+func (app *Config) forwardCallerRequest(w http.ResponseWriter, r *http.Request, label string) {
+	var body any
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		var raw json.RawMessage
+		if err := app.readJSON(w, r, &raw); err != nil && !errors.Is(err, io.EOF) {
+			app.errorJSON(w, err)
+			return
+		}
+		if len(raw) > 0 {
+			body = raw
+		}
+	}
+
+	url := "http://post-service" + r.URL.Path
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
+	log.Printf("RESTful: %s %s %s", label, r.Method, r.URL.Path)
+	app.forwardToPostService(w, r, r.Method, url, body)
+}
+
+// AdminAuthServiceREST 把 /admin/users 下的用户管理请求原样转发给 authentication-service，
+// 角色与权限由 authentication-service 的 RBAC 中间件校验
+func (app *Config) AdminAuthServiceREST(w http.ResponseWriter, r *http.Request) {
+	var body any
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		var raw json.RawMessage
+		if err := app.readJSON(w, r, &raw); err != nil && !errors.Is(err, io.EOF) {
+			app.errorJSON(w, err)
+			return
+		}
+		if len(raw) > 0 {
+			body = raw
+		}
+	}
+
+	url := "http://authentication-service" + r.URL.Path
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
+	log.Printf("RESTful: admin %s %s", r.Method, r.URL.Path)
+	app.forwardToAuthService(w, r, r.Method, url, body)
 }
 
-func (app *Config) forwardToPostService(w http.ResponseWriter, method, url string, body any) {
+// forwardedRequestHeaders are copied from the client request to post-service
+var forwardedRequestHeaders = []string{"If-Match", "If-None-Match"}
+
+// forwardedResponseHeaders are copied from post-service back to the client
+var forwardedResponseHeaders = []string{"ETag"}
+
+// maxLoggedBody is the largest forwarded body written to the log
+const maxLoggedBody = 4096
+
+func (app *Config) forwardToPostService(w http.ResponseWriter, r *http.Request, method, url string, body any) {
 	var reader *bytes.Reader
 	if body != nil {
 		jsonData, err := json.MarshalIndent(body, "", "\t")
@@ -392,7 +829,12 @@ func (app *Config) forwardToPostService(w http.ResponseWriter, method, url strin
 			app.errorJSON(w, err)
 			return
 		}
-		log.Printf("Forwarding request to %s, body: %s", url, string(jsonData))
+		// Application documents are sent base64 encoded; don't log them
+		if len(jsonData) > maxLoggedBody {
+			log.Printf("Forwarding request to %s, body: %d bytes", url, len(jsonData))
+		} else {
+			log.Printf("Forwarding request to %s, body: %s", url, string(jsonData))
+		}
 		reader = bytes.NewReader(jsonData)
 	} else {
 		reader = bytes.NewReader(nil)
@@ -408,6 +850,25 @@ func (app *Config) forwardToPostService(w http.ResponseWriter, method, url strin
 		req.Header.Set("Content-Type", "application/json")
 	}
 
+	if r != nil {
+		for _, h := range forwardedRequestHeaders {
+			if v := r.Header.Get(h); v != "" {
+				req.Header.Set(h, v)
+			}
+		}
+
+		// Anonymous callers are fine here; post-service decides what needs a user
+		if id, err := app.identify(r); err == nil {
+			for k, v := range identityHeaders(id) {
+				req.Header[k] = v
+			}
+		}
+
+		if c, err := r.Cookie(visitorCookie); err == nil {
+			req.Header.Set("X-Session-ID", c.Value)
+		}
+	}
+
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -416,6 +877,17 @@ func (app *Config) forwardToPostService(w http.ResponseWriter, method, url strin
 	}
 	defer resp.Body.Close()
 
+	for _, h := range forwardedResponseHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	var payload jsonResponse
 	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
 		app.errorJSON(w, err)
@@ -428,7 +900,8 @@ func (app *Config) forwardToPostService(w http.ResponseWriter, method, url strin
 		if statusCode == 0 {
 			statusCode = http.StatusInternalServerError
 		}
-		app.errorJSON(w, errors.New(payload.Message), statusCode)
+		// Pass the payload through untouched: a 412 carries the current post
+		app.writeJSON(w, statusCode, payload)
 		return
 	}
 
@@ -568,6 +1041,19 @@ func (app *Config) GetUserFavoriteIDsREST(w http.ResponseWriter, r *http.Request
 	app.forwardToFavoriteService(w, "GET", url, nil)
 }
 
+func (app *Config) GetUserFavoritesREST(w http.ResponseWriter, r *http.Request) {
+	if !app.requireSelf(w, r) {
+		return
+	}
+	userId := chi.URLParam(r, "userId")
+	log.Printf("RESTful: GET favorite listings for user: %s", userId)
+	url := "http://favourite-service/favorites/" + userId
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
+	app.forwardToFavoriteService(w, "GET", url, nil)
+}
+
 func (app *Config) AddFavoriteREST(w http.ResponseWriter, r *http.Request) {
 	log.Println("RESTful: POST /favorites")
 	var payload struct {
@@ -602,6 +1088,51 @@ func (app *Config) SyncFavoritesREST(w http.ResponseWriter, r *http.Request) {
 	app.forwardToFavoriteService(w, "POST", "http://favourite-service/favorites/sync", payload)
 }
 
+// OwnFavoritesREST forwards requests on the caller's own favorites
+// (collections and sync) to favourite-service unchanged
+func (app *Config) OwnFavoritesREST(w http.ResponseWriter, r *http.Request) {
+	if !app.requireSelf(w, r) {
+		return
+	}
+
+	var body any
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		var raw json.RawMessage
+		if err := app.readJSON(w, r, &raw); err != nil && !errors.Is(err, io.EOF) {
+			app.errorJSON(w, err)
+			return
+		}
+		if len(raw) > 0 {
+			body = raw
+		}
+	}
+
+	url := "http://favourite-service" + r.URL.Path
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
+	log.Printf("RESTful: favorites %s %s", r.Method, r.URL.Path)
+	app.forwardToFavoriteService(w, r.Method, url, body)
+}
+
+// TrendingFavoritesREST serves the most favorited listings to anyone
+func (app *Config) TrendingFavoritesREST(w http.ResponseWriter, r *http.Request) {
+	url := "http://favourite-service/favorites/trending"
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
+	app.forwardToFavoriteService(w, "GET", url, nil)
+}
+
+// SharedCollectionREST serves a shared collection to anyone with its link
+func (app *Config) SharedCollectionREST(w http.ResponseWriter, r *http.Request) {
+	url := "http://favourite-service/shared/collections/" + chi.URLParam(r, "token")
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
+	app.forwardToFavoriteService(w, "GET", url, nil)
+}
+
 func (app *Config) forwardToFavoriteService(w http.ResponseWriter, method, url string, body any) {
 	var reader *bytes.Reader
 	if body != nil {
@@ -652,3 +1183,104 @@ func (app *Config) forwardToFavoriteService(w http.ResponseWriter, method, url s
 
 	app.writeJSON(w, resp.StatusCode, payload)
 }
+
+// postService is where AvailabilityFeedREST and ListingTransferREST send
+// requests
+var postService = &url.URL{Scheme: "http", Host: "post-service"}
+
+// AvailabilityFeedREST proxies a listing's iCal feed from post-service. The
+// feed is text/calendar rather than JSON, and calendar apps fetch it without
+// signing in; the token in the URL is what grants access.
+func (app *Config) AvailabilityFeedREST(w http.ResponseWriter, r *http.Request) {
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = postService.Scheme
+			req.URL.Host = postService.Host
+			req.Host = postService.Host
+
+			for _, h := range []string{"Cookie", "Authorization", "Origin", "X-User-ID", "X-User-Role"} {
+				req.Header.Del(h)
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Error proxying %s to post service: %v", r.URL.Path, err)
+			app.errorJSON(w, errors.New("post service unavailable"), http.StatusBadGateway)
+		},
+	}
+
+	log.Println("RESTful: GET calendar feed")
+	proxy.ServeHTTP(w, r)
+}
+
+// ListingTransferREST proxies bulk listing imports and exports to
+// post-service as the caller. Both are CSV or JSON Lines rather than JSON,
+// and uploads can be large, so the body is streamed through as it is.
+func (app *Config) ListingTransferREST(w http.ResponseWriter, r *http.Request) {
+	id, err := app.identify(r)
+	if err != nil {
+		app.errorJSON(w, err, identityStatus(err))
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = postService.Scheme
+			req.URL.Host = postService.Host
+			req.Host = postService.Host
+
+			for _, h := range []string{"Cookie", "Authorization", "Origin", "X-User-ID", "X-User-Role"} {
+				req.Header.Del(h)
+			}
+			for k, v := range identityHeaders(id) {
+				req.Header[k] = v
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Error proxying %s to post service: %v", r.URL.Path, err)
+			app.errorJSON(w, errors.New("post service unavailable"), http.StatusBadGateway)
+		},
+	}
+
+	log.Printf("RESTful: %s %s", r.Method, r.URL.Path)
+	proxy.ServeHTTP(w, r)
+}
+
+// notificationService is where NotificationsREST sends requests
+var notificationService = &url.URL{Scheme: "http", Host: "notification-service"}
+
+// NotificationsREST proxies the caller's notification requests to
+// notification-service. A reverse proxy is used instead of the JSON
+// forwarders because /notifications/stream is a long-lived event stream
+// that has to be flushed to the client as it is written.
+func (app *Config) NotificationsREST(w http.ResponseWriter, r *http.Request) {
+	id, err := app.identify(r)
+	if err != nil {
+		app.errorJSON(w, err, identityStatus(err))
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = notificationService.Scheme
+			req.URL.Host = notificationService.Host
+			req.Host = notificationService.Host
+
+			// Only the broker vouches for the caller, and the broker already
+			// answers CORS itself
+			for _, h := range []string{"Cookie", "Authorization", "Origin", "X-User-ID", "X-User-Role"} {
+				req.Header.Del(h)
+			}
+			for k, v := range identityHeaders(id) {
+				req.Header[k] = v
+			}
+		},
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Error proxying %s to notification service: %v", r.URL.Path, err)
+			app.errorJSON(w, errors.New("notification service unavailable"), http.StatusBadGateway)
+		},
+	}
+
+	log.Printf("RESTful: notifications %s %s", r.Method, r.URL.Path)
+	proxy.ServeHTTP(w, r)
+}
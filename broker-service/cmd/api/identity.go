@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// identity is the caller resolved from a valid access token
+type identity struct {
+	UserID int
+	Role   string
+}
+
+// accessClaims are the claims authentication-service puts in access tokens
+type accessClaims struct {
+	Role string `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// identify validates the caller's access token and returns who they are.
+// The token is read from the access_token cookie set by authentication-service,
+// or from an "Authorization: Bearer" header for non-browser clients. Tokens
+// issued before an admin logged the user out, deactivated them or changed
+// their role are refused.
+func (app *Config) identify(r *http.Request) (*identity, error) {
+	if len(app.AccessSecret) == 0 {
+		return nil, errors.New("access token validation is not configured")
+	}
+
+	raw := ""
+	if c, err := r.Cookie("access_token"); err == nil {
+		raw = c.Value
+	}
+	if h := r.Header.Get("Authorization"); raw == "" && strings.HasPrefix(h, "Bearer ") {
+		raw = strings.TrimPrefix(h, "Bearer ")
+	}
+	if raw == "" {
+		return nil, errors.New("authentication required")
+	}
+
+	claims := &accessClaims{}
+	token, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return app.AccessSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid access token")
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, errors.New("invalid subject in token")
+	}
+
+	revoked, err := app.revoked(userID, claims.IssuedAt)
+	if err != nil {
+		log.Printf("Error checking token revocation of user %d: %v", userID, err)
+		return nil, errRevocationUnavailable
+	}
+	if revoked {
+		return nil, errors.New("access token revoked")
+	}
+
+	return &identity{UserID: userID, Role: claims.Role}, nil
+}
+
+// errRevocationUnavailable is returned by identify when Redis can't be asked
+// whether the token was revoked. The token is refused rather than trusted.
+var errRevocationUnavailable = errors.New("unable to verify the session right now")
+
+// revoked reports whether a token was issued before the cutoff that
+// authentication-service stores in Redis when it revokes a user's tokens.
+// Tokens without an issue time count as revoked once there is a cutoff.
+// Without Redis nothing is revoked; a failed lookup is an error.
+func (app *Config) revoked(userID int, issuedAt *jwt.NumericDate) (bool, error) {
+	if app.Redis == nil {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	value, err := app.Redis.Get(ctx, "revoked_before:"+strconv.Itoa(userID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	cutoff, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	return issuedAt == nil || issuedAt.Unix() < cutoff, nil
+}
+
+// identityStatus is the status to answer when identify fails: 503 when the
+// revocation lookup failed, 401 otherwise
+func identityStatus(err error) int {
+	if errors.Is(err, errRevocationUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusUnauthorized
+}
+
+// identityHeaders turns a resolved caller into the headers downstream services
+// trust. Internal services are not exposed, so only the broker can set them.
+func identityHeaders(id *identity) http.Header {
+	h := http.Header{}
+	if id != nil {
+		h.Set("X-User-ID", strconv.Itoa(id.UserID))
+		if id.Role != "" {
+			h.Set("X-User-Role", id.Role)
+		}
+	}
+	return h
+}
+
+// requireIdentity resolves the caller and answers 401 when there is none,
+// or 503 when their token's revocation can't be checked
+func (app *Config) requireIdentity(w http.ResponseWriter, r *http.Request) bool {
+	if _, err := app.identify(r); err != nil {
+		app.errorJSON(w, err, identityStatus(err))
+		return false
+	}
+	return true
+}
+
+// requireSelf resolves the caller and answers 403 unless they are the user
+// named by the {userId} path parameter
+func (app *Config) requireSelf(w http.ResponseWriter, r *http.Request) bool {
+	id, err := app.identify(r)
+	if err != nil {
+		app.errorJSON(w, err, identityStatus(err))
+		return false
+	}
+	if strconv.Itoa(id.UserID) != chi.URLParam(r, "userId") {
+		app.errorJSON(w, errors.New("you can only manage your own favorites"), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// visitorCookie gives anonymous visitors a stable ID so listing views can be
+// deduplicated per visitor per day
+const visitorCookie = "visitor_id"
+
+// ensureVisitorSession issues a visitor cookie when the caller has none and
+// attaches it to r so it is forwarded with this same request
+func ensureVisitorSession(w http.ResponseWriter, r *http.Request) {
+	if _, err := r.Cookie(visitorCookie); err == nil {
+		return
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return
+	}
+
+	c := &http.Cookie{
+		Name:     visitorCookie,
+		Value:    hex.EncodeToString(buf),
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, c)
+	r.AddCookie(c)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRequireIdentity(t *testing.T) {
+	secret := []byte("test-secret")
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims{
+		Role: "user",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "3",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing listens on port 1, so every lookup fails straight away
+	unreachable := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer unreachable.Close()
+
+	tests := []struct {
+		name   string
+		redis  *redis.Client
+		bearer string
+		want   int
+	}{
+		{name: "valid token without Redis configured", bearer: token, want: http.StatusOK},
+		{name: "revocation lookup fails", redis: unreachable, bearer: token, want: http.StatusServiceUnavailable},
+		{name: "no token", redis: unreachable, want: http.StatusUnauthorized},
+		{name: "forged token", bearer: token + "x", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &Config{AccessSecret: secret, Redis: tt.redis}
+
+			r := httptest.NewRequest(http.MethodGet, "/posts/7/history", nil)
+			if tt.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			w := httptest.NewRecorder()
+
+			if app.requireIdentity(w, r) {
+				w.WriteHeader(http.StatusOK)
+			}
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
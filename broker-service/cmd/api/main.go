@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt" // 用来做字符串格式化（例如 fmt.Sprintf）
 	"log" // 用来打印日志（比 fmt.Println 更适合服务端程序）
 	"math"
 	"net/http" // Go 标准库中的 HTTP 服务器实现
 	"os"
+	"strings"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go" // RabbitMQ 官方 Go 客户端
+	"github.com/redis/go-redis/v9"
 )
 
 // webPort 定义服务监听的端口号
@@ -22,6 +25,15 @@ const webPort = "80"
 // - 依赖对象
 type Config struct {
 	Rabbit *amqp.Connection
+
+	// AccessSecret 用来校验 authentication-service 签发的 access token
+	AccessSecret []byte
+
+	// Redis 用来查询 authentication-service 记录的 token 作废时间点（强制下线）
+	Redis *redis.Client
+
+	// PublicURL 是外部访问 broker 的地址，用于生成 feed 里的绝对链接
+	PublicURL string
 }
 
 // main 是 Go 程序的入口函数
@@ -39,7 +51,10 @@ func main() {
 	// 创建一个 Config 实例
 	// app 会作为整个应用的“上下文”
 	app := Config{
-		Rabbit: rabbitConn,
+		Rabbit:       rabbitConn,
+		AccessSecret: []byte(os.Getenv("ACCESS_SECRET")),
+		Redis:        connectToRedis(),
+		PublicURL:    publicURL(),
 	}
 
 	// 打印一条启动日志
@@ -71,6 +86,38 @@ func main() {
 	}
 }
 
+// connectToRedis 连接 REDIS_ADDR 上的 redis。启动时连不上也返回 client，它会自动重连；
+// 在此之前无法确认 token 是否已作废，需要登录的请求会返回 503
+func connectToRedis() *redis.Client {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "redis:6379"
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		log.Printf("Redis not available yet, signed-in requests are refused until it is: %v", err)
+		return rdb
+	}
+
+	log.Println("Connected to Redis!")
+	return rdb
+}
+
+// publicURL 读取 PUBLIC_URL，默认是本机的 broker 地址
+func publicURL() string {
+	if u := strings.TrimRight(os.Getenv("PUBLIC_URL"), "/"); u != "" {
+		return u
+	}
+	return "http://localhost:8080"
+}
+
 func connect() (*amqp.Connection, error) {
 	var counts int64              // 记录尝试次数
 	var backOff = 1 * time.Second // 初始退避时间
@@ -42,7 +42,8 @@ func (app *Config) routes() http.Handler {
 		// PUT    : 更新数据
 		// DELETE : 删除数据
 		// OPTIONS: 浏览器在跨域时自动发送的“预检请求”
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		// PATCH  : 局部更新（JSON Merge Patch）
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 
 		// 允许前端在请求中携带哪些 HTTP 头
 		AllowedHeaders: []string{
@@ -50,11 +51,14 @@ func (app *Config) routes() http.Handler {
 			"Authorization", // 用来携带认证信息（如 JWT Token）
 			"Content-Type",  // 告诉服务器：请求体的数据格式
 			"X-CSRF-TOKEN",  // 防止 CSRF 攻击的安全令牌
+			"If-Match",      // 乐观并发控制：写操作携带的 ETag
+			"If-None-Match", // 条件 GET：未变化时返回 304
+			"Last-Event-ID", // SSE 断线重连时携带最后收到的事件 ID
 		},
 
 		// 允许前端“读取”的响应头
 		// 默认情况下浏览器只能读到少量响应头
-		ExposedHeaders: []string{"Link"},
+		ExposedHeaders: []string{"Link", "ETag", "Content-Disposition"},
 
 		// 是否允许携带 Cookie / Authorization 等凭证
 		// 如果你使用 session 或需要登录状态，这个通常要 true
@@ -84,9 +88,100 @@ func (app *Config) routes() http.Handler {
 	// RESTful API routes for posts
 	mux.Get("/posts", app.GetAllPostsREST)
 	mux.Get("/posts/{id}", app.GetPostByIDREST)
+	mux.Post("/posts/import", app.ListingTransferREST)
+	mux.Get("/posts/export", app.ListingTransferREST)
 	mux.Post("/posts", app.CreatePostREST)
 	mux.Put("/posts/{id}", app.UpdatePostREST)
+	mux.Patch("/posts/{id}", app.PatchPostREST)
 	mux.Delete("/posts/{id}", app.DeletePostREST)
+	mux.Put("/posts/{id}/status", app.SetPostStatusREST)
+	mux.Get("/posts/{id}/history", app.GetPostHistoryREST)
+	mux.Post("/posts/{id}/history/{revisionId}/restore", app.RestorePostRevisionREST)
+	mux.Get("/posts/{id}/price-history", app.GetPostPriceHistoryREST)
+	mux.Post("/posts/{id}/contact-click", app.RecordContactClickREST)
+	mux.Get("/posts/author/{authorId}", app.GetPostsByAuthorREST)
+	mux.Get("/posts/author/{authorId}/analytics", app.GetAuthorAnalyticsREST)
+	mux.Get("/posts/{id}/matches", app.GetPostMatchesREST)
+	mux.Get("/admin/screenings", app.GetPendingScreeningsREST)
+	mux.Post("/admin/screenings/{postId}/{decision:approve|reject}", app.ReviewScreeningREST)
+	mux.Post("/posts/{id}/reports", app.ReportPostREST)
+	mux.Get("/admin/reports", app.AdminPostServiceREST)
+	mux.Post("/admin/reports/{reportId}/actions", app.AdminPostServiceREST)
+	mux.Post("/admin/posts/{id}/actions", app.AdminPostServiceREST)
+	mux.Get("/admin/moderation/decisions", app.AdminPostServiceREST)
+
+	mux.Get("/saved-searches", app.SavedSearchesREST)
+	mux.Post("/saved-searches", app.SavedSearchesREST)
+	mux.Put("/saved-searches/{id}", app.SavedSearchesREST)
+	mux.Delete("/saved-searches/{id}", app.SavedSearchesREST)
+	mux.Get("/saved-searches/unsubscribe/{token}", app.ConfirmUnsubscribeSavedSearchREST)
+	mux.Post("/saved-searches/unsubscribe/{token}", app.UnsubscribeSavedSearchREST)
+
+	mux.Post("/posts/{id}/conversations", app.ConversationsREST)
+	mux.Get("/conversations", app.ConversationsREST)
+	mux.Get("/conversations/unread-count", app.ConversationsREST)
+	mux.Get("/conversations/{id}", app.ConversationsREST)
+	mux.Post("/conversations/{id}/messages", app.ConversationsREST)
+	mux.Post("/conversations/{id}/read", app.ConversationsREST)
+	mux.Post("/conversations/{id}/block", app.ConversationsREST)
+	mux.Delete("/conversations/{id}/block", app.ConversationsREST)
+	mux.Post("/conversations/{id}/reports", app.ConversationsREST)
+	mux.Get("/admin/user-reports", app.AdminPostServiceREST)
+	mux.Post("/admin/user-reports/{reportId}/actions", app.AdminPostServiceREST)
+
+	mux.Get("/posts/{id}/viewing-slots", app.ViewingsREST)
+	mux.Post("/posts/{id}/viewing-slots", app.ViewingsREST)
+	mux.Delete("/posts/{id}/viewing-slots/{slotId}", app.ViewingsREST)
+	mux.Post("/viewing-slots/{slotId}/bookings", app.ViewingsREST)
+	mux.Get("/viewings", app.ViewingsREST)
+	mux.Post("/viewings/{id}/cancel", app.ViewingsREST)
+	mux.Post("/viewings/{id}/reschedule", app.ViewingsREST)
+
+	mux.Post("/posts/{id}/applications", app.ApplicationsREST)
+	mux.Get("/posts/{id}/applications", app.ApplicationsREST)
+	mux.Get("/applications", app.ApplicationsREST)
+	mux.Get("/applications/{id}", app.ApplicationsREST)
+	mux.Get("/applications/{id}/documents/{documentId}", app.ApplicationsREST)
+	mux.Post("/applications/{id}/status", app.ApplicationsREST)
+
+	mux.Post("/posts/{id}/reviews", app.ReviewsREST)
+	mux.Get("/posts/{id}/reviews", app.ReviewsREST)
+	mux.Get("/users/{userId}/reviews", app.ReviewsREST)
+	mux.Post("/reviews/{id}/reply", app.ReviewsREST)
+	mux.Post("/reviews/{id}/reports", app.ReviewsREST)
+	mux.Get("/admin/review-reports", app.AdminPostServiceREST)
+	mux.Post("/admin/review-reports/{reportId}/actions", app.AdminPostServiceREST)
+
+	mux.Get("/posts/{id}/availability", app.AvailabilityREST)
+	mux.Put("/posts/{id}/availability", app.AvailabilityREST)
+	mux.Post("/posts/{id}/availability/blocks", app.AvailabilityREST)
+	mux.Delete("/posts/{id}/availability/blocks/{blockId}", app.AvailabilityREST)
+	mux.Post("/posts/{id}/availability/feed", app.AvailabilityREST)
+	mux.Delete("/posts/{id}/availability/feed", app.AvailabilityREST)
+	mux.Get("/calendars/{feed}", app.AvailabilityFeedREST)
+
+	mux.Get("/neighborhoods", app.NeighborhoodsREST)
+	mux.Get("/market/stats", app.MarketStatsREST)
+	mux.Get("/market/stats/series", app.MarketStatsREST)
+
+	// 最新房源的 RSS / Atom / JSON Feed，供订阅阅读器使用
+	mux.Get("/feeds/listings.rss", app.ListingFeedREST)
+	mux.Get("/feeds/listings.atom", app.ListingFeedREST)
+	mux.Get("/feeds/listings.json", app.ListingFeedREST)
+	mux.Get("/feeds/listings/{id}/image", app.ListingImageREST)
+
+	mux.Get("/roommates/profile", app.RoommatesREST)
+	mux.Put("/roommates/profile", app.RoommatesREST)
+	mux.Delete("/roommates/profile", app.RoommatesREST)
+	mux.Get("/roommates/matches", app.RoommatesREST)
+	mux.Get("/roommates/{userId}", app.RoommatesREST)
+	mux.Post("/roommates/{userId}/conversations", app.RoommatesREST)
+
+	// 用户与角色管理（权限由 authentication-service 校验）
+	mux.Get("/admin/users", app.AdminAuthServiceREST)
+	mux.Get("/admin/users/{id}", app.AdminAuthServiceREST)
+	mux.Put("/admin/users/{id}/role", app.AdminAuthServiceREST)
+	mux.Post("/admin/users/{id}/{action:deactivate|reactivate|logout}", app.AdminAuthServiceREST)
 
 	// RESTful API routes for auth
 	mux.Route("/auth", func(r chi.Router) {
@@ -100,10 +195,37 @@ func (app *Config) routes() http.Handler {
 	})
 
 	// RESTful API routes for favorites
+	mux.Get("/favorites/trending", app.TrendingFavoritesREST)
+	mux.Get("/favorites/{userId}", app.GetUserFavoritesREST)
 	mux.Get("/favorites/{userId}/ids", app.GetUserFavoriteIDsREST)
 	mux.Post("/favorites", app.AddFavoriteREST)
 	mux.Delete("/favorites/{userId}/{postId}", app.RemoveFavoriteREST)
 	mux.Post("/favorites/sync", app.SyncFavoritesREST)
+	mux.Post("/favorites/{userId}/sync", app.OwnFavoritesREST)
+
+	// Favorite collections (owner and roommate members) and their public share links
+	mux.Route("/favorites/{userId}/collections", func(r chi.Router) {
+		r.Get("/", app.OwnFavoritesREST)
+		r.Post("/", app.OwnFavoritesREST)
+		r.Get("/{collectionId}", app.OwnFavoritesREST)
+		r.Put("/{collectionId}", app.OwnFavoritesREST)
+		r.Delete("/{collectionId}", app.OwnFavoritesREST)
+		r.Put("/{collectionId}/items/{postId}", app.OwnFavoritesREST)
+		r.Delete("/{collectionId}/items/{postId}", app.OwnFavoritesREST)
+		r.Put("/{collectionId}/order", app.OwnFavoritesREST)
+		r.Post("/{collectionId}/share", app.OwnFavoritesREST)
+		r.Delete("/{collectionId}/share", app.OwnFavoritesREST)
+		r.Post("/{collectionId}/members", app.OwnFavoritesREST)
+		r.Delete("/{collectionId}/members/{memberId}", app.OwnFavoritesREST)
+	})
+	mux.Get("/shared/collections/{token}", app.SharedCollectionREST)
+
+	// In-app notifications of the caller, including the SSE stream
+	mux.Get("/notifications", app.NotificationsREST)
+	mux.Get("/notifications/unread-count", app.NotificationsREST)
+	mux.Get("/notifications/stream", app.NotificationsREST)
+	mux.Post("/notifications/read-all", app.NotificationsREST)
+	mux.Post("/notifications/{id}/read", app.NotificationsREST)
 
 	// 返回配置完成的路由器
 	// mux 实现了 http.Handler 接口
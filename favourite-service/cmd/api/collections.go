@@ -0,0 +1,610 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"favourite-service/data"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgconn"
+)
+
+const (
+	maxCollectionName = 100
+	maxItemNote       = 2000
+	maxItemTags       = 20
+)
+
+// collectionItemCard is an item of a collection with its listing card
+type collectionItemCard struct {
+	*data.CollectionItem
+	Availability string         `json:"availability"`
+	Post         map[string]any `json:"post"` // null once the listing is removed
+}
+
+// sharedCollection is what a share link reveals about a collection
+type sharedCollection struct {
+	Name      string    `json:"name"`
+	ItemCount int       `json:"itemCount"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// GetCollections lists a user's collections, the default one first
+func (app *Config) GetCollections(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid user ID"), http.StatusBadRequest)
+		return
+	}
+
+	collections, err := app.Models.Collection.GetAllByUser(userID)
+	if err != nil {
+		log.Printf("Error getting collections of user %d: %v", userID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  collections,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// CreateCollection adds a named collection
+func (app *Config) CreateCollection(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid user ID"), http.StatusBadRequest)
+		return
+	}
+
+	name, ok := app.readCollectionName(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := app.Models.Collection.Insert(userID, name)
+	if err != nil {
+		log.Printf("Error creating collection for user %d: %v", userID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	collection, err := app.Models.Collection.GetOne(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Collection created",
+		Data:    collection,
+	}
+
+	app.writeJSON(w, http.StatusCreated, payload)
+}
+
+// GetCollection returns one of the user's collections, or one they are a
+// member of, with its members and its items as listing cards. ?tag= keeps
+// only items with that tag.
+func (app *Config) GetCollection(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.editableCollection(w, r)
+	if !ok {
+		return
+	}
+
+	items, ok := app.collectionItems(w, collection.ID, r.URL.Query().Get("tag"))
+	if !ok {
+		return
+	}
+
+	members, err := app.Models.Collection.GetMembers(collection.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data: map[string]any{
+			"collection": collection,
+			"members":    members,
+			"items":      items,
+		},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// RenameCollection changes a collection's name
+func (app *Config) RenameCollection(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	name, ok := app.readCollectionName(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.Models.Collection.Rename(collection.ID, name); err != nil {
+		log.Printf("Error renaming collection %d: %v", collection.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	collection.Name = name
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Collection renamed",
+		Data:    collection,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// DeleteCollection removes a collection and its items; the default
+// collection can't be deleted
+func (app *Config) DeleteCollection(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.Models.Collection.Delete(collection.ID)
+	if errors.Is(err, data.ErrDefaultCollection) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting collection %d: %v", collection.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Collection deleted",
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// SaveCollectionItem adds a post to a collection or updates its note and
+// tags. Fields left out of the body are not changed.
+func (app *Config) SaveCollectionItem(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.editableCollection(w, r)
+	if !ok {
+		return
+	}
+
+	postID, err := strconv.Atoi(chi.URLParam(r, "postId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	var requestPayload struct {
+		Note *string  `json:"note"`
+		Tags []string `json:"tags"`
+	}
+
+	if r.ContentLength != 0 {
+		if err := app.readJSON(w, r, &requestPayload); err != nil {
+			app.errorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if requestPayload.Note != nil && len(*requestPayload.Note) > maxItemNote {
+		app.errorJSON(w, errors.New("note is too long"), http.StatusBadRequest)
+		return
+	}
+
+	tags, err := normalizeTags(requestPayload.Tags)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	err = app.Models.Collection.SaveItem(collection.ID, postID, requestPayload.Note, tags)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving post %d in collection %d: %v", postID, collection.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Saved to collection",
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// RemoveCollectionItem takes a post out of a collection
+func (app *Config) RemoveCollectionItem(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.editableCollection(w, r)
+	if !ok {
+		return
+	}
+
+	postID, err := strconv.Atoi(chi.URLParam(r, "postId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Models.Collection.RemoveItem(collection.ID, postID); err != nil {
+		log.Printf("Error removing post %d from collection %d: %v", postID, collection.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Removed from collection",
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// ReorderCollection sets the manual order of a collection from a full list
+// of its post IDs
+func (app *Config) ReorderCollection(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.editableCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var requestPayload struct {
+		PostIDs []int `json:"postIds"`
+	}
+
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	err := app.Models.Collection.Reorder(collection.ID, requestPayload.PostIDs)
+	if errors.Is(err, data.ErrOrderMismatch) {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reordering collection %d: %v", collection.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Collection reordered",
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// ShareCollection creates a read-only share link for a collection. Calling
+// it again replaces the token, which revokes the old link.
+func (app *Config) ShareCollection(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	if err := app.Models.Collection.SetShareToken(collection.ID, &token); err != nil {
+		log.Printf("Error sharing collection %d: %v", collection.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Collection shared",
+		Data: map[string]string{
+			"shareToken": token,
+			"path":       "/shared/collections/" + token,
+		},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// UnshareCollection revokes a collection's share link
+func (app *Config) UnshareCollection(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.Models.Collection.SetShareToken(collection.ID, nil); err != nil {
+		log.Printf("Error unsharing collection %d: %v", collection.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Share link revoked",
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// AddCollectionMember lets a roommate the owner has talked to in the
+// roommate finder edit a collection
+func (app *Config) AddCollectionMember(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var requestPayload struct {
+		UserID int `json:"userId"`
+	}
+
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if collection.IsDefault {
+		app.errorJSON(w, errors.New("the default collection can't be shared with roommates"), http.StatusConflict)
+		return
+	}
+	if requestPayload.UserID <= 0 || requestPayload.UserID == collection.UserID {
+		app.errorJSON(w, errors.New("invalid user ID"), http.StatusBadRequest)
+		return
+	}
+
+	err := app.Models.Collection.AddMember(collection.ID, collection.UserID, requestPayload.UserID)
+	if errors.Is(err, data.ErrNotRoommates) {
+		app.errorJSON(w, err, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("Error adding user %d to collection %d: %v", requestPayload.UserID, collection.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	members, err := app.Models.Collection.GetMembers(collection.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Member added",
+		Data:    members,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// RemoveCollectionMember takes a member out of a collection. The owner can
+// remove anyone and members can remove themselves.
+func (app *Config) RemoveCollectionMember(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.editableCollection(w, r)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.Atoi(chi.URLParam(r, "memberId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid member ID"), http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := strconv.Atoi(chi.URLParam(r, "userId"))
+	if userID != collection.UserID && userID != memberID {
+		app.errorJSON(w, errors.New("only the owner can remove other members"), http.StatusForbidden)
+		return
+	}
+
+	err = app.Models.Collection.RemoveMember(collection.ID, memberID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("member not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error removing user %d from collection %d: %v", memberID, collection.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Member removed",
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetSharedCollection shows a shared collection to anyone holding its token
+func (app *Config) GetSharedCollection(w http.ResponseWriter, r *http.Request) {
+	collection, err := app.Models.Collection.GetByShareToken(chi.URLParam(r, "token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("collection not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	items, ok := app.collectionItems(w, collection.ID, r.URL.Query().Get("tag"))
+	if !ok {
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data: map[string]any{
+			"collection": sharedCollection{
+				Name:      collection.Name,
+				ItemCount: collection.ItemCount,
+				UpdatedAt: collection.UpdatedAt,
+			},
+			"items": items,
+		},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// ownedCollection loads {collectionId} and checks it belongs to {userId}.
+// It writes the error response itself when ok is false.
+func (app *Config) ownedCollection(w http.ResponseWriter, r *http.Request) (*data.Collection, bool) {
+	return app.loadCollection(w, r, false)
+}
+
+// editableCollection is ownedCollection that also lets in the collection's
+// members, for viewing it and changing its items
+func (app *Config) editableCollection(w http.ResponseWriter, r *http.Request) (*data.Collection, bool) {
+	return app.loadCollection(w, r, true)
+}
+
+func (app *Config) loadCollection(w http.ResponseWriter, r *http.Request, members bool) (*data.Collection, bool) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid user ID"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	collectionID, err := strconv.Atoi(chi.URLParam(r, "collectionId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid collection ID"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	collection, err := app.Models.Collection.GetOne(collectionID)
+	if err == nil && collection.UserID != userID {
+		member := false
+		if members {
+			member, err = app.Models.Collection.IsMember(collectionID, userID)
+		}
+		if err == nil && !member {
+			err = sql.ErrNoRows
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("collection not found"), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return collection, true
+}
+
+// collectionItems loads a collection's items with their listing cards
+func (app *Config) collectionItems(w http.ResponseWriter, collectionID int, tag string) ([]collectionItemCard, bool) {
+	items, err := app.Models.Collection.GetItems(collectionID, tag)
+	if err != nil {
+		log.Printf("Error getting items of collection %d: %v", collectionID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		if item.PostStatus == "published" || item.PostStatus == "pending" || item.PostStatus == "rented" {
+			ids = append(ids, item.PostID)
+		}
+	}
+
+	cards, err := fetchPostCards(ids)
+	if err != nil {
+		log.Printf("Error fetching cards for collection %d: %v", collectionID, err)
+	}
+
+	response := make([]collectionItemCard, 0, len(items))
+	for _, item := range items {
+		card := collectionItemCard{
+			CollectionItem: item,
+			Availability:   availabilityOf(item.PostStatus),
+			Post:           cards[item.PostID],
+		}
+		if card.Post == nil && card.Availability != availabilityRemoved && err == nil {
+			card.Availability = availabilityRemoved
+		}
+		response = append(response, card)
+	}
+
+	return response, true
+}
+
+// readCollectionName reads {"name": ...} and validates it
+func (app *Config) readCollectionName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var requestPayload struct {
+		Name string `json:"name"`
+	}
+
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return "", false
+	}
+
+	name := strings.TrimSpace(requestPayload.Name)
+	if name == "" || len(name) > maxCollectionName {
+		app.errorJSON(w, errors.New("name must be 1 to 100 characters"), http.StatusBadRequest)
+		return "", false
+	}
+
+	return name, true
+}
+
+// normalizeTags trims, lowercases and deduplicates tags. A nil slice stays
+// nil so the stored tags are left alone.
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	if len(tags) > maxItemTags {
+		return nil, errors.New("too many tags")
+	}
+
+	seen := map[string]bool{}
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > 50 {
+			return nil, errors.New("tags must be at most 50 characters")
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+
+	return out, nil
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"errors"
+	"favourite-service/data"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -61,6 +64,10 @@ func (app *Config) AddFavorite(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Adding favorite - User: %d, Post: %d", requestPayload.UserID, requestPayload.PostID)
 
 	err = app.Models.Favorite.Insert(requestPayload.UserID, requestPayload.PostID)
+	if errors.Is(err, data.ErrPostNotFound) {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Printf("Error adding favorite: %v", err)
 		app.errorJSON(w, err, http.StatusInternalServerError)
@@ -108,7 +115,9 @@ func (app *Config) RemoveFavorite(w http.ResponseWriter, r *http.Request) {
 	app.writeJSON(w, http.StatusOK, payload)
 }
 
-// SyncFavorites syncs localStorage favorites to database
+// SyncFavorites syncs localStorage favorites to database. Every post ID is
+// added with the server's clock; unknown posts are skipped. Clients that
+// also remove favorites offline use SyncUserFavorites instead.
 func (app *Config) SyncFavorites(w http.ResponseWriter, r *http.Request) {
 	var requestPayload struct {
 		UserID  int   `json:"userId"`
@@ -121,9 +130,19 @@ func (app *Config) SyncFavorites(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(requestPayload.PostIDs) > maxSyncChanges {
+		app.errorJSON(w, errors.New("too many post IDs in one sync"), http.StatusBadRequest)
+		return
+	}
+
 	log.Printf("Syncing favorites - User: %d, Posts: %v", requestPayload.UserID, requestPayload.PostIDs)
 
-	err = app.Models.Favorite.BulkInsert(requestPayload.UserID, requestPayload.PostIDs)
+	changes := make([]data.SyncChange, 0, len(requestPayload.PostIDs))
+	for _, postID := range requestPayload.PostIDs {
+		changes = append(changes, data.SyncChange{PostID: postID, Op: data.SyncAdd})
+	}
+
+	result, err := app.Models.Favorite.Sync(requestPayload.UserID, 0, changes)
 	if err != nil {
 		log.Printf("Error syncing favorites: %v", err)
 		app.errorJSON(w, err, http.StatusInternalServerError)
@@ -131,21 +150,152 @@ func (app *Config) SyncFavorites(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return updated list
-	postIDs, err := app.Models.Favorite.GetPostIDsByUser(requestPayload.UserID)
+	postIDs := make([]string, 0, len(result.Favorites))
+	for _, fav := range result.Favorites {
+		postIDs = append(postIDs, strconv.Itoa(fav.PostID))
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Favorites synced successfully",
+		Data:    postIDs,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// maxSyncChanges caps the changes accepted by one sync request
+const maxSyncChanges = 1000
+
+// SyncUserFavorites merges a client's offline adds and removes into the
+// user's favorites, last write wins, and returns the merged state with a new
+// cursor. The client sends back that cursor next time to learn which
+// favorites other devices removed in between.
+func (app *Config) SyncUserFavorites(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userId"))
 	if err != nil {
-		log.Printf("Error getting favorites after sync: %v", err)
-		app.errorJSON(w, err, http.StatusInternalServerError)
+		app.errorJSON(w, errors.New("invalid user ID"), http.StatusBadRequest)
 		return
 	}
 
-	if postIDs == nil {
-		postIDs = []string{}
+	var requestPayload struct {
+		Cursor  int64             `json:"cursor"`
+		Changes []data.SyncChange `json:"changes"`
+	}
+
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if len(requestPayload.Changes) > maxSyncChanges {
+		app.errorJSON(w, errors.New("too many changes in one sync"), http.StatusBadRequest)
+		return
+	}
+
+	for _, c := range requestPayload.Changes {
+		if c.Op != data.SyncAdd && c.Op != data.SyncRemove {
+			app.errorJSON(w, errors.New(`op must be "add" or "remove"`), http.StatusBadRequest)
+			return
+		}
+		if c.PostID <= 0 {
+			app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := app.Models.Favorite.Sync(userID, requestPayload.Cursor, requestPayload.Changes)
+	if err != nil {
+		log.Printf("Error syncing favorites of user %d: %v", userID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
 	}
 
 	payload := jsonResponse{
 		Error:   false,
 		Message: "Favorites synced successfully",
-		Data:    postIDs,
+		Data:    result,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetPostSubscribers returns the users who favorited a post. It is used by
+// the listener to fan out notifications and is not exposed by the broker.
+func (app *Config) GetPostSubscribers(w http.ResponseWriter, r *http.Request) {
+	postIDStr := chi.URLParam(r, "postId")
+	postID, err := strconv.Atoi(postIDStr)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	subscribers, err := app.Models.Favorite.GetSubscribersByPost(postID)
+	if err != nil {
+		log.Printf("Error getting subscribers for post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if subscribers == nil {
+		subscribers = []*data.Subscriber{}
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  subscribers,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetFavoriteStats returns favorite totals and daily additions for a set of
+// posts. Query parameters: postIds (comma separated) and since (YYYY-MM-DD).
+// It is used by post-service for owner analytics and is not exposed by the broker.
+func (app *Config) GetFavoriteStats(w http.ResponseWriter, r *http.Request) {
+	var postIDs []int
+	for _, raw := range strings.Split(r.URL.Query().Get("postIds"), ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			app.errorJSON(w, errors.New("invalid post ID in postIds"), http.StatusBadRequest)
+			return
+		}
+		postIDs = append(postIDs, id)
+	}
+
+	if len(postIDs) == 0 {
+		app.errorJSON(w, errors.New("postIds is required"), http.StatusBadRequest)
+		return
+	}
+
+	since := time.Time{}
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		parsed, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			app.errorJSON(w, errors.New("since must be a YYYY-MM-DD date"), http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	stats, err := app.Models.Favorite.GetStatsByPosts(postIDs, since)
+	if err != nil {
+		log.Printf("Error getting favorite stats: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]*data.PostFavoriteStats, 0, len(postIDs))
+	for _, id := range postIDs {
+		response = append(response, stats[id])
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  response,
 	}
 
 	app.writeJSON(w, http.StatusOK, payload)
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"favourite-service/data"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	postServiceURL       = "http://post-service"
+	defaultListingsLimit = 20
+	maxListingsLimit     = 50
+)
+
+// Availability markers of a favorited listing
+const (
+	availabilityAvailable = "available"
+	availabilityPending   = "pending"
+	availabilityRented    = "rented"
+	availabilityRemoved   = "removed"
+)
+
+// favoriteCard is one entry of GET /favorites/{userId}
+type favoriteCard struct {
+	PostID       int            `json:"postId"`
+	FavoritedAt  time.Time      `json:"favoritedAt"`
+	Availability string         `json:"availability"`
+	Post         map[string]any `json:"post"` // null once the listing is removed
+}
+
+// listingsCursor is the position after the last card of a page. It is sent
+// to clients base64 encoded and only valid for the same sort and order.
+type listingsCursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d"`
+	Key        string `json:"k"`
+	PostID     int    `json:"id"`
+}
+
+func (c listingsCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeListingsCursor(s string) (listingsCursor, error) {
+	var c listingsCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(raw, &c)
+	}
+	if err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+// GetUserFavorites returns a user's favorites as full listing cards, a page
+// at a time. Query parameters: sort (favorited, price or available), order
+// (asc or desc; newest favorites, lowest price and earliest availability
+// come first by default), limit and cursor (nextCursor of the previous page).
+func (app *Config) GetUserFavorites(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid user ID"), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	q := data.ListQuery{
+		UserID: userID,
+		Sort:   data.SortFavorited,
+		Limit:  defaultListingsLimit,
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		if !data.ValidSort(sort) {
+			app.errorJSON(w, errors.New("sort must be favorited, price or available"), http.StatusBadRequest)
+			return
+		}
+		q.Sort = sort
+	}
+
+	q.Descending = q.Sort == data.SortFavorited
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		q.Descending = false
+	case "desc":
+		q.Descending = true
+	default:
+		app.errorJSON(w, errors.New("order must be asc or desc"), http.StatusBadRequest)
+		return
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxListingsLimit {
+			app.errorJSON(w, fmt.Errorf("limit must be between 1 and %d", maxListingsLimit), http.StatusBadRequest)
+			return
+		}
+		q.Limit = limit
+	}
+
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := decodeListingsCursor(raw)
+		if err != nil || cursor.Sort != q.Sort || cursor.Descending != q.Descending {
+			app.errorJSON(w, errors.New("invalid cursor for this sort order"), http.StatusBadRequest)
+			return
+		}
+		q.AfterKey, q.AfterPostID = cursor.Key, cursor.PostID
+	}
+
+	// One extra row tells whether there is a next page
+	limit := q.Limit
+	q.Limit++
+
+	listings, err := app.Models.Favorite.ListByUser(q)
+	if err != nil {
+		log.Printf("Error listing favorites of user %d: %v", userID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor *string
+	if len(listings) > limit {
+		listings = listings[:limit]
+		last := listings[limit-1]
+		c := listingsCursor{Sort: q.Sort, Descending: q.Descending, Key: last.SortKey, PostID: last.PostID}.encode()
+		nextCursor = &c
+	}
+
+	ids := make([]int, 0, len(listings))
+	for _, l := range listings {
+		if l.PostStatus == "published" || l.PostStatus == "pending" || l.PostStatus == "rented" {
+			ids = append(ids, l.PostID)
+		}
+	}
+
+	cards, err := fetchPostCards(ids)
+	if err != nil {
+		// Still answer with the markers; the client can retry for the cards
+		log.Printf("Error fetching cards for favorites of user %d: %v", userID, err)
+	}
+
+	items := make([]favoriteCard, 0, len(listings))
+	for _, l := range listings {
+		item := favoriteCard{
+			PostID:       l.PostID,
+			FavoritedAt:  l.FavoritedAt,
+			Availability: availabilityOf(l.PostStatus),
+			Post:         cards[l.PostID],
+		}
+		if item.Post == nil && item.Availability != availabilityRemoved && err == nil {
+			item.Availability = availabilityRemoved
+		}
+		items = append(items, item)
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data: map[string]any{
+			"items":      items,
+			"nextCursor": nextCursor,
+		},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// availabilityOf maps a post status to the marker shown on a favorite
+func availabilityOf(status string) string {
+	switch status {
+	case "published":
+		return availabilityAvailable
+	case "pending":
+		return availabilityPending
+	case "rented":
+		return availabilityRented
+	default:
+		return availabilityRemoved
+	}
+}
+
+// fetchPostCards loads listing cards from post-service's batch endpoint,
+// keyed by post ID. Posts post-service won't show are left out.
+func fetchPostCards(ids []int) (map[int]map[string]any, error) {
+	cards := map[int]map[string]any{}
+	if len(ids) == 0 {
+		return cards, nil
+	}
+
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(postServiceURL + "/posts?ids=" + strings.Join(parts, ","))
+	if err != nil {
+		return cards, err
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		Error   bool             `json:"error"`
+		Message string           `json:"message"`
+		Data    []map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return cards, err
+	}
+	if payload.Error {
+		return cards, errors.New(payload.Message)
+	}
+
+	for _, card := range payload.Data {
+		if card["status"] == "unavailable" {
+			continue
+		}
+		idStr, _ := card["id"].(string)
+		if id, err := strconv.Atoi(idStr); err == nil {
+			cards[id] = card
+		}
+	}
+
+	return cards, nil
+}
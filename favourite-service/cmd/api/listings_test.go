@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestAvailabilityOf(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{"published", availabilityAvailable},
+		{"pending", availabilityPending},
+		{"rented", availabilityRented},
+		{"pending_review", availabilityRemoved},
+		{"rejected", availabilityRemoved},
+		{"hidden", availabilityRemoved},
+		{"removed", availabilityRemoved},
+		{"", availabilityRemoved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			if got := availabilityOf(tt.status); got != tt.want {
+				t.Errorf("availabilityOf(%q) = %q, want %q", tt.status, got, tt.want)
+			}
+		})
+	}
+}
@@ -24,6 +24,10 @@ type Config struct {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(os.Args[2:]))
+	}
+
 	log.Println("Starting favourite service")
 
 	pgConn := connectToPG()
@@ -31,11 +35,17 @@ func main() {
 		log.Panic("Can't connect to Postgres!")
 	}
 
+	if err := migrateOnStartup(pgConn); err != nil {
+		log.Panicf("Can't migrate the database: %v", err)
+	}
+
 	app := Config{
 		DB:     pgConn,
 		Models: data.New(pgConn),
 	}
 
+	go app.runTrendingRefresh()
+
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%s", webPort),
 		Handler: app.routes(),
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"database/sql"
+	"favourite-service/migrations"
+	"migrate"
+	"os"
+)
+
+// serviceName identifies this service's rows in schema_history
+const serviceName = "favourite-service"
+
+// migrateOnStartup applies pending migrations before the server starts.
+// Favorites reference tables owned by the authentication and post services,
+// so a failed run is retried while those services create them. Set
+// MIGRATE_ON_START=false to manage the schema with the migrate command instead.
+func migrateOnStartup(db *sql.DB) error {
+	return migrate.OnStartup(db, serviceName, migrations.FS, 10)
+}
+
+// runMigrateCommand implements `favouriteApp migrate ...` and returns the exit code
+func runMigrateCommand(args []string) int {
+	return migrate.Command("favouriteApp", serviceName, migrations.FS, func() (*sql.DB, error) {
+		return openDB(os.Getenv("DSN"))
+	}, args)
+}
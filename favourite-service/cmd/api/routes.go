@@ -23,10 +23,42 @@ func (app *Config) routes() http.Handler {
 	mux.Use(middleware.Heartbeat("/ping"))
 
 	// Favorite routes
+	mux.Get("/favorites/{userId}", app.GetUserFavorites)
 	mux.Get("/favorites/{userId}/ids", app.GetUserFavoriteIDs)
 	mux.Post("/favorites", app.AddFavorite)
 	mux.Delete("/favorites/{userId}/{postId}", app.RemoveFavorite)
 	mux.Post("/favorites/sync", app.SyncFavorites)
+	mux.Post("/favorites/{userId}/sync", app.SyncUserFavorites)
+
+	// Collections: named lists with notes, tags, manual order, share links
+	// and roommate members
+	mux.Route("/favorites/{userId}/collections", func(r chi.Router) {
+		r.Get("/", app.GetCollections)
+		r.Post("/", app.CreateCollection)
+		r.Get("/{collectionId}", app.GetCollection)
+		r.Put("/{collectionId}", app.RenameCollection)
+		r.Delete("/{collectionId}", app.DeleteCollection)
+		r.Put("/{collectionId}/items/{postId}", app.SaveCollectionItem)
+		r.Delete("/{collectionId}/items/{postId}", app.RemoveCollectionItem)
+		r.Put("/{collectionId}/order", app.ReorderCollection)
+		r.Post("/{collectionId}/share", app.ShareCollection)
+		r.Delete("/{collectionId}/share", app.UnshareCollection)
+		r.Post("/{collectionId}/members", app.AddCollectionMember)
+		r.Delete("/{collectionId}/members/{memberId}", app.RemoveCollectionMember)
+	})
+	mux.Get("/shared/collections/{token}", app.GetSharedCollection)
+
+	// Internal: who favorited a post (used by listener-service)
+	mux.Get("/favorites/post/{postId}/subscribers", app.GetPostSubscribers)
+
+	// Trending and most-favorited listings
+	mux.Get("/favorites/trending", app.GetTrending)
+
+	// Internal: favorite counts for listing cards (used by post-service)
+	mux.Get("/favorites/counts", app.GetFavoriteCounts)
+
+	// Internal: favorite counts for listing analytics (used by post-service)
+	mux.Get("/favorites/stats", app.GetFavoriteStats)
 
 	return mux
 }
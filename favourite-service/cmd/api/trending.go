@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"favourite-service/data"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	trendingRefreshInterval = 5 * time.Minute
+	defaultTrendingLimit    = 10
+	maxTrendingLimit        = 50
+	maxCountIDs             = 200
+)
+
+// trendingCard is a trending post with its listing card
+type trendingCard struct {
+	*data.TrendingPost
+	Post map[string]any `json:"post"`
+}
+
+// runTrendingRefresh rebuilds the favorite counts and trending scores now
+// and then every few minutes until the process exits
+func (app *Config) runTrendingRefresh() {
+	ticker := time.NewTicker(trendingRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if refreshed, err := app.Models.Trending.Refresh(); err != nil {
+			log.Printf("Error refreshing trending listings: %v", err)
+		} else if refreshed {
+			log.Printf("Refreshed trending listings in %v", time.Since(start).Round(time.Millisecond))
+		}
+
+		<-ticker.C
+	}
+}
+
+// GetTrending returns the most favorited published listings of the last day
+// or week as listing cards. Query parameters: window (day or week, default
+// week), neighborhood and limit.
+func (app *Config) GetTrending(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	window := query.Get("window")
+	if window == "" {
+		window = data.WindowWeek
+	}
+	if !data.ValidWindow(window) {
+		app.errorJSON(w, errors.New("window must be day or week"), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultTrendingLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxTrendingLimit {
+			app.errorJSON(w, errors.New("limit must be between 1 and 50"), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	neighborhood := strings.TrimSpace(query.Get("neighborhood"))
+
+	top, err := app.Models.Trending.Top(window, neighborhood, limit)
+	if err != nil {
+		log.Printf("Error getting trending listings: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]int, 0, len(top))
+	for _, tp := range top {
+		ids = append(ids, tp.PostID)
+	}
+
+	cards, err := fetchPostCards(ids)
+	if err != nil {
+		log.Printf("Error fetching cards for trending listings: %v", err)
+		app.errorJSON(w, errors.New("listings are unavailable, try again"), http.StatusBadGateway)
+		return
+	}
+
+	items := make([]trendingCard, 0, len(top))
+	for _, tp := range top {
+		card := cards[tp.PostID]
+		if card == nil {
+			continue // hidden since the last refresh
+		}
+		items = append(items, trendingCard{TrendingPost: tp, Post: card})
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data: map[string]any{
+			"window":       window,
+			"neighborhood": neighborhood,
+			"items":        items,
+		},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetFavoriteCounts returns how many users favorited each post, as of the
+// last refresh. Query parameter: postIds (comma separated). It is used by
+// post-service for listing cards and is not exposed by the broker.
+func (app *Config) GetFavoriteCounts(w http.ResponseWriter, r *http.Request) {
+	var postIDs []int
+	for _, raw := range strings.Split(r.URL.Query().Get("postIds"), ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			app.errorJSON(w, errors.New("invalid post ID in postIds"), http.StatusBadRequest)
+			return
+		}
+		postIDs = append(postIDs, id)
+	}
+
+	if len(postIDs) == 0 {
+		app.errorJSON(w, errors.New("postIds is required"), http.StatusBadRequest)
+		return
+	}
+	if len(postIDs) > maxCountIDs {
+		app.errorJSON(w, errors.New("at most 200 postIds per request"), http.StatusBadRequest)
+		return
+	}
+
+	counts, err := app.Models.Trending.Counts(postIDs)
+	if err != nil {
+		log.Printf("Error getting favorite counts: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := make(map[string]int, len(counts))
+	for id, count := range counts {
+		response[strconv.Itoa(id)] = count
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  response,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
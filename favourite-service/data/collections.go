@@ -0,0 +1,479 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// DefaultCollectionName is the name given to a user's default collection
+const DefaultCollectionName = "Favorites"
+
+// ErrDefaultCollection is returned when deleting the default collection
+var ErrDefaultCollection = errors.New("the default collection can't be deleted")
+
+// ErrOrderMismatch is returned by Reorder when the given post IDs aren't
+// exactly the collection's items
+var ErrOrderMismatch = errors.New("postIds must list every item of the collection exactly once")
+
+// ErrNotRoommates is returned when adding a member the owner hasn't talked
+// to in the roommate finder
+var ErrNotRoommates = errors.New("only roommates you have a conversation with can be added")
+
+// Collection is a named list of saved posts
+type Collection struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"userId"`
+	Name        string    `json:"name"`
+	IsDefault   bool      `json:"isDefault"`
+	ShareToken  *string   `json:"shareToken"`
+	ItemCount   int       `json:"itemCount"`
+	MemberCount int       `json:"memberCount"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// CollectionItem is a post in a collection with the owner's annotations
+type CollectionItem struct {
+	PostID     int       `json:"postId"`
+	Note       string    `json:"note"`
+	Tags       []string  `json:"tags"`
+	Position   int       `json:"position"`
+	AddedAt    time.Time `json:"addedAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	PostStatus string    `json:"-"`
+}
+
+// CollectionMember is a roommate who can edit someone else's collection
+type CollectionMember struct {
+	UserID  int       `json:"userId"`
+	Name    string    `json:"name"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+const collectionColumns = `
+	c.id, c.user_id, c.name, c.is_default, c.share_token, c.created_at, c.updated_at,
+	(SELECT COUNT(*) FROM favorite_collection_items i WHERE i.collection_id = c.id),
+	(SELECT COUNT(*) FROM favorite_collection_members m WHERE m.collection_id = c.id)`
+
+func scanCollection(row interface{ Scan(...any) error }) (*Collection, error) {
+	var c Collection
+	err := row.Scan(&c.ID, &c.UserID, &c.Name, &c.IsDefault, &c.ShareToken, &c.CreatedAt, &c.UpdatedAt, &c.ItemCount, &c.MemberCount)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetAllByUser returns a user's collections, the default one first, then
+// the collections shared with them as a member. The default collection is
+// created if the user doesn't have one yet.
+func (cl *Collection) GetAllByUser(userID int) ([]*Collection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	if _, err := ensureDefaultCollection(ctx, db, userID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + collectionColumns + `
+		FROM favorite_collections c
+		WHERE c.user_id = $1
+			OR EXISTS (SELECT 1 FROM favorite_collection_members m WHERE m.collection_id = c.id AND m.user_id = $1)
+		ORDER BY c.user_id = $1 DESC, c.is_default DESC, c.created_at, c.id
+	`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []*Collection
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+
+	return collections, rows.Err()
+}
+
+// GetOne returns a collection by ID
+func (cl *Collection) GetOne(id int) (*Collection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT ` + collectionColumns + ` FROM favorite_collections c WHERE c.id = $1`
+
+	return scanCollection(db.QueryRowContext(ctx, query, id))
+}
+
+// GetByShareToken returns the collection shared under token
+func (cl *Collection) GetByShareToken(token string) (*Collection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT ` + collectionColumns + ` FROM favorite_collections c WHERE c.share_token = $1`
+
+	return scanCollection(db.QueryRowContext(ctx, query, token))
+}
+
+// Insert creates a collection and returns its ID
+func (cl *Collection) Insert(userID int, name string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var id int
+	err := db.QueryRowContext(ctx,
+		`INSERT INTO favorite_collections (user_id, name) VALUES ($1, $2) RETURNING id`,
+		userID, name).Scan(&id)
+	return id, err
+}
+
+// Rename changes a collection's name
+func (cl *Collection) Rename(id int, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx,
+		`UPDATE favorite_collections SET name = $1, updated_at = NOW() WHERE id = $2`, name, id)
+	return err
+}
+
+// Delete removes a collection and its items. The default collection stays.
+func (cl *Collection) Delete(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `DELETE FROM favorite_collections WHERE id = $1 AND NOT is_default`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrDefaultCollection
+	}
+
+	return nil
+}
+
+// SetShareToken shares a collection under token, or stops sharing it when
+// token is nil
+func (cl *Collection) SetShareToken(id int, token *string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx,
+		`UPDATE favorite_collections SET share_token = $1, updated_at = NOW() WHERE id = $2`, token, id)
+	return err
+}
+
+// IsMember reports whether userID is a member of a collection
+func (cl *Collection) IsMember(collectionID, userID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var member bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM favorite_collection_members WHERE collection_id = $1 AND user_id = $2)
+	`, collectionID, userID).Scan(&member)
+	return member, err
+}
+
+// GetMembers returns a collection's members in the order they were added.
+// Only first names and last initials are shown, as in the roommate finder.
+func (cl *Collection) GetMembers(collectionID int) ([]*CollectionMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT m.user_id, u.first_name, COALESCE(LEFT(u.last_name, 1), ''), m.created_at
+		FROM favorite_collection_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.collection_id = $1
+		ORDER BY m.created_at, m.user_id
+	`, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*CollectionMember{}
+	for rows.Next() {
+		var m CollectionMember
+		var initial string
+		if err := rows.Scan(&m.UserID, &m.Name, &initial, &m.AddedAt); err != nil {
+			return nil, err
+		}
+		if initial != "" {
+			m.Name += " " + initial + "."
+		}
+		members = append(members, &m)
+	}
+
+	return members, rows.Err()
+}
+
+// AddMember lets userID edit the collection. Only roommates the owner has a
+// roommate finder conversation with can be added; adding a member twice is
+// a no-op. The check and the insert are one statement, so they see the
+// same conversations.
+func (cl *Collection) AddMember(collectionID, ownerID, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var matched bool
+	err := db.QueryRowContext(ctx, `
+		WITH talked AS (
+			SELECT EXISTS (
+				SELECT 1 FROM conversations
+				WHERE post_id IS NULL
+					AND LEAST(renter_id, landlord_id) = LEAST($2::int, $3::int)
+					AND GREATEST(renter_id, landlord_id) = GREATEST($2::int, $3::int)
+			) AS matched
+		), added AS (
+			INSERT INTO favorite_collection_members (collection_id, user_id, added_by)
+			SELECT $1, $3, $2 FROM talked WHERE matched
+			ON CONFLICT (collection_id, user_id) DO NOTHING
+		)
+		SELECT matched FROM talked
+	`, collectionID, ownerID, userID).Scan(&matched)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return ErrNotRoommates
+	}
+
+	return nil
+}
+
+// RemoveMember takes userID out of a collection. It returns sql.ErrNoRows
+// when they weren't a member.
+func (cl *Collection) RemoveMember(collectionID, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx,
+		`DELETE FROM favorite_collection_members WHERE collection_id = $1 AND user_id = $2`, collectionID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetItems returns a collection's items in their manual order. A non-empty
+// tag keeps only items carrying it.
+func (cl *Collection) GetItems(collectionID int, tag string) ([]*CollectionItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT i.post_id, i.note, i.tags, i.position, i.created_at, i.updated_at, p.status
+		FROM favorite_collection_items i
+		JOIN posts p ON p.id = i.post_id
+		WHERE i.collection_id = $1 AND ($2 = '' OR i.tags ? $2)
+		ORDER BY i.position, i.post_id
+	`
+
+	rows, err := db.QueryContext(ctx, query, collectionID, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*CollectionItem
+	for rows.Next() {
+		var item CollectionItem
+		var tags []byte
+		err := rows.Scan(&item.PostID, &item.Note, &tags, &item.Position, &item.AddedAt, &item.UpdatedAt, &item.PostStatus)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(tags, &item.Tags); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
+// SaveItem adds a post to a collection, at the end, or updates the note and
+// tags of a post already in it. A nil note or tags leaves that field as is.
+func (cl *Collection) SaveItem(collectionID, postID int, note *string, tags []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(ctx, tx, collectionID); err != nil {
+		return err
+	}
+
+	if err := addItem(ctx, tx, collectionID, postID); err != nil {
+		return err
+	}
+
+	if err := touchDefault(ctx, tx, collectionID, postID, true); err != nil {
+		return err
+	}
+
+	if note != nil {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE favorite_collection_items SET note = $1, updated_at = NOW()
+			WHERE collection_id = $2 AND post_id = $3
+		`, *note, collectionID, postID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if tags != nil {
+		encoded, err := json.Marshal(tags)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE favorite_collection_items SET tags = $1, updated_at = NOW()
+			WHERE collection_id = $2 AND post_id = $3
+		`, string(encoded), collectionID, postID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemoveItem takes a post out of a collection
+func (cl *Collection) RemoveItem(collectionID, postID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(ctx, tx, collectionID); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM favorite_collection_items WHERE collection_id = $1 AND post_id = $2`, collectionID, postID)
+	if err != nil {
+		return err
+	}
+
+	if err := touchDefault(ctx, tx, collectionID, postID, false); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Reorder sets the manual order of a collection. postIDs must hold every
+// item exactly once; otherwise ErrOrderMismatch is returned.
+func (cl *Collection) Reorder(collectionID int, postIDs []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM favorite_collection_items WHERE collection_id = $1`, collectionID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count != len(postIDs) {
+		return ErrOrderMismatch
+	}
+
+	seen := make(map[int]bool, len(postIDs))
+	for i, postID := range postIDs {
+		if seen[postID] {
+			return ErrOrderMismatch
+		}
+		seen[postID] = true
+
+		res, err := tx.ExecContext(ctx, `
+			UPDATE favorite_collection_items SET position = $1
+			WHERE collection_id = $2 AND post_id = $3
+		`, i+1, collectionID, postID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrOrderMismatch
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE favorite_collections SET updated_at = NOW() WHERE id = $1`, collectionID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ensureDefaultCollection returns the ID of a user's default collection,
+// creating it on first use
+func ensureDefaultCollection(ctx context.Context, q queryer, userID int) (int, error) {
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO favorite_collections (user_id, name, is_default)
+		VALUES ($1, $2, TRUE)
+		ON CONFLICT (user_id) WHERE is_default DO NOTHING
+	`, userID, DefaultCollectionName)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = q.QueryRowContext(ctx,
+		`SELECT id FROM favorite_collections WHERE user_id = $1 AND is_default`, userID).Scan(&id)
+	return id, err
+}
+
+// addItem appends a post to a collection unless it is already there
+func addItem(ctx context.Context, q queryer, collectionID, postID int) error {
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO favorite_collection_items (collection_id, post_id, position)
+		SELECT $1::int, $2::int, COALESCE(MAX(position), 0) + 1
+		FROM favorite_collection_items
+		WHERE collection_id = $1
+		ON CONFLICT (collection_id, post_id) DO NOTHING
+	`, collectionID, postID)
+	return err
+}
@@ -14,27 +14,38 @@ var db *sql.DB
 func New(dbPool *sql.DB) Models {
 	db = dbPool
 	return Models{
-		Favorite: Favorite{},
+		Favorite:   Favorite{},
+		Collection: Collection{},
+		Trending:   Trending{},
 	}
 }
 
 type Models struct {
-	Favorite Favorite
+	Favorite   Favorite
+	Collection Collection
+	Trending   Trending
 }
 
-// Favorite represents a user's favorite post
+// Favorite represents a post in a user's default collection. The flat
+// favorites endpoints read and write that collection only.
 type Favorite struct {
 	UserID    int       `json:"userId"`
 	PostID    int       `json:"postId"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+// defaultItems joins a user's default collection to its items (as f) and
+// leaves the user ID as $1
+const defaultItems = `
+	favorite_collection_items f
+	JOIN favorite_collections c ON c.id = f.collection_id AND c.is_default AND c.user_id = $1`
+
 // GetPostIDsByUser returns all favorite post IDs for a user as strings
 func (f *Favorite) GetPostIDsByUser(userID int) ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `SELECT post_id FROM favorites WHERE user_id = $1 ORDER BY created_at DESC`
+	query := `SELECT f.post_id FROM ` + defaultItems + ` ORDER BY f.created_at DESC`
 
 	rows, err := db.QueryContext(ctx, query, userID)
 	if err != nil {
@@ -54,53 +65,209 @@ func (f *Favorite) GetPostIDsByUser(userID int) ([]string, error) {
 	return postIDs, nil
 }
 
-// Insert adds a favorite
+// Insert adds a favorite. It returns ErrPostNotFound for unknown posts.
 func (f *Favorite) Insert(userID, postID int) error {
+	return applyNow(userID, SyncAdd, postID)
+}
+
+// Delete removes a favorite, leaving a tombstone for sync
+func (f *Favorite) Delete(userID, postID int) error {
+	return applyNow(userID, SyncRemove, postID)
+}
+
+// Exists checks if a favorite exists
+func (f *Favorite) Exists(userID, postID int) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `INSERT INTO favorites (user_id, post_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	query := `SELECT EXISTS(SELECT 1 FROM ` + defaultItems + ` WHERE f.post_id = $2)`
+
+	var exists bool
+	err := db.QueryRowContext(ctx, query, userID, postID).Scan(&exists)
+	return exists, err
+}
 
-	_, err := db.ExecContext(ctx, stmt, userID, postID)
-	return err
+// Subscriber is a user who favorited a post, with what's needed to mail them
+type Subscriber struct {
+	UserID    int    `json:"userId"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
 }
 
-// Delete removes a favorite
-func (f *Favorite) Delete(userID, postID int) error {
+// GetSubscribersByPost returns every user who favorited a post
+func (f *Favorite) GetSubscribersByPost(postID int) ([]*Subscriber, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `DELETE FROM favorites WHERE user_id = $1 AND post_id = $2`
+	query := `
+		SELECT u.id, u.email, COALESCE(u.first_name, '')
+		FROM favorites f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.post_id = $1 AND u.user_active = 1
+		ORDER BY f.created_at
+	`
 
-	_, err := db.ExecContext(ctx, stmt, userID, postID)
-	return err
+	rows, err := db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscribers []*Subscriber
+	for rows.Next() {
+		var s Subscriber
+		if err := rows.Scan(&s.UserID, &s.Email, &s.FirstName); err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, &s)
+	}
+
+	return subscribers, rows.Err()
 }
 
-// Exists checks if a favorite exists
-func (f *Favorite) Exists(userID, postID int) (bool, error) {
+// PostFavoriteStats summarises the favorites of one post for analytics
+type PostFavoriteStats struct {
+	PostID int `json:"postId"`
+	Total  int `json:"total"`
+	// Daily maps a UTC date (YYYY-MM-DD) to the favorites added that day
+	// that are still in place
+	Daily map[string]int `json:"daily"`
+}
+
+// GetStatsByPosts returns favorite totals and per-day additions since the
+// given date for each of the posts. Posts nobody favorited are included
+// with zero counts.
+func (f *Favorite) GetStatsByPosts(postIDs []int, since time.Time) (map[int]*PostFavoriteStats, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `SELECT EXISTS(SELECT 1 FROM favorites WHERE user_id = $1 AND post_id = $2)`
+	stats := make(map[int]*PostFavoriteStats, len(postIDs))
+	for _, id := range postIDs {
+		stats[id] = &PostFavoriteStats{PostID: id, Daily: map[string]int{}}
+	}
 
-	var exists bool
-	err := db.QueryRowContext(ctx, query, userID, postID).Scan(&exists)
-	return exists, err
+	query := `
+		SELECT post_id, created_at::date, COUNT(*)
+		FROM favorites
+		WHERE post_id = ANY($1::int[])
+		GROUP BY post_id, created_at::date
+	`
+
+	rows, err := db.QueryContext(ctx, query, intArray(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID, count int
+		var day time.Time
+		if err := rows.Scan(&postID, &day, &count); err != nil {
+			return nil, err
+		}
+
+		s, ok := stats[postID]
+		if !ok {
+			continue
+		}
+		s.Total += count
+		if !day.Before(since) {
+			s.Daily[day.Format("2006-01-02")] = count
+		}
+	}
+
+	return stats, rows.Err()
+}
+
+// Sort orders for ListByUser
+const (
+	SortFavorited = "favorited"
+	SortPrice     = "price"
+	SortAvailable = "available"
+)
+
+// sortColumns maps a sort order to the SQL expression it orders by and the
+// type a cursor value is cast to
+var sortColumns = map[string]struct{ expr, cast string }{
+	SortFavorited: {"f.created_at", "timestamptz"},
+	SortPrice:     {"p.price", "numeric"},
+	SortAvailable: {"COALESCE(p.available_from, 'epoch'::timestamp)", "timestamp"},
+}
+
+// ValidSort reports whether ListByUser can order by sort
+func ValidSort(sort string) bool {
+	_, ok := sortColumns[sort]
+	return ok
 }
 
-// BulkInsert inserts multiple favorites (for sync)
-func (f *Favorite) BulkInsert(userID int, postIDs []int) error {
+// FavoriteListing is one favorite with the post fields its list is sorted by
+type FavoriteListing struct {
+	PostID        int
+	FavoritedAt   time.Time
+	Price         float64
+	AvailableFrom time.Time
+	PostStatus    string
+	// SortKey is the value of the sort column as text, for building cursors
+	SortKey string
+}
+
+// ListQuery selects one page of a user's favorites. After, when set, is the
+// sort key and post ID of the last row of the previous page.
+type ListQuery struct {
+	UserID      int
+	Sort        string
+	Descending  bool
+	Limit       int
+	AfterKey    string
+	AfterPostID int
+}
+
+// ListByUser returns a page of a user's default collection ordered by q.Sort, with
+// the post ID as tie breaker so pages never overlap
+func (f *Favorite) ListByUser(q ListQuery) ([]*FavoriteListing, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `INSERT INTO favorites (user_id, post_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	col, ok := sortColumns[q.Sort]
+	if !ok {
+		col = sortColumns[SortFavorited]
+	}
+
+	direction, compare := "ASC", ">"
+	if q.Descending {
+		direction, compare = "DESC", "<"
+	}
+
+	args := []any{q.UserID}
+	where := "TRUE"
+	if q.AfterKey != "" {
+		args = append(args, q.AfterKey, q.AfterPostID)
+		where = "(" + col.expr + ", f.post_id) " + compare + " ($2::" + col.cast + ", $3)"
+	}
+	args = append(args, q.Limit)
 
-	for _, postID := range postIDs {
-		_, err := db.ExecContext(ctx, stmt, userID, postID)
-		if err != nil {
-			return err
+	query := `
+		SELECT f.post_id, f.created_at, p.price, COALESCE(p.available_from, 'epoch'::timestamp), p.status, ` + col.expr + `::text
+		FROM ` + defaultItems + `
+		JOIN posts p ON p.id = f.post_id
+		WHERE ` + where + `
+		ORDER BY ` + col.expr + ` ` + direction + `, f.post_id ` + direction + `
+		LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var listings []*FavoriteListing
+	for rows.Next() {
+		var l FavoriteListing
+		if err := rows.Scan(&l.PostID, &l.FavoritedAt, &l.Price, &l.AvailableFrom, &l.PostStatus, &l.SortKey); err != nil {
+			return nil, err
 		}
+		listings = append(listings, &l)
 	}
 
-	return nil
+	return listings, rows.Err()
 }
@@ -0,0 +1,409 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sync operations
+const (
+	SyncAdd    = "add"
+	SyncRemove = "remove"
+)
+
+// ErrPostNotFound is returned when favoriting a post that doesn't exist
+var ErrPostNotFound = errors.New("post not found")
+
+// SyncChange is an add or remove made on a client, stamped with the
+// client's clock
+type SyncChange struct {
+	PostID int       `json:"postId"`
+	Op     string    `json:"op"`
+	At     time.Time `json:"at"`
+}
+
+// SyncedFavorite is a post in the merged default collection
+type SyncedFavorite struct {
+	PostID    int       `json:"postId"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+// SyncedRemoval is a favorite removed after the client's cursor
+type SyncedRemoval struct {
+	PostID    int       `json:"postId"`
+	RemovedAt time.Time `json:"removedAt"`
+}
+
+// SyncResult is the state of a user's favorites after a sync
+type SyncResult struct {
+	Favorites []SyncedFavorite `json:"favorites"`
+	Removed   []SyncedRemoval  `json:"removed"`
+	// Rejected lists added posts that don't exist; they were skipped
+	Rejected []int `json:"rejected"`
+	Cursor   int64 `json:"cursor"`
+}
+
+// syncState is where a post stands in a user's default collection
+type syncState struct {
+	present bool
+	at      time.Time // changed_at of the item, or deleted_at of the tombstone
+	known   bool      // there is an item or a tombstone
+	dirty   bool
+}
+
+// Sync applies a client's adds and removes to the user's default collection
+// in one transaction and returns the merged state. Each post keeps whichever
+// change has the latest client time; on a tie the remove wins. Times in the
+// future are treated as now. Removed lists tombstones newer than cursor.
+func (f *Favorite) Sync(userID int, cursor int64, changes []SyncChange) (*SyncResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	collectionID, err := lockDefaultCollection(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rejected, err := applyChanges(ctx, tx, userID, collectionID, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := readSyncState(ctx, tx, userID, collectionID, cursor)
+	if err != nil {
+		return nil, err
+	}
+	result.Rejected = rejected
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// applyNow applies a single change stamped with the server's clock
+func applyNow(userID int, op string, postID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	collectionID, err := lockDefaultCollection(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	change := SyncChange{PostID: postID, Op: op, At: time.Now()}
+	rejected, err := applyChanges(ctx, tx, userID, collectionID, []SyncChange{change})
+	if err != nil {
+		return err
+	}
+	if len(rejected) > 0 {
+		return ErrPostNotFound
+	}
+
+	return tx.Commit()
+}
+
+// lockDefaultCollection returns the user's default collection, creating it
+// when needed, and locks it so changes to it are numbered in commit order
+func lockDefaultCollection(ctx context.Context, tx *sql.Tx, userID int) (int, error) {
+	collectionID, err := ensureDefaultCollection(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return collectionID, lockCollection(ctx, tx, collectionID)
+}
+
+// lockCollection holds a collection's row until the transaction ends
+func lockCollection(ctx context.Context, tx *sql.Tx, collectionID int) error {
+	_, err := tx.ExecContext(ctx, `SELECT id FROM favorite_collections WHERE id = $1 FOR UPDATE`, collectionID)
+	return err
+}
+
+// applyChanges merges changes into the default collection last-write-wins
+// and returns the added post IDs that don't exist
+func applyChanges(ctx context.Context, tx *sql.Tx, userID, collectionID int, changes []SyncChange) ([]int, error) {
+	if len(changes) == 0 {
+		return []int{}, nil
+	}
+
+	ids := make([]int, 0, len(changes))
+	for _, c := range changes {
+		ids = append(ids, c.PostID)
+	}
+
+	existing, err := existingPosts(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := loadSyncStates(ctx, tx, userID, collectionID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	rejected := mergeChanges(states, existing, changes, time.Now())
+
+	for postID, s := range states {
+		if !s.dirty {
+			continue
+		}
+		if s.present {
+			err = saveSyncedItem(ctx, tx, userID, collectionID, postID, s.at)
+		} else {
+			err = saveTombstone(ctx, tx, userID, collectionID, postID, s.at)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rejected, nil
+}
+
+// mergeChanges replays changes oldest first onto the stored state of each
+// post and marks the states it changes dirty. The latest change wins and a
+// remove beats an add at the same time; changes without a time or from the
+// future count as now. Adds of posts missing from existing are skipped and
+// returned, each once.
+func mergeChanges(states map[int]*syncState, existing map[int]bool, changes []SyncChange, now time.Time) []int {
+	changes = append([]SyncChange(nil), changes...)
+	for i := range changes {
+		if changes[i].At.IsZero() || changes[i].At.After(now) {
+			changes[i].At = now
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].At.Before(changes[j].At) })
+
+	rejected := []int{}
+	seenRejected := map[int]bool{}
+	for _, c := range changes {
+		s := states[c.PostID]
+		if s == nil {
+			s = &syncState{}
+			states[c.PostID] = s
+		}
+
+		switch c.Op {
+		case SyncAdd:
+			if !existing[c.PostID] {
+				if !seenRejected[c.PostID] {
+					seenRejected[c.PostID] = true
+					rejected = append(rejected, c.PostID)
+				}
+				continue
+			}
+			if s.known && !s.present && !c.At.After(s.at) {
+				continue // removed at the same time or later
+			}
+			if !s.present || c.At.After(s.at) {
+				s.present, s.at, s.known, s.dirty = true, c.At, true, true
+			}
+		case SyncRemove:
+			if s.known && s.present && s.at.After(c.At) {
+				continue // added again later
+			}
+			if s.present || !s.known || c.At.After(s.at) {
+				s.present, s.at, s.known, s.dirty = false, c.At, true, true
+			}
+		}
+	}
+
+	return rejected
+}
+
+// existingPosts reports which of the post IDs exist
+func existingPosts(ctx context.Context, tx *sql.Tx, postIDs []int) (map[int]bool, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM posts WHERE id = ANY($1::int[])`, intArray(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		existing[id] = true
+	}
+
+	return existing, rows.Err()
+}
+
+// loadSyncStates reads the items and tombstones of the given posts
+func loadSyncStates(ctx context.Context, tx *sql.Tx, userID, collectionID int, postIDs []int) (map[int]*syncState, error) {
+	query := `
+		SELECT post_id, TRUE, changed_at FROM favorite_collection_items
+		WHERE collection_id = $1 AND post_id = ANY($3::int[])
+		UNION ALL
+		SELECT post_id, FALSE, deleted_at FROM favorite_tombstones
+		WHERE user_id = $2 AND post_id = ANY($3::int[])
+	`
+
+	rows, err := tx.QueryContext(ctx, query, collectionID, userID, intArray(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := map[int]*syncState{}
+	for rows.Next() {
+		var postID int
+		var present bool
+		var at time.Time
+		if err := rows.Scan(&postID, &present, &at); err != nil {
+			return nil, err
+		}
+		// An item wins over a leftover tombstone of the same post
+		if s, ok := states[postID]; ok && s.present {
+			continue
+		}
+		states[postID] = &syncState{present: present, at: at, known: true}
+	}
+
+	return states, rows.Err()
+}
+
+// saveSyncedItem puts a post in the default collection, or moves its change
+// time forward if it is already there
+func saveSyncedItem(ctx context.Context, tx *sql.Tx, userID, collectionID, postID int, at time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO favorite_collection_items (collection_id, post_id, position, changed_at)
+		SELECT $1::int, $2::int, COALESCE(MAX(position), 0) + 1, $3
+		FROM favorite_collection_items
+		WHERE collection_id = $1
+		ON CONFLICT (collection_id, post_id) DO UPDATE
+			SET changed_at = GREATEST(favorite_collection_items.changed_at, EXCLUDED.changed_at)
+	`, collectionID, postID, at)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM favorite_tombstones WHERE user_id = $1 AND post_id = $2`, userID, postID)
+	return err
+}
+
+// saveTombstone takes a post out of the default collection and records when
+func saveTombstone(ctx context.Context, tx *sql.Tx, userID, collectionID, postID int, at time.Time) error {
+	_, err := tx.ExecContext(ctx,
+		`DELETE FROM favorite_collection_items WHERE collection_id = $1 AND post_id = $2`, collectionID, postID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO favorite_tombstones (user_id, post_id, deleted_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, post_id) DO UPDATE
+			SET deleted_at = GREATEST(favorite_tombstones.deleted_at, EXCLUDED.deleted_at),
+				sync_seq = nextval('favorite_sync_seq')
+	`, userID, postID, at)
+	return err
+}
+
+// touchDefault keeps tombstones in step when a post is added to or removed
+// from a collection outside of sync. It does nothing unless the collection
+// is a default one.
+func touchDefault(ctx context.Context, tx *sql.Tx, collectionID, postID int, present bool) error {
+	var userID int
+	err := tx.QueryRowContext(ctx,
+		`SELECT user_id FROM favorite_collections WHERE id = $1 AND is_default`, collectionID).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if present {
+		_, err = tx.ExecContext(ctx,
+			`DELETE FROM favorite_tombstones WHERE user_id = $1 AND post_id = $2`, userID, postID)
+		return err
+	}
+	return saveTombstone(ctx, tx, userID, collectionID, postID, time.Now())
+}
+
+// readSyncState returns the whole default collection, the tombstones newer
+// than cursor and the cursor that covers both
+func readSyncState(ctx context.Context, tx *sql.Tx, userID, collectionID int, cursor int64) (*SyncResult, error) {
+	result := &SyncResult{
+		Favorites: []SyncedFavorite{},
+		Removed:   []SyncedRemoval{},
+		Cursor:    cursor,
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT post_id, changed_at, sync_seq FROM favorite_collection_items
+		WHERE collection_id = $1
+		ORDER BY created_at DESC, post_id
+	`, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fav SyncedFavorite
+		var seq int64
+		if err := rows.Scan(&fav.PostID, &fav.ChangedAt, &seq); err != nil {
+			return nil, err
+		}
+		result.Favorites = append(result.Favorites, fav)
+		result.Cursor = max(result.Cursor, seq)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tombstones, err := tx.QueryContext(ctx, `
+		SELECT post_id, deleted_at, sync_seq FROM favorite_tombstones
+		WHERE user_id = $1 AND sync_seq > $2
+		ORDER BY sync_seq
+	`, userID, cursor)
+	if err != nil {
+		return nil, err
+	}
+	defer tombstones.Close()
+
+	for tombstones.Next() {
+		var removal SyncedRemoval
+		var seq int64
+		if err := tombstones.Scan(&removal.PostID, &removal.RemovedAt, &seq); err != nil {
+			return nil, err
+		}
+		result.Removed = append(result.Removed, removal)
+		result.Cursor = max(result.Cursor, seq)
+	}
+
+	return result, tombstones.Err()
+}
+
+// intArray formats IDs as a Postgres array literal for $n::int[]
+func intArray(ids []int) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
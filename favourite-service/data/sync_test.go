@@ -0,0 +1,145 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeChanges(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return now.Add(time.Duration(minutes) * time.Minute) }
+	add := func(postID, minutes int) SyncChange { return SyncChange{PostID: postID, Op: SyncAdd, At: at(minutes)} }
+	remove := func(postID, minutes int) SyncChange {
+		return SyncChange{PostID: postID, Op: SyncRemove, At: at(minutes)}
+	}
+
+	// want is the state of post 1 afterwards; nil when nothing is written
+	type state struct {
+		present bool
+		at      time.Time
+	}
+
+	tests := []struct {
+		name         string
+		stored       *syncState
+		changes      []SyncChange
+		want         *state
+		wantRejected []int
+	}{
+		{
+			name:    "add of a new favorite",
+			changes: []SyncChange{add(1, -5)},
+			want:    &state{true, at(-5)},
+		},
+		{
+			name:    "later remove beats an earlier add",
+			changes: []SyncChange{add(1, -5), remove(1, -3)},
+			want:    &state{false, at(-3)},
+		},
+		{
+			name:    "changes are replayed by time, not by order",
+			changes: []SyncChange{remove(1, -3), add(1, -5)},
+			want:    &state{false, at(-3)},
+		},
+		{
+			name:    "later add beats an earlier remove",
+			changes: []SyncChange{remove(1, -5), add(1, -3)},
+			want:    &state{true, at(-3)},
+		},
+		{
+			name:    "remove wins a tie after the add",
+			changes: []SyncChange{add(1, -5), remove(1, -5)},
+			want:    &state{false, at(-5)},
+		},
+		{
+			name:    "remove wins a tie before the add",
+			changes: []SyncChange{remove(1, -5), add(1, -5)},
+			want:    &state{false, at(-5)},
+		},
+		{
+			name:    "stored remove wins a tie with a client add",
+			stored:  &syncState{present: false, at: at(-5), known: true},
+			changes: []SyncChange{add(1, -5)},
+		},
+		{
+			name:    "client remove wins a tie with a stored add",
+			stored:  &syncState{present: true, at: at(-5), known: true},
+			changes: []SyncChange{remove(1, -5)},
+			want:    &state{false, at(-5)},
+		},
+		{
+			name:    "stale client add loses to a newer stored remove",
+			stored:  &syncState{present: false, at: at(-2), known: true},
+			changes: []SyncChange{add(1, -5)},
+		},
+		{
+			name:    "stale client remove loses to a newer stored add",
+			stored:  &syncState{present: true, at: at(-2), known: true},
+			changes: []SyncChange{remove(1, -5)},
+		},
+		{
+			name:    "newer client add refreshes a stored add",
+			stored:  &syncState{present: true, at: at(-5), known: true},
+			changes: []SyncChange{add(1, -2)},
+			want:    &state{true, at(-2)},
+		},
+		{
+			name:    "older client add leaves a stored add alone",
+			stored:  &syncState{present: true, at: at(-2), known: true},
+			changes: []SyncChange{add(1, -5)},
+		},
+		{
+			name:    "future times count as now",
+			stored:  &syncState{present: true, at: at(-1), known: true},
+			changes: []SyncChange{remove(1, 60)},
+			want:    &state{false, now},
+		},
+		{
+			name:    "missing times count as now",
+			changes: []SyncChange{{PostID: 1, Op: SyncAdd}},
+			want:    &state{true, now},
+		},
+		{
+			name:         "adds of missing posts are rejected once",
+			changes:      []SyncChange{add(2, -5), add(2, -4), add(1, -3)},
+			want:         &state{true, at(-3)},
+			wantRejected: []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			states := map[int]*syncState{}
+			if tt.stored != nil {
+				stored := *tt.stored
+				states[1] = &stored
+			}
+			existing := map[int]bool{1: true}
+
+			rejected := mergeChanges(states, existing, tt.changes, now)
+
+			wantRejected := tt.wantRejected
+			if wantRejected == nil {
+				wantRejected = []int{}
+			}
+			if !reflect.DeepEqual(rejected, wantRejected) {
+				t.Errorf("rejected = %v, want %v", rejected, wantRejected)
+			}
+
+			s := states[1]
+			if tt.want == nil {
+				if s != nil && s.dirty {
+					t.Errorf("post 1 written as present=%v at %v, want untouched", s.present, s.at)
+				}
+				return
+			}
+			if s == nil || !s.dirty {
+				t.Fatalf("post 1 not written, want present=%v at %v", tt.want.present, tt.want.at)
+			}
+			if s.present != tt.want.present || !s.at.Equal(tt.want.at) {
+				t.Errorf("post 1 = present=%v at %v, want present=%v at %v", s.present, s.at, tt.want.present, tt.want.at)
+			}
+		})
+	}
+}
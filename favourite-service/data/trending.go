@@ -0,0 +1,166 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// Trending windows
+const (
+	WindowDay  = "day"
+	WindowWeek = "week"
+)
+
+// trendingWindows maps a window to its score and add-count columns
+var trendingWindows = map[string]struct{ score, adds string }{
+	WindowDay:  {"score_day", "adds_day"},
+	WindowWeek: {"score_week", "adds_week"},
+}
+
+// ValidWindow reports whether Top can rank by window
+func ValidWindow(window string) bool {
+	_, ok := trendingWindows[window]
+	return ok
+}
+
+// refreshLockKey keeps replicas from rebuilding the rollup at the same time
+const refreshLockKey = 7_320_117_038
+
+// Trending reads and rebuilds the favorite_post_stats rollup
+type Trending struct{}
+
+// TrendingPost is a post's favorite count and trending score in a window
+type TrendingPost struct {
+	PostID        int     `json:"postId"`
+	Neighborhood  string  `json:"neighborhood"`
+	FavoriteCount int     `json:"favoriteCount"`
+	RecentAdds    int     `json:"recentAdds"`
+	Score         float64 `json:"score"`
+}
+
+// Refresh rebuilds the rollup from the favorites view. Adds in the last day
+// are weighted with a 6 hour half-life and adds in the last week with a 2 day
+// one. It reports false when another replica is already refreshing.
+func (t *Trending) Refresh() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, refreshLockKey).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+
+	now := time.Now()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO favorite_post_stats
+			(post_id, neighborhood, favorite_count, adds_day, adds_week, score_day, score_week, refreshed_at)
+		SELECT f.post_id, p.neighborhood, COUNT(*),
+			COUNT(*) FILTER (WHERE f.created_at > $1::timestamptz - INTERVAL '1 day'),
+			COUNT(*) FILTER (WHERE f.created_at > $1::timestamptz - INTERVAL '7 days'),
+			COALESCE(SUM(POWER(0.5, EXTRACT(EPOCH FROM $1::timestamptz - f.created_at) / 21600))
+				FILTER (WHERE f.created_at > $1::timestamptz - INTERVAL '1 day'), 0),
+			COALESCE(SUM(POWER(0.5, EXTRACT(EPOCH FROM $1::timestamptz - f.created_at) / 172800))
+				FILTER (WHERE f.created_at > $1::timestamptz - INTERVAL '7 days'), 0),
+			$1
+		FROM favorites f
+		JOIN posts p ON p.id = f.post_id
+		GROUP BY f.post_id, p.neighborhood
+		ON CONFLICT (post_id) DO UPDATE SET
+			neighborhood = EXCLUDED.neighborhood,
+			favorite_count = EXCLUDED.favorite_count,
+			adds_day = EXCLUDED.adds_day,
+			adds_week = EXCLUDED.adds_week,
+			score_day = EXCLUDED.score_day,
+			score_week = EXCLUDED.score_week,
+			refreshed_at = EXCLUDED.refreshed_at
+	`, now)
+	if err != nil {
+		return false, err
+	}
+
+	// Posts nobody has favorited any more
+	_, err = tx.ExecContext(ctx, `DELETE FROM favorite_post_stats WHERE refreshed_at < $1`, now)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Top returns the published posts with the highest trending score in the
+// window, optionally limited to one neighborhood. Posts without adds in the
+// window are left out.
+func (t *Trending) Top(window, neighborhood string, limit int) ([]*TrendingPost, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	cols, ok := trendingWindows[window]
+	if !ok {
+		cols = trendingWindows[WindowWeek]
+	}
+
+	query := `
+		SELECT s.post_id, s.neighborhood, s.favorite_count, s.` + cols.adds + `, s.` + cols.score + `
+		FROM favorite_post_stats s
+		JOIN posts p ON p.id = s.post_id AND p.status = 'published'
+		WHERE s.` + cols.score + ` > 0 AND ($1 = '' OR s.neighborhood = $1)
+		ORDER BY s.` + cols.score + ` DESC, s.favorite_count DESC, s.post_id DESC
+		LIMIT $2
+	`
+
+	rows, err := db.QueryContext(ctx, query, neighborhood, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*TrendingPost
+	for rows.Next() {
+		var tp TrendingPost
+		if err := rows.Scan(&tp.PostID, &tp.Neighborhood, &tp.FavoriteCount, &tp.RecentAdds, &tp.Score); err != nil {
+			return nil, err
+		}
+		posts = append(posts, &tp)
+	}
+
+	return posts, rows.Err()
+}
+
+// Counts returns the favorite count of each post as of the last refresh.
+// Posts nobody favorited are included with zero.
+func (t *Trending) Counts(postIDs []int) (map[int]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	counts := make(map[int]int, len(postIDs))
+	for _, id := range postIDs {
+		counts[id] = 0
+	}
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT post_id, favorite_count FROM favorite_post_stats WHERE post_id = ANY($1::int[])`, intArray(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID, count int
+		if err := rows.Scan(&postID, &count); err != nil {
+			return nil, err
+		}
+		counts[postID] = count
+	}
+
+	return counts, rows.Err()
+}
@@ -19,3 +19,7 @@ require (
 	golang.org/x/crypto v0.20.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
+
+require migrate v0.0.0
+
+replace migrate => ../migrate
@@ -0,0 +1,23 @@
+-- Back to the flat table; everything saved in any collection is kept
+CREATE TABLE favorites_flat AS SELECT user_id, post_id, created_at FROM favorites;
+
+DROP VIEW favorites;
+
+CREATE TABLE favorites (
+    user_id     INTEGER NOT NULL,
+    post_id     INTEGER NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (user_id, post_id),
+    CONSTRAINT fk_favorites_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_favorites_post FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_favorites_user_id ON favorites(user_id);
+CREATE INDEX IF NOT EXISTS idx_favorites_post_id ON favorites(post_id);
+
+INSERT INTO favorites (user_id, post_id, created_at)
+SELECT user_id, post_id, created_at FROM favorites_flat;
+
+DROP TABLE favorites_flat;
+DROP TABLE favorite_collection_items;
+DROP TABLE favorite_collections;
@@ -0,0 +1,46 @@
+-- Named lists of saved posts. Every user has one default collection, which
+-- is what the heart button and the flat /favorites endpoints work on.
+CREATE TABLE favorite_collections (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    share_token VARCHAR(64) UNIQUE, -- set while the collection is shared read-only
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_favorite_collections_user_id ON favorite_collections(user_id);
+CREATE UNIQUE INDEX idx_favorite_collections_default ON favorite_collections(user_id) WHERE is_default;
+
+CREATE TABLE favorite_collection_items (
+    collection_id INTEGER NOT NULL REFERENCES favorite_collections(id) ON DELETE CASCADE,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    note TEXT NOT NULL DEFAULT '',
+    tags JSONB NOT NULL DEFAULT '[]', -- ["quiet", "near campus"]
+    position INTEGER NOT NULL DEFAULT 0, -- manual sort order within the collection
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (collection_id, post_id)
+);
+
+CREATE INDEX idx_favorite_collection_items_post_id ON favorite_collection_items(post_id);
+
+-- Existing favorites become each user's default collection, oldest first
+INSERT INTO favorite_collections (user_id, name, is_default)
+SELECT DISTINCT user_id, 'Favorites', TRUE FROM favorites;
+
+INSERT INTO favorite_collection_items (collection_id, post_id, position, created_at, updated_at)
+SELECT c.id, f.post_id, ROW_NUMBER() OVER (PARTITION BY f.user_id ORDER BY f.created_at, f.post_id), f.created_at, f.created_at
+FROM favorites f
+JOIN favorite_collections c ON c.user_id = f.user_id AND c.is_default;
+
+DROP TABLE favorites;
+
+-- Who saved which post, in any collection. Read by subscriber lookups and
+-- favorite stats; a post counts once per user.
+CREATE VIEW favorites AS
+SELECT c.user_id, i.post_id, MIN(i.created_at) AS created_at
+FROM favorite_collection_items i
+JOIN favorite_collections c ON c.id = i.collection_id
+GROUP BY c.user_id, i.post_id;
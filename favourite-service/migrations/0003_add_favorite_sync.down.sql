@@ -0,0 +1,4 @@
+DROP TABLE favorite_tombstones;
+DROP INDEX idx_favorite_collection_items_sync;
+ALTER TABLE favorite_collection_items DROP COLUMN sync_seq, DROP COLUMN changed_at;
+DROP SEQUENCE favorite_sync_seq;
@@ -0,0 +1,27 @@
+-- Change numbers for favorites sync. Every add to and remove from a default
+-- collection takes the next value, and a client's cursor is the highest one
+-- it has seen.
+CREATE SEQUENCE favorite_sync_seq;
+
+-- changed_at is the client's clock for the last add, compared last-write-wins
+-- against removes of the same post
+ALTER TABLE favorite_collection_items
+    ADD COLUMN changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    ADD COLUMN sync_seq BIGINT NOT NULL DEFAULT nextval('favorite_sync_seq');
+
+UPDATE favorite_collection_items SET changed_at = created_at WHERE created_at IS NOT NULL;
+
+CREATE INDEX idx_favorite_collection_items_sync ON favorite_collection_items(collection_id, sync_seq);
+
+-- Favorites removed from a default collection. A tombstone stops an older
+-- add from another device bringing the post back, and tells clients with an
+-- older cursor to drop it.
+CREATE TABLE favorite_tombstones (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id INTEGER NOT NULL, -- no foreign key: the tombstone outlives the post
+    deleted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    sync_seq BIGINT NOT NULL DEFAULT nextval('favorite_sync_seq'),
+    PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX idx_favorite_tombstones_sync ON favorite_tombstones(user_id, sync_seq);
@@ -0,0 +1,17 @@
+-- Favorite counts and trending scores per post, rebuilt every few minutes
+-- from the favorites view by favourite-service. Scores add up the favorites
+-- added within the window, each weighted by half for every half-life of age.
+CREATE TABLE favorite_post_stats (
+    post_id INTEGER PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+    neighborhood VARCHAR(255) NOT NULL,
+    favorite_count INTEGER NOT NULL DEFAULT 0,
+    adds_day INTEGER NOT NULL DEFAULT 0,
+    adds_week INTEGER NOT NULL DEFAULT 0,
+    score_day DOUBLE PRECISION NOT NULL DEFAULT 0,
+    score_week DOUBLE PRECISION NOT NULL DEFAULT 0,
+    refreshed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_favorite_post_stats_day ON favorite_post_stats(score_day DESC) WHERE score_day > 0;
+CREATE INDEX idx_favorite_post_stats_week ON favorite_post_stats(score_week DESC) WHERE score_week > 0;
+CREATE INDEX idx_favorite_post_stats_neighborhood ON favorite_post_stats(neighborhood, score_week DESC);
@@ -0,0 +1 @@
+DROP TABLE favorite_collection_members;
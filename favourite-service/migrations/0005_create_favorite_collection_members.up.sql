@@ -0,0 +1,11 @@
+-- Roommates a collection is shared with for editing. Items saved by members
+-- still belong to the owner's collection.
+CREATE TABLE favorite_collection_members (
+    collection_id INTEGER NOT NULL REFERENCES favorite_collections(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    added_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (collection_id, user_id)
+);
+
+CREATE INDEX idx_favorite_collection_members_user_id ON favorite_collection_members(user_id);
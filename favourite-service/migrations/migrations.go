@@ -0,0 +1,9 @@
+// Package migrations embeds the favourite service's schema migrations
+package migrations
+
+import "embed"
+
+// FS holds the <version>_<name>.(up|down).sql files
+//
+//go:embed *.sql
+var FS embed.FS
@@ -6,21 +6,38 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+const (
+	// maxDeliveryAttempts is how often a failing app event is tried before
+	// it is moved to deadLetterQueue
+	maxDeliveryAttempts = 5
+	// deadLetterQueue keeps app events that kept failing for inspection
+	deadLetterQueue = "app_events_dead"
+	// attemptsHeader counts the failed deliveries of a retried event
+	attemptsHeader = "x-attempts"
+	// routingKeyHeader keeps the original routing key of a retried event,
+	// which is republished straight to the queue
+	routingKeyHeader = "x-routing-key"
+)
+
 // Consumer handles consuming messages from RabbitMQ
 type Consumer struct {
 	conn      *amqp.Connection
 	queueName string
+	handled   *HandledMessages
 }
 
-// NewConsumer creates a new consumer instance
-func NewConsumer(conn *amqp.Connection) (Consumer, error) {
+// NewConsumer creates a new consumer instance. handled may be nil, in which
+// case redelivered app events are handled again.
+func NewConsumer(conn *amqp.Connection, handled *HandledMessages) (Consumer, error) {
 	consumer := Consumer{
-		conn: conn,
+		conn:    conn,
+		handled: handled,
 	}
 
 	err := consumer.setup()
@@ -50,9 +67,18 @@ type Payload struct {
 
 // MailPayload represents an email message
 type MailPayload struct {
-	To      string `json:"to"`
-	Subject string `json:"subject"`
-	Message string `json:"message"`
+	To          string            `json:"to"`
+	Subject     string            `json:"subject"`
+	Message     string            `json:"message"`
+	Attachments []MailAttachment  `json:"attachments,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+// MailAttachment is a file sent along with a mail; Data is base64 in JSON
+type MailAttachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Data        []byte `json:"data"`
 }
 
 // VerificationMailPayload represents a verification email
@@ -126,8 +152,8 @@ func (consumer *Consumer) ListenForAppEvents() error {
 		return err
 	}
 
-	// Bind mail topics
-	mailTopics := []string{"mail.*", "notification.*"}
+	// Bind mail, notification and post topics
+	mailTopics := []string{"mail.*", "notification.*", RoutingPostPriceChanged}
 	for _, topic := range mailTopics {
 		err = ch.QueueBind(
 			q.Name,      // queue name
@@ -155,32 +181,33 @@ func (consumer *Consumer) ListenForAppEvents() error {
 		return err
 	}
 
+	// Events that failed too often are parked here instead of requeued
+	if _, err := declareDurableQueue(ch, deadLetterQueue); err != nil {
+		return err
+	}
+
 	forever := make(chan bool)
 
 	go func() {
 		for d := range messages {
-			log.Printf("Received app event with routing key: %s", d.RoutingKey)
-
-			var err error
-			switch d.RoutingKey {
-			case RoutingMailSend:
-				err = handleMailEvent(d.Body)
-			case RoutingMailVerification:
-				err = handleVerificationMailEvent(d.Body)
-			case RoutingMailPasswordReset:
-				err = handleVerificationMailEvent(d.Body)
-			default:
-				log.Printf("Unknown routing key: %s", d.RoutingKey)
+			routingKey := eventRoutingKey(d)
+			log.Printf("Received app event with routing key: %s", routingKey)
+
+			// The outbox delivers at least once; don't mail the same event twice
+			if consumer.handled.Seen(d.MessageId) {
+				log.Printf("App event %s was already handled, skipping", d.MessageId)
+				d.Ack(false)
+				continue
 			}
 
-			if err != nil {
+			if err := handleAppEvent(routingKey, d.Body); err != nil {
 				log.Printf("Error handling event: %v", err)
-				// Negative acknowledgment - requeue the message
-				d.Nack(false, true)
-			} else {
-				// Positive acknowledgment
-				d.Ack(false)
+				go retryAppEvent(ch, q.Name, routingKey, d)
+				continue
 			}
+
+			consumer.handled.Remember(d.MessageId)
+			d.Ack(false)
 		}
 	}()
 
@@ -190,6 +217,93 @@ func (consumer *Consumer) ListenForAppEvents() error {
 	return nil
 }
 
+// handleAppEvent hands an app event to the handler of its routing key
+func handleAppEvent(routingKey string, body []byte) error {
+	switch routingKey {
+	case RoutingMailSend:
+		return handleMailEvent(body)
+	case RoutingMailVerification:
+		return handleVerificationMailEvent(body)
+	case RoutingMailPasswordReset:
+		return handleVerificationMailEvent(body)
+	case RoutingPostPriceChanged:
+		return handlePriceChangedEvent(body)
+	case RoutingNotification:
+		return handleNotificationEvent(body)
+	}
+
+	// Every notification.* event may carry an address to mail;
+	// notification-service stores them all for the in-app inbox
+	if strings.HasPrefix(routingKey, "notification.") {
+		return handleNotificationEvent(body)
+	}
+
+	log.Printf("Unknown routing key: %s", routingKey)
+	return nil
+}
+
+// eventRoutingKey returns the routing key an event was published with,
+// which retried events carry in a header
+func eventRoutingKey(d amqp.Delivery) string {
+	if key, ok := d.Headers[routingKeyHeader].(string); ok && key != "" {
+		return key
+	}
+	return d.RoutingKey
+}
+
+// deliveryAttempts returns how many times an event has failed so far
+func deliveryAttempts(d amqp.Delivery) int {
+	switch n := d.Headers[attemptsHeader].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// retryAppEvent puts a failed event back on the queue with its attempt
+// count raised, after a delay that grows with every attempt. Once it has
+// failed maxDeliveryAttempts times it goes to deadLetterQueue instead, so a
+// message no handler can process doesn't loop forever. The delivery is only
+// acked once its copy is published.
+func retryAppEvent(ch *amqp.Channel, queue, routingKey string, d amqp.Delivery) {
+	attempts := deliveryAttempts(d) + 1
+
+	target := queue
+	if attempts >= maxDeliveryAttempts {
+		log.Printf("Moving %s event %s to %s after %d attempts", routingKey, d.MessageId, deadLetterQueue, attempts)
+		target = deadLetterQueue
+	} else {
+		time.Sleep(time.Duration(attempts*attempts) * time.Second)
+	}
+
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[attemptsHeader] = int32(attempts)
+	headers[routingKeyHeader] = routingKey
+
+	err := ch.Publish("", target, false, false, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  d.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    d.MessageId,
+		Timestamp:    d.Timestamp,
+		Body:         d.Body,
+	})
+	if err != nil {
+		log.Printf("Error requeueing %s event: %v", routingKey, err)
+		d.Nack(false, true)
+		return
+	}
+
+	d.Ack(false)
+}
+
 // handlePayload processes log events
 func handlePayload(payload Payload) {
 	switch payload.Name {
@@ -244,6 +358,42 @@ func handleVerificationMailEvent(body []byte) error {
 	})
 }
 
+// NotificationPayload is a message for one user. Email is set when the
+// publisher knows the address.
+type NotificationPayload struct {
+	UserID  int    `json:"user_id"`
+	Email   string `json:"email,omitempty"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Type    string `json:"type"`
+
+	Attachments []MailAttachment  `json:"attachments,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+// handleNotificationEvent delivers a notification by mail when it carries
+// an address; others are only logged
+func handleNotificationEvent(body []byte) error {
+	var n NotificationPayload
+	if err := json.Unmarshal(body, &n); err != nil {
+		return err
+	}
+
+	if n.Email == "" {
+		log.Printf("Notification for user %d (%s) has no email, skipping mail", n.UserID, n.Type)
+		return nil
+	}
+
+	log.Printf("Mailing %s notification to user %d", n.Type, n.UserID)
+	return sendMailToService(MailPayload{
+		To:          n.Email,
+		Subject:     n.Title,
+		Message:     n.Message,
+		Attachments: n.Attachments,
+		Headers:     n.Headers,
+	})
+}
+
 // sendMailToService sends the mail via HTTP to mailer-service
 func sendMailToService(mail MailPayload) error {
 	jsonData, err := json.Marshal(mail)
@@ -16,6 +16,7 @@ const (
 	RoutingMailVerification  = "mail.verification"
 	RoutingMailPasswordReset = "mail.password_reset"
 	RoutingNotification      = "notification.send"
+	RoutingPostPriceChanged  = "post.price_changed"
 )
 
 // declareExchange declares the logs exchange
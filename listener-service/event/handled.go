@@ -0,0 +1,61 @@
+package event
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// handledTTL is how long a handled message ID is remembered. The outbox
+// redelivers within minutes, so a week is plenty.
+const handledTTL = 7 * 24 * time.Hour
+
+// HandledMessages remembers the IDs of app events that were handled so a
+// redelivered event isn't mailed twice. Events without a message ID can't
+// be told apart and are always handled. A nil store, or one whose Redis is
+// unreachable, remembers nothing.
+type HandledMessages struct {
+	rdb *redis.Client
+}
+
+// NewHandledMessages keeps handled message IDs in Redis
+func NewHandledMessages(rdb *redis.Client) *HandledMessages {
+	return &HandledMessages{rdb: rdb}
+}
+
+func handledKey(messageID string) string {
+	return "listener:handled:" + messageID
+}
+
+// Seen reports whether the event with this message ID was handled already
+func (h *HandledMessages) Seen(messageID string) bool {
+	if h == nil || h.rdb == nil || messageID == "" {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	n, err := h.rdb.Exists(ctx, handledKey(messageID)).Result()
+	if err != nil {
+		log.Printf("Error checking handled message %s: %v", messageID, err)
+		return false
+	}
+	return n > 0
+}
+
+// Remember records that the event with this message ID was handled
+func (h *HandledMessages) Remember(messageID string) {
+	if h == nil || h.rdb == nil || messageID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := h.rdb.Set(ctx, handledKey(messageID), "1", handledTTL).Err(); err != nil {
+		log.Printf("Error recording handled message %s: %v", messageID, err)
+	}
+}
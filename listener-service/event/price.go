@@ -0,0 +1,94 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// PriceChangedPayload is published by post-service when a post's price changes
+type PriceChangedPayload struct {
+	PostID    int       `json:"post_id"`
+	AuthorID  int       `json:"author_id"`
+	Title     string    `json:"title"`
+	OldPrice  float64   `json:"old_price"`
+	NewPrice  float64   `json:"new_price"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Subscriber is a user who favorited a post
+type Subscriber struct {
+	UserID    int    `json:"userId"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+}
+
+// handlePriceChangedEvent emails everyone who favorited a post when its
+// price drops. Price increases are acknowledged without notifying anyone.
+func handlePriceChangedEvent(body []byte) error {
+	var change PriceChangedPayload
+	if err := json.Unmarshal(body, &change); err != nil {
+		return err
+	}
+
+	if change.NewPrice >= change.OldPrice {
+		log.Printf("Post %d price went up (%.2f -> %.2f), no notification", change.PostID, change.OldPrice, change.NewPrice)
+		return nil
+	}
+
+	subscribers, err := getPostSubscribers(change.PostID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Post %d dropped %.2f -> %.2f, notifying %d subscribers", change.PostID, change.OldPrice, change.NewPrice, len(subscribers))
+
+	// A failed recipient is logged rather than returned: requeueing the
+	// event would re-send the mail to everyone who already got it
+	for _, s := range subscribers {
+		if s.UserID == change.AuthorID {
+			continue
+		}
+
+		err := sendMailToService(MailPayload{
+			To:      s.Email,
+			Subject: fmt.Sprintf("Price drop: %s", change.Title),
+			Message: fmt.Sprintf("Hello %s,\n\nGood news! A listing you saved just got cheaper.\n\n%s\nWas: $%.2f\nNow: $%.2f\n\nOpen DWELL to take another look before it's gone.",
+				s.FirstName, change.Title, change.OldPrice, change.NewPrice),
+		})
+		if err != nil {
+			log.Printf("Error sending price drop mail to user %d: %v", s.UserID, err)
+		}
+	}
+
+	return nil
+}
+
+// getPostSubscribers asks favourite-service who favorited a post
+func getPostSubscribers(postID int) ([]Subscriber, error) {
+	url := fmt.Sprintf("http://favourite-service/favorites/post/%d/subscribers", postID)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("favourite service returned status: %d", response.StatusCode)
+	}
+
+	var payload struct {
+		Error   bool         `json:"error"`
+		Message string       `json:"message"`
+		Data    []Subscriber `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	return payload.Data, nil
+}
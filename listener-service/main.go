@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"listener/event"
 	"log"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
@@ -22,8 +24,11 @@ func main() {
 
 	log.Println("Connected to RabbitMQ! Starting listeners...")
 
+	// Handled app events are remembered in Redis so redeliveries are skipped
+	handled := event.NewHandledMessages(connectToRedis())
+
 	// Create consumer
-	consumer, err := event.NewConsumer(rabbitConn)
+	consumer, err := event.NewConsumer(rabbitConn, handled)
 	if err != nil {
 		panic(err)
 	}
@@ -41,7 +46,7 @@ func main() {
 	go func() {
 		log.Println("Starting app events listener...")
 		// Need a new consumer for the second listener
-		appConsumer, err := event.NewConsumer(rabbitConn)
+		appConsumer, err := event.NewConsumer(rabbitConn, handled)
 		if err != nil {
 			log.Printf("Error creating app consumer: %v", err)
 			return
@@ -89,3 +94,27 @@ func connect() (*amqp.Connection, error) {
 
 	return connection, nil
 }
+
+// connectToRedis connects to the Redis at REDIS_ADDR. It returns nil when
+// Redis isn't reachable, and events are then not deduplicated.
+func connectToRedis() *redis.Client {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "redis:6379"
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		log.Printf("Redis not available, redelivered events won't be skipped: %v", err)
+		return nil
+	}
+
+	log.Println("Connected to Redis!")
+	return rdb
+}
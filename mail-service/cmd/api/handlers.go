@@ -23,6 +23,12 @@ func (app *Config) SendMail(w http.ResponseWriter, r *http.Request) {
 		To      string `json:"to"`      // 收件人邮箱
 		Subject string `json:"subject"` // 邮件标题
 		Message string `json:"message"` // 邮件正文
+
+		// 可选附件，例如 .ics 日历邀请
+		Attachments []Attachment `json:"attachments,omitempty"`
+
+		// 可选的额外邮件头，例如 List-Unsubscribe
+		Headers map[string]string `json:"headers,omitempty"`
 	}
 
 	// requestPayload 用来存放解析后的 JSON 数据
@@ -54,6 +60,9 @@ func (app *Config) SendMail(w http.ResponseWriter, r *http.Request) {
 		To:      requestPayload.To,
 		Subject: requestPayload.Subject,
 		Data:    requestPayload.Message,
+
+		Attachments: requestPayload.Attachments,
+		Headers:     requestPayload.Headers,
 	}
 
 	// =======================
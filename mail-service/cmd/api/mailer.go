@@ -35,17 +35,26 @@ type Mail struct {
 // Message 描述“一封要发送的邮件”
 // 注意：它不关心 SMTP，只关心邮件内容
 type Message struct {
-	From        string         // 发件人邮箱
-	FromName    string         // 发件人名称
-	To          string         // 收件人邮箱
-	Subject     string         // 邮件标题
-	Attachments []string       // 附件路径列表
-	Data        any            // 原始业务数据（通常是字符串或结构体）
-	DataMap     map[string]any // 专供模板渲染使用的数据
+	From        string            // 发件人邮箱
+	FromName    string            // 发件人名称
+	To          string            // 收件人邮箱
+	Subject     string            // 邮件标题
+	Attachments []Attachment      // 附件列表（内容随请求传入，不依赖本地文件）
+	Headers     map[string]string // 额外的邮件头，例如退订用的 List-Unsubscribe
+	Data        any               // 原始业务数据（通常是字符串或结构体）
+	DataMap     map[string]any    // 专供模板渲染使用的数据
 }
 
 //所有字段都会有一个零值，如果没有设置就是零值
 
+// Attachment 描述一个附件，例如看房预约的 .ics 日历文件
+// Data 在 JSON 中按 base64 编码传输（[]byte 的默认编码方式）
+type Attachment struct {
+	Name        string `json:"name"`        // 附件文件名，例如 viewing.ics
+	ContentType string `json:"contentType"` // MIME 类型，为空时按文件名推断
+	Data        []byte `json:"data"`        // 附件内容
+}
+
 // =====================================
 // SendSMTPMessage：对外的“发送邮件”接口
 // =====================================
@@ -116,10 +125,22 @@ func (m *Mail) SendSMTPMessage(msg Message) error {
 	email.AddAlternative(mail.TextHTML, formattedMessage)
 
 	// 添加附件（如果有）
-	if len(msg.Attachments) > 0 {
-		for _, x := range msg.Attachments {
-			email.AddAttachment(x)
-		}
+	for _, x := range msg.Attachments {
+		email.Attach(&mail.File{
+			Name:     x.Name,
+			MimeType: x.ContentType,
+			Data:     x.Data,
+		})
+	}
+
+	// 添加额外的邮件头（如果有）
+	for k, v := range msg.Headers {
+		email.AddHeader(k, v)
+	}
+
+	// 附件无效时 go-simple-mail 会把错误记录在 email.Error 中
+	if email.Error != nil {
+		return email.Error
 	}
 
 	// 发送邮件
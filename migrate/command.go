@@ -0,0 +1,163 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: %s migrate <command>
+
+commands:
+  status          list migrations and whether they are applied
+  up              apply all pending migrations
+  down [n]        roll back the last n migrations (default 1)
+  create <name>   add empty up/down files to the migrations directory
+`
+
+// OnStartup applies a service's pending migrations before it starts
+// serving. A failed run is tried again five seconds later, up to attempts
+// times in all, for services whose tables reference those of a service
+// that may still be creating them. MIGRATE_ON_START=false skips the run so
+// the schema can be managed with the migrate command instead.
+func OnStartup(db *sql.DB, service string, fsys fs.FS, attempts int) error {
+	if os.Getenv("MIGRATE_ON_START") == "false" {
+		log.Println("MIGRATE_ON_START=false, skipping migrations")
+		return nil
+	}
+
+	m, err := New(db, service, fsys)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		applied, err := m.Up(ctx)
+		cancel()
+
+		if err == nil {
+			log.Printf("Schema is up to date (%d migration(s) applied)", applied)
+			return nil
+		}
+		if attempt >= attempts {
+			return err
+		}
+
+		log.Printf("Migrations failed, retrying in five seconds: %v", err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// Command implements the `<binary> migrate ...` subcommand of a service and
+// returns the exit code. openDB is only called by commands that need the
+// database.
+func Command(binary, service string, fsys fs.FS, openDB func() (*sql.DB, error), args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := flags.String("dir", "migrations", "directory new migrations are created in")
+	flags.Usage = func() { fmt.Fprintf(os.Stderr, usage, binary) }
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			flags.Usage()
+			return 2
+		}
+		up, down, err := Create(*dir, args[1])
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		fmt.Printf("created %s\ncreated %s\n", up, down)
+		return 0
+	}
+
+	db, err := openDB()
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	m, err := New(db, service, fsys)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		printStatus(statuses)
+	case "up":
+		applied, err := m.Up(ctx)
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		fmt.Printf("applied %d migration(s)\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Println("down takes a positive number of migrations")
+				return 2
+			}
+		}
+		reverted, err := m.Down(ctx, steps)
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		fmt.Printf("rolled back %d migration(s)\n", reverted)
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	return 0
+}
+
+func printStatus(statuses []Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+
+	for _, s := range statuses {
+		state, appliedAt := "pending", ""
+		if s.Applied {
+			state = "applied"
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Modified {
+			state = "modified"
+		}
+		if s.Missing {
+			state = "missing"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,394 @@
+// Package migrate applies the versioned SQL migrations embedded in the
+// service binary and records them in the shared schema_history table.
+//
+// Migrations are files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql. All services share one Postgres database, so
+// every run holds the same advisory lock: replicas of a service, and
+// services starting side by side, never migrate at the same time.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockKey is the pg_advisory_lock key shared by every service's migrator
+const lockKey int64 = 7_320_117_001
+
+const createHistoryTable = `
+	create table if not exists schema_history (
+		service varchar(50) not null,
+		version bigint not null,
+		name varchar(255) not null,
+		checksum char(64) not null,
+		applied_at timestamp not null default current_timestamp,
+		duration_ms int not null default 0,
+		primary key (service, version)
+	)`
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one version of the schema
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 of Up
+}
+
+// Status describes a migration known to the source, the database or both
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+	Modified  bool       `json:"modified"` // applied, but the file changed since
+	Missing   bool       `json:"missing"`  // applied, but no longer in the source
+}
+
+// Migrator runs one service's migrations
+type Migrator struct {
+	db         *sql.DB
+	service    string
+	migrations []Migration
+}
+
+type appliedRow struct {
+	version   int64
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// New loads the migrations in fsys for the given service
+func New(db *sql.DB, service string, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, service: service, migrations: migrations}, nil
+}
+
+// Load reads and validates the migration files in the root of fsys
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %q is not named <version>_<name>.(up|down).sql", entry.Name())
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Status lists every migration, oldest first
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			s := Status{Version: mig.Version, Name: mig.Name}
+			if row, ok := applied[mig.Version]; ok {
+				s.Applied = true
+				s.AppliedAt = &row.appliedAt
+				s.Modified = row.checksum != mig.Checksum
+				delete(applied, mig.Version)
+			}
+			statuses = append(statuses, s)
+		}
+
+		for _, row := range applied {
+			appliedAt := row.appliedAt
+			statuses = append(statuses, Status{
+				Version:   row.version,
+				Name:      row.name,
+				Applied:   true,
+				AppliedAt: &appliedAt,
+				Missing:   true,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction, and returns how many were applied. It refuses to run when an
+// applied migration's file has been edited since.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if row, ok := applied[mig.Version]; ok && row.checksum != mig.Checksum {
+				return fmt.Errorf("migration %d_%s was changed after it was applied; add a new migration instead", mig.Version, mig.Name)
+			}
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// Down rolls back the last steps applied migrations, newest first, and
+// returns how many were rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	count := 0
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int64, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for _, v := range versions {
+			if count == steps {
+				break
+			}
+
+			mig, ok := m.find(v)
+			if !ok {
+				return fmt.Errorf("migration %d_%s is applied but not in this build", v, applied[v].name)
+			}
+			if strings.TrimSpace(mig.Down) == "" {
+				return fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+			}
+			if err := m.revert(ctx, conn, mig); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// Create writes empty up and down files for the next version into dir and
+// returns their paths
+func Create(dir, name string) (string, string, error) {
+	name = strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", errors.New("migration name is required")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+
+	existing, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+
+	next := int64(1)
+	if len(existing) > 0 {
+		next = existing[len(existing)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", next, name))
+	up, down := base+".up.sql", base+".down.sql"
+
+	if err := os.WriteFile(up, []byte("-- "+name+"\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(down, []byte("-- revert "+name+"\n"), 0o644); err != nil {
+		return "", "", err
+	}
+
+	return up, down, nil
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+// withLock runs fn on a single connection holding the migration lock, after
+// making sure the history table exists
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "select pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer func() {
+		// Unlock even if ctx has expired so the session doesn't keep the lock
+		if _, err := conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", lockKey); err != nil {
+			log.Printf("Releasing migration lock: %v", err)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, createHistoryTable); err != nil {
+		return fmt.Errorf("creating schema_history: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]appliedRow, error) {
+	rows, err := conn.QueryContext(ctx,
+		`select version, name, checksum, applied_at from schema_history where service = $1`, m.service)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]appliedRow{}
+	for rows.Next() {
+		var row appliedRow
+		if err := rows.Scan(&row.version, &row.name, &row.checksum, &row.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[row.version] = row
+	}
+
+	return applied, rows.Err()
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	start := time.Now()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+		return fmt.Errorf("applying %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`insert into schema_history (service, version, name, checksum, duration_ms) values ($1, $2, $3, $4, $5)`,
+		m.service, mig.Version, mig.Name, mig.Checksum, time.Since(start).Milliseconds())
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Applied migration %d_%s for %s in %s", mig.Version, mig.Name, m.service, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+		return fmt.Errorf("rolling back %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`delete from schema_history where service = $1 and version = $2`, m.service, mig.Version)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Rolled back migration %d_%s for %s", mig.Version, mig.Name, m.service)
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type jsonResponse struct {
+	Error   bool   `json:"error"`
+	Message string `json:"message,omitempty"`
+	Data    any    `json:"data,omitempty"`
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errAuthRequired = errors.New("authentication required")
+
+// requestUserID returns the caller's user ID as forwarded by the broker
+// after it validated the access token
+func requestUserID(r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// GetNotifications lists the caller's notifications, newest first.
+// ?before= continues from the last page and ?unread=true leaves out read ones.
+func (app *Config) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errAuthRequired, http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit := defaultPageSize
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			app.errorJSON(w, errors.New("invalid limit"))
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+
+	var before int64
+	if v := query.Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			app.errorJSON(w, errors.New("invalid before"))
+			return
+		}
+		before = n
+	}
+
+	unreadOnly := query.Get("unread") == "true"
+
+	notifications, err := app.Models.Notification.ListByUser(userID, before, limit, unreadOnly)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	unread, err := app.Models.Notification.UnreadCount(userID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"notifications": notifications,
+		"unread":        unread,
+	}
+	if len(notifications) == limit {
+		data["nextBefore"] = notifications[len(notifications)-1].ID
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: "Notifications retrieved",
+		Data:    data,
+	})
+}
+
+// GetUnreadCount returns how many of the caller's notifications are unread
+func (app *Config) GetUnreadCount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errAuthRequired, http.StatusUnauthorized)
+		return
+	}
+
+	unread, err := app.Models.Notification.UnreadCount(userID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: "Unread count retrieved",
+		Data:    map[string]int{"unread": unread},
+	})
+}
+
+// MarkNotificationRead marks one of the caller's notifications as read
+func (app *Config) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errAuthRequired, http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid notification id"))
+		return
+	}
+
+	found, err := app.Models.Notification.MarkRead(userID, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		app.errorJSON(w, errors.New("notification not found"), http.StatusNotFound)
+		return
+	}
+
+	app.writeUnreadCount(w, userID, "Notification marked as read")
+}
+
+// MarkAllNotificationsRead marks all of the caller's notifications as read
+func (app *Config) MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errAuthRequired, http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := app.Models.Notification.MarkAllRead(userID); err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeUnreadCount(w, userID, "Notifications marked as read")
+}
+
+// writeUnreadCount answers a mark-read request with the new unread count
+func (app *Config) writeUnreadCount(w http.ResponseWriter, userID int, message string) {
+	unread, err := app.Models.Notification.UnreadCount(userID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    map[string]int{"unread": unread},
+	})
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"database/sql"
+	"migrate"
+	"notification-service/migrations"
+	"os"
+)
+
+// serviceName identifies this service's rows in schema_history
+const serviceName = "notification-service"
+
+// migrateOnStartup applies pending migrations before the server starts.
+// Notifications reference the users table owned by the authentication service,
+// so a failed run is retried while that service creates it. Set
+// MIGRATE_ON_START=false to manage the schema with the migrate command instead.
+func migrateOnStartup(db *sql.DB) error {
+	return migrate.OnStartup(db, serviceName, migrations.FS, 10)
+}
+
+// runMigrateCommand implements `notificationApp migrate ...` and returns the exit code
+func runMigrateCommand(args []string) int {
+	return migrate.Command("notificationApp", serviceName, migrations.FS, func() (*sql.DB, error) {
+		return openDB(os.Getenv("DSN"))
+	}, args)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+)
+
+func (app *Config) routes() http.Handler {
+	mux := chi.NewRouter()
+
+	mux.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   []string{"https://*", "http://*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-TOKEN"},
+		ExposedHeaders:   []string{"Link"},
+		AllowCredentials: true,
+		MaxAge:           300,
+	}))
+
+	mux.Use(middleware.Heartbeat("/ping"))
+
+	// Notification routes (caller identified by the broker's X-User-ID)
+	mux.Get("/notifications", app.GetNotifications)
+	mux.Get("/notifications/unread-count", app.GetUnreadCount)
+	mux.Get("/notifications/stream", app.StreamNotifications)
+	mux.Post("/notifications/read-all", app.MarkAllNotificationsRead)
+	mux.Post("/notifications/{id}/read", app.MarkNotificationRead)
+
+	return mux
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"notification-service/data"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// heartbeatInterval keeps idle streams from being cut by proxies
+	heartbeatInterval = 25 * time.Second
+	// maxReplay caps how many missed notifications a reconnecting client gets
+	maxReplay = 100
+	// subscriberBuffer is how many notifications may wait for a slow client
+	// before it is disconnected
+	subscriberBuffer = 16
+)
+
+// Hub keeps the SSE clients connected to this replica, by user
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan *data.Notification]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[int]map[chan *data.Notification]struct{})}
+}
+
+// Subscribe registers a client of the user. The channel is closed when the
+// client falls too far behind.
+func (h *Hub) Subscribe(userID int) chan *data.Notification {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan *data.Notification, subscriberBuffer)
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan *data.Notification]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+
+	return ch
+}
+
+// Unsubscribe removes a client registered with Subscribe
+func (h *Hub) Unsubscribe(userID int, ch chan *data.Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[userID][ch]; !ok {
+		return
+	}
+	delete(h.subscribers[userID], ch)
+	if len(h.subscribers[userID]) == 0 {
+		delete(h.subscribers, userID)
+	}
+	close(ch)
+}
+
+// HasSubscribers reports whether the user has a client on this replica
+func (h *Hub) HasSubscribers(userID int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers[userID]) > 0
+}
+
+// Publish hands a notification to every client of its user. Clients whose
+// buffer is full are dropped; they catch up with Last-Event-ID on reconnect.
+func (h *Hub) Publish(n *data.Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[n.UserID] {
+		select {
+		case ch <- n:
+		default:
+			delete(h.subscribers[n.UserID], ch)
+			close(ch)
+		}
+	}
+	if len(h.subscribers[n.UserID]) == 0 {
+		delete(h.subscribers, n.UserID)
+	}
+}
+
+// runNotificationListener listens on the Postgres notify channel and
+// publishes each new notification to the hub, so clients are reached
+// whichever replica stored it. It reconnects whenever the connection drops.
+func (app *Config) runNotificationListener(dsn string) {
+	for {
+		err := app.listenForNotifications(dsn)
+		log.Printf("Notification listener stopped, reconnecting: %v", err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (app *Config) listenForNotifications(dsn string) error {
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+data.NotifyChannel); err != nil {
+		return err
+	}
+
+	for {
+		notice, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var created data.Created
+		if err := json.Unmarshal([]byte(notice.Payload), &created); err != nil {
+			log.Printf("Ignoring malformed %s payload: %v", data.NotifyChannel, err)
+			continue
+		}
+
+		if !app.Hub.HasSubscribers(created.UserID) {
+			continue
+		}
+
+		n, err := app.Models.Notification.GetByID(created.ID)
+		if err != nil {
+			log.Printf("Error loading notification %d: %v", created.ID, err)
+			continue
+		}
+		app.Hub.Publish(n)
+	}
+}
+
+// StreamNotifications pushes the caller's new notifications as server-sent
+// events. The stream opens with the unread count; clients reconnecting with
+// Last-Event-ID first get what they missed.
+func (app *Config) StreamNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errAuthRequired, http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.errorJSON(w, fmt.Errorf("streaming is not supported"), http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before reading the backlog so nothing stored in between is lost
+	ch := app.Hub.Subscribe(userID)
+	defer app.Hub.Unsubscribe(userID, ch)
+
+	var missed []*data.Notification
+	lastID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	if lastID > 0 {
+		var err error
+		missed, err = app.Models.Notification.ListSince(userID, lastID, maxReplay)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	unread, err := app.Models.Notification.UnreadCount(userID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: 5000\n\n")
+	writeEvent(w, "unread_count", 0, map[string]int{"unread": unread})
+	for _, n := range missed {
+		writeEvent(w, "notification", n.ID, n)
+		lastID = n.ID
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case n, ok := <-ch:
+			if !ok {
+				return
+			}
+			// Already sent from the backlog
+			if n.ID <= lastID {
+				continue
+			}
+			writeEvent(w, "notification", n.ID, n)
+			lastID = n.ID
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprintf(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes one server-sent event; id is left out when zero
+func writeEvent(w http.ResponseWriter, name string, id int64, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", name, err)
+		return
+	}
+
+	if id > 0 {
+		fmt.Fprintf(w, "id: %d\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, body)
+}
@@ -0,0 +1,208 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const dbTimeout = time.Second * 3
+
+// NotifyChannel is the Postgres channel told about every stored
+// notification, so each replica can push it to its connected clients
+const NotifyChannel = "notification_created"
+
+var db *sql.DB
+
+func New(dbPool *sql.DB) Models {
+	db = dbPool
+	return Models{
+		Notification: Notification{},
+	}
+}
+
+type Models struct {
+	Notification Notification
+}
+
+// Notification is a message shown to one user in the app
+type Notification struct {
+	ID        int64      `json:"id"`
+	UserID    int        `json:"userId"`
+	Type      string     `json:"type"`
+	Title     string     `json:"title"`
+	Message   string     `json:"message"`
+	Read      bool       `json:"read"`
+	ReadAt    *time.Time `json:"readAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// Created is the payload sent on NotifyChannel
+type Created struct {
+	ID     int64 `json:"id"`
+	UserID int   `json:"userId"`
+}
+
+const notificationColumns = `id, user_id, type, title, message, read_at, created_at`
+
+func scanNotification(row interface{ Scan(...any) error }) (*Notification, error) {
+	var n Notification
+	var readAt sql.NullTime
+
+	err := row.Scan(&n.ID, &n.UserID, &n.Type, &n.Title, &n.Message, &readAt, &n.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if readAt.Valid {
+		n.Read = true
+		n.ReadAt = &readAt.Time
+	}
+
+	return &n, nil
+}
+
+func queryNotifications(ctx context.Context, query string, args ...any) ([]*Notification, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+// Insert stores a notification and announces it on NotifyChannel in the
+// same transaction. messageID may be empty; when it isn't, a message that
+// was already stored is skipped and Insert returns 0.
+func (n *Notification) Insert(notification Notification, messageID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var msgID sql.NullString
+	if messageID != "" {
+		msgID = sql.NullString{String: messageID, Valid: true}
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO notifications (user_id, type, title, message, message_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (message_id) DO NOTHING
+		RETURNING id
+	`, notification.UserID, notification.Type, notification.Title, notification.Message, msgID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	payload, err := json.Marshal(Created{ID: id, UserID: notification.UserID})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, NotifyChannel, string(payload)); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// GetByID returns one notification
+func (n *Notification) GetByID(id int64) (*Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return scanNotification(db.QueryRowContext(ctx,
+		`SELECT `+notificationColumns+` FROM notifications WHERE id = $1`, id))
+}
+
+// ListByUser returns a user's notifications, newest first. beforeID, when
+// not zero, continues from the last page; unreadOnly leaves out read ones.
+func (n *Notification) ListByUser(userID int, beforeID int64, limit int, unreadOnly bool) ([]*Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return queryNotifications(ctx, `
+		SELECT `+notificationColumns+` FROM notifications
+		WHERE user_id = $1
+			AND ($2::bigint = 0 OR id < $2::bigint)
+			AND (NOT $3::boolean OR read_at IS NULL)
+		ORDER BY id DESC
+		LIMIT $4
+	`, userID, beforeID, unreadOnly, limit)
+}
+
+// ListSince returns a user's notifications newer than afterID, oldest
+// first, for clients catching up after a reconnect
+func (n *Notification) ListSince(userID int, afterID int64, limit int) ([]*Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return queryNotifications(ctx, `
+		SELECT `+notificationColumns+` FROM notifications
+		WHERE user_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`, userID, afterID, limit)
+}
+
+// UnreadCount returns how many of a user's notifications are unread
+func (n *Notification) UnreadCount(userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var count int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks one of a user's notifications as read. It reports false
+// when the user has no such notification.
+func (n *Notification) MarkRead(userID int, id int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// MarkAllRead marks every unread notification of a user as read and returns
+// how many there were
+func (n *Notification) MarkAllRead(userID int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx,
+		`UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
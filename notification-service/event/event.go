@@ -0,0 +1,90 @@
+package event
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Exchange names
+const (
+	ExchangeApp = "app_events" // For application events (mail, notifications, etc.)
+)
+
+// Routing keys for app events
+const (
+	RoutingNotifications = "notification.*"
+)
+
+// NotificationPayload is a message for one user, as published on
+// notification.* keys
+type NotificationPayload struct {
+	UserID  int    `json:"user_id"`
+	Email   string `json:"email,omitempty"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// declareAppExchange declares the app events exchange
+func declareAppExchange(ch *amqp.Channel) error {
+	return ch.ExchangeDeclare(
+		ExchangeApp, // name
+		"topic",     // type
+		true,        // durable?
+		false,       // auto-deleted?
+		false,       // internal?
+		false,       // no-wait?
+		nil,         // arguments?
+	)
+}
+
+// Consume binds a durable queue to the routing keys on the app events
+// exchange and hands every delivery to handle until the channel closes. A
+// delivery is acked when handle returns nil and requeued otherwise.
+func Consume(conn *amqp.Connection, queue string, routingKeys []string, handle func(amqp.Delivery) error) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	if err := declareAppExchange(ch); err != nil {
+		return err
+	}
+
+	q, err := ch.QueueDeclare(
+		queue, // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range routingKeys {
+		if err := ch.QueueBind(q.Name, key, ExchangeApp, false, nil); err != nil {
+			return err
+		}
+	}
+
+	if err := ch.Qos(10, 0, false); err != nil {
+		return err
+	}
+
+	messages, err := ch.Consume(q.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	for d := range messages {
+		if err := handle(d); err != nil {
+			d.Nack(false, true)
+		} else {
+			d.Ack(false)
+		}
+	}
+
+	return amqp.ErrClosed
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"post-service/data"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultAnalyticsDays = 30
+	maxAnalyticsDays     = 365
+)
+
+// listingStats are the totals shown next to each listing on the owner's dashboard
+type listingStats struct {
+	Views         int `json:"views"`
+	Favorites     int `json:"favorites"`
+	ContactClicks int `json:"contactClicks"`
+}
+
+// dailyStats is one point of a listing's time series
+type dailyStats struct {
+	Date string `json:"date"`
+	listingStats
+}
+
+// favoriteStats mirrors favourite-service's per-post favorite summary
+type favoriteStats struct {
+	PostID int            `json:"postId"`
+	Total  int            `json:"total"`
+	Daily  map[string]int `json:"daily"`
+}
+
+// viewerKey identifies who is interacting with a listing, for per-day
+// deduplication. Logged in users are keyed by user ID; anonymous visitors by
+// the session ID the broker assigns them.
+func viewerKey(r *http.Request) (string, bool) {
+	if userID, ok := requestUserID(r); ok {
+		return fmt.Sprintf("user:%d", userID), true
+	}
+	if session := strings.TrimSpace(r.Header.Get("X-Session-ID")); session != "" {
+		return "session:" + session, true
+	}
+	return "", false
+}
+
+// recordView counts a detail view of a post. Authors looking at their own
+// listing and callers that can't be deduplicated are not counted. Failures
+// are logged and never affect the response.
+func (app *Config) recordView(r *http.Request, post *data.PostWithAuthor) {
+	if userID, ok := requestUserID(r); ok && userID == post.AuthorID {
+		return
+	}
+
+	key, ok := viewerKey(r)
+	if !ok {
+		return
+	}
+
+	if err := app.Models.Analytics.Record(post.ID, data.InteractionView, key); err != nil {
+		log.Printf("Error recording view of post %d: %v", post.ID, err)
+	}
+}
+
+// RecordContactClick counts a click on a listing's contact button
+func (app *Config) RecordContactClick(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	key, ok := viewerKey(r)
+	if !ok {
+		app.errorJSON(w, errors.New("a user or visitor session is required"), http.StatusBadRequest)
+		return
+	}
+
+	post, err := app.Models.Post.GetByID(id)
+	if err != nil {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+
+	if userID, ok := requestUserID(r); !ok || userID != post.AuthorID {
+		if err := app.Models.Analytics.Record(id, data.InteractionContact, key); err != nil {
+			log.Printf("Error recording contact click on post %d: %v", id, err)
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Contact click recorded",
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetAuthorAnalytics returns daily views, favorites and contact clicks for
+// each of an author's listings over the last `days` days (default 30), plus
+// all-time totals. Only the author and admins may read it.
+func (app *Config) GetAuthorAnalytics(w http.ResponseWriter, r *http.Request) {
+	authorID, err := strconv.Atoi(chi.URLParam(r, "authorId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid author ID"), http.StatusBadRequest)
+		return
+	}
+
+	if !app.isOwnerOrAdmin(w, r, authorID) {
+		return
+	}
+
+	days := defaultAnalyticsDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		days, err = strconv.Atoi(raw)
+		if err != nil || days < 1 || days > maxAnalyticsDays {
+			app.errorJSON(w, fmt.Errorf("days must be between 1 and %d", maxAnalyticsDays), http.StatusBadRequest)
+			return
+		}
+	}
+
+	posts, err := app.Models.Post.GetByAuthorID(authorID)
+	if err != nil {
+		log.Printf("Error getting posts for analytics: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -(days - 1))
+
+	postIDs := make([]int, 0, len(posts))
+	for _, post := range posts {
+		postIDs = append(postIDs, post.ID)
+	}
+
+	listings := []map[string]any{}
+	message := ""
+
+	if len(postIDs) > 0 {
+		totals, err := app.Models.Analytics.GetTotals(postIDs)
+		if err != nil {
+			log.Printf("Error getting analytics totals: %v", err)
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		daily, err := app.Models.Analytics.GetDaily(postIDs, since)
+		if err != nil {
+			log.Printf("Error getting daily analytics: %v", err)
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Favorites live in favourite-service; the dashboard is still useful
+		// without them, so a failure there degrades instead of erroring
+		favorites, err := app.fetchFavoriteStats(postIDs, since)
+		if err != nil {
+			log.Printf("Error getting favorite stats: %v", err)
+			message = "favorite counts are temporarily unavailable"
+		}
+
+		byDay := map[int]map[string]*data.DailyInteractions{}
+		for _, d := range daily {
+			if byDay[d.PostID] == nil {
+				byDay[d.PostID] = map[string]*data.DailyInteractions{}
+			}
+			byDay[d.PostID][d.Day.Format("2006-01-02")] = d
+		}
+
+		for _, post := range posts {
+			fav := favorites[post.ID]
+			if fav == nil {
+				fav = &favoriteStats{}
+			}
+
+			series := make([]dailyStats, 0, days)
+			for day := since; !day.After(today); day = day.AddDate(0, 0, 1) {
+				date := day.Format("2006-01-02")
+				point := dailyStats{Date: date}
+				if d := byDay[post.ID][date]; d != nil {
+					point.Views = d.Views
+					point.ContactClicks = d.ContactClicks
+				}
+				point.Favorites = fav.Daily[date]
+				series = append(series, point)
+			}
+
+			listings = append(listings, map[string]any{
+				"postId": strconv.Itoa(post.ID),
+				"title":  post.Title,
+				"totals": listingStats{
+					Views:         totals[post.ID].Views,
+					Favorites:     fav.Total,
+					ContactClicks: totals[post.ID].ContactClicks,
+				},
+				"series": series,
+			})
+		}
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data: map[string]any{
+			"from":     since.Format("2006-01-02"),
+			"to":       today.Format("2006-01-02"),
+			"listings": listings,
+		},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// authorTotals returns each post's all-time stats for GetPostsByAuthor.
+// Favorite counts are left at zero if favourite-service can't be reached.
+func (app *Config) authorTotals(posts []*data.PostWithAuthor) (map[int]listingStats, error) {
+	postIDs := make([]int, 0, len(posts))
+	for _, post := range posts {
+		postIDs = append(postIDs, post.ID)
+	}
+
+	totals, err := app.Models.Analytics.GetTotals(postIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	favorites, err := app.fetchFavoriteStats(postIDs, today)
+	if err != nil {
+		log.Printf("Error getting favorite stats: %v", err)
+	}
+
+	stats := make(map[int]listingStats, len(postIDs))
+	for _, id := range postIDs {
+		s := listingStats{
+			Views:         totals[id].Views,
+			ContactClicks: totals[id].ContactClicks,
+		}
+		if fav := favorites[id]; fav != nil {
+			s.Favorites = fav.Total
+		}
+		stats[id] = s
+	}
+
+	return stats, nil
+}
+
+// fetchFavoriteStats asks favourite-service for favorite totals and daily
+// additions since the given day
+func (app *Config) fetchFavoriteStats(postIDs []int, since time.Time) (map[int]*favoriteStats, error) {
+	ids := make([]string, 0, len(postIDs))
+	for _, id := range postIDs {
+		ids = append(ids, strconv.Itoa(id))
+	}
+
+	url := fmt.Sprintf("http://favourite-service/favorites/stats?postIds=%s&since=%s",
+		strings.Join(ids, ","), since.Format("2006-01-02"))
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("favourite service returned status: %d", resp.StatusCode)
+	}
+
+	var payload struct {
+		Error   bool             `json:"error"`
+		Message string           `json:"message"`
+		Data    []*favoriteStats `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	stats := make(map[int]*favoriteStats, len(payload.Data))
+	for _, s := range payload.Data {
+		stats[s.PostID] = s
+	}
+
+	return stats, nil
+}
+
+// favoriteCountBatch is how many post IDs go in one favorite counts request
+const favoriteCountBatch = 200
+
+// attachFavoriteCounts sets "favoriteCount" on listing cards. Cards are left
+// without it when favourite-service can't be reached, so listings still load.
+func (app *Config) attachFavoriteCounts(cards []map[string]any) {
+	ids := make([]string, 0, len(cards))
+	for _, card := range cards {
+		if id, ok := card["id"].(string); ok && card["status"] != "unavailable" {
+			ids = append(ids, id)
+		}
+	}
+
+	counts := make(map[string]int, len(ids))
+	for start := 0; start < len(ids); start += favoriteCountBatch {
+		end := min(start+favoriteCountBatch, len(ids))
+		batch, err := fetchFavoriteCounts(ids[start:end])
+		if err != nil {
+			log.Printf("Error fetching favorite counts: %v", err)
+			return
+		}
+		for id, count := range batch {
+			counts[id] = count
+		}
+	}
+
+	for _, card := range cards {
+		if id, ok := card["id"].(string); ok && card["status"] != "unavailable" {
+			card["favoriteCount"] = counts[id]
+		}
+	}
+}
+
+// fetchFavoriteCounts asks favourite-service how many users favorited each
+// post, keyed by post ID
+func fetchFavoriteCounts(ids []string) (map[string]int, error) {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get("http://favourite-service/favorites/counts?postIds=" + strings.Join(ids, ","))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("favourite service returned status: %d", resp.StatusCode)
+	}
+
+	var payload struct {
+		Error   bool           `json:"error"`
+		Message string         `json:"message"`
+		Data    map[string]int `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	return payload.Data, nil
+}
+
+// isOwnerOrAdmin checks that the caller is the given user or an admin and
+// writes the error response when they aren't
+func (app *Config) isOwnerOrAdmin(w http.ResponseWriter, r *http.Request, ownerID int) bool {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return false
+	}
+
+	if userID != ownerID && !requestIsAdmin(r) {
+		app.errorJSON(w, errors.New("you can only view analytics for your own listings"), http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
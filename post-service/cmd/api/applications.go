@@ -0,0 +1,467 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"post-service/data"
+	"post-service/event"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// maxApplicationDocuments caps how many documents go with an application
+	maxApplicationDocuments = 5
+	// maxDocumentSize is the largest document accepted, before base64. Five
+	// of them base64 encoded (about 6.7 MB) stay well under readJSON's 10 MB
+	// body limit.
+	maxDocumentSize = 1 << 20
+	// maxApplicationMessage is the longest message to the landlord, in characters
+	maxApplicationMessage = 2000
+	// maxOccupants is the most occupants an application can list
+	maxOccupants = 20
+)
+
+// applicationDocumentTypes are the document types accepted, by sniffed
+// content type
+var applicationDocumentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+}
+
+// applicationStatusTitles are the notice subjects for each status an
+// application can move to
+var applicationStatusTitles = map[string]string{
+	data.ApplicationSubmitted:   "Application sent",
+	data.ApplicationUnderReview: "Your application is under review",
+	data.ApplicationAccepted:    "Your application was accepted",
+	data.ApplicationRejected:    "Your application was declined",
+	data.ApplicationWithdrawn:   "Application withdrawn",
+}
+
+type applicationPayload struct {
+	MoveInDate string `json:"moveInDate"` // YYYY-MM-DD
+	Occupants  int    `json:"occupants"`
+	Message    string `json:"message"`
+	Documents  []struct {
+		Name string `json:"name"`
+		Data []byte `json:"data"` // base64
+	} `json:"documents"`
+}
+
+// SubmitApplication lets a renter apply for a published listing, with
+// documents sent base64 encoded like listing images
+func (app *Config) SubmitApplication(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	var requestPayload applicationPayload
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	application, err := newApplication(requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	post, err := app.Models.Post.GetByID(postID)
+	if err != nil || !canViewPost(r, post) {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+	if post.AuthorID == userID {
+		app.errorJSON(w, errors.New("you cannot apply for your own listing"), http.StatusBadRequest)
+		return
+	}
+	if post.Status != data.StatusPublished {
+		app.errorJSON(w, errors.New("this listing is no longer taking applications"), http.StatusConflict)
+		return
+	}
+
+	blocked, err := app.Models.Messaging.IsBlocked(userID, post.AuthorID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		app.errorJSON(w, data.ErrBlocked, http.StatusForbidden)
+		return
+	}
+
+	application.PostID = postID
+	application.Applicant.ID = userID
+
+	application, err = app.Models.Application.Submit(application, app.applicationNotices(""))
+	if errors.Is(err, data.ErrApplicationOpen) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error submitting application for post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d applied for post %d (application %d)", userID, postID, application.ID)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Application submitted",
+		Data:    application,
+	}
+
+	app.writeJSON(w, http.StatusCreated, payload)
+}
+
+// newApplication validates a submitted application
+func newApplication(p applicationPayload) (*data.RentalApplication, error) {
+	moveIn, err := time.Parse("2006-01-02", p.MoveInDate)
+	if err != nil {
+		return nil, errors.New("moveInDate must be a date like 2006-01-02")
+	}
+	if moveIn.Before(time.Now().UTC().Truncate(24 * time.Hour)) {
+		return nil, errors.New("moveInDate can't be in the past")
+	}
+	if p.Occupants < 1 || p.Occupants > maxOccupants {
+		return nil, fmt.Errorf("occupants must be between 1 and %d", maxOccupants)
+	}
+	message := strings.TrimSpace(p.Message)
+	if utf8.RuneCountInString(message) > maxApplicationMessage {
+		return nil, fmt.Errorf("message can be at most %d characters", maxApplicationMessage)
+	}
+	if len(p.Documents) > maxApplicationDocuments {
+		return nil, fmt.Errorf("at most %d documents can be attached", maxApplicationDocuments)
+	}
+
+	application := &data.RentalApplication{
+		MoveInDate: moveIn,
+		Occupants:  p.Occupants,
+		Message:    message,
+	}
+
+	for i, d := range p.Documents {
+		name := strings.TrimSpace(d.Name)
+		if name == "" || len(name) > 255 {
+			return nil, fmt.Errorf("document %d needs a name of at most 255 characters", i+1)
+		}
+		if len(d.Data) == 0 {
+			return nil, fmt.Errorf("document %q is empty", name)
+		}
+		if len(d.Data) > maxDocumentSize {
+			return nil, fmt.Errorf("document %q is larger than %d MB", name, maxDocumentSize>>20)
+		}
+		// Trust the bytes, not the name or what the client claims
+		contentType := http.DetectContentType(d.Data)
+		if !applicationDocumentTypes[contentType] {
+			return nil, fmt.Errorf("document %q must be a PDF, JPEG or PNG", name)
+		}
+		application.Documents = append(application.Documents, &data.ApplicationDocument{
+			Name:        name,
+			ContentType: contentType,
+			Data:        d.Data,
+		})
+	}
+
+	return application, nil
+}
+
+// GetPostApplications is the author's inbox of applications for a listing,
+// optionally filtered by ?status=
+func (app *Config) GetPostApplications(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.ownedPost(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if _, known := applicationStatusTitles[status]; status != "" && !known {
+		app.errorJSON(w, errors.New("unknown status"), http.StatusBadRequest)
+		return
+	}
+
+	applications, err := app.Models.Application.ForPost(post.ID, status)
+	if err != nil {
+		log.Printf("Error getting applications of post %d: %v", post.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Applications retrieved successfully",
+		Data:    applications,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetMyApplications lists the applications the caller submitted
+func (app *Config) GetMyApplications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	applications, err := app.Models.Application.ForApplicant(userID)
+	if err != nil {
+		log.Printf("Error getting applications of user %d: %v", userID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Applications retrieved successfully",
+		Data:    applications,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetApplication returns an application with its documents and history to
+// the applicant or the listing's author
+func (app *Config) GetApplication(w http.ResponseWriter, r *http.Request) {
+	_, application, ok := app.participantApplication(w, r)
+	if !ok {
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Application retrieved successfully",
+		Data:    application,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetApplicationDocument returns one document of an application, base64
+// encoded, to the applicant or the listing's author
+func (app *Config) GetApplicationDocument(w http.ResponseWriter, r *http.Request) {
+	_, application, ok := app.participantApplication(w, r)
+	if !ok {
+		return
+	}
+
+	documentID, err := strconv.Atoi(chi.URLParam(r, "documentId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid document ID"), http.StatusBadRequest)
+		return
+	}
+
+	document, err := app.Models.Application.Document(application.ID, documentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("document not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Document retrieved successfully",
+		Data:    document,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// SetApplicationStatus moves an application along. The author reviews,
+// accepts or rejects it, and can mark the listing pending when accepting;
+// the applicant can withdraw it while it's open.
+func (app *Config) SetApplicationStatus(w http.ResponseWriter, r *http.Request) {
+	userID, application, ok := app.participantApplication(w, r)
+	if !ok {
+		return
+	}
+
+	var requestPayload struct {
+		Status      string `json:"status"`
+		Note        string `json:"note"`
+		MarkPending bool   `json:"markPending"`
+	}
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	to := requestPayload.Status
+	note := strings.TrimSpace(requestPayload.Note)
+	if utf8.RuneCountInString(note) > maxApplicationMessage {
+		app.errorJSON(w, fmt.Errorf("note can be at most %d characters", maxApplicationMessage), http.StatusBadRequest)
+		return
+	}
+
+	if userID == application.Applicant.ID {
+		if to != data.ApplicationWithdrawn {
+			app.errorJSON(w, errors.New("applicants can only withdraw their application"), http.StatusForbidden)
+			return
+		}
+	} else if to == data.ApplicationWithdrawn || to == data.ApplicationSubmitted {
+		app.errorJSON(w, fmt.Errorf("status must be %s, %s or %s",
+			data.ApplicationUnderReview, data.ApplicationAccepted, data.ApplicationRejected), http.StatusBadRequest)
+		return
+	}
+
+	if _, known := applicationStatusTitles[to]; !known {
+		app.errorJSON(w, errors.New("unknown status"), http.StatusBadRequest)
+		return
+	}
+	if !data.CanMoveApplication(application.Status, to) {
+		app.errorJSON(w, fmt.Errorf("an application that is %s can't be %s", application.Status, to), http.StatusConflict)
+		return
+	}
+
+	postStatus := ""
+	if requestPayload.MarkPending {
+		if to != data.ApplicationAccepted {
+			app.errorJSON(w, errors.New("markPending only goes with accepting an application"), http.StatusBadRequest)
+			return
+		}
+		post, err := app.Models.Post.GetByID(application.PostID)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		if post.Status != data.StatusPublished && post.Status != data.StatusPending {
+			app.errorJSON(w, fmt.Errorf("a %s listing can't be marked pending", post.Status), http.StatusConflict)
+			return
+		}
+		postStatus = data.StatusPending
+	}
+
+	updated, err := app.Models.Application.SetStatus(application.ID, application.Status, to, userID, note,
+		postStatus, app.applicationNotices(note))
+	if errors.Is(err, data.ErrApplicationMoved) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error moving application %d to %s: %v", application.ID, to, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d moved application %d from %s to %s", userID, application.ID, application.Status, to)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Application updated",
+		Data:    updated,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// participantApplication loads the application in the URL if the caller is
+// its applicant or the listing's author, answering 404 otherwise
+func (app *Config) participantApplication(w http.ResponseWriter, r *http.Request) (int, *data.RentalApplication, bool) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return 0, nil, false
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid application ID"), http.StatusBadRequest)
+		return 0, nil, false
+	}
+
+	application, err := app.Models.Application.Get(id)
+	if err != nil || !application.IsParticipant(userID) {
+		app.errorJSON(w, errors.New("application not found"), http.StatusNotFound)
+		return 0, nil, false
+	}
+
+	return userID, application, true
+}
+
+// applicationNotices returns the notices for an application's new status:
+// the applicant hears about every change, and the author about new and
+// withdrawn applications
+func (app *Config) applicationNotices(note string) data.ApplicationNotices {
+	return func(a *data.RentalApplication) ([]event.NotificationEvent, error) {
+		var notices []event.NotificationEvent
+
+		contact, err := app.Models.Moderation.ContactOf(a.Applicant.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		var body strings.Builder
+		fmt.Fprintf(&body, "Hello %s,\n\n", strings.TrimSpace(a.Applicant.Name))
+		switch a.Status {
+		case data.ApplicationSubmitted:
+			fmt.Fprintf(&body, "Your application for %q was sent to the landlord.\n", a.PostTitle)
+		case data.ApplicationUnderReview:
+			fmt.Fprintf(&body, "The landlord is reviewing your application for %q.\n", a.PostTitle)
+		case data.ApplicationAccepted:
+			fmt.Fprintf(&body, "Good news: your application for %q was accepted. The landlord will be in touch about next steps.\n", a.PostTitle)
+		case data.ApplicationRejected:
+			fmt.Fprintf(&body, "Your application for %q was declined.\n", a.PostTitle)
+		case data.ApplicationWithdrawn:
+			fmt.Fprintf(&body, "You withdrew your application for %q.\n", a.PostTitle)
+		}
+		if note != "" && a.Status != data.ApplicationWithdrawn {
+			fmt.Fprintf(&body, "\nNote from the landlord:\n%s\n", note)
+		}
+		fmt.Fprintf(&body, "\nSee your applications at %s/applications\n", app.PublicURL)
+
+		notices = append(notices, event.NotificationEvent{
+			UserID:  a.Applicant.ID,
+			Email:   contact.Email,
+			Title:   applicationStatusTitles[a.Status] + ": " + a.PostTitle,
+			Message: body.String(),
+			Type:    "application_" + a.Status,
+		})
+
+		if a.Status == data.ApplicationSubmitted || a.Status == data.ApplicationWithdrawn {
+			landlord, err := app.Models.Moderation.ContactOf(a.LandlordID)
+			if err != nil {
+				return nil, err
+			}
+
+			title := "New application: " + a.PostTitle
+			message := fmt.Sprintf("%s applied for %q, moving in %s with %d occupant(s).\n\nReview it at %s/posts/%d/applications\n",
+				a.Applicant.Name, a.PostTitle, a.MoveIn, a.Occupants, app.PublicURL, a.PostID)
+			if a.Status == data.ApplicationWithdrawn {
+				title = "Application withdrawn: " + a.PostTitle
+				message = fmt.Sprintf("%s withdrew their application for %q.\n", a.Applicant.Name, a.PostTitle)
+			}
+
+			notices = append(notices, event.NotificationEvent{
+				UserID:  a.LandlordID,
+				Email:   landlord.Email,
+				Title:   title,
+				Message: message,
+				Type:    "application_" + a.Status,
+			})
+		}
+
+		return notices, nil
+	}
+}
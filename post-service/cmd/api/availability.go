@@ -0,0 +1,376 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"post-service/data"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxAvailabilityPeriods = 20
+	maxBlockedRanges       = 100
+	maxAvailabilityNote    = 200
+)
+
+type datesPayload struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Price *float64 `json:"price"`
+	Note  string   `json:"note"`
+}
+
+// parseDates checks a from/to pair of YYYY-MM-DD dates, to inclusive
+func parseDates(from, to string) error {
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return errors.New("from must be a YYYY-MM-DD date")
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return errors.New("to must be a YYYY-MM-DD date")
+	}
+	if end.Before(start) {
+		return errors.New("to is before from")
+	}
+	return nil
+}
+
+// availabilityFeedURL is where calendar apps subscribe to a listing's feed
+func (app *Config) availabilityFeedURL(token string) string {
+	return fmt.Sprintf("%s/calendars/%s.ics", app.PublicURL, token)
+}
+
+// GetAvailability returns a listing's availability periods and blocked
+// dates. The owner also sees the notes on blocked dates and the calendar
+// feed URL.
+func (app *Config) GetAvailability(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	post, err := app.Models.Post.GetByID(postID)
+	if err != nil || !canViewPost(r, post) {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+
+	calendar, err := app.Models.Availability.Get(postID)
+	if err != nil {
+		log.Printf("Error getting availability of post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]any{
+		"price":   post.Price,
+		"periods": calendar.Periods,
+		"blocked": calendar.Blocked,
+	}
+
+	userID, ok := requestUserID(r)
+	if ok && (userID == post.AuthorID || requestIsAdmin(r)) {
+		token, err := app.Models.Availability.FeedToken(postID)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		response["feedUrl"] = nil
+		if token != "" {
+			response["feedUrl"] = app.availabilityFeedURL(token)
+		}
+	} else {
+		for _, b := range calendar.Blocked {
+			b.Note = ""
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{Error: false, Data: response})
+}
+
+// SetAvailability replaces the availability periods of the caller's listing.
+// The listing's availableFrom/availableTo become the earliest start and the
+// latest end.
+func (app *Config) SetAvailability(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.ownedPost(w, r)
+	if !ok {
+		return
+	}
+
+	var requestPayload struct {
+		Periods []datesPayload `json:"periods"`
+	}
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if len(requestPayload.Periods) == 0 {
+		app.errorJSON(w, errors.New("at least one period is required"), http.StatusBadRequest)
+		return
+	}
+	if len(requestPayload.Periods) > maxAvailabilityPeriods {
+		app.errorJSON(w, fmt.Errorf("at most %d periods are allowed", maxAvailabilityPeriods), http.StatusBadRequest)
+		return
+	}
+
+	periods := make([]*data.AvailabilityPeriod, 0, len(requestPayload.Periods))
+	for i, p := range requestPayload.Periods {
+		note := strings.TrimSpace(p.Note)
+		err := parseDates(p.From, p.To)
+		switch {
+		case err != nil:
+			err = fmt.Errorf("period %d: %v", i+1, err)
+		case p.Price != nil && *p.Price <= 0:
+			err = fmt.Errorf("period %d: price must be positive", i+1)
+		case len(note) > maxAvailabilityNote:
+			err = fmt.Errorf("period %d: note must be at most %d characters", i+1, maxAvailabilityNote)
+		}
+		if err != nil {
+			app.errorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+		periods = append(periods, &data.AvailabilityPeriod{From: p.From, To: p.To, Price: p.Price, Note: note})
+	}
+
+	if data.SortPeriods(periods) {
+		app.errorJSON(w, data.ErrPeriodOverlap, http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Models.Availability.SetPeriods(post.ID, periods); err != nil {
+		log.Printf("Error setting availability of post %d: %v", post.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Set %d availability periods on post %d", len(periods), post.ID)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Availability updated",
+		Data:    periods,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// BlockDates takes dates of the caller's listing off its calendar
+func (app *Config) BlockDates(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.ownedPost(w, r)
+	if !ok {
+		return
+	}
+
+	var requestPayload datesPayload
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := parseDates(requestPayload.From, requestPayload.To); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	block := &data.BlockedDates{
+		From: requestPayload.From,
+		To:   requestPayload.To,
+		Note: strings.TrimSpace(requestPayload.Note),
+	}
+	if len(block.Note) > maxAvailabilityNote {
+		app.errorJSON(w, fmt.Errorf("note must be at most %d characters", maxAvailabilityNote), http.StatusBadRequest)
+		return
+	}
+
+	calendar, err := app.Models.Availability.Get(post.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(calendar.Blocked) >= maxBlockedRanges {
+		app.errorJSON(w, fmt.Errorf("at most %d blocked ranges are allowed", maxBlockedRanges), http.StatusConflict)
+		return
+	}
+
+	err = app.Models.Availability.AddBlock(post.ID, block)
+	if errors.Is(err, data.ErrBlockOverlap) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error blocking dates of post %d: %v", post.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Dates blocked",
+		Data:    block,
+	}
+
+	app.writeJSON(w, http.StatusCreated, payload)
+}
+
+// UnblockDates puts blocked dates of the caller's listing back
+func (app *Config) UnblockDates(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.ownedPost(w, r)
+	if !ok {
+		return
+	}
+
+	blockID, err := strconv.Atoi(chi.URLParam(r, "blockId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid block ID"), http.StatusBadRequest)
+		return
+	}
+
+	err = app.Models.Availability.DeleteBlock(post.ID, blockID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("blocked dates not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error unblocking dates %d of post %d: %v", blockID, post.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Dates unblocked",
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// CreateAvailabilityFeed publishes the caller's listing as an iCal feed.
+// Calling it again replaces the URL, which stops the old one working.
+func (app *Config) CreateAvailabilityFeed(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.ownedPost(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := newURLToken()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.Models.Availability.SetFeedToken(post.ID, token); err != nil {
+		log.Printf("Error creating availability feed of post %d: %v", post.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Calendar feed created",
+		Data:    map[string]string{"feedUrl": app.availabilityFeedURL(token)},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// DeleteAvailabilityFeed stops publishing the caller's listing as a feed
+func (app *Config) DeleteAvailabilityFeed(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.ownedPost(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.Models.Availability.SetFeedToken(post.ID, ""); err != nil {
+		log.Printf("Error deleting availability feed of post %d: %v", post.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Calendar feed revoked",
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetAvailabilityFeed serves a listing's periods and blocked dates as an
+// iCalendar feed to anyone holding its token, so owners can subscribe to
+// it from their own calendar
+func (app *Config) GetAvailabilityFeed(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(chi.URLParam(r, "feed"), ".ics")
+
+	postID, err := app.Models.Availability.PostByFeedToken(token)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("calendar not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	post, err := app.Models.Post.GetByID(postID)
+	if err != nil {
+		app.errorJSON(w, errors.New("calendar not found"), http.StatusNotFound)
+		return
+	}
+
+	calendar, err := app.Models.Availability.Get(postID)
+	if err != nil {
+		log.Printf("Error getting availability of post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	listingURL := fmt.Sprintf("%s/posts/%d", app.PublicURL, post.ID)
+	events := make([]icalEvent, 0, len(calendar.Periods)+len(calendar.Blocked))
+	for _, p := range calendar.Periods {
+		price := post.Price
+		if p.Price != nil {
+			price = *p.Price
+		}
+		events = append(events, icalEvent{
+			UID:         fmt.Sprintf("availability-%d@dwell", p.ID),
+			Start:       feedDate(p.From),
+			End:         feedDate(p.To).AddDate(0, 0, 1),
+			AllDay:      true,
+			Summary:     fmt.Sprintf("Available: %s ($%.0f)", post.Title, price),
+			Description: p.Note,
+			Location:    post.Location,
+			URL:         listingURL,
+		})
+	}
+	for _, b := range calendar.Blocked {
+		events = append(events, icalEvent{
+			UID:         fmt.Sprintf("blocked-%d@dwell", b.ID),
+			Start:       feedDate(b.From),
+			End:         feedDate(b.To).AddDate(0, 0, 1),
+			AllDay:      true,
+			Summary:     "Blocked: " + post.Title,
+			Description: b.Note,
+			URL:         listingURL,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(icalendar(post.Title, events))
+}
+
+// feedDate parses a stored YYYY-MM-DD date
+func feedDate(date string) time.Time {
+	t, _ := time.Parse("2006-01-02", date)
+	return t
+}
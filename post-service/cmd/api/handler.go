@@ -1,11 +1,16 @@
 package main
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"post-service/data"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -38,10 +43,22 @@ type PostPayload struct {
 	AuthorID         int      `json:"authorId"`
 }
 
-// GetAllPosts returns all posts
+// GetAllPosts returns all posts, newest first. The listing search
+// parameters of searchFromQuery narrow them down.
 func (app *Config) GetAllPosts(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("ids") {
+		app.getPostsByIDs(w, r)
+		return
+	}
+
 	log.Println("========== GetAllPosts START ==========")
 
+	criteria, filtered, err := searchFromQuery(r.URL.Query())
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
 	posts, err := app.Models.Post.GetAll()
 	if err != nil {
 		log.Printf("ERROR getting posts from database: %v", err)
@@ -49,6 +66,15 @@ func (app *Config) GetAllPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if filtered {
+		posts, err = app.matchingPosts(posts, criteria)
+		if err != nil {
+			log.Printf("Error filtering posts: %v", err)
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
 	log.Printf("Found %d posts in database", len(posts))
 
 	// Convert to frontend format
@@ -56,6 +82,7 @@ func (app *Config) GetAllPosts(w http.ResponseWriter, r *http.Request) {
 	for _, post := range posts {
 		response = append(response, convertPostToFrontend(post))
 	}
+	app.attachFavoriteCounts(response)
 
 	payload := jsonResponse{
 		Error: false,
@@ -66,6 +93,171 @@ func (app *Config) GetAllPosts(w http.ResponseWriter, r *http.Request) {
 	app.writeJSON(w, http.StatusOK, payload)
 }
 
+// searchFromQuery reads listing search parameters into saved search
+// criteria: minPrice, maxPrice, minBedrooms, maxBedrooms, minBathrooms,
+// neighborhood and type (repeated or comma separated), availableFrom,
+// availableTo and keywords. filtered is false when none is set.
+func searchFromQuery(q url.Values) (criteria data.SearchCriteria, filtered bool, err error) {
+	number := func(name string) (*float64, error) {
+		v := q.Get(name)
+		if v == "" {
+			return nil, nil
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative number", name)
+		}
+		filtered = true
+		return &n, nil
+	}
+	count := func(name string) (*int, error) {
+		v := q.Get(name)
+		if v == "" {
+			return nil, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative whole number", name)
+		}
+		filtered = true
+		return &n, nil
+	}
+	list := func(name string) []string {
+		var values []string
+		for _, v := range q[name] {
+			for _, part := range strings.Split(v, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					values = append(values, part)
+				}
+			}
+		}
+		if len(values) > 0 {
+			filtered = true
+		}
+		return values
+	}
+
+	if criteria.MinPrice, err = number("minPrice"); err != nil {
+		return
+	}
+	if criteria.MaxPrice, err = number("maxPrice"); err != nil {
+		return
+	}
+	if criteria.MinBedrooms, err = count("minBedrooms"); err != nil {
+		return
+	}
+	if criteria.MaxBedrooms, err = count("maxBedrooms"); err != nil {
+		return
+	}
+	if criteria.MinBathrooms, err = count("minBathrooms"); err != nil {
+		return
+	}
+	criteria.Neighborhoods = list("neighborhood")
+	criteria.Types = list("type")
+	criteria.AvailableFrom = q.Get("availableFrom")
+	criteria.AvailableTo = q.Get("availableTo")
+	criteria.Keywords = strings.TrimSpace(q.Get("keywords"))
+	if criteria.AvailableFrom != "" || criteria.AvailableTo != "" || criteria.Keywords != "" {
+		filtered = true
+	}
+
+	err = criteria.Validate()
+	return
+}
+
+// matchingPosts keeps the posts that meet the criteria
+func (app *Config) matchingPosts(posts []*data.PostWithAuthor, criteria data.SearchCriteria) ([]*data.PostWithAuthor, error) {
+	ids := make([]int, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+
+	var calendars map[int]*data.AvailabilityCalendar
+	if criteria.AvailableFrom != "" || criteria.AvailableTo != "" {
+		var err error
+		if calendars, err = app.Models.Availability.ForPosts(ids); err != nil {
+			return nil, err
+		}
+	}
+
+	matching := make([]*data.PostWithAuthor, 0, len(posts))
+	for _, post := range posts {
+		if criteria.Matches(&post.Post, calendars[post.ID]) {
+			matching = append(matching, post)
+		}
+	}
+
+	return matching, nil
+}
+
+// maxBatchIDs caps how many posts one GET /posts?ids= request may ask for
+const maxBatchIDs = 100
+
+// getPostsByIDs serves GET /posts?ids=1,2,3. Cards come back in the order
+// asked for. A post the caller may not view is reduced to its ID and an
+// "unavailable" status; IDs that don't exist are left out.
+func (app *Config) getPostsByIDs(w http.ResponseWriter, r *http.Request) {
+	var ids []int
+	for _, raw := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			app.errorJSON(w, errors.New("invalid post ID in ids"), http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) > maxBatchIDs {
+		app.errorJSON(w, fmt.Errorf("at most %d ids per request", maxBatchIDs), http.StatusBadRequest)
+		return
+	}
+
+	posts := []*data.PostWithAuthor{}
+	if len(ids) > 0 {
+		var err error
+		posts, err = app.Models.Post.GetByIDs(ids)
+		if err != nil {
+			log.Printf("Error getting posts by IDs: %v", err)
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	byID := make(map[int]*data.PostWithAuthor, len(posts))
+	for _, post := range posts {
+		byID[post.ID] = post
+	}
+
+	response := make([]map[string]any, 0, len(posts))
+	for _, id := range ids {
+		post, ok := byID[id]
+		if !ok {
+			continue
+		}
+		delete(byID, id) // a repeated ID is returned once
+
+		if !canViewPost(r, post) {
+			response = append(response, map[string]any{
+				"id":     strconv.Itoa(post.ID),
+				"status": "unavailable",
+			})
+			continue
+		}
+		response = append(response, convertPostToFrontend(post))
+	}
+	app.attachFavoriteCounts(response)
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  response,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
 // GetPostByID returns a single post
 func (app *Config) GetPostByID(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
@@ -84,12 +276,28 @@ func (app *Config) GetPostByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Held and rejected posts are only visible to their author and admins
+	if !canViewPost(r, post) {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+
+	if post.Status == data.StatusPublished {
+		app.recordView(r, post)
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, post, true) {
+		w.Header().Set("ETag", postETag(post))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	payload := jsonResponse{
 		Error: false,
 		Data:  convertPostToFrontend(post),
 	}
 
-	app.writeJSON(w, http.StatusOK, payload)
+	app.writeJSON(w, http.StatusOK, payload, etagHeader(post))
 }
 
 // GetPostsByAuthor returns all posts by a specific author
@@ -110,9 +318,29 @@ func (app *Config) GetPostsByAuthor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Owners (and admins) also see held posts and each listing's view,
+	// favorite and contact totals
+	userID, ok := requestUserID(r)
+	isOwner := ok && (userID == authorID || requestIsAdmin(r))
+
+	var stats map[int]listingStats
+	if isOwner && len(posts) > 0 {
+		stats, err = app.authorTotals(posts)
+		if err != nil {
+			log.Printf("Error getting listing totals: %v", err)
+		}
+	}
+
 	response := make([]map[string]any, 0, len(posts))
 	for _, post := range posts {
-		response = append(response, convertPostToFrontend(post))
+		if !isOwner && post.Status != data.StatusPublished {
+			continue
+		}
+		item := convertPostToFrontend(post)
+		if s, ok := stats[post.ID]; ok {
+			item["stats"] = s
+		}
+		response = append(response, item)
 	}
 
 	payload := jsonResponse{
@@ -170,8 +398,14 @@ func (app *Config) CreatePost(w http.ResponseWriter, r *http.Request) {
 		AuthorID:         requestPayload.AuthorID,
 	}
 
+	// Likely duplicates and scams are held for review instead of published
+	screened := app.screenPost(post, true)
+	if screened.Result.Flagged {
+		log.Printf("Post flagged by screening (score %.2f), holding for review", screened.Result.Score)
+	}
+
 	log.Println("Inserting post into database...")
-	newID, err := app.Models.Post.Insert(post)
+	newID, err := app.Models.Post.Insert(post, screened)
 	if err != nil {
 		log.Printf("ERROR inserting post into database: %v", err)
 		app.errorJSON(w, err, http.StatusInternalServerError)
@@ -187,13 +421,18 @@ func (app *Config) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	message := "Post created successfully"
+	if createdPost.Status == data.StatusPendingReview {
+		message = "Post submitted for review"
+	}
+
 	payload := jsonResponse{
 		Error:   false,
-		Message: "Post created successfully",
+		Message: message,
 		Data:    convertPostToFrontend(createdPost),
 	}
 
-	app.writeJSON(w, http.StatusCreated, payload)
+	app.writeJSON(w, http.StatusCreated, payload, etagHeader(createdPost))
 }
 
 // UpdatePost updates an existing post
@@ -205,6 +444,12 @@ func (app *Config) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
 	var requestPayload PostPayload
 
 	err = app.readJSON(w, r, &requestPayload)
@@ -214,33 +459,26 @@ func (app *Config) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Updating post %d: %+v", id, requestPayload)
+	if requestPayload.AuthorID != 0 && requestPayload.AuthorID != userID {
+		app.errorJSON(w, errAuthorMismatch, http.StatusForbidden)
+		return
+	}
 
-	// Convert timestamps
-	availableFrom := time.Unix(requestPayload.AvailableFrom/1000, 0)
-	availableTo := time.Unix(requestPayload.AvailableTo/1000, 0)
+	log.Printf("Updating post %d by author %d: %+v", id, userID, requestPayload)
 
-	post := data.Post{
-		ID:               id,
-		Title:            requestPayload.Title,
-		Price:            requestPayload.Price,
-		Location:         requestPayload.Location,
-		Neighborhood:     requestPayload.Neighborhood,
-		Lat:              requestPayload.Lat,
-		Lng:              requestPayload.Lng,
-		Radius:           requestPayload.Radius,
-		Type:             requestPayload.Type,
-		ImageURL:         requestPayload.ImageURL,
-		AdditionalImages: requestPayload.AdditionalImages,
-		Description:      requestPayload.Description,
-		Bedrooms:         requestPayload.Bedrooms,
-		Bathrooms:        requestPayload.Bathrooms,
-		AvailableFrom:    availableFrom,
-		AvailableTo:      availableTo,
-		AuthorID:         requestPayload.AuthorID,
+	expectedVersion, ok := app.expectedVersion(w, r, id, userID)
+	if !ok {
+		return
 	}
 
-	err = app.Models.Post.Update(post)
+	post := postFromPayload(id, userID, requestPayload)
+	screened := app.screenPost(post, true)
+
+	_, err = app.Models.Post.UpdateIfVersion(post, expectedVersion, screened)
+	if errors.Is(err, data.ErrVersionConflict) {
+		app.staleWrite(w, id)
+		return
+	}
 	if err != nil {
 		log.Printf("Error updating post: %v", err)
 		app.errorJSON(w, errors.New("post not found or unauthorized"), http.StatusNotFound)
@@ -261,7 +499,7 @@ func (app *Config) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		Data:    convertPostToFrontend(updatedPost),
 	}
 
-	app.writeJSON(w, http.StatusOK, payload)
+	app.writeJSON(w, http.StatusOK, payload, etagHeader(updatedPost))
 }
 
 // DeletePost deletes a post
@@ -273,21 +511,41 @@ func (app *Config) DeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get author ID from request body
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	// Older clients still send their author ID; it must be the caller's
 	var requestPayload struct {
 		AuthorID int `json:"authorId"`
 	}
 
 	err = app.readJSON(w, r, &requestPayload)
-	if err != nil {
+	if err != nil && !errors.Is(err, io.EOF) {
 		log.Printf("Error reading delete payload: %v", err)
 		app.errorJSON(w, err, http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Deleting post %d by author %d", id, requestPayload.AuthorID)
+	if requestPayload.AuthorID != 0 && requestPayload.AuthorID != userID {
+		app.errorJSON(w, errAuthorMismatch, http.StatusForbidden)
+		return
+	}
+
+	log.Printf("Deleting post %d by author %d", id, userID)
 
-	err = app.Models.Post.Delete(id, requestPayload.AuthorID)
+	expectedVersion, ok := app.expectedVersion(w, r, id, userID)
+	if !ok {
+		return
+	}
+
+	err = app.Models.Post.DeleteIfVersion(id, userID, expectedVersion)
+	if errors.Is(err, data.ErrVersionConflict) {
+		app.staleWrite(w, id)
+		return
+	}
 	if err != nil {
 		log.Printf("Error deleting post: %v", err)
 		app.errorJSON(w, errors.New("post not found or unauthorized"), http.StatusNotFound)
@@ -302,6 +560,102 @@ func (app *Config) DeletePost(w http.ResponseWriter, r *http.Request) {
 	app.writeJSON(w, http.StatusOK, payload)
 }
 
+// SetPostStatus lets the author mark a listing as rented, or put a rented
+// listing back on the market. Other statuses belong to review and moderation.
+func (app *Config) SetPostStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	var requestPayload struct {
+		Status string `json:"status"`
+	}
+
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if requestPayload.Status != data.StatusRented && requestPayload.Status != data.StatusPublished {
+		app.errorJSON(w, errors.New("status must be rented or published"), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Setting post %d status to %s by author %d", id, requestPayload.Status, userID)
+
+	err = app.Models.Post.SetStatus(id, userID, requestPayload.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("post not found or unauthorized"), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, data.ErrStatusTransition) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error setting post status: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := app.Models.Post.GetByID(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Post status updated",
+		Data:    convertPostToFrontend(updated),
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// expectedVersion resolves the If-Match header into the version userID's
+// write must be applied against. Writes without it get a 428 like PATCH
+// does, and posts of other authors a 404 before their current state is
+// sent with a 412. It writes the error response itself when ok is false.
+func (app *Config) expectedVersion(w http.ResponseWriter, r *http.Request, id, userID int) (int, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		app.errorJSON(w, errPreconditionRequired, http.StatusPreconditionRequired)
+		return 0, false
+	}
+
+	current, err := app.Models.Post.GetByID(id)
+	if err != nil || current.AuthorID != userID {
+		app.errorJSON(w, errors.New("post not found or unauthorized"), http.StatusNotFound)
+		return 0, false
+	}
+
+	if !etagMatches(ifMatch, current, false) {
+		app.preconditionFailed(w, current)
+		return 0, false
+	}
+
+	return current.Version, true
+}
+
+// staleWrite answers a write that lost a version race
+func (app *Config) staleWrite(w http.ResponseWriter, id int) {
+	latest, err := app.Models.Post.GetByID(id)
+	if err != nil {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+	app.preconditionFailed(w, latest)
+}
+
 // convertPostToFrontend converts a PostWithAuthor to frontend format
 func convertPostToFrontend(post *data.PostWithAuthor) map[string]any {
 	return map[string]any{
@@ -319,11 +673,16 @@ func convertPostToFrontend(post *data.PostWithAuthor) map[string]any {
 		"bedrooms":         post.Bedrooms,
 		"bathrooms":        post.Bathrooms,
 		"createdAt":        post.CreatedAt.UnixMilli(),
+		"updatedAt":        post.UpdatedAt.UnixMilli(),
 		"availableFrom":    post.AvailableFrom.UnixMilli(),
 		"availableTo":      post.AvailableTo.UnixMilli(),
+		"version":          post.Version,
+		"status":           post.Status,
 		"author": map[string]any{
-			"name":   post.Author.Name,
-			"avatar": post.Author.Avatar,
+			"name":        post.Author.Name,
+			"avatar":      post.Author.Avatar,
+			"rating":      post.Author.Rating,
+			"reviewCount": post.Author.ReviewCount,
 		},
 	}
 }
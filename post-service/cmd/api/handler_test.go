@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TestWriteAuthorComesFromCaller checks that PUT and DELETE refuse a body
+// naming another author before anything is written, so the revision history
+// can only ever record the signed-in caller as the actor. The handlers run
+// without a database; reaching it would panic.
+func TestWriteAuthorComesFromCaller(t *testing.T) {
+	app := &Config{}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		userID  string
+		body    string
+		want    int
+	}{
+		{
+			name:    "update naming another author",
+			handler: app.UpdatePost,
+			method:  http.MethodPut,
+			userID:  "3",
+			body:    `{"title":"Sunny 2BR","price":1500,"authorId":4}`,
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "update without a caller",
+			handler: app.UpdatePost,
+			method:  http.MethodPut,
+			body:    `{"title":"Sunny 2BR","price":1500,"authorId":3}`,
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "update without If-Match",
+			handler: app.UpdatePost,
+			method:  http.MethodPut,
+			userID:  "3",
+			body:    `{"title":"Sunny 2BR","price":1500,"authorId":3}`,
+			want:    http.StatusPreconditionRequired,
+		},
+		{
+			name:    "delete naming another author",
+			handler: app.DeletePost,
+			method:  http.MethodDelete,
+			userID:  "3",
+			body:    `{"authorId":4}`,
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "delete without a caller",
+			handler: app.DeletePost,
+			method:  http.MethodDelete,
+			body:    `{"authorId":3}`,
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "delete without a body or If-Match",
+			handler: app.DeletePost,
+			method:  http.MethodDelete,
+			userID:  "3",
+			want:    http.StatusPreconditionRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/posts/7", strings.NewReader(tt.body))
+			if tt.userID != "" {
+				r.Header.Set("X-User-ID", tt.userID)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "7")
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			tt.handler(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"post-service/data"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetPostHistory returns the revision history of a post. Only the post's
+// author and moderators may read it; it stays readable after the post is deleted.
+func (app *Config) GetPostHistory(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	if !app.canManagePost(w, r, postID) {
+		return
+	}
+
+	revisions, err := app.Models.Revision.GetByPostID(postID)
+	if err != nil {
+		log.Printf("Error getting history for post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if revisions == nil {
+		revisions = []*data.Revision{}
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  revisions,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// RestorePostRevision puts a post back into the state recorded by one of its
+// revisions. Restoring a delete revision brings the post back.
+func (app *Config) RestorePostRevision(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	revisionID, err := strconv.Atoi(chi.URLParam(r, "revisionId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid revision ID"), http.StatusBadRequest)
+		return
+	}
+
+	if !app.canManagePost(w, r, postID) {
+		return
+	}
+
+	actorID, _ := requestUserID(r)
+	log.Printf("Restoring post %d to revision %d by user %d", postID, revisionID, actorID)
+
+	// The revision's content is screened like an edit before it is restored
+	var screened *data.Screened
+	target, err := app.Models.Revision.GetOne(postID, revisionID)
+	if err == nil && target.Snapshot != nil {
+		content := *target.Snapshot
+		content.ID = postID
+		screened = app.screenPost(content, true)
+	}
+
+	_, err = app.Models.Revision.Restore(postID, revisionID, actorID, requestIsModerator(r), screened)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		app.errorJSON(w, errors.New("revision not found"), http.StatusNotFound)
+		return
+	case errors.Is(err, data.ErrNothingToRestore):
+		app.errorJSON(w, err, http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, data.ErrRestoreModerated):
+		app.errorJSON(w, err, http.StatusForbidden)
+		return
+	case err != nil:
+		log.Printf("Error restoring post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	restored, err := app.Models.Post.GetByID(postID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Post restored successfully",
+		Data:    convertPostToFrontend(restored),
+	}
+
+	app.writeJSON(w, http.StatusOK, payload, etagHeader(restored))
+}
+
+// canManagePost checks that the caller is the post's author or a moderator
+// and writes the error response when they aren't
+func (app *Config) canManagePost(w http.ResponseWriter, r *http.Request, postID int) bool {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return false
+	}
+
+	if requestIsModerator(r) {
+		return true
+	}
+
+	ownerID, err := app.Models.Revision.OwnerOf(postID)
+	if err != nil || ownerID != userID {
+		app.errorJSON(w, errors.New("post not found or unauthorized"), http.StatusNotFound)
+		return false
+	}
+
+	return true
+}
+
+// GetPostPriceHistory returns the asking prices a post has had, oldest first,
+// for the price chart on the listing page
+func (app *Config) GetPostPriceHistory(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	// Held and taken down posts keep their prices private like GetPostByID
+	post, err := app.Models.Post.GetByID(postID)
+	if err != nil || !canViewPost(r, post) {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+
+	points, err := app.Models.PriceHistory.GetByPostID(postID)
+	if err != nil {
+		log.Printf("Error getting price history for post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if points == nil {
+		points = []*data.PricePoint{}
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  points,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// icalEvent is one VEVENT of an iCalendar file
+type icalEvent struct {
+	UID         string
+	Sequence    int
+	Start       time.Time
+	End         time.Time
+	AllDay      bool // Start and End are dates; End is exclusive
+	Summary     string
+	Description string
+	Location    string
+	Status      string // CONFIRMED, CANCELLED, ...
+	URL         string
+}
+
+const icalTimeFormat = "20060102T150405Z"
+
+// icalendar renders events as an RFC 5545 calendar. No ORGANIZER or
+// ATTENDEE lines are written so no email address ends up in the file.
+func icalendar(name string, events []icalEvent) []byte {
+	var b strings.Builder
+
+	line := func(s string) {
+		// Fold lines longer than 75 octets without splitting a UTF-8 sequence
+		for len(s) > 75 {
+			cut := 75
+			for cut > 0 && s[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			b.WriteString(s[:cut] + "\r\n")
+			s = " " + s[cut:]
+		}
+		b.WriteString(s + "\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//DWELL//Listings//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	if name != "" {
+		line("X-WR-CALNAME:" + icalText(name))
+	}
+
+	stamp := time.Now().UTC().Format(icalTimeFormat)
+	for _, e := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line("DTSTAMP:" + stamp)
+		line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+		if e.AllDay {
+			line("DTSTART;VALUE=DATE:" + e.Start.Format("20060102"))
+			line("DTEND;VALUE=DATE:" + e.End.Format("20060102"))
+		} else {
+			line("DTSTART:" + e.Start.UTC().Format(icalTimeFormat))
+			line("DTEND:" + e.End.UTC().Format(icalTimeFormat))
+		}
+		line("SUMMARY:" + icalText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:" + icalText(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION:" + icalText(e.Location))
+		}
+		if e.URL != "" {
+			line("URL:" + e.URL)
+		}
+		if e.Status != "" {
+			line("STATUS:" + e.Status)
+		}
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+
+	return []byte(b.String())
+}
+
+// icalText escapes a TEXT value
+var icalText = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+).Replace
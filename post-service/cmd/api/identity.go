@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// requestUserID returns the caller's user ID as forwarded by the broker
+// after it validated the access token
+func requestUserID(r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// requestIsAdmin reports whether the broker marked the caller as an admin
+func requestIsAdmin(r *http.Request) bool {
+	return r.Header.Get("X-User-Role") == "admin"
+}
+
+// requestIsModerator reports whether the caller may review reported and
+// flagged content; admins can do everything moderators can
+func requestIsModerator(r *http.Request) bool {
+	role := r.Header.Get("X-User-Role")
+	return role == "moderator" || role == "admin"
+}
+
+// requireModerator checks the caller is a moderator or admin and writes the
+// error response when they aren't
+func (app *Config) requireModerator(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := requestUserID(r); !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return false
+	}
+	if !requestIsModerator(r) {
+		app.errorJSON(w, errors.New("moderator access required"), http.StatusForbidden)
+		return false
+	}
+	return true
+}
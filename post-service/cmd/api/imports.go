@@ -0,0 +1,625 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"post-service/data"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxImportRows  = 500
+	maxImportBytes = 10485760 // same as readJSON, listings may carry base64 images
+	maxExternalRef = 100
+)
+
+// listingColumns are the CSV columns of the import/export format, in the
+// order exports write them. JSON Lines use the same names as keys.
+var listingColumns = []string{
+	"id", "externalRef", "title", "price", "type", "bedrooms", "bathrooms",
+	"neighborhood", "location", "lat", "lng", "radius",
+	"availableFrom", "availableTo", "description", "imageUrl", "additionalImages",
+}
+
+// listingTypes are the property types the listing form offers
+var listingTypes = []string{"Apartment", "House", "Studio", "Loft"}
+
+// listingRow is one listing in the import/export format. id is the DWELL
+// listing ID and externalRef the owner's own reference for it; either one
+// updates an existing listing, and a row with neither creates one. Dates are
+// YYYY-MM-DD and CSV separates additionalImages with "|".
+type listingRow struct {
+	ID               int      `json:"id,omitempty"`
+	ExternalRef      string   `json:"externalRef,omitempty"`
+	Title            string   `json:"title"`
+	Price            float64  `json:"price"`
+	Type             string   `json:"type"`
+	Bedrooms         int      `json:"bedrooms"`
+	Bathrooms        int      `json:"bathrooms"`
+	Neighborhood     string   `json:"neighborhood"`
+	Location         string   `json:"location,omitempty"`
+	Lat              float64  `json:"lat"`
+	Lng              float64  `json:"lng"`
+	Radius           int      `json:"radius"`
+	AvailableFrom    string   `json:"availableFrom"`
+	AvailableTo      string   `json:"availableTo"`
+	Description      string   `json:"description"`
+	ImageURL         string   `json:"imageUrl"`
+	AdditionalImages []string `json:"additionalImages,omitempty"`
+}
+
+// parsedRow is a listingRow read from an upload with the line it started on
+// and the errors found while reading it
+type parsedRow struct {
+	line   int
+	row    listingRow
+	errors []string
+}
+
+// importResult reports what happened to one row
+type importResult struct {
+	Line        int      `json:"line"`
+	ExternalRef string   `json:"externalRef,omitempty"`
+	PostID      int      `json:"postId,omitempty"`
+	Action      string   `json:"action"` // create, update, unchanged or error
+	Status      string   `json:"status,omitempty"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// importReport is the response of an import
+type importReport struct {
+	DryRun    bool            `json:"dryRun"`
+	Total     int             `json:"total"`
+	Created   int             `json:"created"`
+	Updated   int             `json:"updated"`
+	Unchanged int             `json:"unchanged"`
+	Failed    int             `json:"failed"`
+	Rows      []*importResult `json:"rows"`
+}
+
+// transferFormat picks csv or jsonl from the format parameter, falling back
+// to the Content-Type of an upload
+func transferFormat(format, contentType string) (string, error) {
+	if format == "" && contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		switch mediaType {
+		case "text/csv":
+			format = "csv"
+		case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+			format = "jsonl"
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case "csv":
+		return "csv", nil
+	case "jsonl", "ndjson":
+		return "jsonl", nil
+	}
+	return "", errors.New("format must be csv or jsonl")
+}
+
+// ImportPosts creates and updates the caller's listings from a CSV or JSON
+// Lines upload. Every row is validated and written on its own, so one bad
+// row doesn't stop the rest, and the response reports each row. With
+// ?dryRun=true nothing is saved.
+func (app *Config) ImportPosts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	format, err := transferFormat(r.URL.Query().Get("format"), r.Header.Get("Content-Type"))
+	if err != nil {
+		app.errorJSON(w, err, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	dryRun := false
+	if v := r.URL.Query().Get("dryRun"); v != "" {
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			app.errorJSON(w, errors.New("dryRun must be true or false"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var rows []*parsedRow
+	if format == "csv" {
+		rows, err = readCSVRows(body)
+	} else {
+		rows, err = readJSONLRows(body)
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if len(rows) == 0 {
+		app.errorJSON(w, errors.New("the file has no listings"), http.StatusBadRequest)
+		return
+	}
+	if len(rows) > maxImportRows {
+		app.errorJSON(w, fmt.Errorf("at most %d listings can be imported at once", maxImportRows), http.StatusBadRequest)
+		return
+	}
+
+	report := importReport{DryRun: dryRun, Total: len(rows), Rows: make([]*importResult, 0, len(rows))}
+	refLines := map[string]int{}
+	idLines := map[int]int{}
+
+	for _, in := range rows {
+		result := &importResult{Line: in.line, ExternalRef: in.row.ExternalRef, PostID: in.row.ID}
+		report.Rows = append(report.Rows, result)
+
+		// Rows that couldn't be read are reported as they are, since their
+		// other fields would only add noise
+		errs := in.errors
+		if len(errs) == 0 {
+			errs = validateListingRow(&in.row)
+		}
+		if ref := in.row.ExternalRef; ref != "" {
+			if line, ok := refLines[ref]; ok {
+				errs = append(errs, fmt.Sprintf("externalRef is repeated from line %d", line))
+			} else {
+				refLines[ref] = in.line
+			}
+		}
+		if id := in.row.ID; id != 0 {
+			if line, ok := idLines[id]; ok {
+				errs = append(errs, fmt.Sprintf("id is repeated from line %d", line))
+			} else {
+				idLines[id] = in.line
+			}
+		}
+		if len(errs) > 0 {
+			result.Action, result.Errors = "error", errs
+			report.Failed++
+			continue
+		}
+
+		if err := app.importRow(userID, in.row, dryRun, result); err != nil {
+			result.Action, result.Errors = "error", []string{err.Error()}
+			report.Failed++
+			continue
+		}
+
+		switch result.Action {
+		case data.ImportCreate:
+			report.Created++
+		case data.ImportUpdate:
+			report.Updated++
+		case data.ImportUnchanged:
+			report.Unchanged++
+		}
+	}
+
+	log.Printf("User %d imported %d listings (dry run %t): %d created, %d updated, %d failed",
+		userID, report.Total, dryRun, report.Created, report.Updated, report.Failed)
+
+	message := "Import finished"
+	if dryRun {
+		message = "Import checked, nothing was saved"
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    report,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// importRow writes one valid row and fills in its result. Listings are
+// screened like CreatePost and UpdatePost do.
+func (app *Config) importRow(userID int, row listingRow, dryRun bool, result *importResult) error {
+	post := postFromRow(row, userID)
+
+	if post.ID == 0 && row.ExternalRef != "" {
+		id, err := app.Models.Import.PostByRef(userID, row.ExternalRef)
+		if err != nil {
+			log.Printf("Error looking up externalRef of user %d: %v", userID, err)
+			return errors.New("could not save this listing")
+		}
+		post.ID = id
+	}
+
+	// Dry runs don't fetch remote photos, which a real import may hash
+	screened := app.screenPost(post, !dryRun)
+
+	action, change, err := app.Models.Import.Upsert(post, row.ExternalRef, dryRun, screened)
+	switch {
+	case errors.Is(err, data.ErrRefTaken):
+		return err
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("listing %d not found", post.ID)
+	case err != nil:
+		log.Printf("Error importing listing for user %d: %v", userID, err)
+		return errors.New("could not save this listing")
+	}
+
+	result.Action = action
+	result.Status = change.After.Status
+	if action != data.ImportCreate || !dryRun {
+		result.PostID = change.After.ID
+	}
+
+	return nil
+}
+
+// validateListingRow checks a row the way the listing form does and
+// normalises its type. It returns every problem found.
+func validateListingRow(row *listingRow) []string {
+	var errs []string
+
+	row.ExternalRef = strings.TrimSpace(row.ExternalRef)
+	row.Title = strings.TrimSpace(row.Title)
+	row.Neighborhood = strings.TrimSpace(row.Neighborhood)
+
+	if row.ID < 0 {
+		errs = append(errs, "id must be a listing ID")
+	}
+	if len(row.ExternalRef) > maxExternalRef {
+		errs = append(errs, fmt.Sprintf("externalRef must be at most %d characters", maxExternalRef))
+	}
+	if row.Title == "" {
+		errs = append(errs, "title is required")
+	}
+	if row.Price <= 0 {
+		errs = append(errs, "price must be positive")
+	}
+
+	listingType := ""
+	for _, t := range listingTypes {
+		if strings.EqualFold(t, strings.TrimSpace(row.Type)) {
+			listingType = t
+		}
+	}
+	if listingType == "" {
+		errs = append(errs, "type must be one of "+strings.Join(listingTypes, ", "))
+	}
+	row.Type = listingType
+
+	if row.Bedrooms < 0 {
+		errs = append(errs, "bedrooms can't be negative")
+	}
+	if row.Bathrooms < 0 {
+		errs = append(errs, "bathrooms can't be negative")
+	}
+	if row.Neighborhood == "" {
+		errs = append(errs, "neighborhood is required")
+	}
+	if row.Lat < -90 || row.Lat > 90 {
+		errs = append(errs, "lat must be between -90 and 90")
+	}
+	if row.Lng < -180 || row.Lng > 180 {
+		errs = append(errs, "lng must be between -180 and 180")
+	}
+	if row.Radius < 0 {
+		errs = append(errs, "radius can't be negative")
+	}
+
+	from, fromErr := time.Parse("2006-01-02", row.AvailableFrom)
+	if fromErr != nil {
+		errs = append(errs, "availableFrom must be a YYYY-MM-DD date")
+	}
+	to, toErr := time.Parse("2006-01-02", row.AvailableTo)
+	if toErr != nil {
+		errs = append(errs, "availableTo must be a YYYY-MM-DD date")
+	}
+	if fromErr == nil && toErr == nil && to.Before(from) {
+		errs = append(errs, "availableTo is before availableFrom")
+	}
+
+	return errs
+}
+
+// postFromRow converts a validated row into a data.Post
+func postFromRow(row listingRow, authorID int) data.Post {
+	return data.Post{
+		ID:               row.ID,
+		Title:            row.Title,
+		Price:            row.Price,
+		Location:         strings.TrimSpace(row.Location),
+		Neighborhood:     row.Neighborhood,
+		Lat:              row.Lat,
+		Lng:              row.Lng,
+		Radius:           row.Radius,
+		Type:             row.Type,
+		ImageURL:         strings.TrimSpace(row.ImageURL),
+		AdditionalImages: row.AdditionalImages,
+		Description:      row.Description,
+		Bedrooms:         row.Bedrooms,
+		Bathrooms:        row.Bathrooms,
+		AvailableFrom:    feedDate(row.AvailableFrom),
+		AvailableTo:      feedDate(row.AvailableTo),
+		AuthorID:         authorID,
+	}
+}
+
+// rowFromPost converts a stored listing into the export format
+func rowFromPost(post *data.PostWithAuthor, ref string) listingRow {
+	return listingRow{
+		ID:               post.ID,
+		ExternalRef:      ref,
+		Title:            post.Title,
+		Price:            post.Price,
+		Type:             post.Type,
+		Bedrooms:         post.Bedrooms,
+		Bathrooms:        post.Bathrooms,
+		Neighborhood:     post.Neighborhood,
+		Location:         post.Location,
+		Lat:              post.Lat,
+		Lng:              post.Lng,
+		Radius:           post.Radius,
+		AvailableFrom:    post.AvailableFrom.UTC().Format("2006-01-02"),
+		AvailableTo:      post.AvailableTo.UTC().Format("2006-01-02"),
+		Description:      post.Description,
+		ImageURL:         post.ImageURL,
+		AdditionalImages: post.AdditionalImages,
+	}
+}
+
+// readCSVRows reads a CSV upload whose first record names the columns.
+// Columns may come in any order and be left out, but unknown ones are
+// rejected so a typo doesn't silently drop a field.
+func readCSVRows(body io.Reader) ([]*parsedRow, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	reader.FieldsPerRecord = len(header)
+
+	// Spreadsheet apps often start the file with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	seen := map[string]bool{}
+	for _, name := range header {
+		name = strings.TrimSpace(name)
+		known := false
+		for _, column := range listingColumns {
+			known = known || column == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column %q, expected some of: %s", name, strings.Join(listingColumns, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("column %q appears twice", name)
+		}
+		seen[name] = true
+	}
+
+	var rows []*parsedRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, rowFromRecord(line, header, record))
+	}
+}
+
+// rowFromRecord reads one CSV record. Empty numeric cells are zero.
+func rowFromRecord(line int, header, record []string) *parsedRow {
+	in := &parsedRow{line: line}
+	row := &in.row
+
+	integer := func(name, value string, dst *int) {
+		if value == "" {
+			return
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			in.errors = append(in.errors, name+" must be a whole number")
+			return
+		}
+		*dst = n
+	}
+	number := func(name, value string, dst *float64) {
+		if value == "" {
+			return
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			in.errors = append(in.errors, name+" must be a number")
+			return
+		}
+		*dst = f
+	}
+
+	for i, name := range header {
+		value := strings.TrimSpace(record[i])
+		switch strings.TrimSpace(name) {
+		case "id":
+			integer(name, value, &row.ID)
+		case "externalRef":
+			row.ExternalRef = value
+		case "title":
+			row.Title = value
+		case "price":
+			number(name, value, &row.Price)
+		case "type":
+			row.Type = value
+		case "bedrooms":
+			integer(name, value, &row.Bedrooms)
+		case "bathrooms":
+			integer(name, value, &row.Bathrooms)
+		case "neighborhood":
+			row.Neighborhood = value
+		case "location":
+			row.Location = value
+		case "lat":
+			number(name, value, &row.Lat)
+		case "lng":
+			number(name, value, &row.Lng)
+		case "radius":
+			integer(name, value, &row.Radius)
+		case "availableFrom":
+			row.AvailableFrom = value
+		case "availableTo":
+			row.AvailableTo = value
+		case "description":
+			row.Description = record[i]
+		case "imageUrl":
+			row.ImageURL = value
+		case "additionalImages":
+			for _, src := range strings.Split(value, "|") {
+				if src = strings.TrimSpace(src); src != "" {
+					row.AdditionalImages = append(row.AdditionalImages, src)
+				}
+			}
+		}
+	}
+
+	return in
+}
+
+// readJSONLRows reads a JSON Lines upload, one listing object per line.
+// Blank lines are skipped and a line that doesn't decode is reported as a
+// failed row.
+func readJSONLRows(body io.Reader) ([]*parsedRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportBytes)
+
+	var rows []*parsedRow
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		in := &parsedRow{line: line}
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&in.row); err != nil {
+			in.row = listingRow{}
+			in.errors = []string{fmt.Sprintf("invalid JSON: %v", err)}
+		} else if dec.More() {
+			in.errors = []string{"a line must hold a single JSON object"}
+		}
+		rows = append(rows, in)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid JSON Lines: %v", err)
+	}
+	return rows, nil
+}
+
+// ExportPosts downloads all of the caller's listings as CSV (the default)
+// or JSON Lines, in the format ImportPosts reads back
+func (app *Config) ExportPosts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	format, err := transferFormat(format, "")
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	posts, err := app.Models.Post.GetByAuthorID(userID)
+	if err != nil {
+		log.Printf("Error exporting posts of user %d: %v", userID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	refs, err := app.Models.Import.Refs(userID)
+	if err != nil {
+		log.Printf("Error exporting posts of user %d: %v", userID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if format == "csv" {
+		out := csv.NewWriter(&buf)
+		out.Write(listingColumns)
+		for _, post := range posts {
+			out.Write(csvRecord(rowFromPost(post, refs[post.ID])))
+		}
+		out.Flush()
+		err = out.Error()
+	} else {
+		enc := json.NewEncoder(&buf)
+		for _, post := range posts {
+			if err = enc.Encode(rowFromPost(post, refs[post.ID])); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == "jsonl" {
+		contentType = "application/x-ndjson"
+	}
+	filename := fmt.Sprintf("listings-%s.%s", time.Now().Format("2006-01-02"), format)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// csvRecord writes a row in listingColumns order
+func csvRecord(row listingRow) []string {
+	float := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+
+	return []string{
+		strconv.Itoa(row.ID),
+		row.ExternalRef,
+		row.Title,
+		float(row.Price),
+		row.Type,
+		strconv.Itoa(row.Bedrooms),
+		strconv.Itoa(row.Bathrooms),
+		row.Neighborhood,
+		row.Location,
+		float(row.Lat),
+		float(row.Lng),
+		strconv.Itoa(row.Radius),
+		row.AvailableFrom,
+		row.AvailableTo,
+		row.Description,
+		row.ImageURL,
+		strings.Join(row.AdditionalImages, "|"),
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// validListingRow is a row that passes validateListingRow
+func validListingRow() listingRow {
+	return listingRow{
+		Title:         "Sunny 2BR",
+		Price:         1500,
+		Type:          "Apartment",
+		Bedrooms:      2,
+		Bathrooms:     1,
+		Neighborhood:  "North Davis",
+		Lat:           38.56,
+		Lng:           -121.74,
+		AvailableFrom: "2026-09-01",
+		AvailableTo:   "2027-06-30",
+	}
+}
+
+func TestValidateListingRow(t *testing.T) {
+	tests := []struct {
+		name     string
+		edit     func(row *listingRow)
+		wantErrs []string
+		check    func(t *testing.T, row listingRow)
+	}{
+		{name: "valid row", edit: func(row *listingRow) {}},
+		{
+			name: "type is matched case-insensitively",
+			edit: func(row *listingRow) { row.Type = " studio " },
+			check: func(t *testing.T, row listingRow) {
+				if row.Type != "Studio" {
+					t.Errorf("type = %q, want Studio", row.Type)
+				}
+			},
+		},
+		{
+			name: "text fields are trimmed",
+			edit: func(row *listingRow) { row.Title = "  Sunny 2BR "; row.ExternalRef = " A-1 " },
+			check: func(t *testing.T, row listingRow) {
+				if row.Title != "Sunny 2BR" || row.ExternalRef != "A-1" {
+					t.Errorf("title, externalRef = %q, %q", row.Title, row.ExternalRef)
+				}
+			},
+		},
+		{name: "same start and end day", edit: func(row *listingRow) { row.AvailableTo = row.AvailableFrom }},
+		{name: "negative id", edit: func(row *listingRow) { row.ID = -1 }, wantErrs: []string{"id must be a listing ID"}},
+		{
+			name:     "long externalRef",
+			edit:     func(row *listingRow) { row.ExternalRef = strings.Repeat("x", maxExternalRef+1) },
+			wantErrs: []string{"externalRef must be at most 100 characters"},
+		},
+		{name: "blank title", edit: func(row *listingRow) { row.Title = "   " }, wantErrs: []string{"title is required"}},
+		{name: "zero price", edit: func(row *listingRow) { row.Price = 0 }, wantErrs: []string{"price must be positive"}},
+		{
+			name:     "unknown type",
+			edit:     func(row *listingRow) { row.Type = "Castle" },
+			wantErrs: []string{"type must be one of Apartment, House, Studio, Loft"},
+		},
+		{
+			name:     "negative rooms",
+			edit:     func(row *listingRow) { row.Bedrooms = -1; row.Bathrooms = -1 },
+			wantErrs: []string{"bedrooms can't be negative", "bathrooms can't be negative"},
+		},
+		{name: "missing neighborhood", edit: func(row *listingRow) { row.Neighborhood = "" }, wantErrs: []string{"neighborhood is required"}},
+		{
+			name:     "coordinates out of range",
+			edit:     func(row *listingRow) { row.Lat = 91; row.Lng = -181 },
+			wantErrs: []string{"lat must be between -90 and 90", "lng must be between -180 and 180"},
+		},
+		{name: "negative radius", edit: func(row *listingRow) { row.Radius = -5 }, wantErrs: []string{"radius can't be negative"}},
+		{
+			name:     "dates in another format",
+			edit:     func(row *listingRow) { row.AvailableFrom = "09/01/2026"; row.AvailableTo = "" },
+			wantErrs: []string{"availableFrom must be a YYYY-MM-DD date", "availableTo must be a YYYY-MM-DD date"},
+		},
+		{
+			name:     "end before start",
+			edit:     func(row *listingRow) { row.AvailableTo = "2026-08-31" },
+			wantErrs: []string{"availableTo is before availableFrom"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := validListingRow()
+			tt.edit(&row)
+
+			errs := validateListingRow(&row)
+			if !reflect.DeepEqual(errs, tt.wantErrs) {
+				t.Errorf("validateListingRow() = %q, want %q", errs, tt.wantErrs)
+			}
+			if tt.check != nil {
+				tt.check(t, row)
+			}
+		})
+	}
+}
+
+func TestReadCSVRows(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     []parsedRow
+		wantErrs string
+	}{
+		{name: "empty upload", body: ""},
+		{name: "header only", body: "title,price\n"},
+		{
+			name: "columns in any order",
+			body: "price,title,additionalImages\n1500,Sunny 2BR,a.jpg| b.jpg |\n",
+			want: []parsedRow{{line: 2, row: listingRow{
+				Title: "Sunny 2BR", Price: 1500, AdditionalImages: []string{"a.jpg", "b.jpg"},
+			}}},
+		},
+		{
+			name: "byte order mark and spaces",
+			body: "\ufeffid, externalRef,bedrooms\n 7, A-1 ,\n",
+			want: []parsedRow{{line: 2, row: listingRow{ID: 7, ExternalRef: "A-1"}}},
+		},
+		{
+			name: "quoted description keeps its lines",
+			body: "title,description\nLoft,\"Two lines\nof text\"\nStudio,\n",
+			want: []parsedRow{
+				{line: 2, row: listingRow{Title: "Loft", Description: "Two lines\nof text"}},
+				{line: 4, row: listingRow{Title: "Studio"}},
+			},
+		},
+		{
+			name: "bad numbers are row errors",
+			body: "id,price,lat\nseven,cheap,north\n",
+			want: []parsedRow{{line: 2, errors: []string{
+				"id must be a whole number", "price must be a number", "lat must be a number",
+			}}},
+		},
+		{name: "unknown column", body: "title,owner\n", wantErrs: `unknown column "owner"`},
+		{name: "repeated column", body: "title,title\n", wantErrs: `column "title" appears twice`},
+		{name: "short record", body: "title,price\nLoft\n", wantErrs: "invalid CSV"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readCSVRows(strings.NewReader(tt.body))
+			if tt.wantErrs != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrs) {
+					t.Fatalf("readCSVRows() error = %v, want %q", err, tt.wantErrs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readCSVRows() error = %v", err)
+			}
+			assertParsedRows(t, rows, tt.want)
+		})
+	}
+}
+
+func TestReadJSONLRows(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []parsedRow
+	}{
+		{name: "empty upload", body: ""},
+		{
+			name: "blank lines are skipped but counted",
+			body: "{\"title\":\"Loft\",\"price\":900}\n\n  \n{\"externalRef\":\"A-1\",\"additionalImages\":[\"a.jpg\"]}\n",
+			want: []parsedRow{
+				{line: 1, row: listingRow{Title: "Loft", Price: 900}},
+				{line: 4, row: listingRow{ExternalRef: "A-1", AdditionalImages: []string{"a.jpg"}}},
+			},
+		},
+		{
+			name: "unknown field",
+			body: "{\"title\":\"Loft\",\"owner\":\"someone\"}\n",
+			want: []parsedRow{{line: 1, errors: []string{`invalid JSON: json: unknown field "owner"`}}},
+		},
+		{
+			name: "wrong type",
+			body: "{\"price\":\"cheap\"}\n",
+			want: []parsedRow{{line: 1, errors: []string{"invalid JSON: json: cannot unmarshal string"}}},
+		},
+		{
+			name: "two objects on a line",
+			body: "{\"title\":\"Loft\"} {\"title\":\"Studio\"}\n",
+			want: []parsedRow{{line: 1, row: listingRow{Title: "Loft"}, errors: []string{"a line must hold a single JSON object"}}},
+		},
+		{
+			name: "a bad line doesn't stop the rest",
+			body: "{\n{\"title\":\"Studio\"}\n",
+			want: []parsedRow{
+				{line: 1, errors: []string{"invalid JSON"}},
+				{line: 2, row: listingRow{Title: "Studio"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readJSONLRows(strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("readJSONLRows() error = %v", err)
+			}
+			assertParsedRows(t, rows, tt.want)
+		})
+	}
+}
+
+// assertParsedRows compares rows with want. Errors only need to start with
+// the wanted text since decoder messages vary between Go versions.
+func assertParsedRows(t *testing.T, rows []*parsedRow, want []parsedRow) {
+	t.Helper()
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i, row := range rows {
+		if row.line != want[i].line || !reflect.DeepEqual(row.row, want[i].row) {
+			t.Errorf("row %d = line %d %+v, want line %d %+v", i, row.line, row.row, want[i].line, want[i].row)
+		}
+		matches := len(row.errors) == len(want[i].errors)
+		for j := 0; matches && j < len(row.errors); j++ {
+			matches = strings.HasPrefix(row.errors[j], want[i].errors[j])
+		}
+		if !matches {
+			t.Errorf("row %d errors = %q, want %q", i, row.errors, want[i].errors)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"post-service/data"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	marketStatsInterval = time.Hour
+	// marketStatsMonths is how far back the rollup goes
+	marketStatsMonths = 24
+	// Buckets with fewer listings or landlords than these are published
+	// without prices, so no one landlord's rents can be worked out
+	minMarketListings  = 5
+	minMarketLandlords = 3
+)
+
+// marketDimensions are the ways the market stats can be broken down
+var marketDimensions = []string{"neighborhood", "bedrooms", "type"}
+
+// runMarketStatsRollup rebuilds the market stats rollup at startup and then
+// every marketStatsInterval
+func (app *Config) runMarketStatsRollup() {
+	ticker := time.NewTicker(marketStatsInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := app.Models.Market.Refresh(time.Now(), marketStatsMonths, minMarketListings, minMarketLandlords)
+		if err != nil {
+			log.Printf("Error refreshing market stats: %v", err)
+		} else {
+			log.Printf("Refreshed market stats (%d buckets)", n)
+		}
+		<-ticker.C
+	}
+}
+
+// marketFilter reads the neighborhood, bedrooms and type parameters
+func marketFilter(q url.Values) (data.MarketFilter, error) {
+	filter := data.MarketFilter{
+		Neighborhood: strings.TrimSpace(q.Get("neighborhood")),
+		Type:         strings.TrimSpace(q.Get("type")),
+	}
+
+	for _, t := range listingTypes {
+		if strings.EqualFold(t, filter.Type) {
+			filter.Type = t
+		}
+	}
+
+	if v := q.Get("bedrooms"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return filter, errors.New("bedrooms must be a whole number")
+		}
+		filter.Bedrooms = &n
+	}
+
+	return filter, nil
+}
+
+// marketMeta describes the rollup a response was read from
+func marketMeta(computedAt time.Time) map[string]any {
+	return map[string]any{
+		"computedAt":   computedAt.UnixMilli(),
+		"minListings":  minMarketListings,
+		"minLandlords": minMarketLandlords,
+	}
+}
+
+// GetMarketStats returns the p25, median and p75 price and the inventory of
+// a month (?month=YYYY-MM, the current one by default). neighborhood,
+// bedrooms and type narrow the stats to one value each, and groupBy lists
+// the dimensions to break down into one bucket per value instead.
+func (app *Config) GetMarketStats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter, err := marketFilter(q)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	groupBy := map[string]bool{}
+	for _, dim := range strings.Split(q.Get("groupBy"), ",") {
+		dim = strings.TrimSpace(dim)
+		if dim == "" {
+			continue
+		}
+		known := false
+		for _, d := range marketDimensions {
+			known = known || d == dim
+		}
+		if !known {
+			app.errorJSON(w, fmt.Errorf("groupBy can hold %s", strings.Join(marketDimensions, ", ")), http.StatusBadRequest)
+			return
+		}
+		if q.Get(dim) != "" {
+			app.errorJSON(w, fmt.Errorf("%s can't be both filtered and grouped by", dim), http.StatusBadRequest)
+			return
+		}
+		groupBy[dim] = true
+	}
+
+	latest, computedAt, ok, err := app.Models.Market.LastRefresh()
+	if err != nil {
+		log.Printf("Error reading market stats: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		app.errorJSON(w, errors.New("market statistics are not ready yet"), http.StatusServiceUnavailable)
+		return
+	}
+
+	month := latest
+	if v := q.Get("month"); v != "" {
+		if _, err := time.Parse("2006-01", v); err != nil {
+			app.errorJSON(w, errors.New("month must be YYYY-MM"), http.StatusBadRequest)
+			return
+		}
+		month = v
+	}
+
+	buckets, err := app.Models.Market.Buckets(month, filter, groupBy)
+	if err != nil {
+		log.Printf("Error reading market stats: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := marketMeta(computedAt)
+	response["month"] = month
+	response["buckets"] = buckets
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  response,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload, http.Header{"Cache-Control": []string{"public, max-age=300"}})
+}
+
+// GetMarketSeries returns the monthly stats of one bucket, picked with
+// neighborhood, bedrooms and type, for the last ?months=12 months (at most
+// marketStatsMonths). Months without listings are included with zero
+// inventory so the series has no gaps.
+func (app *Config) GetMarketSeries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter, err := marketFilter(q)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	months := 12
+	if v := q.Get("months"); v != "" {
+		months, err = strconv.Atoi(v)
+		if err != nil || months < 1 || months > marketStatsMonths {
+			app.errorJSON(w, fmt.Errorf("months must be between 1 and %d", marketStatsMonths), http.StatusBadRequest)
+			return
+		}
+	}
+
+	latest, computedAt, ok, err := app.Models.Market.LastRefresh()
+	if err != nil {
+		log.Printf("Error reading market stats: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		app.errorJSON(w, errors.New("market statistics are not ready yet"), http.StatusServiceUnavailable)
+		return
+	}
+
+	end, _ := time.Parse("2006-01", latest)
+	start := end.AddDate(0, -(months - 1), 0)
+
+	buckets, err := app.Models.Market.Series(filter, start.Format("2006-01"))
+	if err != nil {
+		log.Printf("Error reading market stats: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	byMonth := make(map[string]*data.MarketBucket, len(buckets))
+	for _, b := range buckets {
+		byMonth[b.Month] = b
+	}
+
+	series := make([]*data.MarketBucket, 0, months)
+	for m := start; !m.After(end); m = m.AddDate(0, 1, 0) {
+		b, ok := byMonth[m.Format("2006-01")]
+		if !ok {
+			b = emptyMarketBucket(m.Format("2006-01"), filter)
+		}
+		series = append(series, b)
+	}
+
+	response := marketMeta(computedAt)
+	response["series"] = series
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  response,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload, http.Header{"Cache-Control": []string{"public, max-age=300"}})
+}
+
+// emptyMarketBucket is the bucket of a month without matching listings
+func emptyMarketBucket(month string, filter data.MarketFilter) *data.MarketBucket {
+	b := &data.MarketBucket{Month: month}
+	if filter.Neighborhood != "" {
+		b.Neighborhood = &filter.Neighborhood
+	}
+	if filter.Bedrooms != nil {
+		bedrooms := min(*filter.Bedrooms, data.MaxBedroomBucket)
+		b.Bedrooms = &bedrooms
+	}
+	if filter.Type != "" {
+		b.Type = &filter.Type
+	}
+	return b
+}
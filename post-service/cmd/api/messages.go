@@ -0,0 +1,629 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"post-service/data"
+	"post-service/event"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxMessageLength      = 5000
+	messageSnippetLength  = 300
+	defaultConversations  = 20
+	maxConversations      = 50
+	defaultMessagesPage   = 50
+	maxMessagesPage       = 100
+	moderationContextSize = 50
+)
+
+// userReportNotices are sent to a reported user for each moderation action
+var userReportNotices = map[string]struct{ title, message string }{
+	data.ActionWarn:    {"Warning about your messages", "A moderator reviewed a report about your messages on %q and issued a warning. Repeated violations may lead to suspension."},
+	data.ActionSuspend: {"Your account has been suspended", "Your account has been suspended following a review of your messages on %q."},
+}
+
+// messagingUser returns the caller and records them as online for the
+// offline mail check
+func (app *Config) messagingUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return 0, false
+	}
+
+	if err := app.Models.Messaging.Touch(userID); err != nil {
+		log.Printf("Error recording messaging presence of user %d: %v", userID, err)
+	}
+
+	return userID, true
+}
+
+// participantConversation loads the {id} conversation and answers 404 unless
+// the caller takes part in it
+func (app *Config) participantConversation(w http.ResponseWriter, r *http.Request, userID int) (*data.Conversation, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid conversation ID"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	conversation, err := app.Models.Messaging.Get(id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("conversation not found"), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return conversation, true
+}
+
+// readMessageBody reads and validates the {"body"} of a new message
+func (app *Config) readMessageBody(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var requestPayload struct {
+		Body string `json:"body"`
+	}
+
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return "", false
+	}
+
+	body := strings.TrimSpace(requestPayload.Body)
+	if body == "" {
+		app.errorJSON(w, errors.New("message body is required"), http.StatusUnprocessableEntity)
+		return "", false
+	}
+	if len(body) > maxMessageLength {
+		app.errorJSON(w, fmt.Errorf("message must be at most %d characters", maxMessageLength), http.StatusUnprocessableEntity)
+		return "", false
+	}
+
+	return body, true
+}
+
+// StartConversation sends a renter's first message about a listing to its
+// author. Writing about the same listing again continues the existing
+// conversation.
+func (app *Config) StartConversation(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := app.messagingUser(w, r)
+	if !ok {
+		return
+	}
+
+	body, ok := app.readMessageBody(w, r)
+	if !ok {
+		return
+	}
+
+	post, err := app.Models.Post.GetByID(postID)
+	if err != nil || !canViewPost(r, post) {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+
+	if post.AuthorID == userID {
+		app.errorJSON(w, errors.New("you cannot message yourself about your own post"), http.StatusBadRequest)
+		return
+	}
+
+	if post.Status != data.StatusPublished {
+		app.errorJSON(w, errors.New("this listing is no longer taking messages"), http.StatusConflict)
+		return
+	}
+
+	blocked, err := app.Models.Messaging.IsBlocked(userID, post.AuthorID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		app.errorJSON(w, data.ErrBlocked, http.StatusForbidden)
+		return
+	}
+
+	conversationID, created, err := app.Models.Messaging.Start(postID, userID, post.AuthorID)
+	if err != nil {
+		log.Printf("Error starting conversation on post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	conversation, err := app.Models.Messaging.Get(conversationID, userID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	msg, ok := app.sendMessage(w, conversation, userID, body)
+	if !ok {
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		log.Printf("User %d started conversation %d on post %d", userID, conversationID, postID)
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Message sent",
+		Data: map[string]any{
+			"conversation": conversation,
+			"message":      msg,
+		},
+	}
+
+	app.writeJSON(w, status, payload)
+}
+
+// GetConversations lists the caller's conversations, most recently active
+// first, each with the other participant, the last message and the unread count
+func (app *Config) GetConversations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.messagingUser(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := defaultConversations, 0
+	for _, p := range []struct {
+		key string
+		dst *int
+		min int
+	}{{"limit", &limit, 1}, {"offset", &offset, 0}} {
+		if raw := r.URL.Query().Get(p.key); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < p.min {
+				app.errorJSON(w, fmt.Errorf("invalid %s", p.key), http.StatusBadRequest)
+				return
+			}
+			*p.dst = n
+		}
+	}
+	limit = min(limit, maxConversations)
+
+	conversations, err := app.Models.Messaging.List(userID, limit, offset)
+	if err != nil {
+		log.Printf("Error listing conversations of user %d: %v", userID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  conversations,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetMessagingUnreadCount returns how many unread messages the caller has
+// and in how many conversations
+func (app *Config) GetMessagingUnreadCount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.messagingUser(w, r)
+	if !ok {
+		return
+	}
+
+	messages, conversations, err := app.Models.Messaging.UnreadCount(userID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  map[string]int{"messages": messages, "conversations": conversations},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetConversation returns a conversation with a page of its messages,
+// newest first. ?before= continues from the oldest message of the last page.
+func (app *Config) GetConversation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.messagingUser(w, r)
+	if !ok {
+		return
+	}
+
+	conversation, ok := app.participantConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	limit := defaultMessagesPage
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			app.errorJSON(w, errors.New("invalid limit"), http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxMessagesPage)
+	}
+
+	var before int64
+	if raw := r.URL.Query().Get("before"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 {
+			app.errorJSON(w, errors.New("invalid before"), http.StatusBadRequest)
+			return
+		}
+		before = n
+	}
+
+	messages, err := app.Models.Messaging.Messages(conversation.ID, before, limit)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]any{
+		"conversation": conversation,
+		"messages":     messages,
+	}
+	if len(messages) == limit {
+		response["nextBefore"] = messages[len(messages)-1].ID
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  response,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// SendMessage adds the caller's message to a conversation
+func (app *Config) SendMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.messagingUser(w, r)
+	if !ok {
+		return
+	}
+
+	conversation, ok := app.participantConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	body, ok := app.readMessageBody(w, r)
+	if !ok {
+		return
+	}
+
+	msg, ok := app.sendMessage(w, conversation, userID, body)
+	if !ok {
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Message sent",
+		Data:    msg,
+	}
+
+	app.writeJSON(w, http.StatusCreated, payload)
+}
+
+// sendMessage stores a message with the notice the recipient gets when it is
+// the first one they haven't read
+func (app *Config) sendMessage(w http.ResponseWriter, conversation *data.Conversation, senderID int, body string) (*data.Message, bool) {
+	senderName := "Someone"
+	if contact, err := app.Models.Moderation.ContactOf(senderID); err == nil && contact.FirstName != "" {
+		senderName = contact.FirstName
+	}
+
+	snippet := body
+	if runes := []rune(snippet); len(runes) > messageSnippetLength {
+		snippet = strings.TrimSpace(string(runes[:messageSnippetLength])) + "…"
+	}
+
+	notice := event.NotificationEvent{
+		Title: fmt.Sprintf("New message about %q", conversation.PostTitle),
+		Message: fmt.Sprintf("%s sent you a message about %q:\n\n%s\n\nReply at %s/conversations/%d\n",
+			senderName, conversation.PostTitle, snippet, app.PublicURL, conversation.ID),
+		Type: "message",
+	}
+	if conversation.Kind == data.ConversationRoommate {
+		notice.Title = "New message from a potential roommate"
+		notice.Message = fmt.Sprintf("%s sent you a message from the roommate finder:\n\n%s\n\nReply at %s/conversations/%d\n",
+			senderName, snippet, app.PublicURL, conversation.ID)
+	}
+
+	recipientID := conversation.OtherParticipant(senderID)
+	msg, err := app.Models.Messaging.Send(conversation.ID, senderID, recipientID, body, notice)
+	if errors.Is(err, data.ErrBlocked) {
+		app.errorJSON(w, err, http.StatusForbidden)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error sending message in conversation %d: %v", conversation.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return msg, true
+}
+
+// MarkConversationRead sets the read receipt on every message the caller
+// received in a conversation
+func (app *Config) MarkConversationRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.messagingUser(w, r)
+	if !ok {
+		return
+	}
+
+	conversation, ok := app.participantConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	n, err := app.Models.Messaging.MarkRead(conversation.ID, userID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Conversation marked as read",
+		Data:    map[string]int64{"read": n},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// BlockParticipant stops the other participant of a conversation from
+// messaging the caller, and the caller from messaging them
+func (app *Config) BlockParticipant(w http.ResponseWriter, r *http.Request) {
+	app.setBlocked(w, r, true)
+}
+
+// UnblockParticipant lifts a block set with BlockParticipant
+func (app *Config) UnblockParticipant(w http.ResponseWriter, r *http.Request) {
+	app.setBlocked(w, r, false)
+}
+
+func (app *Config) setBlocked(w http.ResponseWriter, r *http.Request, blocked bool) {
+	userID, ok := app.messagingUser(w, r)
+	if !ok {
+		return
+	}
+
+	conversation, ok := app.participantConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	otherID := conversation.OtherParticipant(userID)
+
+	var err error
+	message := "User blocked"
+	if blocked {
+		err = app.Models.Messaging.Block(userID, otherID)
+	} else {
+		err = app.Models.Messaging.Unblock(userID, otherID)
+		message = "User unblocked"
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s: user %d, other user %d", message, userID, otherID)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    map[string]bool{"blocked": blocked},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// ReportParticipant lets a participant flag the other one for moderators,
+// optionally pointing at one of their messages
+func (app *Config) ReportParticipant(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.messagingUser(w, r)
+	if !ok {
+		return
+	}
+
+	conversation, ok := app.participantConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var requestPayload struct {
+		Reason    string `json:"reason"`
+		Details   string `json:"details"`
+		MessageID *int64 `json:"messageId"`
+	}
+
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if !data.UserReportReasons[requestPayload.Reason] {
+		app.errorJSON(w, errors.New("reason must be one of spam, scam, harassment, offensive, other"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	details := strings.TrimSpace(requestPayload.Details)
+	if len(details) > maxReportDetails {
+		app.errorJSON(w, fmt.Errorf("details must be at most %d characters", maxReportDetails), http.StatusUnprocessableEntity)
+		return
+	}
+
+	reportID, err := app.Models.Messaging.CreateReport(data.UserReport{
+		ConversationID: conversation.ID,
+		MessageID:      requestPayload.MessageID,
+		ReporterID:     userID,
+		ReportedID:     conversation.OtherParticipant(userID),
+		Reason:         requestPayload.Reason,
+		Details:        details,
+	})
+	if errors.Is(err, data.ErrDuplicateUserReport) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating report on conversation %d: %v", conversation.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d reported user %d in conversation %d (%s)",
+		userID, conversation.OtherParticipant(userID), conversation.ID, requestPayload.Reason)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Report submitted",
+		Data:    map[string]any{"id": reportID, "status": data.ReportOpen},
+	}
+
+	app.writeJSON(w, http.StatusCreated, payload)
+}
+
+// GetUserReports returns reports on conversation participants with the
+// given status (default open), oldest first, each with the conversation and
+// its latest messages
+func (app *Config) GetUserReports(w http.ResponseWriter, r *http.Request) {
+	if !app.requireModerator(w, r) {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = data.ReportOpen
+	}
+
+	reports, err := app.Models.Messaging.GetReports(status)
+	if err != nil {
+		log.Printf("Error getting user reports: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]map[string]any, 0, len(reports))
+	for _, report := range reports {
+		item := map[string]any{"report": report}
+		if conversation, err := app.Models.Messaging.GetByID(report.ConversationID); err == nil {
+			item["conversation"] = conversation
+		}
+		if messages, err := app.Models.Messaging.Messages(report.ConversationID, 0, moderationContextSize); err == nil {
+			item["messages"] = messages
+		}
+		response = append(response, item)
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  response,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// ReviewUserReport dismisses an open user report, or warns or suspends the
+// reported user, and tells both sides
+func (app *Config) ReviewUserReport(w http.ResponseWriter, r *http.Request) {
+	reportID, err := strconv.Atoi(chi.URLParam(r, "reportId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid report ID"), http.StatusBadRequest)
+		return
+	}
+
+	if !app.requireModerator(w, r) {
+		return
+	}
+
+	var requestPayload moderationRequest
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	action := requestPayload.Action
+	if _, ok := userReportNotices[action]; !ok && action != data.ActionDismiss {
+		app.errorJSON(w, fmt.Errorf("unsupported action %q", action), http.StatusUnprocessableEntity)
+		return
+	}
+
+	report, err := app.Models.Messaging.GetReport(reportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("report not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if report.Status != data.ReportOpen {
+		app.errorJSON(w, errors.New("report has already been reviewed"), http.StatusConflict)
+		return
+	}
+
+	conversation, err := app.Models.Messaging.GetByID(report.ConversationID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	moderatorID, _ := requestUserID(r)
+	note := strings.TrimSpace(requestPayload.Note)
+
+	decisionID, err := app.Models.Messaging.ResolveReport(report, conversation.PostID, action, note, moderatorID)
+	if err != nil {
+		log.Printf("Error resolving user report %d: %v", reportID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Moderator %d applied %s to user %d (report %d)", moderatorID, action, report.ReportedID, reportID)
+
+	if notice, ok := userReportNotices[action]; ok {
+		subject := conversation.PostTitle
+		if conversation.Kind == data.ConversationRoommate {
+			subject = "the roommate finder"
+		}
+		message := fmt.Sprintf(notice.message, subject)
+		if note != "" {
+			message += "\n\nModerator note: " + note
+		}
+		app.notifyUser(report.ReportedID, "moderation", notice.title, message)
+	}
+
+	message := "We reviewed your report about a conversation and took action. Thank you for helping keep DWELL safe."
+	if action == data.ActionDismiss {
+		message = "We reviewed your report about a conversation and found that it doesn't break our rules. You can still block the user."
+	}
+	app.notifyUser(report.ReporterID, "moderation", "Your report was reviewed", message)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Moderation action applied",
+		Data:    map[string]any{"decisionId": decisionID, "reportId": reportID, "action": action},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"database/sql"
+	"migrate"
+	"os"
+	"post-service/migrations"
+)
+
+// serviceName identifies this service's rows in schema_history
+const serviceName = "post-service"
+
+// migrateOnStartup applies pending migrations before the server starts.
+// Posts reference tables owned by the authentication service, so a failed
+// run is retried while that service creates them. Set MIGRATE_ON_START=false
+// to manage the schema with the migrate command instead.
+func migrateOnStartup(db *sql.DB) error {
+	return migrate.OnStartup(db, serviceName, migrations.FS, 10)
+}
+
+// runMigrateCommand implements `postApp migrate ...` and returns the exit code
+func runMigrateCommand(args []string) int {
+	return migrate.Command("postApp", serviceName, migrations.FS, func() (*sql.DB, error) {
+		return openDB(os.Getenv("DSN"))
+	}, args)
+}
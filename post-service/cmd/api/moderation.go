@@ -0,0 +1,313 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"post-service/data"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const maxReportDetails = 2000
+
+// moderationRequest is the body of the admin moderation endpoints
+type moderationRequest struct {
+	Action string `json:"action"`
+	Note   string `json:"note"`
+}
+
+// authorNotices are sent to a listing's author for each moderation action
+var authorNotices = map[string]struct{ title, message string }{
+	data.ActionHide:    {"Your listing was hidden", "Your listing %q has been hidden by a moderator and is no longer visible to renters."},
+	data.ActionUnhide:  {"Your listing is visible again", "Your listing %q has been reviewed and is visible to renters again."},
+	data.ActionRemove:  {"Your listing was removed", "Your listing %q has been removed by a moderator for breaking our listing rules."},
+	data.ActionWarn:    {"Warning about your listing", "A moderator reviewed your listing %q and issued a warning. Repeated violations may lead to suspension."},
+	data.ActionSuspend: {"Your account has been suspended", "Your account has been suspended following a review of your listing %q."},
+}
+
+// ReportPost lets a logged in user flag a listing for moderators
+func (app *Config) ReportPost(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	var requestPayload struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if !data.ReportReasons[requestPayload.Reason] {
+		app.errorJSON(w, errors.New("reason must be one of scam, fake, offensive, duplicate, wrong_info, other"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	details := strings.TrimSpace(requestPayload.Details)
+	if len(details) > maxReportDetails {
+		app.errorJSON(w, fmt.Errorf("details must be at most %d characters", maxReportDetails), http.StatusUnprocessableEntity)
+		return
+	}
+
+	post, err := app.Models.Post.GetByID(postID)
+	if err != nil || !canViewPost(r, post) {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+
+	if post.AuthorID == userID {
+		app.errorJSON(w, errors.New("you cannot report your own post"), http.StatusBadRequest)
+		return
+	}
+
+	reportID, err := app.Models.Moderation.CreateReport(data.Report{
+		PostID:     postID,
+		ReporterID: userID,
+		Reason:     requestPayload.Reason,
+		Details:    details,
+	})
+	if errors.Is(err, data.ErrDuplicateReport) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating report on post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d reported post %d (%s)", userID, postID, requestPayload.Reason)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Report submitted",
+		Data:    map[string]any{"id": reportID, "status": data.ReportOpen},
+	}
+
+	app.writeJSON(w, http.StatusCreated, payload)
+}
+
+// GetReports returns the moderation queue: reports with the given status
+// (default open), oldest first, each with the reported listing
+func (app *Config) GetReports(w http.ResponseWriter, r *http.Request) {
+	if !app.requireModerator(w, r) {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = data.ReportOpen
+	}
+
+	reports, err := app.Models.Moderation.GetReports(status)
+	if err != nil {
+		log.Printf("Error getting reports: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]map[string]any, 0, len(reports))
+	for _, report := range reports {
+		item := map[string]any{"report": report}
+		if post, err := app.Models.Post.GetByID(report.PostID); err == nil {
+			card := convertPostToFrontend(post)
+			card["authorId"] = post.AuthorID
+			item["post"] = card
+		}
+		response = append(response, item)
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  response,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// ReviewReport takes a moderation action on the listing behind an open report
+func (app *Config) ReviewReport(w http.ResponseWriter, r *http.Request) {
+	reportID, err := strconv.Atoi(chi.URLParam(r, "reportId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid report ID"), http.StatusBadRequest)
+		return
+	}
+
+	if !app.requireModerator(w, r) {
+		return
+	}
+
+	report, err := app.Models.Moderation.GetReport(reportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("report not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if report.Status != data.ReportOpen {
+		app.errorJSON(w, errors.New("report has already been reviewed"), http.StatusConflict)
+		return
+	}
+
+	app.moderate(w, r, report, report.PostID)
+}
+
+// ModeratePost takes a moderation action on a listing without a report,
+// e.g. to unhide it after an appeal
+func (app *Config) ModeratePost(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	if !app.requireModerator(w, r) {
+		return
+	}
+
+	app.moderate(w, r, nil, postID)
+}
+
+// moderate validates and applies an action to a post and its author, then
+// notifies the author and the reporters whose reports it closed
+func (app *Config) moderate(w http.ResponseWriter, r *http.Request, report *data.Report, postID int) {
+	var requestPayload moderationRequest
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	action := requestPayload.Action
+	_, authorAction := authorNotices[action]
+	if !authorAction && !(action == data.ActionDismiss && report != nil) {
+		app.errorJSON(w, fmt.Errorf("unsupported action %q", action), http.StatusUnprocessableEntity)
+		return
+	}
+
+	post, err := app.Models.Post.GetByID(postID)
+	if err != nil {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+
+	// Reporters to tell about the outcome, before their reports get closed
+	reporters := []int{}
+	if action == data.ActionDismiss || action == data.ActionWarn {
+		if report != nil {
+			reporters = append(reporters, report.ReporterID)
+		}
+	} else if ids, err := app.Models.Moderation.OpenReporters(postID); err == nil {
+		reporters = ids
+	}
+
+	moderatorID, _ := requestUserID(r)
+	decision := data.Decision{
+		PostID:      postID,
+		UserID:      post.AuthorID,
+		Action:      action,
+		Note:        strings.TrimSpace(requestPayload.Note),
+		ModeratorID: moderatorID,
+	}
+	if report != nil {
+		decision.ReportID = &report.ID
+	}
+
+	decision.ID, err = app.Models.Moderation.Apply(decision)
+	if err != nil {
+		log.Printf("Error applying moderation on post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Moderator %d applied %s to post %d (author %d)", moderatorID, action, postID, post.AuthorID)
+
+	if notice, ok := authorNotices[action]; ok {
+		message := fmt.Sprintf(notice.message, post.Title)
+		if decision.Note != "" {
+			message += "\n\nModerator note: " + decision.Note
+		}
+		app.notifyUser(post.AuthorID, "moderation", notice.title, message)
+	}
+
+	for _, reporterID := range reporters {
+		message := fmt.Sprintf("We reviewed your report on %q and took action. Thank you for helping keep listings safe.", post.Title)
+		if action == data.ActionDismiss {
+			message = fmt.Sprintf("We reviewed your report on %q and found that it doesn't break our listing rules.", post.Title)
+		}
+		app.notifyUser(reporterID, "moderation", "Your report was reviewed", message)
+	}
+
+	updated, err := app.Models.Post.GetByID(postID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Moderation action applied",
+		Data: map[string]any{
+			"decision": decision,
+			"post":     convertPostToFrontend(updated),
+		},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetModerationDecisions returns the moderation log, optionally filtered by
+// postId and/or userId
+func (app *Config) GetModerationDecisions(w http.ResponseWriter, r *http.Request) {
+	if !app.requireModerator(w, r) {
+		return
+	}
+
+	var ids [2]int
+	for i, key := range []string{"postId", "userId"} {
+		if raw := r.URL.Query().Get(key); raw != "" {
+			id, err := strconv.Atoi(raw)
+			if err != nil {
+				app.errorJSON(w, fmt.Errorf("invalid %s", key), http.StatusBadRequest)
+				return
+			}
+			ids[i] = id
+		}
+	}
+
+	decisions, err := app.Models.Moderation.GetDecisions(ids[0], ids[1])
+	if err != nil {
+		log.Printf("Error getting moderation decisions: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if decisions == nil {
+		decisions = []*data.Decision{}
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  decisions,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
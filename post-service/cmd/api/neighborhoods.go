@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"post-service/data"
+	"post-service/geo"
+	"post-service/neighborhoods"
+	"strings"
+	"unicode"
+)
+
+const neighborhoodsUsage = `usage: postApp neighborhoods import [-prune] [file]
+
+Loads neighborhood boundaries from a GeoJSON FeatureCollection whose
+features are Polygons or MultiPolygons with a "name" property (and
+optionally a "slug"), then moves every listing with coordinates into the
+neighborhood it falls in. Without a file the built-in Davis boundaries are
+loaded.
+
+flags:
+  -prune   delete neighborhoods that aren't in the file
+`
+
+// GetNeighborhoods returns every neighborhood as a GeoJSON FeatureCollection.
+// Each feature's properties carry the neighborhood's published listing
+// count and its median, lowest and highest price.
+func (app *Config) GetNeighborhoods(w http.ResponseWriter, r *http.Request) {
+	hoods, err := app.Models.Neighborhood.All()
+	if err != nil {
+		log.Printf("Error getting neighborhoods: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	stats, err := app.Models.Neighborhood.Stats()
+	if err != nil {
+		log.Printf("Error getting neighborhood stats: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	features := make([]map[string]any, 0, len(hoods))
+	for _, hood := range hoods {
+		s, ok := stats[hood.Name]
+		if !ok {
+			s = &data.NeighborhoodStats{}
+		}
+		features = append(features, map[string]any{
+			"type":     "Feature",
+			"id":       hood.Slug,
+			"geometry": hood.Boundary,
+			"properties": map[string]any{
+				"id":             hood.ID,
+				"slug":           hood.Slug,
+				"name":           hood.Name,
+				"activeListings": s.ActiveListings,
+				"medianPrice":    s.MedianPrice,
+				"minPrice":       s.MinPrice,
+				"maxPrice":       s.MaxPrice,
+			},
+		})
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data: map[string]any{
+			"type":     "FeatureCollection",
+			"features": features,
+		},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload, http.Header{"Cache-Control": []string{"public, max-age=300"}})
+}
+
+// runNeighborhoodsCommand implements `postApp neighborhoods import ...` and
+// returns the exit code
+func runNeighborhoodsCommand(args []string) int {
+	if len(args) == 0 || args[0] != "import" {
+		fmt.Fprint(os.Stderr, neighborhoodsUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("neighborhoods import", flag.ContinueOnError)
+	prune := flags.Bool("prune", false, "delete neighborhoods that aren't in the file")
+	flags.Usage = func() { fmt.Fprint(os.Stderr, neighborhoodsUsage) }
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	var raw []byte
+	var err error
+	if flags.NArg() == 1 {
+		raw, err = os.ReadFile(flags.Arg(0))
+	} else {
+		raw, err = neighborhoods.FS.ReadFile(neighborhoods.Default)
+	}
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	hoods, err := parseNeighborhoods(raw)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	db, err := openDB(os.Getenv("DSN"))
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	models := data.New(db)
+	moved, err := models.Neighborhood.Import(hoods, *prune)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	fmt.Printf("imported %d neighborhood(s), moved %d listing(s)\n", len(hoods), moved)
+	return 0
+}
+
+// parseNeighborhoods reads a GeoJSON FeatureCollection of neighborhoods
+func parseNeighborhoods(raw []byte) ([]*data.Neighborhood, error) {
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Properties struct {
+				Name string `json:"name"`
+				Slug string `json:"slug"`
+			} `json:"properties"`
+			Geometry json.RawMessage `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(raw, &collection); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %v", err)
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, errors.New("the file must hold a GeoJSON FeatureCollection")
+	}
+	if len(collection.Features) == 0 {
+		return nil, errors.New("the file has no neighborhoods")
+	}
+
+	seen := map[string]bool{}
+	hoods := make([]*data.Neighborhood, 0, len(collection.Features))
+	for i, feature := range collection.Features {
+		name := strings.TrimSpace(feature.Properties.Name)
+		if name == "" {
+			return nil, fmt.Errorf("feature %d has no name property", i+1)
+		}
+
+		slug := feature.Properties.Slug
+		if slug == "" {
+			slug = slugify(name)
+		}
+		if seen[slug] || seen[name] {
+			return nil, fmt.Errorf("neighborhood %q appears twice", name)
+		}
+		seen[slug], seen[name] = true, true
+
+		shape, err := geo.ParseGeometry(feature.Geometry)
+		if err != nil {
+			return nil, fmt.Errorf("neighborhood %q: %v", name, err)
+		}
+
+		hoods = append(hoods, &data.Neighborhood{Slug: slug, Name: name, Boundary: feature.Geometry, Shape: shape})
+	}
+
+	return hoods, nil
+}
+
+// slugify lowercases a name and joins its words with dashes
+func slugify(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
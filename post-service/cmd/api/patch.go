@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"post-service/data"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// errPreconditionRequired is returned when a write arrives without If-Match
+var errPreconditionRequired = errors.New("If-Match header is required")
+
+// errAuthorMismatch is returned when a write names an author other than the
+// signed-in caller
+var errAuthorMismatch = errors.New("authorId must be the signed-in user")
+
+// postETag builds the strong entity tag for a post. The version column is
+// bumped on every write, so the tag changes whenever the post does.
+func postETag(post *data.PostWithAuthor) string {
+	return fmt.Sprintf(`"post-%d-v%d"`, post.ID, post.Version)
+}
+
+// etagHeader returns response headers carrying the post's ETag
+func etagHeader(post *data.PostWithAuthor) http.Header {
+	return http.Header{"ETag": []string{postETag(post)}}
+}
+
+// etagMatches reports whether an If-Match or If-None-Match value matches
+// the post's current ETag. The value may be "*" or a comma separated list.
+// If-Match uses the strong comparison of RFC 9110, so weak W/ tags never
+// match it; If-None-Match uses the weak one and ignores the W/ prefix.
+func etagMatches(header string, post *data.PostWithAuthor, weak bool) bool {
+	current := postETag(post)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// preconditionFailed answers a stale write with 412 and the current post so
+// the client can rebase its edit
+func (app *Config) preconditionFailed(w http.ResponseWriter, post *data.PostWithAuthor) {
+	payload := jsonResponse{
+		Error:   true,
+		Message: "post was modified by another request",
+		Data:    convertPostToFrontend(post),
+	}
+	app.writeJSON(w, http.StatusPreconditionFailed, payload, etagHeader(post))
+}
+
+// PatchPost applies a JSON Merge Patch (RFC 7386) to a post. The request must
+// carry If-Match with the post's current ETag; stale edits get a 412.
+func (app *Config) PatchPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		app.errorJSON(w, errPreconditionRequired, http.StatusPreconditionRequired)
+		return
+	}
+
+	current, err := app.Models.Post.GetByID(id)
+	if err != nil || current.AuthorID != userID {
+		app.errorJSON(w, errors.New("post not found or unauthorized"), http.StatusNotFound)
+		return
+	}
+
+	if !etagMatches(ifMatch, current, false) {
+		log.Printf("Stale PATCH on post %d: If-Match %s, current %s", id, ifMatch, postETag(current))
+		app.preconditionFailed(w, current)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(10485760))
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var patch map[string]any
+	if err := json.Unmarshal(body, &patch); err != nil {
+		app.errorJSON(w, errors.New("merge patch body must be a JSON object"), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := applyPostPatch(current, patch)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	log.Printf("Patching post %d (version %d): %s", id, current.Version, string(body))
+
+	screened := app.screenPost(updated, true)
+
+	_, err = app.Models.Post.UpdateIfVersion(updated, current.Version, screened)
+	if errors.Is(err, data.ErrVersionConflict) {
+		// Someone else won the race between our read and our write
+		app.staleWrite(w, id)
+		return
+	}
+	if err != nil {
+		log.Printf("Error patching post: %v", err)
+		app.errorJSON(w, errors.New("post not found or unauthorized"), http.StatusNotFound)
+		return
+	}
+
+	patchedPost, err := app.Models.Post.GetByID(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Post updated successfully",
+		Data:    convertPostToFrontend(patchedPost),
+	}
+
+	app.writeJSON(w, http.StatusOK, payload, etagHeader(patchedPost))
+}
+
+// applyPostPatch merges patch into the payload representation of current and
+// converts the result back into a data.Post ready for UpdateIfVersion
+func applyPostPatch(current *data.PostWithAuthor, patch map[string]any) (data.Post, error) {
+	for _, field := range []string{"id", "authorId"} {
+		if _, ok := patch[field]; ok {
+			return data.Post{}, fmt.Errorf("%s cannot be changed", field)
+		}
+	}
+
+	raw, err := json.Marshal(payloadFromPost(current))
+	if err != nil {
+		return data.Post{}, err
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return data.Post{}, err
+	}
+
+	merged, err := json.Marshal(mergePatch(doc, patch))
+	if err != nil {
+		return data.Post{}, err
+	}
+
+	var payload PostPayload
+	dec := json.NewDecoder(strings.NewReader(string(merged)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&payload); err != nil {
+		return data.Post{}, fmt.Errorf("invalid patch: %v", err)
+	}
+
+	if strings.TrimSpace(payload.Title) == "" {
+		return data.Post{}, errors.New("title cannot be empty")
+	}
+	if payload.Price <= 0 {
+		return data.Post{}, errors.New("price must be positive")
+	}
+
+	return postFromPayload(current.ID, current.AuthorID, payload), nil
+}
+
+// mergePatch implements the JSON Merge Patch algorithm from RFC 7386:
+// null removes a member, objects merge recursively, anything else replaces.
+func mergePatch(target any, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = map[string]any{}
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergePatch(targetObj[key], value)
+	}
+
+	return targetObj
+}
+
+// payloadFromPost converts a stored post back into the client payload shape
+func payloadFromPost(post *data.PostWithAuthor) PostPayload {
+	return PostPayload{
+		ID:               post.ID,
+		Title:            post.Title,
+		Price:            post.Price,
+		Location:         post.Location,
+		Neighborhood:     post.Neighborhood,
+		Lat:              post.Lat,
+		Lng:              post.Lng,
+		Radius:           post.Radius,
+		Type:             post.Type,
+		ImageURL:         post.ImageURL,
+		AdditionalImages: post.AdditionalImages,
+		Description:      post.Description,
+		Bedrooms:         post.Bedrooms,
+		Bathrooms:        post.Bathrooms,
+		AvailableFrom:    post.AvailableFrom.UnixMilli(),
+		AvailableTo:      post.AvailableTo.UnixMilli(),
+		AuthorID:         post.AuthorID,
+	}
+}
+
+// postFromPayload converts a client payload into a data.Post
+func postFromPayload(id, authorID int, p PostPayload) data.Post {
+	return data.Post{
+		ID:               id,
+		Title:            p.Title,
+		Price:            p.Price,
+		Location:         p.Location,
+		Neighborhood:     p.Neighborhood,
+		Lat:              p.Lat,
+		Lng:              p.Lng,
+		Radius:           p.Radius,
+		Type:             p.Type,
+		ImageURL:         p.ImageURL,
+		AdditionalImages: p.AdditionalImages,
+		Description:      p.Description,
+		Bedrooms:         p.Bedrooms,
+		Bathrooms:        p.Bathrooms,
+		AvailableFrom:    time.Unix(p.AvailableFrom/1000, 0),
+		AvailableTo:      time.Unix(p.AvailableTo/1000, 0),
+		AuthorID:         authorID,
+	}
+}
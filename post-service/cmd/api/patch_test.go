@@ -0,0 +1,197 @@
+package main
+
+import (
+	"post-service/data"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		target any
+		patch  any
+		want   any
+	}{
+		{
+			name:   "replaces a member",
+			target: map[string]any{"a": "b"},
+			patch:  map[string]any{"a": "c"},
+			want:   map[string]any{"a": "c"},
+		},
+		{
+			name:   "adds a member",
+			target: map[string]any{"a": "b"},
+			patch:  map[string]any{"b": "c"},
+			want:   map[string]any{"a": "b", "b": "c"},
+		},
+		{
+			name:   "null removes a member",
+			target: map[string]any{"a": "b", "b": "c"},
+			patch:  map[string]any{"a": nil},
+			want:   map[string]any{"b": "c"},
+		},
+		{
+			name:   "null on a missing member is a no-op",
+			target: map[string]any{"a": "b"},
+			patch:  map[string]any{"c": nil},
+			want:   map[string]any{"a": "b"},
+		},
+		{
+			name:   "objects merge recursively",
+			target: map[string]any{"a": map[string]any{"b": "c", "d": "e"}},
+			patch:  map[string]any{"a": map[string]any{"b": nil, "f": "g"}},
+			want:   map[string]any{"a": map[string]any{"d": "e", "f": "g"}},
+		},
+		{
+			name:   "arrays are replaced, not merged",
+			target: map[string]any{"a": []any{"b", "c"}},
+			patch:  map[string]any{"a": []any{"d"}},
+			want:   map[string]any{"a": []any{"d"}},
+		},
+		{
+			name:   "an object replaces a scalar",
+			target: map[string]any{"a": "b"},
+			patch:  map[string]any{"a": map[string]any{"c": "d"}},
+			want:   map[string]any{"a": map[string]any{"c": "d"}},
+		},
+		{
+			name:   "a non-object patch replaces the target",
+			target: map[string]any{"a": "b"},
+			patch:  []any{"c"},
+			want:   []any{"c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergePatch(tt.target, tt.patch); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergePatch() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func patchTestPost() *data.PostWithAuthor {
+	return &data.PostWithAuthor{Post: data.Post{
+		ID:               7,
+		Title:            "Sunny 2BR",
+		Price:            1500,
+		Neighborhood:     "North Davis",
+		Type:             "Apartment",
+		AdditionalImages: []string{"https://img.example.com/a.jpg"},
+		Description:      "Close to campus",
+		Bedrooms:         2,
+		Bathrooms:        1,
+		AvailableFrom:    time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+		AvailableTo:      time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC),
+		AuthorID:         3,
+		Version:          4,
+	}}
+}
+
+func TestApplyPostPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   map[string]any
+		check   func(t *testing.T, post data.Post)
+		wantErr string
+	}{
+		{
+			name:  "changes only the patched fields",
+			patch: map[string]any{"price": float64(1400), "bedrooms": float64(3)},
+			check: func(t *testing.T, post data.Post) {
+				if post.Price != 1400 || post.Bedrooms != 3 {
+					t.Errorf("price, bedrooms = %v, %d, want 1400, 3", post.Price, post.Bedrooms)
+				}
+				if post.Title != "Sunny 2BR" || post.Neighborhood != "North Davis" {
+					t.Errorf("untouched fields changed: %q, %q", post.Title, post.Neighborhood)
+				}
+			},
+		},
+		{
+			name:  "keeps the ID and author",
+			patch: map[string]any{"title": "Renovated 2BR"},
+			check: func(t *testing.T, post data.Post) {
+				if post.ID != 7 || post.AuthorID != 3 {
+					t.Errorf("id, author = %d, %d, want 7, 3", post.ID, post.AuthorID)
+				}
+			},
+		},
+		{
+			name:  "null clears a field",
+			patch: map[string]any{"additionalImages": nil, "description": nil},
+			check: func(t *testing.T, post data.Post) {
+				if len(post.AdditionalImages) != 0 || post.Description != "" {
+					t.Errorf("images, description = %v, %q, want cleared", post.AdditionalImages, post.Description)
+				}
+			},
+		},
+		{
+			name:  "dates survive the round trip",
+			patch: map[string]any{"title": "Renovated 2BR"},
+			check: func(t *testing.T, post data.Post) {
+				want := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+				if !post.AvailableFrom.Equal(want) {
+					t.Errorf("availableFrom = %v, want %v", post.AvailableFrom, want)
+				}
+			},
+		},
+		{name: "id can't be changed", patch: map[string]any{"id": float64(8)}, wantErr: "id cannot be changed"},
+		{name: "author can't be changed", patch: map[string]any{"authorId": float64(4)}, wantErr: "authorId cannot be changed"},
+		{name: "unknown fields are refused", patch: map[string]any{"owner": "someone"}, wantErr: "invalid patch"},
+		{name: "wrong types are refused", patch: map[string]any{"price": "cheap"}, wantErr: "invalid patch"},
+		{name: "title can't be removed", patch: map[string]any{"title": nil}, wantErr: "title cannot be empty"},
+		{name: "title can't be blank", patch: map[string]any{"title": "  "}, wantErr: "title cannot be empty"},
+		{name: "price must stay positive", patch: map[string]any{"price": float64(0)}, wantErr: "price must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post, err := applyPostPatch(patchTestPost(), tt.patch)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyPostPatch() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyPostPatch() error = %v", err)
+			}
+			tt.check(t, post)
+		})
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	post := patchTestPost() // ETag "post-7-v4"
+
+	tests := []struct {
+		name   string
+		header string
+		weak   bool
+		want   bool
+	}{
+		{name: "current tag", header: `"post-7-v4"`, want: true},
+		{name: "stale tag", header: `"post-7-v3"`, want: false},
+		{name: "another post's tag", header: `"post-8-v4"`, want: false},
+		{name: "unquoted tag", header: `post-7-v4`, want: false},
+		{name: "any", header: `*`, want: true},
+		{name: "list containing the current tag", header: `"post-7-v3", "post-7-v4"`, want: true},
+		{name: "list without the current tag", header: `"post-7-v2","post-7-v3"`, want: false},
+		{name: "weak tag never matches If-Match", header: `W/"post-7-v4"`, want: false},
+		{name: "weak tag matches If-None-Match", header: `W/"post-7-v4"`, weak: true, want: true},
+		{name: "strong tag matches If-None-Match", header: `"post-7-v4"`, weak: true, want: true},
+		{name: "stale weak tag", header: `W/"post-7-v3"`, weak: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, post, tt.weak); got != tt.want {
+				t.Errorf("etagMatches(%q, weak=%v) = %v, want %v", tt.header, tt.weak, got, tt.want)
+			}
+		})
+	}
+}
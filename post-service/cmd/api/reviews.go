@@ -0,0 +1,492 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"post-service/data"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// maxReviewLength is the longest review or reply, in characters
+	maxReviewLength = 2000
+	defaultReviews  = 20
+	maxReviews      = 50
+)
+
+// reviewReportNotices are sent to the author of a reported review or reply
+// for each moderation action
+var reviewReportNotices = map[string]struct{ title, message string }{
+	data.ActionHideReview: {"Your review was hidden", "A moderator hid your review of %q for breaking our review rules."},
+	data.ActionHideReply:  {"Your reply was hidden", "A moderator hid your reply to a review of %q for breaking our review rules."},
+	data.ActionWarn:       {"Warning about your review", "A moderator reviewed a report about your text on %q and issued a warning. Repeated violations may lead to suspension."},
+	data.ActionSuspend:    {"Your account has been suspended", "Your account has been suspended following a review of your text on %q."},
+}
+
+// CreateReview lets a renter who had a completed viewing or an accepted
+// application rate the listing's author
+func (app *Config) CreateReview(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	var requestPayload struct {
+		Rating int    `json:"rating"`
+		Body   string `json:"body"`
+	}
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if requestPayload.Rating < 1 || requestPayload.Rating > 5 {
+		app.errorJSON(w, errors.New("rating must be between 1 and 5"), http.StatusUnprocessableEntity)
+		return
+	}
+	body := strings.TrimSpace(requestPayload.Body)
+	if utf8.RuneCountInString(body) > maxReviewLength {
+		app.errorJSON(w, fmt.Errorf("review can be at most %d characters", maxReviewLength), http.StatusUnprocessableEntity)
+		return
+	}
+
+	post, err := app.Models.Post.GetByID(postID)
+	if err != nil || !canViewPost(r, post) {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+	if post.AuthorID == userID {
+		app.errorJSON(w, errors.New("you cannot review your own listing"), http.StatusBadRequest)
+		return
+	}
+
+	eligible, err := app.Models.Review.CanReview(postID, userID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !eligible {
+		app.errorJSON(w, data.ErrNotReviewable, http.StatusForbidden)
+		return
+	}
+
+	id, err := app.Models.Review.Create(&data.Review{
+		PostID:     postID,
+		LandlordID: post.AuthorID,
+		ReviewerID: userID,
+		Rating:     requestPayload.Rating,
+		Body:       body,
+	})
+	if errors.Is(err, data.ErrAlreadyReviewed) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating review of post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	review, err := app.Models.Review.Get(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d reviewed post %d (%d stars)", userID, postID, review.Rating)
+
+	app.notifyUser(post.AuthorID, "review_received", "New review: "+post.Title,
+		fmt.Sprintf("%s rated their experience with %q %d out of 5. You can post one public reply at %s/posts/%d/reviews",
+			review.Reviewer, post.Title, review.Rating, app.PublicURL, postID))
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Review posted",
+		Data:    review,
+	}
+
+	app.writeJSON(w, http.StatusCreated, payload)
+}
+
+// GetPostReviews lists a listing's published reviews with their average
+func (app *Config) GetPostReviews(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	post, err := app.Models.Post.GetByID(postID)
+	if err != nil || !canViewPost(r, post) {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+
+	limit, offset, ok := app.reviewPage(w, r)
+	if !ok {
+		return
+	}
+
+	reviews, summary, err := app.Models.Review.ForPost(postID, limit, offset)
+	if err != nil {
+		log.Printf("Error getting reviews of post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  map[string]any{"summary": summary, "reviews": reviews},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetLandlordReviews lists the published reviews of a landlord across
+// their listings with their average
+func (app *Config) GetLandlordReviews(w http.ResponseWriter, r *http.Request) {
+	landlordID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid user ID"), http.StatusBadRequest)
+		return
+	}
+
+	limit, offset, ok := app.reviewPage(w, r)
+	if !ok {
+		return
+	}
+
+	reviews, summary, err := app.Models.Review.ForLandlord(landlordID, limit, offset)
+	if err != nil {
+		log.Printf("Error getting reviews of landlord %d: %v", landlordID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  map[string]any{"summary": summary, "reviews": reviews},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// reviewPage reads ?limit= and ?offset= for the review lists
+func (app *Config) reviewPage(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	limit, offset := defaultReviews, 0
+	for _, p := range []struct {
+		key string
+		dst *int
+		min int
+	}{{"limit", &limit, 1}, {"offset", &offset, 0}} {
+		if raw := r.URL.Query().Get(p.key); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < p.min {
+				app.errorJSON(w, fmt.Errorf("invalid %s", p.key), http.StatusBadRequest)
+				return 0, 0, false
+			}
+			*p.dst = n
+		}
+	}
+
+	return min(limit, maxReviews), offset, true
+}
+
+// ReplyToReview lets the landlord post their one public reply to a review
+func (app *Config) ReplyToReview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	review, ok := app.publishedReview(w, r)
+	if !ok {
+		return
+	}
+	if review.LandlordID != userID {
+		app.errorJSON(w, errors.New("only the reviewed landlord can reply"), http.StatusForbidden)
+		return
+	}
+
+	var requestPayload struct {
+		Body string `json:"body"`
+	}
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	body := strings.TrimSpace(requestPayload.Body)
+	if body == "" {
+		app.errorJSON(w, errors.New("reply can't be empty"), http.StatusUnprocessableEntity)
+		return
+	}
+	if utf8.RuneCountInString(body) > maxReviewLength {
+		app.errorJSON(w, fmt.Errorf("reply can be at most %d characters", maxReviewLength), http.StatusUnprocessableEntity)
+		return
+	}
+
+	err := app.Models.Review.Reply(review.ID, body)
+	if errors.Is(err, data.ErrAlreadyReplied) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error replying to review %d: %v", review.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	review, err = app.Models.Review.Get(review.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.notifyUser(review.ReviewerID, "review_reply", "The landlord replied to your review",
+		fmt.Sprintf("The landlord of %q replied to your review:\n\n%s", review.PostTitle, body))
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Reply posted",
+		Data:    review,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// ReportReview lets a logged in user flag a review, or its reply, for
+// moderators
+func (app *Config) ReportReview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	review, ok := app.publishedReview(w, r)
+	if !ok {
+		return
+	}
+
+	var requestPayload struct {
+		Target  string `json:"target"`
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	report := data.ReviewReport{
+		ReviewID:   review.ID,
+		Target:     "review",
+		ReporterID: userID,
+		ReportedID: review.ReviewerID,
+		Reason:     requestPayload.Reason,
+		Details:    strings.TrimSpace(requestPayload.Details),
+	}
+	switch requestPayload.Target {
+	case "", "review":
+	case "reply":
+		if review.Reply == nil {
+			app.errorJSON(w, errors.New("this review has no reply"), http.StatusUnprocessableEntity)
+			return
+		}
+		report.Target = "reply"
+		report.ReportedID = review.LandlordID
+	default:
+		app.errorJSON(w, errors.New("target must be review or reply"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if report.ReportedID == userID {
+		app.errorJSON(w, errors.New("you cannot report your own text"), http.StatusBadRequest)
+		return
+	}
+	if !data.ReviewReportReasons[report.Reason] {
+		app.errorJSON(w, errors.New("reason must be one of spam, fake, offensive, personal_info, other"), http.StatusUnprocessableEntity)
+		return
+	}
+	if len(report.Details) > maxReportDetails {
+		app.errorJSON(w, fmt.Errorf("details must be at most %d characters", maxReportDetails), http.StatusUnprocessableEntity)
+		return
+	}
+
+	reportID, err := app.Models.Review.CreateReport(report)
+	if errors.Is(err, data.ErrDuplicateReviewReport) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating report on review %d: %v", review.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d reported the %s of review %d (%s)", userID, report.Target, review.ID, report.Reason)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Report submitted",
+		Data:    map[string]any{"id": reportID, "status": data.ReportOpen},
+	}
+
+	app.writeJSON(w, http.StatusCreated, payload)
+}
+
+// publishedReview loads the review in the URL, answering 404 unless it's
+// published
+func (app *Config) publishedReview(w http.ResponseWriter, r *http.Request) (*data.Review, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid review ID"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	review, err := app.Models.Review.Get(id)
+	if err != nil || review.Status != data.ReviewPublished {
+		app.errorJSON(w, errors.New("review not found"), http.StatusNotFound)
+		return nil, false
+	}
+
+	return review, true
+}
+
+// GetReviewReports returns reports on reviews with the given status
+// (default open), oldest first, each with the review
+func (app *Config) GetReviewReports(w http.ResponseWriter, r *http.Request) {
+	if !app.requireModerator(w, r) {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = data.ReportOpen
+	}
+
+	reports, err := app.Models.Review.GetReports(status)
+	if err != nil {
+		log.Printf("Error getting review reports: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]map[string]any, 0, len(reports))
+	for _, report := range reports {
+		item := map[string]any{"report": report}
+		if review, err := app.Models.Review.Get(report.ReviewID); err == nil {
+			item["review"] = review
+		}
+		response = append(response, item)
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  response,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// ReviewReviewReport dismisses an open review report, or hides the review
+// or reply, or warns or suspends its author, and tells both sides
+func (app *Config) ReviewReviewReport(w http.ResponseWriter, r *http.Request) {
+	reportID, err := strconv.Atoi(chi.URLParam(r, "reportId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid report ID"), http.StatusBadRequest)
+		return
+	}
+
+	if !app.requireModerator(w, r) {
+		return
+	}
+
+	var requestPayload moderationRequest
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	action := requestPayload.Action
+	if _, ok := reviewReportNotices[action]; !ok && action != data.ActionDismiss {
+		app.errorJSON(w, fmt.Errorf("unsupported action %q", action), http.StatusUnprocessableEntity)
+		return
+	}
+
+	report, err := app.Models.Review.GetReport(reportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("report not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if report.Status != data.ReportOpen {
+		app.errorJSON(w, errors.New("report has already been reviewed"), http.StatusConflict)
+		return
+	}
+	if (action == data.ActionHideReview && report.Target != "review") ||
+		(action == data.ActionHideReply && report.Target != "reply") {
+		app.errorJSON(w, fmt.Errorf("%s doesn't apply to a report on a %s", action, report.Target), http.StatusUnprocessableEntity)
+		return
+	}
+
+	review, err := app.Models.Review.Get(report.ReviewID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	moderatorID, _ := requestUserID(r)
+	note := strings.TrimSpace(requestPayload.Note)
+
+	decisionID, err := app.Models.Review.ResolveReport(report, review.PostID, action, note, moderatorID)
+	if err != nil {
+		log.Printf("Error resolving review report %d: %v", reportID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Moderator %d applied %s to the %s of review %d (report %d)", moderatorID, action, report.Target, review.ID, reportID)
+
+	if notice, ok := reviewReportNotices[action]; ok {
+		message := fmt.Sprintf(notice.message, review.PostTitle)
+		if note != "" {
+			message += "\n\nModerator note: " + note
+		}
+		app.notifyUser(report.ReportedID, "moderation", notice.title, message)
+	}
+
+	message := "We reviewed your report about a review and took action. Thank you for helping keep DWELL safe."
+	if action == data.ActionDismiss {
+		message = "We reviewed your report about a review and found that it doesn't break our rules."
+	}
+	app.notifyUser(report.ReporterID, "moderation", "Your report was reviewed", message)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Moderation action applied",
+		Data:    map[string]any{"decisionId": decisionID, "reportId": reportID, "action": action},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"post-service/data"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxRoommateBio           = 1000
+	maxRoommateBudget        = 20000
+	maxRoommateNeighborhoods = 10
+	maxNeighborhoodLength    = 50
+	roommateCandidates       = 500
+	defaultRoommateMatches   = 20
+	maxRoommateMatches       = 50
+)
+
+// smokingOrder ranks smoking answers so neighbours differ by one step
+var smokingOrder = map[string]int{"smoker": 0, "outdoors_only": 1, "non_smoker": 2}
+
+// matchFactor is one line of a compatibility score's breakdown
+type matchFactor struct {
+	Factor string `json:"factor"`
+	Points int    `json:"points"`
+	Max    int    `json:"max"`
+	Detail string `json:"detail"`
+}
+
+// roommateMatch is another user's profile scored against the caller's
+type roommateMatch struct {
+	Profile   *data.RoommateProfile `json:"profile"`
+	Score     int                   `json:"score"`
+	Breakdown []matchFactor         `json:"breakdown"`
+}
+
+// compatibility scores b against a out of 100. Every point is explained in
+// the breakdown so users can see why a match ranks where it does.
+func compatibility(a, b *data.RoommateProfile) (int, []matchFactor) {
+	factors := []matchFactor{
+		budgetFactor(a, b),
+		neighborhoodFactor(a, b),
+		moveInFactor(a, b),
+		sleepFactor(a, b),
+		cleanlinessFactor(a, b),
+		petsFactor(a, b),
+		smokingFactor(a, b),
+	}
+
+	score := 0
+	for _, f := range factors {
+		score += f.Points
+	}
+
+	return score, factors
+}
+
+func budgetFactor(a, b *data.RoommateProfile) matchFactor {
+	f := matchFactor{Factor: "budget", Max: 25}
+
+	low, high := max(a.BudgetMin, b.BudgetMin), min(a.BudgetMax, b.BudgetMax)
+	if low > high {
+		f.Detail = fmt.Sprintf("budgets are $%d apart", low-high)
+		if low-high <= max(a.BudgetMax, b.BudgetMax)/10 {
+			f.Points = 8
+		}
+		return f
+	}
+
+	// 15 points for any overlap, the rest by how much of the narrower range it covers
+	narrower := min(a.BudgetMax-a.BudgetMin, b.BudgetMax-b.BudgetMin)
+	share := 1.0
+	if narrower > 0 {
+		share = float64(high-low) / float64(narrower)
+	}
+	f.Points = 15 + int(math.Round(10*share))
+	f.Detail = fmt.Sprintf("budgets overlap between $%d and $%d", low, high)
+
+	return f
+}
+
+func neighborhoodFactor(a, b *data.RoommateProfile) matchFactor {
+	f := matchFactor{Factor: "neighborhoods", Max: 15}
+
+	if len(a.Neighborhoods) == 0 || len(b.Neighborhoods) == 0 {
+		f.Points = 10
+		f.Detail = "no neighborhood preference on one side"
+		return f
+	}
+
+	wanted := make(map[string]bool, len(a.Neighborhoods))
+	for _, n := range a.Neighborhoods {
+		wanted[strings.ToLower(n)] = true
+	}
+
+	var shared []string
+	for _, n := range b.Neighborhoods {
+		if wanted[strings.ToLower(n)] {
+			shared = append(shared, n)
+		}
+	}
+
+	if len(shared) == 0 {
+		f.Detail = "no neighborhoods in common"
+		return f
+	}
+	f.Points = 15
+	f.Detail = "both interested in " + strings.Join(shared, ", ")
+
+	return f
+}
+
+func moveInFactor(a, b *data.RoommateProfile) matchFactor {
+	f := matchFactor{Factor: "moveIn", Max: 15}
+
+	from, to := a.MoveInFrom, a.MoveInTo
+	if b.MoveInFrom.After(from) {
+		from = b.MoveInFrom
+	}
+	if b.MoveInTo.Before(to) {
+		to = b.MoveInTo
+	}
+
+	if !from.After(to) {
+		f.Points = 15
+		f.Detail = fmt.Sprintf("both can move in between %s and %s", from.Format("Jan 2"), to.Format("Jan 2"))
+		return f
+	}
+
+	days := int(from.Sub(to).Hours() / 24)
+	f.Detail = fmt.Sprintf("move-in windows are %d days apart", days)
+	if days <= 14 {
+		f.Points = 8
+	}
+
+	return f
+}
+
+func sleepFactor(a, b *data.RoommateProfile) matchFactor {
+	f := matchFactor{Factor: "sleepSchedule", Max: 15}
+
+	switch {
+	case a.SleepSchedule == b.SleepSchedule:
+		f.Points = 15
+		f.Detail = "same sleep schedule"
+	case a.SleepSchedule == "flexible" || b.SleepSchedule == "flexible":
+		f.Points = 8
+		f.Detail = "one of you has a flexible schedule"
+	default:
+		f.Detail = "opposite sleep schedules"
+	}
+
+	return f
+}
+
+func cleanlinessFactor(a, b *data.RoommateProfile) matchFactor {
+	f := matchFactor{Factor: "cleanliness", Max: 10}
+
+	diff := a.Cleanliness - b.Cleanliness
+	if diff < 0 {
+		diff = -diff
+	}
+	f.Points = max(0, 10-3*diff)
+	if diff == 0 {
+		f.Detail = "same cleanliness level"
+	} else {
+		f.Detail = fmt.Sprintf("cleanliness levels differ by %d", diff)
+	}
+
+	return f
+}
+
+func petsFactor(a, b *data.RoommateProfile) matchFactor {
+	f := matchFactor{Factor: "pets", Max: 10, Points: 10, Detail: "pet preferences are compatible"}
+
+	if (a.Pets == "have_pets" && b.Pets == "no_pets") || (a.Pets == "no_pets" && b.Pets == "have_pets") {
+		f.Points = 0
+		f.Detail = "one of you has pets and the other wants none"
+	}
+
+	return f
+}
+
+func smokingFactor(a, b *data.RoommateProfile) matchFactor {
+	f := matchFactor{Factor: "smoking", Max: 10}
+
+	steps := smokingOrder[a.Smoking] - smokingOrder[b.Smoking]
+	if steps < 0 {
+		steps = -steps
+	}
+	f.Points = 10 - 5*steps
+	switch steps {
+	case 0:
+		f.Detail = "same smoking habits"
+	case 1:
+		f.Detail = "smoking habits partly compatible"
+	default:
+		f.Detail = "a smoker and a non-smoker"
+	}
+
+	return f
+}
+
+// activeRoommate returns the caller's profile, answering 404 without one and
+// 409 when it is paused, since matching is only open to visible profiles
+func (app *Config) activeRoommate(w http.ResponseWriter, r *http.Request) (*data.RoommateProfile, bool) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	profile, err := app.Models.Roommate.Get(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("create a roommate profile first"), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if !profile.Active {
+		app.errorJSON(w, errors.New("your roommate profile is paused"), http.StatusConflict)
+		return nil, false
+	}
+
+	return profile, true
+}
+
+// visibleRoommate loads the {userId} profile as seen by the caller
+func (app *Config) visibleRoommate(w http.ResponseWriter, r *http.Request, viewerID int) (*data.RoommateProfile, bool) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid user ID"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	profile, err := app.Models.Roommate.GetVisible(viewerID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("roommate profile not found"), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return profile, true
+}
+
+// GetRoommateProfile returns the caller's own profile
+func (app *Config) GetRoommateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := app.Models.Roommate.Get(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("roommate profile not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{Error: false, Data: profile})
+}
+
+// SaveRoommateProfile creates or replaces the caller's profile
+func (app *Config) SaveRoommateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	var requestPayload struct {
+		Active        *bool    `json:"active"`
+		Bio           string   `json:"bio"`
+		BudgetMin     int      `json:"budgetMin"`
+		BudgetMax     int      `json:"budgetMax"`
+		Neighborhoods []string `json:"neighborhoods"`
+		MoveIn        struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+		} `json:"moveIn"`
+		SleepSchedule string `json:"sleepSchedule"`
+		Cleanliness   int    `json:"cleanliness"`
+		Pets          string `json:"pets"`
+		Smoking       string `json:"smoking"`
+	}
+
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	profile := &data.RoommateProfile{
+		UserID:        userID,
+		Active:        requestPayload.Active == nil || *requestPayload.Active,
+		Bio:           strings.TrimSpace(requestPayload.Bio),
+		BudgetMin:     requestPayload.BudgetMin,
+		BudgetMax:     requestPayload.BudgetMax,
+		SleepSchedule: requestPayload.SleepSchedule,
+		Cleanliness:   requestPayload.Cleanliness,
+		Pets:          requestPayload.Pets,
+		Smoking:       requestPayload.Smoking,
+	}
+
+	if len(profile.Bio) > maxRoommateBio {
+		app.errorJSON(w, fmt.Errorf("bio must be at most %d characters", maxRoommateBio), http.StatusUnprocessableEntity)
+		return
+	}
+	if profile.BudgetMin < 0 || profile.BudgetMax < profile.BudgetMin || profile.BudgetMax > maxRoommateBudget {
+		app.errorJSON(w, fmt.Errorf("budget must be a range between 0 and %d", maxRoommateBudget), http.StatusUnprocessableEntity)
+		return
+	}
+
+	seen := map[string]bool{}
+	profile.Neighborhoods = []string{}
+	for _, n := range requestPayload.Neighborhoods {
+		n = strings.TrimSpace(n)
+		if n == "" || seen[strings.ToLower(n)] {
+			continue
+		}
+		if len(n) > maxNeighborhoodLength {
+			app.errorJSON(w, fmt.Errorf("neighborhood names must be at most %d characters", maxNeighborhoodLength), http.StatusUnprocessableEntity)
+			return
+		}
+		seen[strings.ToLower(n)] = true
+		profile.Neighborhoods = append(profile.Neighborhoods, n)
+	}
+	if len(profile.Neighborhoods) > maxRoommateNeighborhoods {
+		app.errorJSON(w, fmt.Errorf("at most %d neighborhoods can be listed", maxRoommateNeighborhoods), http.StatusUnprocessableEntity)
+		return
+	}
+
+	from, err := time.Parse("2006-01-02", requestPayload.MoveIn.From)
+	if err != nil {
+		app.errorJSON(w, errors.New("moveIn.from must be a YYYY-MM-DD date"), http.StatusUnprocessableEntity)
+		return
+	}
+	to, err := time.Parse("2006-01-02", requestPayload.MoveIn.To)
+	if err != nil {
+		app.errorJSON(w, errors.New("moveIn.to must be a YYYY-MM-DD date"), http.StatusUnprocessableEntity)
+		return
+	}
+	if to.Before(from) {
+		app.errorJSON(w, errors.New("move-in window must end after it starts"), http.StatusUnprocessableEntity)
+		return
+	}
+	if to.Before(time.Now().Truncate(24 * time.Hour)) {
+		app.errorJSON(w, errors.New("move-in window is already over"), http.StatusUnprocessableEntity)
+		return
+	}
+	profile.MoveInFrom, profile.MoveInTo = from, to
+
+	if !data.SleepSchedules[profile.SleepSchedule] {
+		app.errorJSON(w, errors.New("sleepSchedule must be early_bird, flexible or night_owl"), http.StatusUnprocessableEntity)
+		return
+	}
+	if profile.Cleanliness < 1 || profile.Cleanliness > 5 {
+		app.errorJSON(w, errors.New("cleanliness must be between 1 and 5"), http.StatusUnprocessableEntity)
+		return
+	}
+	if !data.PetAnswers[profile.Pets] {
+		app.errorJSON(w, errors.New("pets must be have_pets, ok_with_pets or no_pets"), http.StatusUnprocessableEntity)
+		return
+	}
+	if !data.SmokingAnswers[profile.Smoking] {
+		app.errorJSON(w, errors.New("smoking must be smoker, outdoors_only or non_smoker"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := app.Models.Roommate.Save(profile); err != nil {
+		log.Printf("Error saving roommate profile of user %d: %v", userID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	saved, err := app.Models.Roommate.Get(userID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Roommate profile saved",
+		Data:    saved,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// DeleteRoommateProfile removes the caller from the roommate finder
+func (app *Config) DeleteRoommateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	err := app.Models.Roommate.Delete(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("roommate profile not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{Error: false, Message: "Roommate profile deleted"})
+}
+
+// GetRoommateMatches ranks other profiles by compatibility with the caller's.
+// ?minScore= drops weaker matches.
+func (app *Config) GetRoommateMatches(w http.ResponseWriter, r *http.Request) {
+	profile, ok := app.activeRoommate(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultRoommateMatches
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, maxRoommateMatches)
+	}
+
+	minScore := 0
+	if v := r.URL.Query().Get("minScore"); v != "" {
+		s, err := strconv.Atoi(v)
+		if err != nil || s < 0 || s > 100 {
+			app.errorJSON(w, errors.New("minScore must be between 0 and 100"), http.StatusBadRequest)
+			return
+		}
+		minScore = s
+	}
+
+	candidates, err := app.Models.Roommate.Candidates(profile.UserID, roommateCandidates)
+	if err != nil {
+		log.Printf("Error getting roommate candidates for user %d: %v", profile.UserID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	matches := []roommateMatch{}
+	for _, c := range candidates {
+		score, breakdown := compatibility(profile, c)
+		if score < minScore {
+			continue
+		}
+		matches = append(matches, roommateMatch{Profile: c, Score: score, Breakdown: breakdown})
+	}
+
+	// Candidates come most recently updated first, so ties keep that order
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	app.writeJSON(w, http.StatusOK, jsonResponse{Error: false, Data: matches})
+}
+
+// GetRoommate returns another user's profile with its score against the
+// caller's
+func (app *Config) GetRoommate(w http.ResponseWriter, r *http.Request) {
+	profile, ok := app.activeRoommate(w, r)
+	if !ok {
+		return
+	}
+
+	other, ok := app.visibleRoommate(w, r, profile.UserID)
+	if !ok {
+		return
+	}
+
+	score, breakdown := compatibility(profile, other)
+	app.writeJSON(w, http.StatusOK, jsonResponse{
+		Error: false,
+		Data:  roommateMatch{Profile: other, Score: score, Breakdown: breakdown},
+	})
+}
+
+// StartRoommateConversation sends the first message to a potential roommate.
+// Writing to the same person again continues the existing conversation.
+func (app *Config) StartRoommateConversation(w http.ResponseWriter, r *http.Request) {
+	profile, ok := app.activeRoommate(w, r)
+	if !ok {
+		return
+	}
+
+	other, ok := app.visibleRoommate(w, r, profile.UserID)
+	if !ok {
+		return
+	}
+
+	body, ok := app.readMessageBody(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.Models.Messaging.Touch(profile.UserID); err != nil {
+		log.Printf("Error recording messaging presence of user %d: %v", profile.UserID, err)
+	}
+
+	conversationID, created, err := app.Models.Messaging.StartRoommate(profile.UserID, other.UserID)
+	if err != nil {
+		log.Printf("Error starting roommate conversation between %d and %d: %v", profile.UserID, other.UserID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	conversation, err := app.Models.Messaging.Get(conversationID, profile.UserID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	msg, ok := app.sendMessage(w, conversation, profile.UserID, body)
+	if !ok {
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		log.Printf("User %d started roommate conversation %d with user %d", profile.UserID, conversationID, other.UserID)
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Message sent",
+		Data: map[string]any{
+			"conversation": conversation,
+			"message":      msg,
+		},
+	}
+
+	app.writeJSON(w, status, payload)
+}
@@ -13,9 +13,9 @@ func (app *Config) routes() http.Handler {
 
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-TOKEN"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-TOKEN", "If-Match", "If-None-Match"},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -28,7 +28,106 @@ func (app *Config) routes() http.Handler {
 	mux.Get("/posts/author/{authorId}", app.GetPostsByAuthor)
 	mux.Post("/posts", app.CreatePost)
 	mux.Put("/posts/{id}", app.UpdatePost)
+	mux.Patch("/posts/{id}", app.PatchPost)
 	mux.Delete("/posts/{id}", app.DeletePost)
+	mux.Put("/posts/{id}/status", app.SetPostStatus)
+
+	// Bulk import and export of the caller's listings
+	mux.Post("/posts/import", app.ImportPosts)
+	mux.Get("/posts/export", app.ExportPosts)
+
+	// Revision history
+	mux.Get("/posts/{id}/history", app.GetPostHistory)
+	mux.Post("/posts/{id}/history/{revisionId}/restore", app.RestorePostRevision)
+	mux.Get("/posts/{id}/price-history", app.GetPostPriceHistory)
+
+	// Listing analytics
+	mux.Post("/posts/{id}/contact-click", app.RecordContactClick)
+	mux.Get("/posts/author/{authorId}/analytics", app.GetAuthorAnalytics)
+
+	// Duplicate and scam screening (admin only)
+	mux.Get("/posts/{id}/matches", app.GetPostMatches)
+	mux.Get("/admin/screenings", app.GetPendingScreenings)
+	mux.Post("/admin/screenings/{postId}/approve", app.ApproveScreening)
+	mux.Post("/admin/screenings/{postId}/reject", app.RejectScreening)
+
+	// Reporting and moderation
+	mux.Post("/posts/{id}/reports", app.ReportPost)
+	mux.Get("/admin/reports", app.GetReports)
+	mux.Post("/admin/reports/{reportId}/actions", app.ReviewReport)
+	mux.Post("/admin/posts/{id}/actions", app.ModeratePost)
+	mux.Get("/admin/moderation/decisions", app.GetModerationDecisions)
+
+	// Saved searches and their alerts
+	mux.Get("/saved-searches", app.GetSavedSearches)
+	mux.Post("/saved-searches", app.CreateSavedSearch)
+	mux.Put("/saved-searches/{id}", app.UpdateSavedSearch)
+	mux.Delete("/saved-searches/{id}", app.DeleteSavedSearch)
+	mux.Get("/saved-searches/unsubscribe/{token}", app.GetUnsubscribeSavedSearch)
+	mux.Post("/saved-searches/unsubscribe/{token}", app.UnsubscribeSavedSearch)
+
+	// Messaging between renters and listing authors
+	mux.Post("/posts/{id}/conversations", app.StartConversation)
+	mux.Get("/conversations", app.GetConversations)
+	mux.Get("/conversations/unread-count", app.GetMessagingUnreadCount)
+	mux.Get("/conversations/{id}", app.GetConversation)
+	mux.Post("/conversations/{id}/messages", app.SendMessage)
+	mux.Post("/conversations/{id}/read", app.MarkConversationRead)
+	mux.Post("/conversations/{id}/block", app.BlockParticipant)
+	mux.Delete("/conversations/{id}/block", app.UnblockParticipant)
+	mux.Post("/conversations/{id}/reports", app.ReportParticipant)
+	mux.Get("/admin/user-reports", app.GetUserReports)
+	mux.Post("/admin/user-reports/{reportId}/actions", app.ReviewUserReport)
+
+	// Viewing appointments
+	mux.Get("/posts/{id}/viewing-slots", app.GetViewingSlots)
+	mux.Post("/posts/{id}/viewing-slots", app.CreateViewingSlots)
+	mux.Delete("/posts/{id}/viewing-slots/{slotId}", app.DeleteViewingSlot)
+	mux.Post("/viewing-slots/{slotId}/bookings", app.BookViewing)
+	mux.Get("/viewings", app.GetViewings)
+	mux.Post("/viewings/{id}/cancel", app.CancelViewing)
+	mux.Post("/viewings/{id}/reschedule", app.RescheduleViewing)
+
+	// Rental applications
+	mux.Post("/posts/{id}/applications", app.SubmitApplication)
+	mux.Get("/posts/{id}/applications", app.GetPostApplications)
+	mux.Get("/applications", app.GetMyApplications)
+	mux.Get("/applications/{id}", app.GetApplication)
+	mux.Get("/applications/{id}/documents/{documentId}", app.GetApplicationDocument)
+	mux.Post("/applications/{id}/status", app.SetApplicationStatus)
+
+	// Ratings and reviews of landlords
+	mux.Post("/posts/{id}/reviews", app.CreateReview)
+	mux.Get("/posts/{id}/reviews", app.GetPostReviews)
+	mux.Get("/users/{userId}/reviews", app.GetLandlordReviews)
+	mux.Post("/reviews/{id}/reply", app.ReplyToReview)
+	mux.Post("/reviews/{id}/reports", app.ReportReview)
+	mux.Get("/admin/review-reports", app.GetReviewReports)
+	mux.Post("/admin/review-reports/{reportId}/actions", app.ReviewReviewReport)
+
+	// Availability periods, blocked dates and the iCal feed
+	mux.Get("/posts/{id}/availability", app.GetAvailability)
+	mux.Put("/posts/{id}/availability", app.SetAvailability)
+	mux.Post("/posts/{id}/availability/blocks", app.BlockDates)
+	mux.Delete("/posts/{id}/availability/blocks/{blockId}", app.UnblockDates)
+	mux.Post("/posts/{id}/availability/feed", app.CreateAvailabilityFeed)
+	mux.Delete("/posts/{id}/availability/feed", app.DeleteAvailabilityFeed)
+	mux.Get("/calendars/{feed}", app.GetAvailabilityFeed)
+
+	// Neighborhood boundaries and stats
+	mux.Get("/neighborhoods", app.GetNeighborhoods)
+
+	// Rental market statistics
+	mux.Get("/market/stats", app.GetMarketStats)
+	mux.Get("/market/stats/series", app.GetMarketSeries)
+
+	// Roommate finder
+	mux.Get("/roommates/profile", app.GetRoommateProfile)
+	mux.Put("/roommates/profile", app.SaveRoommateProfile)
+	mux.Delete("/roommates/profile", app.DeleteRoommateProfile)
+	mux.Get("/roommates/matches", app.GetRoommateMatches)
+	mux.Get("/roommates/{userId}", app.GetRoommate)
+	mux.Post("/roommates/{userId}/conversations", app.StartRoommateConversation)
 
 	return mux
 }
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"post-service/data"
+	"post-service/screening"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// flagThreshold is the score at which a post is held for review
+	flagThreshold = 0.6
+	// maxScreenedImages bounds how many photos are hashed per post
+	maxScreenedImages = 6
+	// imageMatchDistance and textMatchDistance are the largest hash
+	// distances (out of 64 bits) still treated as the same photo / text
+	imageMatchDistance = 6
+	textMatchDistance  = 6
+	// priceOutlierRatio flags prices below this share of the local median
+	priceOutlierRatio = 0.6
+)
+
+// screenPost fingerprints a post and scores it for reposted photos, copied
+// descriptions and a suspiciously low price. post.ID is 0 for a new post.
+// Inline photos are always hashed, remote ones only on an allowed host and
+// with remoteImages. Lookup failures are logged and skipped so screening
+// never blocks a write.
+func (app *Config) screenPost(post data.Post, remoteImages bool) *data.Screened {
+	fp := data.Fingerprint{PostID: post.ID, AuthorID: post.AuthorID}
+	result := data.PostScreening{PostID: post.ID, Reasons: []data.ScreeningReason{}, ScreenedAt: time.Now()}
+
+	images := append([]string{post.ImageURL}, post.AdditionalImages...)
+	for _, src := range images {
+		if src == "" || len(fp.ImageHashes) == maxScreenedImages {
+			continue
+		}
+		if !screening.IsInline(src) && !(remoteImages && screening.AllowedHost(src)) {
+			continue
+		}
+		h, err := screening.ImageHash(src)
+		if err != nil {
+			log.Printf("Skipping image while screening post %d: %v", post.ID, err)
+			continue
+		}
+		fp.ImageHashes = append(fp.ImageHashes, h)
+	}
+
+	if h, ok := screening.TextFingerprint(post.Description); ok {
+		fp.TextHash = &h
+	}
+
+	candidates, err := app.Models.Screening.Candidates(post.ID)
+	if err != nil {
+		log.Printf("Error loading fingerprints for screening: %v", err)
+	}
+
+	for _, other := range candidates {
+		sameAuthor := other.AuthorID == post.AuthorID
+
+		if d, ok := closestImage(fp.ImageHashes, other.ImageHashes); ok && d <= imageMatchDistance {
+			reason := data.ScreeningReason{Code: "duplicate_image", MatchedPostID: other.PostID, Distance: d, Score: 0.6,
+				Detail: fmt.Sprintf("photo matches post %d by another account", other.PostID)}
+			if sameAuthor {
+				reason.Score = 0.2
+				reason.Detail = fmt.Sprintf("photo matches the author's post %d", other.PostID)
+			}
+			result.Reasons = append(result.Reasons, reason)
+		}
+
+		if fp.TextHash != nil && other.TextHash != nil {
+			if d := screening.Distance(*fp.TextHash, *other.TextHash); d <= textMatchDistance {
+				reason := data.ScreeningReason{Code: "duplicate_text", MatchedPostID: other.PostID, Distance: d, Score: 0.4,
+					Detail: fmt.Sprintf("description matches post %d by another account", other.PostID)}
+				if sameAuthor {
+					reason.Score = 0.15
+					reason.Detail = fmt.Sprintf("description matches the author's post %d", other.PostID)
+				}
+				result.Reasons = append(result.Reasons, reason)
+			}
+		}
+	}
+
+	median, comps, err := app.Models.Screening.PriceBaseline(post)
+	if err != nil {
+		log.Printf("Error computing price baseline for screening: %v", err)
+	}
+	if comps > 0 && median > 0 {
+		if ratio := post.Price / median; ratio < priceOutlierRatio {
+			result.Reasons = append(result.Reasons, data.ScreeningReason{
+				Code:   "price_outlier",
+				Score:  math.Min(0.6, 0.3+(priceOutlierRatio-ratio)),
+				Detail: fmt.Sprintf("price $%.0f is %.0f%% of the $%.0f median for %d comparable listings", post.Price, ratio*100, median, comps),
+			})
+		}
+	}
+
+	sort.SliceStable(result.Reasons, func(i, j int) bool {
+		return result.Reasons[i].Score > result.Reasons[j].Score
+	})
+
+	for _, reason := range result.Reasons {
+		result.Score += reason.Score
+	}
+	result.Score = math.Round(math.Min(1, result.Score)*100) / 100
+	result.Flagged = result.Score >= flagThreshold
+
+	return &data.Screened{Fingerprint: fp, Result: result}
+}
+
+// closestImage returns the smallest distance between any pair of photo hashes
+func closestImage(a, b []uint64) (int, bool) {
+	best, found := 65, false
+	for _, x := range a {
+		for _, y := range b {
+			if d := screening.Distance(x, y); d < best {
+				best, found = d, true
+			}
+		}
+	}
+	return best, found
+}
+
+// canViewPost reports whether the caller may see a post. Published,
+// pending and rented posts are public; the rest only to their author, or a moderator
+// reviewing them.
+func canViewPost(r *http.Request, post *data.PostWithAuthor) bool {
+	if data.IsPublicStatus(post.Status) || requestIsModerator(r) {
+		return true
+	}
+	userID, ok := requestUserID(r)
+	return ok && userID == post.AuthorID
+}
+
+// GetPendingScreenings lists posts held for review with why they were flagged
+func (app *Config) GetPendingScreenings(w http.ResponseWriter, r *http.Request) {
+	if !app.requireModerator(w, r) {
+		return
+	}
+
+	screenings, err := app.Models.Screening.GetPending()
+	if err != nil {
+		log.Printf("Error getting pending screenings: %v", err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]map[string]any, 0, len(screenings))
+	for _, s := range screenings {
+		post, err := app.Models.Post.GetByID(s.PostID)
+		if err != nil {
+			continue
+		}
+		response = append(response, map[string]any{
+			"post":      convertPostToFrontend(post),
+			"screening": s,
+		})
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  response,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetPostMatches returns a post's screening result together with the
+// listings it was matched against
+func (app *Config) GetPostMatches(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	if !app.requireModerator(w, r) {
+		return
+	}
+
+	result, err := app.Models.Screening.Get(postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("post has not been screened"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	matches := []map[string]any{}
+	seen := map[int]bool{}
+	for _, reason := range result.Reasons {
+		if reason.MatchedPostID == 0 || seen[reason.MatchedPostID] {
+			continue
+		}
+		seen[reason.MatchedPostID] = true
+
+		matched, err := app.Models.Post.GetByID(reason.MatchedPostID)
+		if err != nil {
+			continue
+		}
+		card := convertPostToFrontend(matched)
+		card["authorId"] = matched.AuthorID
+		matches = append(matches, card)
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data: map[string]any{
+			"screening": result,
+			"matches":   matches,
+		},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// ApproveScreening publishes a held post
+func (app *Config) ApproveScreening(w http.ResponseWriter, r *http.Request) {
+	app.reviewScreening(w, r, data.DecisionApproved, data.StatusPublished)
+}
+
+// RejectScreening keeps a held post out of listings for good
+func (app *Config) RejectScreening(w http.ResponseWriter, r *http.Request) {
+	app.reviewScreening(w, r, data.DecisionRejected, data.StatusRejected)
+}
+
+func (app *Config) reviewScreening(w http.ResponseWriter, r *http.Request, decision, status string) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "postId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	if !app.requireModerator(w, r) {
+		return
+	}
+
+	reviewerID, _ := requestUserID(r)
+	log.Printf("Screening of post %d %s by admin %d", postID, decision, reviewerID)
+
+	err = app.Models.Screening.Review(postID, reviewerID, decision, status)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("post has not been screened"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	post, err := app.Models.Post.GetByID(postID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Post " + decision,
+		Data:    convertPostToFrontend(post),
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"post-service/data"
+	"post-service/event"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	_ "time/tzdata"
+)
+
+const (
+	// maxSlotsPerRequest caps how many slots can be added at once
+	maxSlotsPerRequest = 50
+	// maxSlotLength is the longest a single viewing slot can be
+	maxSlotLength = 4 * time.Hour
+	// viewingReminderLead is how long before a viewing the reminder goes out
+	viewingReminderLead = 24 * time.Hour
+	// viewingReminderInterval is how often due reminders are looked for
+	viewingReminderInterval = time.Minute
+)
+
+// mailLocation is the zone viewing times are written in, from TIMEZONE
+var mailLocation = loadMailLocation()
+
+func loadMailLocation() *time.Location {
+	name := os.Getenv("TIMEZONE")
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Unknown TIMEZONE %q, writing times in UTC: %v", name, err)
+		return time.UTC
+	}
+	return loc
+}
+
+type slotPayload struct {
+	StartsAt time.Time `json:"startsAt"`
+	EndsAt   time.Time `json:"endsAt"`
+}
+
+// GetViewingSlots lists a listing's upcoming viewing slots and whether each
+// is still free. The owner also sees which booking holds a slot.
+func (app *Config) GetViewingSlots(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return
+	}
+
+	post, err := app.Models.Post.GetByID(postID)
+	if err != nil || !canViewPost(r, post) {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return
+	}
+
+	slots, err := app.Models.Viewing.Slots(postID)
+	if err != nil {
+		log.Printf("Error getting viewing slots of post %d: %v", postID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := requestUserID(r)
+	if !ok || userID != post.AuthorID {
+		for _, slot := range slots {
+			slot.BookingID = nil
+		}
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Viewing slots retrieved successfully",
+		Data:    slots,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// CreateViewingSlots adds viewing slots to the caller's listing
+func (app *Config) CreateViewingSlots(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.ownedPost(w, r)
+	if !ok {
+		return
+	}
+
+	var requestPayload struct {
+		Slots []slotPayload `json:"slots"`
+	}
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if len(requestPayload.Slots) == 0 {
+		app.errorJSON(w, errors.New("at least one slot is required"), http.StatusBadRequest)
+		return
+	}
+	if len(requestPayload.Slots) > maxSlotsPerRequest {
+		app.errorJSON(w, fmt.Errorf("at most %d slots can be added at once", maxSlotsPerRequest), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	slots := make([]*data.ViewingSlot, 0, len(requestPayload.Slots))
+	for i, s := range requestPayload.Slots {
+		var err error
+		switch {
+		case s.StartsAt.IsZero() || s.EndsAt.IsZero():
+			err = fmt.Errorf("slot %d: startsAt and endsAt are required", i+1)
+		case !s.StartsAt.After(now):
+			err = fmt.Errorf("slot %d must start in the future", i+1)
+		case !s.EndsAt.After(s.StartsAt):
+			err = fmt.Errorf("slot %d must end after it starts", i+1)
+		case s.EndsAt.Sub(s.StartsAt) > maxSlotLength:
+			err = fmt.Errorf("slot %d is longer than %s", i+1, maxSlotLength)
+		}
+		if err != nil {
+			app.errorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+		slots = append(slots, &data.ViewingSlot{StartsAt: s.StartsAt, EndsAt: s.EndsAt})
+	}
+
+	err := app.Models.Viewing.AddSlots(post.ID, slots)
+	if errors.Is(err, data.ErrSlotOverlap) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error adding viewing slots to post %d: %v", post.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Added %d viewing slots to post %d", len(slots), post.ID)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Viewing slots added",
+		Data:    slots,
+	}
+
+	app.writeJSON(w, http.StatusCreated, payload)
+}
+
+// DeleteViewingSlot removes a slot nobody has booked from the caller's listing
+func (app *Config) DeleteViewingSlot(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.ownedPost(w, r)
+	if !ok {
+		return
+	}
+
+	slotID, err := strconv.Atoi(chi.URLParam(r, "slotId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid slot ID"), http.StatusBadRequest)
+		return
+	}
+
+	err = app.Models.Viewing.DeleteSlot(post.ID, slotID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		app.errorJSON(w, errors.New("slot not found"), http.StatusNotFound)
+		return
+	case errors.Is(err, data.ErrSlotBooked):
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error deleting viewing slot %d: %v", slotID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Viewing slot deleted",
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// BookViewing books a free slot for the caller and mails both sides a
+// calendar invite
+func (app *Config) BookViewing(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	slotID, err := strconv.Atoi(chi.URLParam(r, "slotId"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid slot ID"), http.StatusBadRequest)
+		return
+	}
+
+	slot, err := app.Models.Viewing.GetSlot(slotID)
+	if err != nil {
+		app.errorJSON(w, errors.New("slot not found"), http.StatusNotFound)
+		return
+	}
+
+	post, err := app.Models.Post.GetByID(slot.PostID)
+	if err != nil || !canViewPost(r, post) {
+		app.errorJSON(w, errors.New("slot not found"), http.StatusNotFound)
+		return
+	}
+
+	if post.AuthorID == userID {
+		app.errorJSON(w, errors.New("you cannot book a viewing of your own listing"), http.StatusBadRequest)
+		return
+	}
+	if post.Status != data.StatusPublished {
+		app.errorJSON(w, errors.New("this listing is no longer taking viewings"), http.StatusConflict)
+		return
+	}
+	if !slot.StartsAt.After(time.Now()) {
+		app.errorJSON(w, errors.New("this slot has already started"), http.StatusConflict)
+		return
+	}
+
+	blocked, err := app.Models.Messaging.IsBlocked(userID, post.AuthorID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		app.errorJSON(w, data.ErrBlocked, http.StatusForbidden)
+		return
+	}
+
+	booking, err := app.Models.Viewing.Book(slot.ID, post.ID, userID, app.viewingNotices("booked"))
+	if errors.Is(err, data.ErrSlotTaken) || errors.Is(err, data.ErrAlreadyBooked) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error booking viewing slot %d: %v", slot.ID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d booked viewing %d of post %d", userID, booking.ID, post.ID)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Viewing booked",
+		Data:    booking,
+	}
+
+	app.writeJSON(w, http.StatusCreated, payload)
+}
+
+// GetViewings lists the caller's upcoming viewings, both those they booked
+// and those booked on their listings
+func (app *Config) GetViewings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+
+	bookings, err := app.Models.Viewing.BookingsForUser(userID)
+	if err != nil {
+		log.Printf("Error getting viewings of user %d: %v", userID, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Viewings retrieved successfully",
+		Data:    bookings,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// CancelViewing cancels a booking; either the renter or the landlord can
+func (app *Config) CancelViewing(w http.ResponseWriter, r *http.Request) {
+	userID, booking, ok := app.participantBooking(w, r)
+	if !ok {
+		return
+	}
+
+	id := booking.ID
+	booking, err := app.Models.Viewing.Cancel(id, userID, app.viewingNotices("cancelled"))
+	if errors.Is(err, data.ErrBookingClosed) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error cancelling viewing %d: %v", id, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d cancelled viewing %d", userID, id)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Viewing cancelled",
+		Data:    booking,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// RescheduleViewing moves a booking to another free slot of the same listing
+func (app *Config) RescheduleViewing(w http.ResponseWriter, r *http.Request) {
+	userID, booking, ok := app.participantBooking(w, r)
+	if !ok {
+		return
+	}
+
+	var requestPayload struct {
+		SlotID int `json:"slotId"`
+	}
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	slot, err := app.Models.Viewing.GetSlot(requestPayload.SlotID)
+	if err != nil || slot.PostID != booking.PostID {
+		app.errorJSON(w, errors.New("slot not found"), http.StatusNotFound)
+		return
+	}
+	if slot.ID == booking.SlotID {
+		app.errorJSON(w, errors.New("the viewing is already in this slot"), http.StatusBadRequest)
+		return
+	}
+	if !slot.StartsAt.After(time.Now()) {
+		app.errorJSON(w, errors.New("this slot has already started"), http.StatusConflict)
+		return
+	}
+
+	id := booking.ID
+	booking, err = app.Models.Viewing.Reschedule(id, slot.ID, app.viewingNotices("rescheduled"))
+	if errors.Is(err, data.ErrSlotTaken) || errors.Is(err, data.ErrBookingClosed) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error rescheduling viewing %d: %v", id, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d moved viewing %d to slot %d", userID, id, slot.ID)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Viewing rescheduled",
+		Data:    booking,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// ownedPost loads the post in the URL and checks the caller owns it
+func (app *Config) ownedPost(w http.ResponseWriter, r *http.Request) (*data.PostWithAuthor, bool) {
+	postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid post ID"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	post, err := app.Models.Post.GetByID(postID)
+	if err != nil {
+		app.errorJSON(w, errors.New("post not found"), http.StatusNotFound)
+		return nil, false
+	}
+	if post.AuthorID != userID && !requestIsAdmin(r) {
+		app.errorJSON(w, errors.New("only the author can manage this listing"), http.StatusForbidden)
+		return nil, false
+	}
+
+	return post, true
+}
+
+// participantBooking loads the booking in the URL if the caller is its
+// renter or landlord, answering 404 otherwise
+func (app *Config) participantBooking(w http.ResponseWriter, r *http.Request) (int, *data.ViewingBooking, bool) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		app.errorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+		return 0, nil, false
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid viewing ID"), http.StatusBadRequest)
+		return 0, nil, false
+	}
+
+	booking, err := app.Models.Viewing.GetBooking(id)
+	if err != nil || !booking.IsParticipant(userID) {
+		app.errorJSON(w, errors.New("viewing not found"), http.StatusNotFound)
+		return 0, nil, false
+	}
+
+	return userID, booking, true
+}
+
+// viewingNotices returns the mails sent to the renter and the landlord
+// when a booking is made, moved, cancelled or coming up. All but the
+// reminder carry the viewing as an .ics invite whose UID and SEQUENCE let
+// calendars update the same event.
+func (app *Config) viewingNotices(kind string) data.BookingNotices {
+	return func(b *data.ViewingBooking) ([]event.NotificationEvent, error) {
+		when := b.StartsAt.In(mailLocation).Format("Monday, Jan 2 at 3:04 PM") +
+			" – " + b.EndsAt.In(mailLocation).Format("3:04 PM MST")
+
+		var attachments []event.Attachment
+		if kind != "reminder" {
+			status := "CONFIRMED"
+			if b.Status == data.BookingCancelled {
+				status = "CANCELLED"
+			}
+			location := b.PostLocation
+			if location == "" {
+				location = b.Neighborhood
+			}
+			ics := icalendar("", []icalEvent{{
+				UID:         fmt.Sprintf("viewing-%d@dwell", b.ID),
+				Sequence:    b.Sequence,
+				Start:       b.StartsAt,
+				End:         b.EndsAt,
+				Summary:     "Viewing: " + b.PostTitle,
+				Description: fmt.Sprintf("Viewing of %s with %s and %s", b.PostTitle, b.Renter.Name, b.Landlord.Name),
+				Location:    location,
+				Status:      status,
+				URL:         fmt.Sprintf("%s/posts/%d", app.PublicURL, b.PostID),
+			}})
+			attachments = []event.Attachment{{
+				Name:        "viewing.ics",
+				ContentType: "text/calendar; charset=utf-8; method=PUBLISH",
+				Data:        ics,
+			}}
+		}
+
+		var notices []event.NotificationEvent
+		for _, side := range []struct {
+			to, other data.Participant
+		}{{b.Renter, b.Landlord}, {b.Landlord, b.Renter}} {
+			contact, err := app.Models.Moderation.ContactOf(side.to.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			title, message := viewingMessage(kind, b, side.to, side.other, when)
+			notices = append(notices, event.NotificationEvent{
+				UserID:      side.to.ID,
+				Email:       contact.Email,
+				Title:       title,
+				Message:     message,
+				Type:        "viewing_" + kind,
+				Attachments: attachments,
+			})
+		}
+
+		return notices, nil
+	}
+}
+
+// viewingMessage writes the subject and body of a viewing mail for one side
+func viewingMessage(kind string, b *data.ViewingBooking, to, other data.Participant, when string) (string, string) {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hello %s,\n\n", strings.TrimSpace(to.Name))
+
+	var title string
+	switch kind {
+	case "booked":
+		title = "Viewing booked: " + b.PostTitle
+		if to.ID == b.Renter.ID {
+			fmt.Fprintf(&body, "Your viewing of %q is booked for %s.\n", b.PostTitle, when)
+		} else {
+			fmt.Fprintf(&body, "%s booked a viewing of %q for %s.\n", other.Name, b.PostTitle, when)
+		}
+	case "rescheduled":
+		title = "Viewing moved: " + b.PostTitle
+		fmt.Fprintf(&body, "The viewing of %q with %s has moved to %s.\n", b.PostTitle, other.Name, when)
+	case "cancelled":
+		title = "Viewing cancelled: " + b.PostTitle
+		by := "You"
+		if b.CancelledBy != nil && *b.CancelledBy == other.ID {
+			by = other.Name
+		}
+		fmt.Fprintf(&body, "%s cancelled the viewing of %q on %s.\n", by, b.PostTitle, when)
+	default:
+		title = "Viewing tomorrow: " + b.PostTitle
+		fmt.Fprintf(&body, "A reminder that the viewing of %q with %s is on %s.\n", b.PostTitle, other.Name, when)
+	}
+
+	if kind != "cancelled" && b.PostLocation != "" {
+		fmt.Fprintf(&body, "\nAddress: %s\n", b.PostLocation)
+	}
+	if kind != "cancelled" && kind != "reminder" {
+		body.WriteString("\nThe attached invite adds it to your calendar.\n")
+	}
+
+	return title, body.String()
+}
+
+// runViewingReminders mails both sides of each viewing a day before it
+// until the process exits
+func (app *Config) runViewingReminders() {
+	ticker := time.NewTicker(viewingReminderInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := app.Models.Viewing.SendReminders(viewingReminderLead, 100, app.viewingNotices("reminder"))
+		if err != nil {
+			log.Printf("Error sending viewing reminders: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("Queued reminders for %d viewings", n)
+		}
+	}
+}
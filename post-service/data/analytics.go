@@ -0,0 +1,121 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Interaction kinds recorded for listing analytics
+const (
+	InteractionView    = "view"
+	InteractionContact = "contact"
+)
+
+// DailyInteractions holds one post's interaction counts for one UTC day
+type DailyInteractions struct {
+	PostID        int       `json:"postId"`
+	Day           time.Time `json:"day"`
+	Views         int       `json:"views"`
+	ContactClicks int       `json:"contactClicks"`
+}
+
+// InteractionTotals holds one post's all-time interaction counts
+type InteractionTotals struct {
+	Views         int `json:"views"`
+	ContactClicks int `json:"contactClicks"`
+}
+
+// Analytics records and aggregates how visitors interact with listings.
+// Interactions are deduplicated per viewer per day: a viewer key is either
+// "user:<id>" for logged in callers or "session:<id>" for anonymous ones.
+type Analytics struct{}
+
+// Record stores one interaction. Repeats by the same viewer on the same UTC
+// day are ignored.
+func (a *Analytics) Record(postID int, kind, viewerKey string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO post_interactions (post_id, kind, viewer_key, day, created_at)
+		VALUES ($1, $2, $3, (NOW() AT TIME ZONE 'UTC')::date, NOW())
+		ON CONFLICT (post_id, kind, viewer_key, day) DO NOTHING
+	`
+
+	_, err := db.ExecContext(ctx, stmt, postID, kind, viewerKey)
+	return err
+}
+
+// GetDaily returns per-day counts for the posts from since onwards. Days
+// without any interaction are omitted.
+func (a *Analytics) GetDaily(postIDs []int, since time.Time) ([]*DailyInteractions, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT post_id, day,
+			COUNT(*) FILTER (WHERE kind = $3),
+			COUNT(*) FILTER (WHERE kind = $4)
+		FROM post_interactions
+		WHERE post_id = ANY($1) AND day >= $2
+		GROUP BY post_id, day
+		ORDER BY post_id, day
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(postIDs), since, InteractionView, InteractionContact)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []*DailyInteractions
+	for rows.Next() {
+		var d DailyInteractions
+		if err := rows.Scan(&d.PostID, &d.Day, &d.Views, &d.ContactClicks); err != nil {
+			return nil, err
+		}
+		days = append(days, &d)
+	}
+
+	return days, rows.Err()
+}
+
+// GetTotals returns all-time counts for the posts, keyed by post ID. Posts
+// without interactions are present with zero counts.
+func (a *Analytics) GetTotals(postIDs []int) (map[int]InteractionTotals, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT post_id,
+			COUNT(*) FILTER (WHERE kind = $2),
+			COUNT(*) FILTER (WHERE kind = $3)
+		FROM post_interactions
+		WHERE post_id = ANY($1)
+		GROUP BY post_id
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(postIDs), InteractionView, InteractionContact)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[int]InteractionTotals, len(postIDs))
+	for _, id := range postIDs {
+		totals[id] = InteractionTotals{}
+	}
+
+	for rows.Next() {
+		var postID int
+		var t InteractionTotals
+		if err := rows.Scan(&postID, &t.Views, &t.ContactClicks); err != nil {
+			return nil, err
+		}
+		totals[postID] = t
+	}
+
+	return totals, rows.Err()
+}
@@ -0,0 +1,354 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"post-service/event"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// Rental application statuses
+const (
+	ApplicationSubmitted   = "submitted"
+	ApplicationUnderReview = "under_review"
+	ApplicationAccepted    = "accepted"
+	ApplicationRejected    = "rejected"
+	ApplicationWithdrawn   = "withdrawn"
+)
+
+// applicationTransitions lists where each status can move to. Accepted,
+// rejected and withdrawn applications are final.
+var applicationTransitions = map[string][]string{
+	ApplicationSubmitted:   {ApplicationUnderReview, ApplicationAccepted, ApplicationRejected, ApplicationWithdrawn},
+	ApplicationUnderReview: {ApplicationAccepted, ApplicationRejected, ApplicationWithdrawn},
+}
+
+// CanMoveApplication reports whether an application can go from one status
+// to another
+func CanMoveApplication(from, to string) bool {
+	for _, s := range applicationTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ErrApplicationOpen is returned when the renter already has an open
+	// application for the listing
+	ErrApplicationOpen = errors.New("you already have an open application for this listing")
+	// ErrApplicationMoved is returned when the application's status changed
+	// since the caller read it
+	ErrApplicationMoved = errors.New("the application's status has changed")
+)
+
+// RentalApplication is a renter's application to rent a listing
+type RentalApplication struct {
+	ID         int                    `json:"id"`
+	PostID     int                    `json:"postId"`
+	PostTitle  string                 `json:"postTitle"`
+	Applicant  Participant            `json:"applicant"`
+	LandlordID int                    `json:"landlordId"`
+	MoveInDate time.Time              `json:"-"`
+	MoveIn     string                 `json:"moveInDate"` // MoveInDate as YYYY-MM-DD
+	Occupants  int                    `json:"occupants"`
+	Message    string                 `json:"message"`
+	Status     string                 `json:"status"`
+	Documents  []*ApplicationDocument `json:"documents,omitempty"`
+	History    []*ApplicationStatus   `json:"history,omitempty"`
+	CreatedAt  time.Time              `json:"createdAt"`
+	UpdatedAt  time.Time              `json:"updatedAt"`
+}
+
+// IsParticipant reports whether the user is the applicant or the landlord
+func (a *RentalApplication) IsParticipant(userID int) bool {
+	return a.Applicant.ID == userID || a.LandlordID == userID
+}
+
+// ApplicationDocument is a file uploaded with an application. Data is only
+// loaded when the document itself is requested.
+type ApplicationDocument struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"contentType"`
+	Size        int       `json:"size"`
+	Data        []byte    `json:"data,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// ApplicationStatus is one step of an application's history
+type ApplicationStatus struct {
+	Status    string    `json:"status"`
+	ChangedBy *int      `json:"changedBy,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ApplicationNotices builds the notifications for an application once its
+// status changed, so they can be queued in the same transaction
+type ApplicationNotices func(*RentalApplication) ([]event.NotificationEvent, error)
+
+// Applications stores rental applications and their documents
+type Applications struct{}
+
+// applicationSelect is the query read by scanApplication
+const applicationSelect = `
+	SELECT a.id, a.post_id, p.title, a.applicant_id, u.first_name, u.last_name, p.author_id,
+		a.move_in_date, a.occupants, a.message, a.status, a.created_at, a.updated_at
+	FROM rental_applications a
+	JOIN posts p ON p.id = a.post_id
+	JOIN users u ON u.id = a.applicant_id`
+
+func scanApplication(row rowScanner) (*RentalApplication, error) {
+	var a RentalApplication
+	var firstName, lastName string
+
+	err := row.Scan(&a.ID, &a.PostID, &a.PostTitle, &a.Applicant.ID, &firstName, &lastName, &a.LandlordID,
+		&a.MoveInDate, &a.Occupants, &a.Message, &a.Status, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Applicant.Name = firstName + " " + lastName
+	a.Applicant.Role = "renter"
+	a.MoveIn = a.MoveInDate.Format("2006-01-02")
+
+	return &a, nil
+}
+
+func scanApplications(rows *sql.Rows) ([]*RentalApplication, error) {
+	defer rows.Close()
+
+	applications := []*RentalApplication{}
+	for rows.Next() {
+		a, err := scanApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+		applications = append(applications, a)
+	}
+
+	return applications, rows.Err()
+}
+
+// Submit stores a new application with its documents and queues its
+// notices. The unique index on open applications turns a second one for
+// the same listing into ErrApplicationOpen.
+func (ap *Applications) Submit(a *RentalApplication, notices ApplicationNotices) (*RentalApplication, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO rental_applications (post_id, applicant_id, move_in_date, occupants, message, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		RETURNING id
+	`, a.PostID, a.Applicant.ID, a.MoveInDate, a.Occupants, a.Message, ApplicationSubmitted, now).Scan(&id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrApplicationOpen
+		}
+		return nil, err
+	}
+
+	for _, d := range a.Documents {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO application_documents (application_id, name, content_type, size, data, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, id, d.Name, d.ContentType, len(d.Data), d.Data, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return finishApplicationChange(ctx, tx, id, ApplicationSubmitted, a.Applicant.ID, "", notices)
+}
+
+// SetStatus moves an application from one status to another. It returns
+// ErrApplicationMoved when the application is no longer in from. With
+// postStatus set the listing is moved to it in the same transaction.
+func (ap *Applications) SetStatus(id int, from, to string, changedBy int, note, postStatus string, notices ApplicationNotices) (*RentalApplication, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var postID int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE rental_applications SET status = $1, updated_at = $2
+		WHERE id = $3 AND status = $4
+		RETURNING post_id
+	`, to, time.Now(), id, from).Scan(&postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrApplicationMoved
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if postStatus != "" {
+		if err := changePostStatus(ctx, tx, postID, postStatus); err != nil {
+			return nil, err
+		}
+	}
+
+	return finishApplicationChange(ctx, tx, id, to, changedBy, note, notices)
+}
+
+// finishApplicationChange records the new status in the history, queues
+// the notices and commits
+func finishApplicationChange(ctx context.Context, tx *sql.Tx, id int, status string, changedBy int, note string, notices ApplicationNotices) (*RentalApplication, error) {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO application_status_history (application_id, status, changed_by, note, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, id, status, changedBy, note, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := scanApplication(tx.QueryRowContext(ctx, applicationSelect+` WHERE a.id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	if notices != nil {
+		events, err := notices(a)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			if err := enqueueEvent(ctx, tx, event.RoutingNotification, e); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return a, tx.Commit()
+}
+
+// Get returns an application with its document list and history
+func (ap *Applications) Get(id int) (*RentalApplication, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	a, err := scanApplication(db.QueryRowContext(ctx, applicationSelect+` WHERE a.id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, name, content_type, size, created_at
+		FROM application_documents
+		WHERE application_id = $1
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d ApplicationDocument
+		if err := rows.Scan(&d.ID, &d.Name, &d.ContentType, &d.Size, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.Documents = append(a.Documents, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	history, err := db.QueryContext(ctx, `
+		SELECT status, changed_by, note, created_at
+		FROM application_status_history
+		WHERE application_id = $1
+		ORDER BY created_at, id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer history.Close()
+
+	for history.Next() {
+		var s ApplicationStatus
+		var changedBy sql.NullInt64
+		if err := history.Scan(&s.Status, &changedBy, &s.Note, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		if changedBy.Valid {
+			id := int(changedBy.Int64)
+			s.ChangedBy = &id
+		}
+		a.History = append(a.History, &s)
+	}
+
+	return a, history.Err()
+}
+
+// Document returns one document of an application, with its data
+func (ap *Applications) Document(applicationID, documentID int) (*ApplicationDocument, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var d ApplicationDocument
+	err := db.QueryRowContext(ctx, `
+		SELECT id, name, content_type, size, data, created_at
+		FROM application_documents
+		WHERE id = $1 AND application_id = $2
+	`, documentID, applicationID).Scan(&d.ID, &d.Name, &d.ContentType, &d.Size, &d.Data, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// ForPost returns a listing's applications, newest first, optionally only
+// those in one status
+func (ap *Applications) ForPost(postID int, status string) ([]*RentalApplication, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, applicationSelect+`
+		WHERE a.post_id = $1 AND ($2::text = '' OR a.status = $2::text)
+		ORDER BY a.created_at DESC, a.id DESC
+	`, postID, status)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanApplications(rows)
+}
+
+// ForApplicant returns the applications a renter submitted, newest first
+func (ap *Applications) ForApplicant(applicantID int) ([]*RentalApplication, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, applicationSelect+`
+		WHERE a.applicant_id = $1
+		ORDER BY a.created_at DESC, a.id DESC
+	`, applicantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanApplications(rows)
+}
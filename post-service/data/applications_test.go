@@ -0,0 +1,42 @@
+package data
+
+import "testing"
+
+func TestCanMoveApplication(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{ApplicationSubmitted, ApplicationUnderReview, true},
+		{ApplicationSubmitted, ApplicationAccepted, true},
+		{ApplicationSubmitted, ApplicationRejected, true},
+		{ApplicationSubmitted, ApplicationWithdrawn, true},
+		{ApplicationSubmitted, ApplicationSubmitted, false},
+
+		{ApplicationUnderReview, ApplicationAccepted, true},
+		{ApplicationUnderReview, ApplicationRejected, true},
+		{ApplicationUnderReview, ApplicationWithdrawn, true},
+		{ApplicationUnderReview, ApplicationSubmitted, false},
+		{ApplicationUnderReview, ApplicationUnderReview, false},
+
+		{ApplicationAccepted, ApplicationRejected, false},
+		{ApplicationAccepted, ApplicationWithdrawn, false},
+		{ApplicationAccepted, ApplicationUnderReview, false},
+		{ApplicationRejected, ApplicationAccepted, false},
+		{ApplicationRejected, ApplicationSubmitted, false},
+		{ApplicationWithdrawn, ApplicationSubmitted, false},
+		{ApplicationWithdrawn, ApplicationUnderReview, false},
+
+		{"", ApplicationSubmitted, false},
+		{ApplicationSubmitted, "approved", false},
+		{"approved", ApplicationAccepted, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := CanMoveApplication(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanMoveApplication(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
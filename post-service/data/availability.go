@@ -0,0 +1,360 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// dateFormat is how availability dates are written: YYYY-MM-DD
+const dateFormat = "2006-01-02"
+
+var (
+	// ErrPeriodOverlap is returned when availability periods overlap
+	ErrPeriodOverlap = errors.New("availability periods can't overlap")
+	// ErrBlockOverlap is returned when blocked dates overlap ones already
+	// blocked
+	ErrBlockOverlap = errors.New("these dates are already blocked")
+)
+
+// AvailabilityPeriod is a stretch of dates a listing can be rented in
+type AvailabilityPeriod struct {
+	ID    int      `json:"id"`
+	From  string   `json:"from"`  // YYYY-MM-DD
+	To    string   `json:"to"`    // inclusive
+	Price *float64 `json:"price"` // nil means the listing's price
+	Note  string   `json:"note"`
+}
+
+// BlockedDates are dates the owner took off the calendar
+type BlockedDates struct {
+	ID   int    `json:"id"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	Note string `json:"note,omitempty"` // only shown to the owner
+}
+
+// AvailabilityCalendar is a listing's periods and blocked dates, both in
+// date order
+type AvailabilityCalendar struct {
+	Periods []*AvailabilityPeriod `json:"periods"`
+	Blocked []*BlockedDates       `json:"blocked"`
+}
+
+// Available reports whether any day from from to to (YYYY-MM-DD, either may
+// be empty for an open end) falls in a period and isn't blocked
+func (c *AvailabilityCalendar) Available(from, to string) bool {
+	for _, p := range c.Periods {
+		start, end := p.From, p.To
+		if from != "" && from > start {
+			start = from
+		}
+		if to != "" && to < end {
+			end = to
+		}
+		if start > end {
+			continue
+		}
+		if !c.blockedThrough(start, end) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockedThrough reports whether blocks cover every day from start to end
+func (c *AvailabilityCalendar) blockedThrough(start, end string) bool {
+	for _, b := range c.Blocked {
+		if b.From > start {
+			return false
+		}
+		if b.To >= start {
+			start = nextDay(b.To)
+			if start > end {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func nextDay(date string) string {
+	t, err := time.Parse(dateFormat, date)
+	if err != nil {
+		return date
+	}
+	return t.AddDate(0, 0, 1).Format(dateFormat)
+}
+
+// SortPeriods orders periods by start date and reports whether any overlap
+func SortPeriods(periods []*AvailabilityPeriod) (overlap bool) {
+	sort.Slice(periods, func(i, j int) bool { return periods[i].From < periods[j].From })
+	for i := 1; i < len(periods); i++ {
+		if periods[i].From <= periods[i-1].To {
+			return true
+		}
+	}
+	return false
+}
+
+// Availability stores listings' availability periods, blocked dates and
+// calendar feed tokens
+type Availability struct{}
+
+// Get returns a listing's calendar
+func (a *Availability) Get(postID int) (*AvailabilityCalendar, error) {
+	calendars, err := a.ForPosts([]int{postID})
+	if err != nil {
+		return nil, err
+	}
+	return calendars[postID], nil
+}
+
+// ForPosts returns the calendars of several listings. Every ID gets a
+// calendar, empty when the listing has no periods.
+func (a *Availability) ForPosts(postIDs []int) (map[int]*AvailabilityCalendar, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	calendars := make(map[int]*AvailabilityCalendar, len(postIDs))
+	for _, id := range postIDs {
+		calendars[id] = &AvailabilityCalendar{Periods: []*AvailabilityPeriod{}, Blocked: []*BlockedDates{}}
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT post_id, id, to_char(starts_on, 'YYYY-MM-DD'), to_char(ends_on, 'YYYY-MM-DD'), price, note
+		FROM availability_periods
+		WHERE post_id = ANY($1)
+		ORDER BY starts_on
+	`, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var p AvailabilityPeriod
+		var price sql.NullFloat64
+		if err := rows.Scan(&postID, &p.ID, &p.From, &p.To, &price, &p.Note); err != nil {
+			return nil, err
+		}
+		if price.Valid {
+			p.Price = &price.Float64
+		}
+		calendars[postID].Periods = append(calendars[postID].Periods, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT post_id, id, to_char(starts_on, 'YYYY-MM-DD'), to_char(ends_on, 'YYYY-MM-DD'), note
+		FROM availability_blocks
+		WHERE post_id = ANY($1)
+		ORDER BY starts_on
+	`, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var b BlockedDates
+		if err := rows.Scan(&postID, &b.ID, &b.From, &b.To, &b.Note); err != nil {
+			return nil, err
+		}
+		calendars[postID].Blocked = append(calendars[postID].Blocked, &b)
+	}
+
+	return calendars, rows.Err()
+}
+
+// SetPeriods replaces a listing's periods, which must be sorted and not
+// overlap, and moves the listing's availableFrom/availableTo to the
+// earliest start and latest end. The listing's version is bumped so cached
+// copies are refreshed.
+func (a *Availability) SetPeriods(postID int, periods []*AvailabilityPeriod) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockPost(ctx, tx, postID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM availability_periods WHERE post_id = $1`, postID); err != nil {
+		return err
+	}
+
+	for _, p := range periods {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO availability_periods (post_id, starts_on, ends_on, price, note)
+			VALUES ($1, $2::date, $3::date, $4, $5)
+			RETURNING id
+		`, postID, p.From, p.To, p.Price, p.Note).Scan(&p.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(periods) > 0 {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE posts SET available_from = $2::date, available_to = $3::date,
+				updated_at = $4, version = version + 1
+			WHERE id = $1
+		`, postID, periods[0].From, periods[len(periods)-1].To, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// syncSinglePeriod keeps a listing with at most one period in step with its
+// availableFrom/availableTo, so edits of those dates keep working for
+// listings that never used the calendar
+func syncSinglePeriod(ctx context.Context, tx *sql.Tx, post *Post) error {
+	if post.AvailableFrom.IsZero() {
+		return nil
+	}
+
+	from := post.AvailableFrom.Format(dateFormat)
+	to := post.AvailableTo.Format(dateFormat)
+	if to < from {
+		to = from
+	}
+
+	var count int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM availability_periods WHERE post_id = $1`, post.ID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	switch count {
+	case 0:
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO availability_periods (post_id, starts_on, ends_on) VALUES ($1, $2::date, $3::date)
+		`, post.ID, from, to)
+	case 1:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE availability_periods SET starts_on = $2::date, ends_on = $3::date WHERE post_id = $1
+		`, post.ID, from, to)
+	}
+
+	return err
+}
+
+// AddBlock blocks dates of a listing. It fails with ErrBlockOverlap when
+// some of them are blocked already.
+func (a *Availability) AddBlock(postID int, block *BlockedDates) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT id FROM posts WHERE id = $1 FOR UPDATE`, postID); err != nil {
+		return err
+	}
+
+	var overlap bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM availability_blocks
+			WHERE post_id = $1 AND starts_on <= $3::date AND ends_on >= $2::date
+		)
+	`, postID, block.From, block.To).Scan(&overlap)
+	if err != nil {
+		return err
+	}
+	if overlap {
+		return ErrBlockOverlap
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO availability_blocks (post_id, starts_on, ends_on, note)
+		VALUES ($1, $2::date, $3::date, $4)
+		RETURNING id
+	`, postID, block.From, block.To, block.Note).Scan(&block.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteBlock unblocks dates of a listing. It returns sql.ErrNoRows when the
+// block isn't the listing's.
+func (a *Availability) DeleteBlock(postID, blockID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `DELETE FROM availability_blocks WHERE id = $1 AND post_id = $2`, blockID, postID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// FeedToken returns the token of a listing's calendar feed, or "" when it
+// has none
+func (a *Availability) FeedToken(postID int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var token string
+	err := db.QueryRowContext(ctx, `SELECT token FROM availability_feeds WHERE post_id = $1`, postID).Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return token, err
+}
+
+// SetFeedToken publishes a listing's calendar feed under token, replacing
+// any earlier token, or stops publishing it when token is ""
+func (a *Availability) SetFeedToken(postID int, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	if token == "" {
+		_, err := db.ExecContext(ctx, `DELETE FROM availability_feeds WHERE post_id = $1`, postID)
+		return err
+	}
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO availability_feeds (post_id, token, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (post_id) DO UPDATE SET token = EXCLUDED.token, created_at = EXCLUDED.created_at
+	`, postID, token, time.Now())
+	return err
+}
+
+// PostByFeedToken returns the ID of the listing whose feed token is token
+func (a *Availability) PostByFeedToken(token string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var postID int
+	err := db.QueryRowContext(ctx, `SELECT post_id FROM availability_feeds WHERE token = $1`, token).Scan(&postID)
+	return postID, err
+}
@@ -0,0 +1,166 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+)
+
+// ErrRefTaken is returned when an import row names both a listing and an
+// externalRef that already belongs to a different listing
+var ErrRefTaken = errors.New("externalRef already belongs to another listing")
+
+// Import actions reported for each row
+const (
+	ImportCreate    = "create"
+	ImportUpdate    = "update"
+	ImportUnchanged = "unchanged"
+)
+
+// Imports stores authors' external references of their listings and
+// writes bulk imported listings
+type Imports struct{}
+
+// Refs returns the externalRef of each of an author's listings that has one
+func (i *Imports) Refs(authorID int) (map[int]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT post_id, external_ref FROM post_import_refs WHERE author_id = $1`, authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refs := map[int]string{}
+	for rows.Next() {
+		var postID int
+		var ref string
+		if err := rows.Scan(&postID, &ref); err != nil {
+			return nil, err
+		}
+		refs[postID] = ref
+	}
+
+	return refs, rows.Err()
+}
+
+// PostByRef returns the ID of the author's listing with externalRef ref, or
+// 0 when there is none
+func (i *Imports) PostByRef(authorID int, ref string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var postID int
+	err := db.QueryRowContext(ctx, `
+		SELECT post_id FROM post_import_refs WHERE author_id = $1 AND external_ref = $2
+	`, authorID, ref).Scan(&postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return postID, err
+}
+
+// Upsert writes one imported listing. The listing is found by ref, then by
+// post.ID, and created when neither matches; ref is then recorded against
+// it. Rows identical to the stored listing are left alone so re-importing
+// an export doesn't bump every version. With dryRun everything is rolled
+// back, which still reports what would have happened. It returns the action
+// taken and the change, whose Before is nil for a new listing, and
+// sql.ErrNoRows when post.ID isn't one of the author's listings. screened
+// is stored with a created or changed listing like Insert and
+// UpdateIfVersion do.
+func (i *Imports) Upsert(post Post, ref string, dryRun bool, screened *Screened) (string, *PostChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	if ref != "" {
+		var refPostID int
+		err := tx.QueryRowContext(ctx, `
+			SELECT post_id FROM post_import_refs WHERE author_id = $1 AND external_ref = $2 FOR UPDATE
+		`, post.AuthorID, ref).Scan(&refPostID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return "", nil, err
+		case post.ID != 0 && post.ID != refPostID:
+			return "", nil, ErrRefTaken
+		default:
+			post.ID = refPostID
+		}
+	}
+
+	action := ImportCreate
+	change := &PostChange{}
+	if post.ID == 0 {
+		change.After, err = insertPost(ctx, tx, post, screened)
+		if err != nil {
+			return "", nil, err
+		}
+	} else {
+		old, err := lockPost(ctx, tx, post.ID)
+		if err != nil {
+			return "", nil, err
+		}
+		if old.AuthorID != post.AuthorID {
+			return "", nil, sql.ErrNoRows
+		}
+
+		if err := assignNeighborhood(ctx, tx, &post); err != nil {
+			return "", nil, err
+		}
+
+		change.Before, change.After = old, old
+		action = ImportUnchanged
+		if !sameListing(old, &post) {
+			action = ImportUpdate
+			change.After, err = updatePost(ctx, tx, old, post, screened)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	if ref != "" {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO post_import_refs (post_id, author_id, external_ref) VALUES ($1, $2, $3)
+			ON CONFLICT (post_id) DO UPDATE SET external_ref = EXCLUDED.external_ref
+		`, change.After.ID, post.AuthorID, ref)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	if dryRun {
+		return action, change, nil
+	}
+
+	return action, change, tx.Commit()
+}
+
+// sameListing reports whether an import row matches the stored listing in
+// every field the import format carries. Dates are compared by day.
+func sameListing(old, post *Post) bool {
+	return old.Title == post.Title &&
+		old.Price == post.Price &&
+		old.Location == post.Location &&
+		old.Neighborhood == post.Neighborhood &&
+		old.Lat == post.Lat &&
+		old.Lng == post.Lng &&
+		old.Radius == post.Radius &&
+		old.Type == post.Type &&
+		old.ImageURL == post.ImageURL &&
+		slices.Equal(old.AdditionalImages, post.AdditionalImages) &&
+		old.Description == post.Description &&
+		old.Bedrooms == post.Bedrooms &&
+		old.Bathrooms == post.Bathrooms &&
+		old.AvailableFrom.UTC().Format(dateFormat) == post.AvailableFrom.UTC().Format(dateFormat) &&
+		old.AvailableTo.UTC().Format(dateFormat) == post.AvailableTo.UTC().Format(dateFormat)
+}
@@ -0,0 +1,79 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSameListing(t *testing.T) {
+	stored := func() *Post {
+		return &Post{
+			ID:               7,
+			Title:            "Sunny 2BR",
+			Price:            1500,
+			Location:         "123 Russell Blvd",
+			Neighborhood:     "North Davis",
+			Lat:              38.56,
+			Lng:              -121.74,
+			Radius:           200,
+			Type:             "Apartment",
+			ImageURL:         "https://img.example.com/a.jpg",
+			AdditionalImages: []string{"https://img.example.com/b.jpg"},
+			Description:      "Close to campus",
+			Bedrooms:         2,
+			Bathrooms:        1,
+			AvailableFrom:    time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+			AvailableTo:      time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC),
+			AuthorID:         3,
+			Version:          4,
+		}
+	}
+	pacific := time.FixedZone("PDT", -7*60*60)
+
+	tests := []struct {
+		name string
+		edit func(post *Post)
+		want bool
+	}{
+		{name: "identical", edit: func(post *Post) {}, want: true},
+		{name: "fields the format doesn't carry", edit: func(post *Post) { post.Version = 9; post.Status = "pending" }, want: true},
+		{
+			name: "same day at another time",
+			edit: func(post *Post) { post.AvailableFrom = time.Date(2026, 9, 1, 15, 30, 0, 0, time.UTC) },
+			want: true,
+		},
+		{
+			name: "same instant in another zone",
+			edit: func(post *Post) { post.AvailableTo = time.Date(2027, 6, 29, 17, 0, 0, 0, pacific) },
+			want: true,
+		},
+		{
+			name: "same local day but another UTC day",
+			edit: func(post *Post) { post.AvailableFrom = time.Date(2026, 9, 1, 20, 0, 0, 0, pacific) },
+			want: false,
+		},
+		{name: "nil and empty images", edit: func(post *Post) { post.AdditionalImages = nil }, want: false},
+		{name: "title", edit: func(post *Post) { post.Title = "Sunny 2BR!" }, want: false},
+		{name: "price", edit: func(post *Post) { post.Price = 1499.99 }, want: false},
+		{name: "location", edit: func(post *Post) { post.Location = "" }, want: false},
+		{name: "neighborhood", edit: func(post *Post) { post.Neighborhood = "Downtown" }, want: false},
+		{name: "coordinates", edit: func(post *Post) { post.Lat = 38.57 }, want: false},
+		{name: "radius", edit: func(post *Post) { post.Radius = 0 }, want: false},
+		{name: "type", edit: func(post *Post) { post.Type = "House" }, want: false},
+		{name: "image", edit: func(post *Post) { post.ImageURL = "" }, want: false},
+		{name: "image order", edit: func(post *Post) { post.AdditionalImages = append(post.AdditionalImages, "c.jpg") }, want: false},
+		{name: "description", edit: func(post *Post) { post.Description = "Close to campus." }, want: false},
+		{name: "rooms", edit: func(post *Post) { post.Bathrooms = 2 }, want: false},
+		{name: "end date", edit: func(post *Post) { post.AvailableTo = post.AvailableTo.AddDate(0, 0, 1) }, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := stored()
+			tt.edit(post)
+			if got := sameListing(stored(), post); got != tt.want {
+				t.Errorf("sameListing() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// allValues is the market_stats value of a dimension that isn't broken down
+const allValues = "*"
+
+// MaxBedroomBucket is the bedroom count that also holds larger listings
+const MaxBedroomBucket = 4
+
+// MarketFilter picks one value of each market dimension. Empty fields (nil
+// bedrooms) mean all values.
+type MarketFilter struct {
+	Neighborhood string
+	Bedrooms     *int
+	Type         string
+}
+
+// MarketBucket is the price distribution and inventory of one month and
+// combination of neighborhood, bedrooms and type. A nil dimension covers
+// all values; prices are nil when the bucket is suppressed or empty.
+type MarketBucket struct {
+	Month        string   `json:"month"` // YYYY-MM
+	Neighborhood *string  `json:"neighborhood"`
+	Bedrooms     *int     `json:"bedrooms"` // MaxBedroomBucket means that many or more
+	Type         *string  `json:"type"`
+	Listings     int      `json:"listings"`
+	NewListings  int      `json:"newListings"`
+	P25          *float64 `json:"p25"`
+	Median       *float64 `json:"median"`
+	P75          *float64 `json:"p75"`
+	Suppressed   bool     `json:"suppressed"`
+}
+
+// MarketStats stores the monthly rental market rollup
+type MarketStats struct{}
+
+// Refresh rebuilds the rollup for the months months up to and including
+// the one now falls in. A listing counts in a month when it was on the
+// market at some point in it, at the state and price of its last revision
+// before the month ended, so deleted listings keep counting for the months
+// they were up. Listings with no revisions count as they are now. Listings
+// held for review or taken down by moderators are left out. Buckets with
+// fewer than minListings listings or minLandlords landlords are stored
+// without prices.
+func (m *MarketStats) Refresh(now time.Time, months, minListings, minLandlords int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM market_stats`); err != nil {
+		return 0, err
+	}
+
+	stmt := `
+		WITH months AS (
+			SELECT generate_series(
+				date_trunc('month', $1::timestamp) - make_interval(months => $2::int - 1),
+				date_trunc('month', $1::timestamp),
+				interval '1 month'
+			) AS month_start
+		),
+		states AS (
+			SELECT DISTINCT ON (m.month_start, r.post_id)
+				m.month_start, r.post_id, r.author_id, r.action, r.created_at, r.snapshot
+			FROM months m
+			JOIN post_revisions r ON r.created_at < m.month_start + interval '1 month'
+			ORDER BY m.month_start, r.post_id, r.created_at DESC, r.id DESC
+		),
+		listed AS (
+			SELECT s.month_start, s.author_id,
+				COALESCE(s.snapshot->>'neighborhood', '') AS neighborhood,
+				LEAST(GREATEST(COALESCE((s.snapshot->>'bedrooms')::int, 0), 0), $4::int) AS bedrooms,
+				COALESCE(s.snapshot->>'type', '') AS type,
+				(s.snapshot->>'price')::float8 AS price,
+				f.first_at >= s.month_start AS is_new
+			FROM states s
+			JOIN (
+				SELECT post_id, MIN(created_at) AS first_at FROM post_revisions GROUP BY post_id
+			) f ON f.post_id = s.post_id
+			WHERE NOT (s.action = 'delete' AND s.created_at < s.month_start)
+				AND NOT EXISTS (SELECT 1 FROM posts p WHERE p.id = s.post_id AND p.status = ANY($3))
+			UNION ALL
+			-- Listings older than the revision history count as they are now
+			SELECT m.month_start, p.author_id, p.neighborhood,
+				LEAST(GREATEST(p.bedrooms, 0), $4::int), p.type, p.price::float8,
+				p.created_at >= m.month_start
+			FROM months m
+			JOIN posts p ON p.created_at < m.month_start + interval '1 month'
+			WHERE p.status <> ALL($3)
+				AND NOT EXISTS (SELECT 1 FROM post_revisions r WHERE r.post_id = p.id)
+		)
+		SELECT to_char(month_start, 'YYYY-MM-DD'),
+			CASE WHEN GROUPING(neighborhood) = 1 THEN '*' ELSE neighborhood END,
+			CASE WHEN GROUPING(bedrooms) = 1 THEN -1 ELSE bedrooms END,
+			CASE WHEN GROUPING(type) = 1 THEN '*' ELSE type END,
+			COUNT(*),
+			COUNT(*) FILTER (WHERE is_new),
+			COUNT(DISTINCT author_id),
+			ROUND(percentile_cont(0.25) WITHIN GROUP (ORDER BY price)::numeric, 2)::float8,
+			ROUND(percentile_cont(0.5) WITHIN GROUP (ORDER BY price)::numeric, 2)::float8,
+			ROUND(percentile_cont(0.75) WITHIN GROUP (ORDER BY price)::numeric, 2)::float8
+		FROM listed
+		GROUP BY month_start, CUBE (neighborhood, bedrooms, type)
+	`
+
+	hidden := []string{StatusPendingReview, StatusRejected, StatusHidden, StatusRemoved}
+	rows, err := tx.QueryContext(ctx, stmt, now, months, pq.Array(hidden), MaxBedroomBucket)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var buckets []*marketRow
+	for rows.Next() {
+		var r marketRow
+		err := rows.Scan(&r.month, &r.neighborhood, &r.bedrooms, &r.listingType,
+			&r.listings, &r.newListings, &r.landlords, &r.p25, &r.median, &r.p75)
+		if err != nil {
+			return 0, err
+		}
+		suppressSmallBucket(&r, minListings, minLandlords)
+		buckets = append(buckets, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := insertMarketRows(ctx, tx, buckets, now); err != nil {
+		return 0, err
+	}
+
+	return int64(len(buckets)), tx.Commit()
+}
+
+// marketRow is one bucket of the rollup as Refresh computes and stores it
+type marketRow struct {
+	month        string // YYYY-MM-DD
+	neighborhood string
+	bedrooms     int
+	listingType  string
+	listings     int
+	newListings  int
+	landlords    int
+	p25          sql.NullFloat64
+	median       sql.NullFloat64
+	p75          sql.NullFloat64
+	suppressed   bool
+}
+
+// suppressSmallBucket drops the prices of a bucket with fewer than
+// minListings listings or minLandlords landlords
+func suppressSmallBucket(r *marketRow, minListings, minLandlords int) {
+	if r.listings >= minListings && r.landlords >= minLandlords {
+		return
+	}
+	r.suppressed = true
+	r.p25, r.median, r.p75 = sql.NullFloat64{}, sql.NullFloat64{}, sql.NullFloat64{}
+}
+
+// insertMarketRows stores the rollup's buckets in one statement
+func insertMarketRows(ctx context.Context, tx *sql.Tx, buckets []*marketRow, computedAt time.Time) error {
+	n := len(buckets)
+	monthCol, neighborhoodCol, typeCol := make([]string, n), make([]string, n), make([]string, n)
+	bedroomsCol, listingsCol, newListingsCol := make([]int64, n), make([]int64, n), make([]int64, n)
+	p25Col, medianCol, p75Col := make([]sql.NullFloat64, n), make([]sql.NullFloat64, n), make([]sql.NullFloat64, n)
+	suppressedCol := make([]bool, n)
+	for i, r := range buckets {
+		monthCol[i], neighborhoodCol[i], typeCol[i] = r.month, r.neighborhood, r.listingType
+		bedroomsCol[i], listingsCol[i], newListingsCol[i] = int64(r.bedrooms), int64(r.listings), int64(r.newListings)
+		p25Col[i], medianCol[i], p75Col[i] = r.p25, r.median, r.p75
+		suppressedCol[i] = r.suppressed
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO market_stats (
+			month, neighborhood, bedrooms, type, listings, new_listings,
+			p25, median, p75, suppressed, computed_at
+		)
+		SELECT month::date, neighborhood, bedrooms, type, listings, new_listings,
+			p25, median, p75, suppressed, $11::timestamp
+		FROM unnest($1::text[], $2::text[], $3::int[], $4::text[], $5::int[], $6::int[],
+			$7::numeric[], $8::numeric[], $9::numeric[], $10::bool[])
+			AS b(month, neighborhood, bedrooms, type, listings, new_listings, p25, median, p75, suppressed)
+	`, pq.Array(monthCol), pq.Array(neighborhoodCol), pq.Array(bedroomsCol), pq.Array(typeCol),
+		pq.Array(listingsCol), pq.Array(newListingsCol), pq.Array(p25Col), pq.Array(medianCol),
+		pq.Array(p75Col), pq.Array(suppressedCol), computedAt)
+	return err
+}
+
+// LastRefresh returns the latest month in the rollup (YYYY-MM) and when it
+// was computed. ok is false before the first refresh.
+func (m *MarketStats) LastRefresh() (month string, computedAt time.Time, ok bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var latest sql.NullString
+	var at sql.NullTime
+	err = db.QueryRowContext(ctx, `
+		SELECT to_char(MAX(month), 'YYYY-MM'), MAX(computed_at) FROM market_stats
+	`).Scan(&latest, &at)
+	if err != nil || !latest.Valid {
+		return "", time.Time{}, false, err
+	}
+
+	return latest.String, at.Time, true, nil
+}
+
+// Buckets returns the buckets of a month (YYYY-MM). Dimensions named in
+// groupBy ("neighborhood", "bedrooms", "type") are broken down into one
+// bucket per value; the others are narrowed to filter's value or cover all
+// values.
+func (m *MarketStats) Buckets(month string, filter MarketFilter, groupBy map[string]bool) ([]*MarketBucket, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	where, args := marketConditions(filter, groupBy)
+	args = append(args, month+"-01")
+	where = append(where, fmt.Sprintf("month = $%d::date", len(args)))
+
+	return queryMarketBuckets(ctx, `
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY neighborhood, bedrooms, type
+	`, args...)
+}
+
+// Series returns the filtered bucket of each month from since (YYYY-MM) on,
+// oldest first. Months without any listings in the bucket are left out.
+func (m *MarketStats) Series(filter MarketFilter, since string) ([]*MarketBucket, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	where, args := marketConditions(filter, nil)
+	args = append(args, since+"-01")
+	where = append(where, fmt.Sprintf("month >= $%d::date", len(args)))
+
+	return queryMarketBuckets(ctx, `
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY month
+	`, args...)
+}
+
+// marketConditions turns a filter into WHERE conditions on market_stats
+func marketConditions(filter MarketFilter, groupBy map[string]bool) ([]string, []any) {
+	var where []string
+	var args []any
+
+	text := func(column, value string) {
+		switch {
+		case groupBy[column]:
+			where = append(where, column+" <> '"+allValues+"'")
+		case value != "":
+			args = append(args, value)
+			where = append(where, fmt.Sprintf("%s = $%d", column, len(args)))
+		default:
+			where = append(where, column+" = '"+allValues+"'")
+		}
+	}
+
+	text("neighborhood", filter.Neighborhood)
+	switch {
+	case groupBy["bedrooms"]:
+		where = append(where, "bedrooms >= 0")
+	case filter.Bedrooms != nil:
+		args = append(args, min(*filter.Bedrooms, MaxBedroomBucket))
+		where = append(where, fmt.Sprintf("bedrooms = $%d::int", len(args)))
+	default:
+		where = append(where, "bedrooms = -1")
+	}
+	text("type", filter.Type)
+
+	return where, args
+}
+
+// queryMarketBuckets selects market_stats rows with the given WHERE and
+// ORDER BY clauses
+func queryMarketBuckets(ctx context.Context, clauses string, args ...any) ([]*MarketBucket, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT to_char(month, 'YYYY-MM'), neighborhood, bedrooms, type, listings, new_listings,
+			p25::float8, median::float8, p75::float8, suppressed
+		FROM market_stats
+	`+clauses, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []*MarketBucket{}
+	for rows.Next() {
+		var b MarketBucket
+		var neighborhood, listingType string
+		var bedrooms int
+		var p25, median, p75 sql.NullFloat64
+		err := rows.Scan(&b.Month, &neighborhood, &bedrooms, &listingType, &b.Listings, &b.NewListings,
+			&p25, &median, &p75, &b.Suppressed)
+		if err != nil {
+			return nil, err
+		}
+
+		if neighborhood != allValues {
+			b.Neighborhood = &neighborhood
+		}
+		if bedrooms >= 0 {
+			b.Bedrooms = &bedrooms
+		}
+		if listingType != allValues {
+			b.Type = &listingType
+		}
+		if p25.Valid {
+			b.P25, b.Median, b.P75 = &p25.Float64, &median.Float64, &p75.Float64
+		}
+		buckets = append(buckets, &b)
+	}
+
+	return buckets, rows.Err()
+}
@@ -0,0 +1,50 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSuppressSmallBucket(t *testing.T) {
+	const minListings, minLandlords = 5, 3
+	price := func(f float64) sql.NullFloat64 { return sql.NullFloat64{Float64: f, Valid: true} }
+
+	tests := []struct {
+		name      string
+		listings  int
+		landlords int
+		want      bool
+	}{
+		{name: "at both thresholds", listings: 5, landlords: 3, want: false},
+		{name: "well above both", listings: 40, landlords: 12, want: false},
+		{name: "one listing short", listings: 4, landlords: 3, want: true},
+		{name: "one landlord short", listings: 5, landlords: 2, want: true},
+		{name: "one landlord with many listings", listings: 30, landlords: 1, want: true},
+		{name: "many landlords with one listing each, too few listings", listings: 4, landlords: 4, want: true},
+		{name: "single listing", listings: 1, landlords: 1, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &marketRow{
+				listings: tt.listings, newListings: 1, landlords: tt.landlords,
+				p25: price(1200), median: price(1450), p75: price(1700),
+			}
+			suppressSmallBucket(r, minListings, minLandlords)
+
+			if r.suppressed != tt.want {
+				t.Errorf("suppressed = %v, want %v", r.suppressed, tt.want)
+			}
+			hasPrices := r.p25.Valid || r.median.Valid || r.p75.Valid
+			if hasPrices == tt.want {
+				t.Errorf("prices = %v, %v, %v, want them dropped only when suppressed", r.p25, r.median, r.p75)
+			}
+			if !tt.want && (r.p25.Float64 != 1200 || r.median.Float64 != 1450 || r.p75.Float64 != 1700) {
+				t.Errorf("prices changed to %v, %v, %v", r.p25.Float64, r.median.Float64, r.p75.Float64)
+			}
+			if r.listings != tt.listings || r.newListings != 1 {
+				t.Errorf("counts changed to %d, %d", r.listings, r.newListings)
+			}
+		})
+	}
+}
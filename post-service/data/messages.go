@@ -0,0 +1,587 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"post-service/event"
+	"time"
+)
+
+// PresenceWindow is how long after their last messaging request a user
+// counts as online. Online recipients are not mailed about new messages.
+const PresenceWindow = 2 * time.Minute
+
+// Reasons a user can pick when reporting a conversation participant
+var UserReportReasons = map[string]bool{
+	"spam":       true,
+	"scam":       true,
+	"harassment": true,
+	"offensive":  true,
+	"other":      true,
+}
+
+// ErrBlocked is returned when either participant blocked the other
+var ErrBlocked = errors.New("you can't message this user")
+
+// ErrDuplicateUserReport is returned when a user reports a conversation they
+// already have an open report on
+var ErrDuplicateUserReport = errors.New("you have already reported this conversation")
+
+// Participant is the public side of a conversation member; it never
+// includes contact details
+type Participant struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"` // renter, landlord or roommate
+}
+
+// Conversation kinds
+const (
+	ConversationListing  = "listing"
+	ConversationRoommate = "roommate"
+)
+
+// Conversation is a renter's thread with a listing's author, or between two
+// renters from the roommate finder, as seen by one of them. Roommate
+// conversations have no listing; PostID is 0.
+type Conversation struct {
+	ID            int         `json:"id"`
+	Kind          string      `json:"kind"`
+	PostID        int         `json:"postId"`
+	PostTitle     string      `json:"postTitle"`
+	PostImageURL  string      `json:"postImageUrl"`
+	RenterID      int         `json:"renterId"`
+	LandlordID    int         `json:"landlordId"`
+	With          Participant `json:"with"`
+	LastMessage   *Message    `json:"lastMessage,omitempty"`
+	Unread        int         `json:"unread"`
+	Blocked       bool        `json:"blocked"` // the viewer blocked the other participant
+	CreatedAt     time.Time   `json:"createdAt"`
+	LastMessageAt time.Time   `json:"lastMessageAt"`
+}
+
+// IsParticipant reports whether the user is the renter or the landlord
+func (c *Conversation) IsParticipant(userID int) bool {
+	return c.RenterID == userID || c.LandlordID == userID
+}
+
+// OtherParticipant returns the ID of the participant who isn't userID
+func (c *Conversation) OtherParticipant(userID int) int {
+	if c.RenterID == userID {
+		return c.LandlordID
+	}
+	return c.RenterID
+}
+
+// Message is one message in a conversation. ReadAt is the read receipt.
+type Message struct {
+	ID             int64      `json:"id"`
+	ConversationID int        `json:"conversationId"`
+	SenderID       int        `json:"senderId"`
+	Body           string     `json:"body"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ReadAt         *time.Time `json:"readAt,omitempty"`
+}
+
+// UserReport is a complaint about a conversation participant
+type UserReport struct {
+	ID             int        `json:"id"`
+	ConversationID int        `json:"conversationId"`
+	MessageID      *int64     `json:"messageId,omitempty"`
+	ReporterID     int        `json:"reporterId"`
+	ReportedID     int        `json:"reportedId"`
+	Reason         string     `json:"reason"`
+	Details        string     `json:"details,omitempty"`
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ResolvedBy     *int       `json:"resolvedBy,omitempty"`
+	ResolvedAt     *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// Messaging stores conversations, messages, blocks and user reports
+type Messaging struct{}
+
+// conversationSelect reads a conversation from the point of view of the
+// user in $1. Keep it in sync with scanConversation.
+const conversationSelect = `
+	SELECT c.id, COALESCE(c.post_id, 0), COALESCE(p.title, ''), COALESCE(p.image_url, ''), c.renter_id, c.landlord_id,
+		c.created_at, c.last_message_at, o.id, o.first_name, o.last_name,
+		(SELECT COUNT(*) FROM messages m
+			WHERE m.conversation_id = c.id AND m.sender_id <> $1 AND m.read_at IS NULL),
+		EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = $1 AND b.blocked_id = o.id),
+		lm.id, lm.sender_id, lm.body, lm.created_at, lm.read_at
+	FROM conversations c
+	LEFT JOIN posts p ON p.id = c.post_id
+	JOIN users o ON o.id = CASE WHEN c.renter_id = $1 THEN c.landlord_id ELSE c.renter_id END
+	LEFT JOIN LATERAL (
+		SELECT id, sender_id, body, created_at, read_at FROM messages
+		WHERE conversation_id = c.id ORDER BY id DESC LIMIT 1
+	) lm ON true`
+
+func scanConversation(row rowScanner) (*Conversation, error) {
+	var c Conversation
+	var firstName, lastName string
+	var lastID, lastSender sql.NullInt64
+	var lastBody sql.NullString
+	var lastAt, lastReadAt sql.NullTime
+
+	err := row.Scan(&c.ID, &c.PostID, &c.PostTitle, &c.PostImageURL, &c.RenterID, &c.LandlordID,
+		&c.CreatedAt, &c.LastMessageAt, &c.With.ID, &firstName, &lastName,
+		&c.Unread, &c.Blocked,
+		&lastID, &lastSender, &lastBody, &lastAt, &lastReadAt)
+	if err != nil {
+		return nil, err
+	}
+
+	c.With.Name = firstName + " " + lastName
+	c.Kind = ConversationListing
+	c.With.Role = "renter"
+	switch {
+	case c.PostID == 0:
+		c.Kind = ConversationRoommate
+		c.With.Role = "roommate"
+	case c.With.ID == c.LandlordID:
+		c.With.Role = "landlord"
+	}
+
+	if lastID.Valid {
+		c.LastMessage = &Message{
+			ID:             lastID.Int64,
+			ConversationID: c.ID,
+			SenderID:       int(lastSender.Int64),
+			Body:           lastBody.String,
+			CreatedAt:      lastAt.Time,
+		}
+		if lastReadAt.Valid {
+			c.LastMessage.ReadAt = &lastReadAt.Time
+		}
+	}
+
+	return &c, nil
+}
+
+// Start returns the renter's conversation about a post, creating it when
+// there is none yet. created reports whether it is new.
+func (m *Messaging) Start(postID, renterID, landlordID int) (id int, created bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// The no-op update makes RETURNING work for existing rows too
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO conversations (post_id, renter_id, landlord_id, created_at, last_message_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (post_id, renter_id) DO UPDATE SET post_id = EXCLUDED.post_id
+		RETURNING id, xmax = 0
+	`, postID, renterID, landlordID, time.Now()).Scan(&id, &created)
+
+	return id, created, err
+}
+
+// StartRoommate returns the roommate conversation between two users,
+// whoever started it, creating it when there is none yet. created reports
+// whether it is new.
+func (m *Messaging) StartRoommate(userID, otherID int) (id int, created bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO conversations (post_id, renter_id, landlord_id, created_at, last_message_at)
+		VALUES (NULL, $1, $2, $3, $3)
+		ON CONFLICT (LEAST(renter_id, landlord_id), GREATEST(renter_id, landlord_id)) WHERE post_id IS NULL
+		DO UPDATE SET post_id = NULL
+		RETURNING id, xmax = 0
+	`, userID, otherID, time.Now()).Scan(&id, &created)
+
+	return id, created, err
+}
+
+// Get returns a conversation as seen by viewerID, or sql.ErrNoRows when it
+// doesn't exist or the viewer isn't part of it
+func (m *Messaging) Get(id, viewerID int) (*Conversation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := conversationSelect + `
+		WHERE c.id = $2 AND (c.renter_id = $1 OR c.landlord_id = $1)`
+
+	return scanConversation(db.QueryRowContext(ctx, query, viewerID, id))
+}
+
+// GetByID returns a conversation without a viewer, for moderators
+func (m *Messaging) GetByID(id int) (*Conversation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var renterID int
+	err := db.QueryRowContext(ctx, `SELECT renter_id FROM conversations WHERE id = $1`, id).Scan(&renterID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanConversation(db.QueryRowContext(ctx, conversationSelect+` WHERE c.id = $2`, renterID, id))
+}
+
+// List returns the user's conversations, most recently active first
+func (m *Messaging) List(userID, limit, offset int) ([]*Conversation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := conversationSelect + `
+		WHERE c.renter_id = $1 OR c.landlord_id = $1
+		ORDER BY c.last_message_at DESC, c.id DESC
+		LIMIT $2 OFFSET $3`
+
+	rows, err := db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []*Conversation{}
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+
+	return conversations, rows.Err()
+}
+
+// Messages returns a conversation's messages, newest first. beforeID, when
+// not zero, continues from the last page.
+func (m *Messaging) Messages(conversationID int, beforeID int64, limit int) ([]*Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, conversation_id, sender_id, body, created_at, read_at
+		FROM messages
+		WHERE conversation_id = $1 AND ($2::bigint = 0 OR id < $2::bigint)
+		ORDER BY id DESC
+		LIMIT $3
+	`, conversationID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []*Message{}
+	for rows.Next() {
+		var msg Message
+		var readAt sql.NullTime
+		err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.Body, &msg.CreatedAt, &readAt)
+		if err != nil {
+			return nil, err
+		}
+		if readAt.Valid {
+			msg.ReadAt = &readAt.Time
+		}
+		messages = append(messages, &msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// Send stores a message and, when it is the first one the recipient hasn't
+// read yet, queues notice in the same transaction. The notice gets the
+// recipient's email only when they haven't used messaging within
+// PresenceWindow, so online users are told in the app only.
+func (m *Messaging) Send(conversationID, senderID, recipientID int, body string, notice event.NotificationEvent) (*Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blocked, err := isBlocked(ctx, tx, senderID, recipientID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrBlocked
+	}
+
+	now := time.Now()
+	msg := Message{ConversationID: conversationID, SenderID: senderID, Body: body, CreatedAt: now}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO messages (conversation_id, sender_id, body, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, conversationID, senderID, body, now).Scan(&msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE conversations SET last_message_at = $1 WHERE id = $2`, now, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var unread int
+	var online bool
+	var email string
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM messages
+				WHERE conversation_id = $1 AND sender_id = $2 AND read_at IS NULL),
+			EXISTS (SELECT 1 FROM messaging_presence WHERE user_id = $3 AND last_seen_at > $4),
+			(SELECT email FROM users WHERE id = $3)
+	`, conversationID, senderID, recipientID, now.Add(-PresenceWindow)).Scan(&unread, &online, &email)
+	if err != nil {
+		return nil, err
+	}
+
+	if unread == 1 {
+		notice.UserID = recipientID
+		notice.Email = ""
+		if !online {
+			notice.Email = email
+		}
+		if err := enqueueEvent(ctx, tx, event.RoutingNotification, notice); err != nil {
+			return nil, err
+		}
+	}
+
+	return &msg, tx.Commit()
+}
+
+// MarkRead sets the read receipt on every message the reader received in a
+// conversation and returns how many there were
+func (m *Messaging) MarkRead(conversationID, readerID int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE messages SET read_at = $1
+		WHERE conversation_id = $2 AND sender_id <> $3 AND read_at IS NULL
+	`, time.Now(), conversationID, readerID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// UnreadCount returns how many unread messages the user has and in how many
+// conversations
+func (m *Messaging) UnreadCount(userID int) (messages, conversations int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	err = db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT m.conversation_id)
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE (c.renter_id = $1 OR c.landlord_id = $1) AND m.sender_id <> $1 AND m.read_at IS NULL
+	`, userID).Scan(&messages, &conversations)
+
+	return messages, conversations, err
+}
+
+// Touch records that the user is using messaging right now
+func (m *Messaging) Touch(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO messaging_presence (user_id, last_seen_at) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at
+	`, userID, time.Now())
+
+	return err
+}
+
+// Block stops the blocked user from messaging the blocker, and the other
+// way round
+func (m *Messaging) Block(blockerID, blockedID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO user_blocks (blocker_id, blocked_id, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, blockerID, blockedID, time.Now())
+
+	return err
+}
+
+// Unblock removes a block
+func (m *Messaging) Unblock(blockerID, blockedID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`, blockerID, blockedID)
+	return err
+}
+
+// IsBlocked reports whether either user blocked the other
+func (m *Messaging) IsBlocked(a, b int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return isBlocked(ctx, db, a, b)
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func isBlocked(ctx context.Context, q queryRower, a, b int) (bool, error) {
+	var blocked bool
+	err := q.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`, a, b).Scan(&blocked)
+
+	return blocked, err
+}
+
+// userReportColumns is the column list read by scanUserReport
+const userReportColumns = `id, conversation_id, message_id, reporter_id, reported_id, reason, details,
+	status, created_at, resolved_by, resolved_at`
+
+// CreateReport files a report on a conversation participant and returns its
+// ID. A message ID that isn't the reported user's message in the
+// conversation is dropped.
+func (m *Messaging) CreateReport(report UserReport) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var id int
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO user_reports (conversation_id, message_id, reporter_id, reported_id, reason, details, status, created_at)
+		VALUES ($1,
+			(SELECT id FROM messages WHERE id = $2 AND conversation_id = $1 AND sender_id = $4),
+			$3, $4, $5, $6, $7, $8)
+		ON CONFLICT (conversation_id, reporter_id) WHERE status = 'open' DO NOTHING
+		RETURNING id
+	`, report.ConversationID, report.MessageID, report.ReporterID, report.ReportedID,
+		report.Reason, report.Details, ReportOpen, time.Now()).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrDuplicateUserReport
+	}
+
+	return id, err
+}
+
+// GetReports returns user reports with the given status, oldest first
+func (m *Messaging) GetReports(status string) ([]*UserReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+userReportColumns+` FROM user_reports
+		WHERE status = $1
+		ORDER BY created_at, id
+	`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []*UserReport
+	for rows.Next() {
+		report, err := scanUserReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// GetReport returns a single user report
+func (m *Messaging) GetReport(id int) (*UserReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return scanUserReport(db.QueryRowContext(ctx,
+		`SELECT `+userReportColumns+` FROM user_reports WHERE id = $1`, id))
+}
+
+// ResolveReport closes a user report with a dismiss, warn or suspend
+// decision and records it in the moderation log under the conversation's
+// listing, if it has one. Suspend deactivates the reported user.
+func (m *Messaging) ResolveReport(report *UserReport, postID int, action, note string, moderatorID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	if action == ActionSuspend {
+		_, err = tx.ExecContext(ctx, `UPDATE users SET user_active = 0, updated_at = $1 WHERE id = $2`, now, report.ReportedID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO moderation_decisions (post_id, user_id, action, note, moderator_id, created_at)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6)
+		RETURNING id
+	`, postID, report.ReportedID, action, note, moderatorID, now).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	status := ReportResolved
+	if action == ActionDismiss {
+		status = ReportDismissed
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_reports SET status = $1, resolved_by = $2, resolved_at = $3
+		WHERE id = $4
+	`, status, moderatorID, now, report.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// scanUserReport reads one row selected with userReportColumns
+func scanUserReport(row rowScanner) (*UserReport, error) {
+	var report UserReport
+	var messageID, resolvedBy sql.NullInt64
+	var details sql.NullString
+	var resolvedAt sql.NullTime
+
+	err := row.Scan(&report.ID, &report.ConversationID, &messageID, &report.ReporterID, &report.ReportedID,
+		&report.Reason, &details, &report.Status, &report.CreatedAt, &resolvedBy, &resolvedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Details = details.String
+	if messageID.Valid {
+		report.MessageID = &messageID.Int64
+	}
+	if resolvedBy.Valid {
+		id := int(resolvedBy.Int64)
+		report.ResolvedBy = &id
+	}
+	if resolvedAt.Valid {
+		report.ResolvedAt = &resolvedAt.Time
+	}
+
+	return &report, nil
+}
@@ -3,7 +3,9 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"log"
+	"slices"
 	"time"
 
 	"github.com/lib/pq"
@@ -11,17 +13,89 @@ import (
 
 const dbTimeout = time.Second * 3
 
+// ErrVersionConflict is returned by conditional writes when the stored post
+// no longer has the version the caller based its change on
+var ErrVersionConflict = errors.New("post was modified by another request")
+
+// ErrStatusTransition is returned when an author tries to move their
+// listing to a status they can't set from its current one
+var ErrStatusTransition = errors.New("the listing can't be moved to that status")
+
+// Post statuses. Only published posts are listed publicly; rented ones, and
+// pending ones whose author accepted an application, can still be opened by
+// anyone, e.g. from a favorites list.
+const (
+	StatusPublished     = "published"
+	StatusPending       = "pending"
+	StatusRented        = "rented"
+	StatusPendingReview = "pending_review"
+	StatusRejected      = "rejected"
+	StatusHidden        = "hidden"
+	StatusRemoved       = "removed"
+)
+
+// IsPublicStatus reports whether anyone may open a post with the status
+func IsPublicStatus(status string) bool {
+	return status == StatusPublished || status == StatusPending || status == StatusRented
+}
+
+// ownerStatusTransitions lists where an author can move their own listing.
+// The other statuses belong to review and moderation.
+var ownerStatusTransitions = map[string][]string{
+	StatusPublished: {StatusRented},
+	StatusPending:   {StatusRented},
+	StatusRented:    {StatusPublished},
+}
+
+// CanOwnerSetStatus reports whether an author can move their listing from
+// one status to another
+func CanOwnerSetStatus(from, to string) bool {
+	return slices.Contains(ownerStatusTransitions[from], to)
+}
+
 var db *sql.DB
 
 func New(dbPool *sql.DB) Models {
 	db = dbPool
 	return Models{
-		Post: Post{},
+		Post:         Post{},
+		Revision:     Revision{},
+		PriceHistory: PriceHistory{},
+		Analytics:    Analytics{},
+		Screening:    Screening{},
+		Moderation:   Moderation{},
+		Outbox:       Outbox{},
+		SavedSearch:  SavedSearches{},
+		Messaging:    Messaging{},
+		Viewing:      Viewings{},
+		Application:  Applications{},
+		Review:       Reviews{},
+		Roommate:     Roommates{},
+		Availability: Availability{},
+		Import:       Imports{},
+		Neighborhood: Neighborhoods{},
+		Market:       MarketStats{},
 	}
 }
 
 type Models struct {
-	Post Post
+	Post         Post
+	Revision     Revision
+	PriceHistory PriceHistory
+	Analytics    Analytics
+	Screening    Screening
+	Moderation   Moderation
+	Outbox       Outbox
+	SavedSearch  SavedSearches
+	Messaging    Messaging
+	Viewing      Viewings
+	Application  Applications
+	Review       Reviews
+	Roommate     Roommates
+	Availability Availability
+	Import       Imports
+	Neighborhood Neighborhoods
+	Market       MarketStats
 }
 
 // Post represents a rental listing
@@ -45,6 +119,14 @@ type Post struct {
 	AuthorID         int       `json:"authorId"`
 	CreatedAt        time.Time `json:"createdAt"`
 	UpdatedAt        time.Time `json:"updatedAt"`
+	Version          int       `json:"version"`
+	Status           string    `json:"status"`
+}
+
+// PostChange is the state of a post before and after a write
+type PostChange struct {
+	Before *Post
+	After  *Post
 }
 
 // PostWithAuthor includes author information for API responses
@@ -55,100 +137,47 @@ type PostWithAuthor struct {
 
 // Author represents the post author's public info
 type Author struct {
-	Name   string `json:"name"`
-	Avatar string `json:"avatar,omitempty"`
+	Name        string  `json:"name"`
+	Avatar      string  `json:"avatar,omitempty"`
+	Rating      float64 `json:"rating"` // average of published reviews, 0 when there are none
+	ReviewCount int     `json:"reviewCount"`
 }
 
-// GetAll returns all posts with author info, ordered by creation date
-func (p *Post) GetAll() ([]*PostWithAuthor, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	query := `
-		SELECT
-			p.id, p.title, p.price, COALESCE(p.location, ''), p.neighborhood,
-			p.lat, p.lng, p.radius, p.type, COALESCE(p.image_url, ''),
-			COALESCE(p.additional_images, '{}'), COALESCE(p.description, ''),
-			p.bedrooms, p.bathrooms, p.available_from, p.available_to,
-			p.author_id, p.created_at, p.updated_at,
-			u.first_name, u.last_name
-		FROM posts p
-		JOIN users u ON p.author_id = u.id
-		ORDER BY p.created_at DESC
-	`
-
-	rows, err := db.QueryContext(ctx, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var posts []*PostWithAuthor
-
-	for rows.Next() {
-		var post PostWithAuthor
-		var firstName, lastName string
-
-		err := rows.Scan(
-			&post.ID,
-			&post.Title,
-			&post.Price,
-			&post.Location,
-			&post.Neighborhood,
-			&post.Lat,
-			&post.Lng,
-			&post.Radius,
-			&post.Type,
-			&post.ImageURL,
-			pq.Array(&post.AdditionalImages),
-			&post.Description,
-			&post.Bedrooms,
-			&post.Bathrooms,
-			&post.AvailableFrom,
-			&post.AvailableTo,
-			&post.AuthorID,
-			&post.CreatedAt,
-			&post.UpdatedAt,
-			&firstName,
-			&lastName,
-		)
-		if err != nil {
-			log.Println("Error scanning post:", err)
-			return nil, err
-		}
-
-		post.Author = Author{
-			Name: firstName + " " + lastName,
-		}
-
-		posts = append(posts, &post)
-	}
-
-	return posts, nil
+// postColumns is the column list shared by every query that returns a
+// PostWithAuthor, selected from posts p joined with postAuthorJoins. Keep it
+// in sync with scanPost.
+const postColumns = `
+	p.id, p.title, p.price, COALESCE(p.location, ''), p.neighborhood,
+	p.lat, p.lng, p.radius, p.type, COALESCE(p.image_url, ''),
+	COALESCE(p.additional_images, '{}'), COALESCE(p.description, ''),
+	p.bedrooms, p.bathrooms, p.available_from, p.available_to,
+	p.author_id, p.created_at, p.updated_at, p.version, p.status,
+	u.first_name, u.last_name,
+	COALESCE(ar.rating, 0), COALESCE(ar.review_count, 0)`
+
+// postAuthorJoins joins a post's author and their review aggregate. The
+// aggregate is computed once per landlord rather than once per row.
+const postAuthorJoins = `
+	JOIN users u ON p.author_id = u.id
+	LEFT JOIN (
+		SELECT landlord_id, ROUND(AVG(rating), 1)::float8 AS rating, COUNT(*) AS review_count
+		FROM reviews
+		WHERE status = 'published'
+		GROUP BY landlord_id
+	) ar ON ar.landlord_id = p.author_id`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-// GetByID returns a single post by ID with author info
-func (p *Post) GetByID(id int) (*PostWithAuthor, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	query := `
-		SELECT
-			p.id, p.title, p.price, COALESCE(p.location, ''), p.neighborhood,
-			p.lat, p.lng, p.radius, p.type, COALESCE(p.image_url, ''),
-			COALESCE(p.additional_images, '{}'), COALESCE(p.description, ''),
-			p.bedrooms, p.bathrooms, p.available_from, p.available_to,
-			p.author_id, p.created_at, p.updated_at,
-			u.first_name, u.last_name
-		FROM posts p
-		JOIN users u ON p.author_id = u.id
-		WHERE p.id = $1
-	`
-
+// scanPost reads one row selected with postColumns
+func scanPost(row rowScanner) (*PostWithAuthor, error) {
 	var post PostWithAuthor
 	var firstName, lastName string
+	var rating float64
+	var reviewCount int
 
-	row := db.QueryRowContext(ctx, query, id)
 	err := row.Scan(
 		&post.ID,
 		&post.Title,
@@ -169,41 +198,29 @@ func (p *Post) GetByID(id int) (*PostWithAuthor, error) {
 		&post.AuthorID,
 		&post.CreatedAt,
 		&post.UpdatedAt,
+		&post.Version,
+		&post.Status,
 		&firstName,
 		&lastName,
+		&rating,
+		&reviewCount,
 	)
-
 	if err != nil {
 		return nil, err
 	}
 
 	post.Author = Author{
-		Name: firstName + " " + lastName,
+		Name:        firstName + " " + lastName,
+		Rating:      rating,
+		ReviewCount: reviewCount,
 	}
 
 	return &post, nil
 }
 
-// GetByAuthorID returns all posts by a specific author
-func (p *Post) GetByAuthorID(authorID int) ([]*PostWithAuthor, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	query := `
-		SELECT
-			p.id, p.title, p.price, COALESCE(p.location, ''), p.neighborhood,
-			p.lat, p.lng, p.radius, p.type, COALESCE(p.image_url, ''),
-			COALESCE(p.additional_images, '{}'), COALESCE(p.description, ''),
-			p.bedrooms, p.bathrooms, p.available_from, p.available_to,
-			p.author_id, p.created_at, p.updated_at,
-			u.first_name, u.last_name
-		FROM posts p
-		JOIN users u ON p.author_id = u.id
-		WHERE p.author_id = $1
-		ORDER BY p.created_at DESC
-	`
-
-	rows, err := db.QueryContext(ctx, query, authorID)
+// queryPosts runs a query selecting postColumns and scans every row
+func queryPosts(ctx context.Context, query string, args ...any) ([]*PostWithAuthor, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -212,63 +229,121 @@ func (p *Post) GetByAuthorID(authorID int) ([]*PostWithAuthor, error) {
 	var posts []*PostWithAuthor
 
 	for rows.Next() {
-		var post PostWithAuthor
-		var firstName, lastName string
-
-		err := rows.Scan(
-			&post.ID,
-			&post.Title,
-			&post.Price,
-			&post.Location,
-			&post.Neighborhood,
-			&post.Lat,
-			&post.Lng,
-			&post.Radius,
-			&post.Type,
-			&post.ImageURL,
-			pq.Array(&post.AdditionalImages),
-			&post.Description,
-			&post.Bedrooms,
-			&post.Bathrooms,
-			&post.AvailableFrom,
-			&post.AvailableTo,
-			&post.AuthorID,
-			&post.CreatedAt,
-			&post.UpdatedAt,
-			&firstName,
-			&lastName,
-		)
+		post, err := scanPost(rows)
 		if err != nil {
 			log.Println("Error scanning post:", err)
 			return nil, err
 		}
+		posts = append(posts, post)
+	}
 
-		post.Author = Author{
-			Name: firstName + " " + lastName,
-		}
+	return posts, rows.Err()
+}
 
-		posts = append(posts, &post)
-	}
+// GetAll returns the published posts of active authors with author info,
+// ordered by creation date
+func (p *Post) GetAll() ([]*PostWithAuthor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + postColumns + `
+		FROM posts p ` + postAuthorJoins + `
+		WHERE p.status = 'published' AND u.user_active = 1
+		ORDER BY p.created_at DESC
+	`
 
-	return posts, nil
+	return queryPosts(ctx, query)
 }
 
-// Insert creates a new post and returns its ID
-func (p *Post) Insert(post Post) (int, error) {
+// GetByIDs returns the posts with the given IDs, in no particular order.
+// IDs that don't exist are skipped.
+func (p *Post) GetByIDs(ids []int) ([]*PostWithAuthor, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
+	query := `
+		SELECT ` + postColumns + `
+		FROM posts p ` + postAuthorJoins + `
+		WHERE p.id = ANY($1)
+	`
+
+	return queryPosts(ctx, query, pq.Array(ids))
+}
+
+// GetByID returns a single post by ID with author info
+func (p *Post) GetByID(id int) (*PostWithAuthor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + postColumns + `
+		FROM posts p ` + postAuthorJoins + `
+		WHERE p.id = $1
+	`
+
+	return scanPost(db.QueryRowContext(ctx, query, id))
+}
+
+// GetByAuthorID returns all posts by a specific author
+func (p *Post) GetByAuthorID(authorID int) ([]*PostWithAuthor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + postColumns + `
+		FROM posts p ` + postAuthorJoins + `
+		WHERE p.author_id = $1
+		ORDER BY p.created_at DESC
+	`
+
+	return queryPosts(ctx, query, authorID)
+}
+
+// Insert creates a new post and returns its ID. The author is recorded as
+// the actor of the "create" revision. screened, when given, is stored with
+// the post and holds it for review if it was flagged.
+func (p *Post) Insert(post Post, screened *Screened) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	created, err := insertPost(ctx, tx, post, screened)
+	if err != nil {
+		return 0, err
+	}
+
+	return created.ID, tx.Commit()
+}
+
+// insertPost creates a post inside the caller's transaction along with its
+// availability period, screening, revision, price history and events
+func insertPost(ctx context.Context, tx *sql.Tx, post Post, screened *Screened) (*Post, error) {
+	if err := assignNeighborhood(ctx, tx, &post); err != nil {
+		return nil, err
+	}
+
 	stmt := `
 		INSERT INTO posts (
 			title, price, location, neighborhood, lat, lng, radius, type,
 			image_url, additional_images, description, bedrooms, bathrooms,
-			available_from, available_to, author_id, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+			available_from, available_to, author_id, created_at, updated_at, status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
 		RETURNING id
 	`
 
+	status := post.Status
+	if status == "" {
+		status = StatusPublished
+	}
+
 	var newID int
-	err := db.QueryRowContext(ctx, stmt,
+	err := tx.QueryRowContext(ctx, stmt,
 		post.Title,
 		post.Price,
 		post.Location,
@@ -287,20 +362,270 @@ func (p *Post) Insert(post Post) (int, error) {
 		post.AuthorID,
 		time.Now(),
 		time.Now(),
+		status,
 	).Scan(&newID)
 
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	created, err := lockPost(ctx, tx, newID)
+	if err != nil {
+		return nil, err
 	}
 
-	return newID, nil
+	if err := syncSinglePeriod(ctx, tx, created); err != nil {
+		return nil, err
+	}
+
+	if err := applyScreening(ctx, tx, created, screened); err != nil {
+		return nil, err
+	}
+
+	err = recordRevision(ctx, tx, RevisionCreate, nil, created, post.AuthorID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordPriceChange(ctx, tx, nil, created)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordPostEvents(ctx, tx, nil, created)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
 }
 
 // Update updates an existing post
-func (p *Post) Update(post Post) error {
+func (p *Post) Update(post Post) (*PostChange, error) {
+	return p.UpdateIfVersion(post, 0, nil)
+}
+
+// UpdateIfVersion updates an existing post only if its stored version still
+// equals expectedVersion. An expectedVersion of 0 skips the check. It returns
+// ErrVersionConflict when the post exists but has moved on, and
+// sql.ErrNoRows when it doesn't exist or belongs to someone else. screened,
+// when given, is stored with the edit and holds the post for review if it
+// was flagged. post.AuthorID must be the signed-in caller; it is recorded as
+// the revision's actor.
+func (p *Post) UpdateIfVersion(post Post, expectedVersion int, screened *Screened) (*PostChange, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	old, err := lockPost(ctx, tx, post.ID)
+	if err != nil {
+		return nil, err
+	}
+	if old.AuthorID != post.AuthorID {
+		return nil, sql.ErrNoRows
+	}
+	if expectedVersion != 0 && old.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	updated, err := updatePost(ctx, tx, old, post, screened)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostChange{Before: old, After: updated}, tx.Commit()
+}
+
+// updatePost overwrites a locked post inside the caller's transaction and
+// records the screening, revision, price change and events of the edit
+func updatePost(ctx context.Context, tx *sql.Tx, old *Post, post Post, screened *Screened) (*Post, error) {
+	updated, err := writePost(ctx, tx, post)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyScreening(ctx, tx, updated, screened); err != nil {
+		return nil, err
+	}
+
+	err = recordRevision(ctx, tx, RevisionUpdate, old, updated, post.AuthorID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordPriceChange(ctx, tx, old, updated)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordPostEvents(ctx, tx, old, updated)
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// SetStatus moves an author's listing to status, checking the move against
+// the status it has once locked. It returns sql.ErrNoRows when the post
+// isn't the author's and ErrStatusTransition when the move isn't allowed.
+func (p *Post) SetStatus(id, authorID int, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	old, err := lockPost(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if old.AuthorID != authorID {
+		return sql.ErrNoRows
+	}
+	if !CanOwnerSetStatus(old.Status, status) {
+		return ErrStatusTransition
+	}
+
+	if err := changePostStatus(ctx, tx, id, status); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// changePostStatus moves a post to status inside the caller's transaction
+// and queues post.status_changed. Setting the current status is a no-op.
+func changePostStatus(ctx context.Context, tx *sql.Tx, id int, status string) error {
+	old, err := lockPost(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if old.Status == status {
+		return nil
+	}
+
+	stmt := `UPDATE posts SET status = $1, version = version + 1 WHERE id = $2 RETURNING ` + plainPostColumns
+
+	updated, err := scanPlainPost(tx.QueryRowContext(ctx, stmt, status, id))
+	if err != nil {
+		return err
+	}
+
+	return recordPostEvents(ctx, tx, old, updated)
+}
+
+// Delete removes a post by ID (only if author matches)
+func (p *Post) Delete(id, authorID int) error {
+	return p.DeleteIfVersion(id, authorID, 0)
+}
+
+// DeleteIfVersion removes a post only if its stored version still equals
+// expectedVersion. An expectedVersion of 0 skips the check. authorID must be
+// the signed-in caller; it is recorded as the revision's actor.
+func (p *Post) DeleteIfVersion(id, authorID, expectedVersion int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	old, err := lockPost(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if old.AuthorID != authorID {
+		return sql.ErrNoRows
+	}
+	if expectedVersion != 0 && old.Version != expectedVersion {
+		return ErrVersionConflict
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM posts WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	err = recordRevision(ctx, tx, RevisionDelete, old, nil, authorID, nil)
+	if err != nil {
+		return err
+	}
+
+	err = recordPostEvents(ctx, tx, old, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// plainPostColumns selects a posts row without the author join
+const plainPostColumns = `
+	id, title, price, COALESCE(location, ''), neighborhood,
+	lat, lng, radius, type, COALESCE(image_url, ''),
+	COALESCE(additional_images, '{}'), COALESCE(description, ''),
+	bedrooms, bathrooms, available_from, available_to,
+	author_id, created_at, updated_at, version, status`
+
+// scanPlainPost reads one row selected with plainPostColumns
+func scanPlainPost(row rowScanner) (*Post, error) {
+	var post Post
+
+	err := row.Scan(
+		&post.ID,
+		&post.Title,
+		&post.Price,
+		&post.Location,
+		&post.Neighborhood,
+		&post.Lat,
+		&post.Lng,
+		&post.Radius,
+		&post.Type,
+		&post.ImageURL,
+		pq.Array(&post.AdditionalImages),
+		&post.Description,
+		&post.Bedrooms,
+		&post.Bathrooms,
+		&post.AvailableFrom,
+		&post.AvailableTo,
+		&post.AuthorID,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.Version,
+		&post.Status,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &post, nil
+}
+
+// lockPost loads a post row and locks it until the transaction ends
+func lockPost(ctx context.Context, tx *sql.Tx, id int) (*Post, error) {
+	query := `SELECT ` + plainPostColumns + ` FROM posts WHERE id = $1 FOR UPDATE`
+	return scanPlainPost(tx.QueryRowContext(ctx, query, id))
+}
+
+// writePost overwrites every editable column of a post, bumps its version
+// and returns the stored row. The neighborhood follows the coordinates and a
+// single availability period follows the new dates.
+func writePost(ctx context.Context, tx *sql.Tx, post Post) (*Post, error) {
+	if err := assignNeighborhood(ctx, tx, &post); err != nil {
+		return nil, err
+	}
+
 	stmt := `
 		UPDATE posts SET
 			title = $1,
@@ -318,11 +643,12 @@ func (p *Post) Update(post Post) error {
 			bathrooms = $13,
 			available_from = $14,
 			available_to = $15,
-			updated_at = $16
-		WHERE id = $17 AND author_id = $18
-	`
+			updated_at = $16,
+			version = version + 1
+		WHERE id = $17
+		RETURNING ` + plainPostColumns
 
-	result, err := db.ExecContext(ctx, stmt,
+	updated, err := scanPlainPost(tx.QueryRowContext(ctx, stmt,
 		post.Title,
 		post.Price,
 		post.Location,
@@ -340,37 +666,10 @@ func (p *Post) Update(post Post) error {
 		post.AvailableTo,
 		time.Now(),
 		post.ID,
-		post.AuthorID,
-	)
-
+	))
 	if err != nil {
-		return err
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
-
-	return nil
-}
-
-// Delete removes a post by ID (only if author matches)
-func (p *Post) Delete(id, authorID int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `DELETE FROM posts WHERE id = $1 AND author_id = $2`
-
-	result, err := db.ExecContext(ctx, stmt, id, authorID)
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return nil, err
 	}
 
-	return nil
+	return updated, syncSinglePeriod(ctx, tx, updated)
 }
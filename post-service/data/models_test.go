@@ -0,0 +1,34 @@
+package data
+
+import "testing"
+
+func TestCanOwnerSetStatus(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusPublished, StatusRented, true},
+		{StatusPending, StatusRented, true},
+		{StatusRented, StatusPublished, true},
+
+		{StatusPublished, StatusPublished, false},
+		{StatusRented, StatusRented, false},
+		{StatusPending, StatusPublished, false},
+		{StatusRented, StatusPending, false},
+		{StatusPublished, StatusHidden, false},
+
+		{StatusPendingReview, StatusRented, false},
+		{StatusPendingReview, StatusPublished, false},
+		{StatusRejected, StatusPublished, false},
+		{StatusHidden, StatusPublished, false},
+		{StatusRemoved, StatusRented, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := CanOwnerSetStatus(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanOwnerSetStatus(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
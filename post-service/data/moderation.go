@@ -0,0 +1,326 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Report reasons a user can pick when flagging a listing
+var ReportReasons = map[string]bool{
+	"scam":       true,
+	"fake":       true,
+	"offensive":  true,
+	"duplicate":  true,
+	"wrong_info": true,
+	"other":      true,
+}
+
+// Report statuses
+const (
+	ReportOpen      = "open"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+// Moderation actions. Post actions change the listing's status; user
+// actions apply to the listing's author.
+const (
+	ActionDismiss = "dismiss"
+	ActionHide    = "hide"
+	ActionUnhide  = "unhide"
+	ActionRemove  = "remove"
+	ActionWarn    = "warn"
+	ActionSuspend = "suspend"
+)
+
+// ErrDuplicateReport is returned when a user reports a post they already
+// have an open report on
+var ErrDuplicateReport = errors.New("you have already reported this post")
+
+// actionStatus maps post actions to the status they leave the post in
+var actionStatus = map[string]string{
+	ActionHide:   StatusHidden,
+	ActionUnhide: StatusPublished,
+	ActionRemove: StatusRemoved,
+}
+
+// Report is a user's complaint about a listing
+type Report struct {
+	ID         int        `json:"id"`
+	PostID     int        `json:"postId"`
+	ReporterID int        `json:"reporterId"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details,omitempty"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ResolvedBy *int       `json:"resolvedBy,omitempty"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// Decision is one recorded moderation action
+type Decision struct {
+	ID          int       `json:"id"`
+	ReportID    *int      `json:"reportId,omitempty"`
+	PostID      int       `json:"postId"`
+	UserID      int       `json:"userId"`
+	Action      string    `json:"action"`
+	Note        string    `json:"note,omitempty"`
+	ModeratorID int       `json:"moderatorId"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Contact is what's needed to notify a user
+type Contact struct {
+	UserID    int
+	Email     string
+	FirstName string
+}
+
+// Moderation stores reports and moderation decisions
+type Moderation struct{}
+
+// CreateReport files a report and returns its ID
+func (m *Moderation) CreateReport(report Report) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO post_reports (post_id, reporter_id, reason, details, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (post_id, reporter_id) WHERE status = 'open' DO NOTHING
+		RETURNING id
+	`
+
+	var id int
+	err := db.QueryRowContext(ctx, stmt,
+		report.PostID,
+		report.ReporterID,
+		report.Reason,
+		report.Details,
+		ReportOpen,
+		time.Now(),
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrDuplicateReport
+	}
+
+	return id, err
+}
+
+// GetReports returns reports with the given status, oldest first
+func (m *Moderation) GetReports(status string) ([]*Report, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, post_id, reporter_id, reason, details, status, created_at, resolved_by, resolved_at
+		FROM post_reports
+		WHERE status = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := db.QueryContext(ctx, query, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []*Report
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// GetReport returns a single report
+func (m *Moderation) GetReport(id int) (*Report, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, post_id, reporter_id, reason, details, status, created_at, resolved_by, resolved_at
+		FROM post_reports
+		WHERE id = $1
+	`
+
+	return scanReport(db.QueryRowContext(ctx, query, id))
+}
+
+// OpenReporters returns the users with open reports on a post
+func (m *Moderation) OpenReporters(postID int) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT reporter_id FROM post_reports WHERE post_id = $1 AND status = $2`, postID, ReportOpen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Apply records a decision and carries it out in one transaction: post
+// actions change the post's status, suspend deactivates the author. Any
+// action other than warn and dismiss closes every open report on the post;
+// dismiss and warn only close the report they were taken on.
+func (m *Moderation) Apply(decision Decision) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if status, ok := actionStatus[decision.Action]; ok {
+		err = changePostStatus(ctx, tx, decision.PostID, status)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if decision.Action == ActionSuspend {
+		_, err = tx.ExecContext(ctx, `UPDATE users SET user_active = 0, updated_at = $1 WHERE id = $2`, time.Now(), decision.UserID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO moderation_decisions (report_id, post_id, user_id, action, note, moderator_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, decision.ReportID, decision.PostID, decision.UserID, decision.Action, decision.Note, decision.ModeratorID, time.Now()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	reportStatus := ReportResolved
+	if decision.Action == ActionDismiss {
+		reportStatus = ReportDismissed
+	}
+
+	switch {
+	case decision.Action != ActionDismiss && decision.Action != ActionWarn:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE post_reports SET status = $1, resolved_by = $2, resolved_at = $3
+			WHERE post_id = $4 AND status = $5
+		`, reportStatus, decision.ModeratorID, time.Now(), decision.PostID, ReportOpen)
+	case decision.ReportID != nil:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE post_reports SET status = $1, resolved_by = $2, resolved_at = $3
+			WHERE id = $4
+		`, reportStatus, decision.ModeratorID, time.Now(), *decision.ReportID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// GetDecisions returns moderation decisions about a post or a user, newest
+// first. A zero ID means "any".
+func (m *Moderation) GetDecisions(postID, userID int) ([]*Decision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, report_id, COALESCE(post_id, 0), user_id, action, note, moderator_id, created_at
+		FROM moderation_decisions
+		WHERE ($1 = 0 OR post_id = $1) AND ($2 = 0 OR user_id = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT 200
+	`
+
+	rows, err := db.QueryContext(ctx, query, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decisions []*Decision
+	for rows.Next() {
+		var d Decision
+		var reportID sql.NullInt64
+		err := rows.Scan(&d.ID, &reportID, &d.PostID, &d.UserID, &d.Action, &d.Note, &d.ModeratorID, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if reportID.Valid {
+			id := int(reportID.Int64)
+			d.ReportID = &id
+		}
+		decisions = append(decisions, &d)
+	}
+
+	return decisions, rows.Err()
+}
+
+// ContactOf returns what's needed to notify a user
+func (m *Moderation) ContactOf(userID int) (*Contact, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var c Contact
+	err := db.QueryRowContext(ctx, `SELECT id, email, COALESCE(first_name, '') FROM users WHERE id = $1`, userID).
+		Scan(&c.UserID, &c.Email, &c.FirstName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// scanReport reads one post_reports row
+func scanReport(row rowScanner) (*Report, error) {
+	var report Report
+	var details sql.NullString
+	var resolvedBy sql.NullInt64
+	var resolvedAt sql.NullTime
+
+	err := row.Scan(
+		&report.ID,
+		&report.PostID,
+		&report.ReporterID,
+		&report.Reason,
+		&details,
+		&report.Status,
+		&report.CreatedAt,
+		&resolvedBy,
+		&resolvedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Details = details.String
+	if resolvedBy.Valid {
+		id := int(resolvedBy.Int64)
+		report.ResolvedBy = &id
+	}
+	if resolvedAt.Valid {
+		report.ResolvedAt = &resolvedAt.Time
+	}
+
+	return &report, nil
+}
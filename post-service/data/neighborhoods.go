@@ -0,0 +1,238 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"post-service/geo"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Neighborhood is a named area with a GeoJSON boundary
+type Neighborhood struct {
+	ID       int             `json:"id"`
+	Slug     string          `json:"slug"`
+	Name     string          `json:"name"`
+	Boundary json.RawMessage `json:"boundary"` // GeoJSON Polygon or MultiPolygon
+	Shape    *geo.Shape      `json:"-"`
+}
+
+// NeighborhoodStats summarises the published listings in a neighborhood.
+// The prices are nil when it has none.
+type NeighborhoodStats struct {
+	ActiveListings int      `json:"activeListings"`
+	MedianPrice    *float64 `json:"medianPrice"`
+	MinPrice       *float64 `json:"minPrice"`
+	MaxPrice       *float64 `json:"maxPrice"`
+}
+
+// Neighborhoods stores neighborhood boundaries and assigns listings to them
+type Neighborhoods struct{}
+
+// All returns every neighborhood by name, with its boundary parsed
+func (n *Neighborhoods) All() ([]*Neighborhood, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return queryNeighborhoods(ctx, db, `SELECT id, slug, name, boundary FROM neighborhoods ORDER BY name`)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// queryNeighborhoods runs a query selecting id, slug, name and boundary
+func queryNeighborhoods(ctx context.Context, q queryer, query string, args ...any) ([]*Neighborhood, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var neighborhoods []*Neighborhood
+	for rows.Next() {
+		var hood Neighborhood
+		if err := rows.Scan(&hood.ID, &hood.Slug, &hood.Name, &hood.Boundary); err != nil {
+			return nil, err
+		}
+		hood.Shape, err = geo.ParseGeometry(hood.Boundary)
+		if err != nil {
+			return nil, err
+		}
+		neighborhoods = append(neighborhoods, &hood)
+	}
+
+	return neighborhoods, rows.Err()
+}
+
+// Stats returns the stats of each neighborhood that has published listings,
+// keyed by name
+func (n *Neighborhoods) Stats() (map[string]*NeighborhoodStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT p.neighborhood, COUNT(*),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY p.price)::float8,
+			MIN(p.price)::float8, MAX(p.price)::float8
+		FROM posts p
+		JOIN users u ON p.author_id = u.id
+		JOIN neighborhoods n ON n.name = p.neighborhood
+		WHERE p.status = 'published' AND u.user_active = 1
+		GROUP BY p.neighborhood
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := map[string]*NeighborhoodStats{}
+	for rows.Next() {
+		var name string
+		var s NeighborhoodStats
+		var median, low, high float64
+		if err := rows.Scan(&name, &s.ActiveListings, &median, &low, &high); err != nil {
+			return nil, err
+		}
+		s.MedianPrice, s.MinPrice, s.MaxPrice = &median, &low, &high
+		stats[name] = &s
+	}
+
+	return stats, rows.Err()
+}
+
+// Import saves neighborhoods by slug, replacing the boundaries of ones that
+// exist, and with prune deletes those not given. Every listing with
+// coordinates is then reassigned. It returns how many listings moved.
+func (n *Neighborhoods) Import(neighborhoods []*Neighborhood, prune bool) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	slugs := make([]string, 0, len(neighborhoods))
+	for _, hood := range neighborhoods {
+		minLat, minLng, maxLat, maxLng := hood.Shape.Bounds()
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO neighborhoods (slug, name, boundary, min_lat, min_lng, max_lat, max_lng, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (slug) DO UPDATE SET
+				name = EXCLUDED.name, boundary = EXCLUDED.boundary,
+				min_lat = EXCLUDED.min_lat, min_lng = EXCLUDED.min_lng,
+				max_lat = EXCLUDED.max_lat, max_lng = EXCLUDED.max_lng,
+				updated_at = EXCLUDED.updated_at
+			RETURNING id
+		`, hood.Slug, hood.Name, string(hood.Boundary), minLat, minLng, maxLat, maxLng, time.Now()).Scan(&hood.ID)
+		if err != nil {
+			return 0, err
+		}
+		slugs = append(slugs, hood.Slug)
+	}
+
+	if prune {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM neighborhoods WHERE slug <> ALL($1)`, pq.Array(slugs)); err != nil {
+			return 0, err
+		}
+	}
+
+	moved, err := reassignNeighborhoods(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return moved, tx.Commit()
+}
+
+// reassignNeighborhoods moves every listing with coordinates into the
+// neighborhood they fall in. Listings outside all of them keep theirs. The
+// change is the system's rather than the author's, so it bumps the version
+// and queues events but records no revision.
+func reassignNeighborhoods(ctx context.Context, tx *sql.Tx) (int, error) {
+	neighborhoods, err := queryNeighborhoods(ctx, tx, `SELECT id, slug, name, boundary FROM neighborhoods ORDER BY name`)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, lat, lng, neighborhood FROM posts WHERE lat <> 0 OR lng <> 0`)
+	if err != nil {
+		return 0, err
+	}
+
+	moves := map[int]string{}
+	for rows.Next() {
+		var id int
+		var lat, lng float64
+		var current string
+		if err := rows.Scan(&id, &lat, &lng, &current); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if name := neighborhoodAt(neighborhoods, lat, lng); name != "" && name != current {
+			moves[id] = name
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, name := range moves {
+		old, err := lockPost(ctx, tx, id)
+		if err != nil {
+			return 0, err
+		}
+
+		stmt := `UPDATE posts SET neighborhood = $1, version = version + 1 WHERE id = $2 RETURNING ` + plainPostColumns
+		updated, err := scanPlainPost(tx.QueryRowContext(ctx, stmt, name, id))
+		if err != nil {
+			return 0, err
+		}
+
+		if err := recordPostEvents(ctx, tx, old, updated); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(moves), nil
+}
+
+// assignNeighborhood sets the neighborhood of a post with coordinates to
+// the one they fall in. Posts without coordinates, or outside every
+// neighborhood, keep the neighborhood their author picked.
+func assignNeighborhood(ctx context.Context, tx *sql.Tx, post *Post) error {
+	if post.Lat == 0 && post.Lng == 0 {
+		return nil
+	}
+
+	candidates, err := queryNeighborhoods(ctx, tx, `
+		SELECT id, slug, name, boundary FROM neighborhoods
+		WHERE $1 BETWEEN min_lat AND max_lat AND $2 BETWEEN min_lng AND max_lng
+		ORDER BY name
+	`, post.Lat, post.Lng)
+	if err != nil {
+		return err
+	}
+
+	if name := neighborhoodAt(candidates, post.Lat, post.Lng); name != "" {
+		post.Neighborhood = name
+	}
+	return nil
+}
+
+// neighborhoodAt returns the name of the first neighborhood containing the
+// point, or "" when none does
+func neighborhoodAt(neighborhoods []*Neighborhood, lat, lng float64) string {
+	for _, hood := range neighborhoods {
+		if hood.Shape.Contains(lat, lng) {
+			return hood.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,226 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"post-service/event"
+	"sort"
+	"time"
+)
+
+// OutboxEvent is an event written in the same transaction as the change it
+// describes and published to RabbitMQ afterwards by the outbox relay
+type OutboxEvent struct {
+	ID         int64
+	RoutingKey string
+	Payload    json.RawMessage
+	CreatedAt  time.Time
+	Attempts   int
+}
+
+// MessageID is the AMQP message id consumers can deduplicate on
+func (e *OutboxEvent) MessageID() string {
+	return fmt.Sprintf("post-service-%d", e.ID)
+}
+
+// Outbox stores events until they have been published
+type Outbox struct{}
+
+// Enqueue stores an event that isn't tied to a post write, such as a
+// notification, so it is published by the relay like every other event
+func (o *Outbox) Enqueue(routingKey string, payload any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return enqueueEvent(ctx, db, routingKey, payload)
+}
+
+// Dispatch hands up to limit unpublished events, oldest first, to publish
+// and marks each one published once publish returns nil. It stops at the
+// first failure so events keep their order, and returns how many were sent.
+// Rows are locked with SKIP LOCKED so several replicas can relay at once.
+func (o *Outbox) Dispatch(ctx context.Context, limit int, publish func(*OutboxEvent) error) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, routing_key, payload, created_at, attempts
+		FROM post_outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var events []*OutboxEvent
+	for rows.Next() {
+		var e OutboxEvent
+		if err := rows.Scan(&e.ID, &e.RoutingKey, &e.Payload, &e.CreatedAt, &e.Attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, &e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var publishErr error
+	for _, e := range events {
+		if publishErr = publish(e); publishErr != nil {
+			_, err = tx.ExecContext(ctx,
+				`UPDATE post_outbox SET attempts = attempts + 1, last_error = $1 WHERE id = $2`,
+				publishErr.Error(), e.ID)
+			if err != nil {
+				return sent, err
+			}
+			break
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE post_outbox SET attempts = attempts + 1, published_at = $1, last_error = NULL WHERE id = $2`,
+			time.Now(), e.ID)
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return sent, publishErr
+}
+
+// Prune deletes events published before the cutoff
+func (o *Outbox) Prune(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx,
+		`DELETE FROM post_outbox WHERE published_at IS NOT NULL AND published_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// enqueueEvent writes one outbox row
+func enqueueEvent(ctx context.Context, ex execer, routingKey string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = ex.ExecContext(ctx,
+		`INSERT INTO post_outbox (routing_key, payload, created_at) VALUES ($1, $2, $3)`,
+		routingKey, string(body), time.Now())
+	return err
+}
+
+// recordPostEvents queues the domain events for a write inside the caller's
+// transaction: post.created when before is nil, post.deleted when after is
+// nil, otherwise post.updated if an editable field changed,
+// post.status_changed if the status did and post.price_changed if the price
+// did.
+func recordPostEvents(ctx context.Context, tx *sql.Tx, before, after *Post) error {
+	now := time.Now()
+
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		return enqueueEvent(ctx, tx, event.RoutingPostCreated, event.PostEvent{
+			Type:       event.RoutingPostCreated,
+			PostID:     after.ID,
+			AuthorID:   after.AuthorID,
+			NewStatus:  after.Status,
+			After:      after,
+			OccurredAt: now,
+		})
+	case after == nil:
+		return enqueueEvent(ctx, tx, event.RoutingPostDeleted, event.PostEvent{
+			Type:       event.RoutingPostDeleted,
+			PostID:     before.ID,
+			AuthorID:   before.AuthorID,
+			OldStatus:  before.Status,
+			Before:     before,
+			OccurredAt: now,
+		})
+	}
+
+	changes, err := diffPosts(before, after)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) > 0 {
+		changed := make([]string, 0, len(changes))
+		for field := range changes {
+			changed = append(changed, field)
+		}
+		sort.Strings(changed)
+
+		err = enqueueEvent(ctx, tx, event.RoutingPostUpdated, event.PostEvent{
+			Type:       event.RoutingPostUpdated,
+			PostID:     after.ID,
+			AuthorID:   after.AuthorID,
+			Changed:    changed,
+			Before:     before,
+			After:      after,
+			OccurredAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if before.Status != after.Status {
+		err = enqueueEvent(ctx, tx, event.RoutingPostStatusChanged, event.PostEvent{
+			Type:       event.RoutingPostStatusChanged,
+			PostID:     after.ID,
+			AuthorID:   after.AuthorID,
+			OldStatus:  before.Status,
+			NewStatus:  after.Status,
+			Before:     before,
+			After:      after,
+			OccurredAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if before.Price != after.Price {
+		err = enqueueEvent(ctx, tx, event.RoutingPostPriceChanged, event.PriceChangedEvent{
+			PostID:    after.ID,
+			AuthorID:  after.AuthorID,
+			Title:     after.Title,
+			OldPrice:  before.Price,
+			NewPrice:  after.Price,
+			ChangedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
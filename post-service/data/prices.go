@@ -0,0 +1,59 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PricePoint is one entry in a post's price history
+type PricePoint struct {
+	Price     float64   `json:"price"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+// PriceHistory reads the asking prices a post has had over time
+type PriceHistory struct{}
+
+// GetByPostID returns a post's price history, oldest first
+func (ph *PriceHistory) GetByPostID(postID int) ([]*PricePoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT price, changed_at
+		FROM post_price_history
+		WHERE post_id = $1
+		ORDER BY changed_at, id
+	`
+
+	rows, err := db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []*PricePoint
+	for rows.Next() {
+		var point PricePoint
+		if err := rows.Scan(&point.Price, &point.ChangedAt); err != nil {
+			return nil, err
+		}
+		points = append(points, &point)
+	}
+
+	return points, rows.Err()
+}
+
+// recordPriceChange appends to the price history when a write set a new price.
+// before is nil for a newly created post.
+func recordPriceChange(ctx context.Context, tx *sql.Tx, before, after *Post) error {
+	if after == nil || (before != nil && before.Price == after.Price) {
+		return nil
+	}
+
+	stmt := `INSERT INTO post_price_history (post_id, price, changed_at) VALUES ($1, $2, $3)`
+
+	_, err := tx.ExecContext(ctx, stmt, after.ID, after.Price, time.Now())
+	return err
+}
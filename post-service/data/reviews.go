@@ -0,0 +1,385 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// Review statuses. Hidden reviews are left out of listings and ratings.
+const (
+	ReviewPublished = "published"
+	ReviewHidden    = "hidden"
+)
+
+// Review moderation actions, besides dismiss, warn and suspend
+const (
+	ActionHideReview = "hide_review"
+	ActionHideReply  = "hide_reply"
+)
+
+// Reasons a user can pick when reporting a review or a reply
+var ReviewReportReasons = map[string]bool{
+	"spam":          true,
+	"fake":          true,
+	"offensive":     true,
+	"personal_info": true,
+	"other":         true,
+}
+
+var (
+	// ErrNotReviewable is returned when the renter hasn't had a completed
+	// viewing or an accepted application for the listing
+	ErrNotReviewable = errors.New("you can review a listing after a completed viewing or an accepted application")
+	// ErrAlreadyReviewed is returned for a second review of the same listing
+	ErrAlreadyReviewed = errors.New("you have already reviewed this listing")
+	// ErrAlreadyReplied is returned for a second reply to a review
+	ErrAlreadyReplied = errors.New("this review already has a reply")
+	// ErrDuplicateReviewReport is returned when a user reports a review they
+	// already have an open report on
+	ErrDuplicateReviewReport = errors.New("you have already reported this review")
+)
+
+// RatingSummary is the average rating over a number of reviews
+type RatingSummary struct {
+	Rating float64 `json:"rating"` // 0 when there are no reviews
+	Count  int     `json:"count"`
+}
+
+// Review is a renter's rating of a landlord for a listing. Only the
+// reviewer's first name and last initial are shown.
+type Review struct {
+	ID         int        `json:"id"`
+	PostID     int        `json:"postId"`
+	PostTitle  string     `json:"postTitle"`
+	LandlordID int        `json:"landlordId"`
+	ReviewerID int        `json:"reviewerId"`
+	Reviewer   string     `json:"reviewer"`
+	Rating     int        `json:"rating"`
+	Body       string     `json:"body"`
+	Status     string     `json:"status"`
+	Reply      *string    `json:"reply,omitempty"`
+	RepliedAt  *time.Time `json:"repliedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// ReviewReport is a complaint about a review or the landlord's reply
+type ReviewReport struct {
+	ID         int        `json:"id"`
+	ReviewID   int        `json:"reviewId"`
+	Target     string     `json:"target"` // review or reply
+	ReporterID int        `json:"reporterId"`
+	ReportedID int        `json:"reportedId"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details,omitempty"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ResolvedBy *int       `json:"resolvedBy,omitempty"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// Reviews stores reviews, replies and reports on them
+type Reviews struct{}
+
+// reviewSelect is the query read by scanReview. Hidden replies read as none.
+const reviewSelect = `
+	SELECT r.id, r.post_id, p.title, r.landlord_id, r.reviewer_id, u.first_name, u.last_name,
+		r.rating, r.body, r.status, CASE WHEN r.reply_hidden THEN NULL ELSE r.reply END,
+		r.replied_at, r.created_at
+	FROM reviews r
+	JOIN posts p ON p.id = r.post_id
+	JOIN users u ON u.id = r.reviewer_id`
+
+func scanReview(row rowScanner) (*Review, error) {
+	var r Review
+	var firstName, lastName string
+	var reply sql.NullString
+	var repliedAt sql.NullTime
+
+	err := row.Scan(&r.ID, &r.PostID, &r.PostTitle, &r.LandlordID, &r.ReviewerID, &firstName, &lastName,
+		&r.Rating, &r.Body, &r.Status, &reply, &repliedAt, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Reviewer = firstName
+	if lastName != "" {
+		r.Reviewer += " " + string([]rune(lastName)[:1]) + "."
+	}
+	if reply.Valid {
+		r.Reply = &reply.String
+		r.RepliedAt = &repliedAt.Time
+	}
+
+	return &r, nil
+}
+
+// CanReview reports whether a renter had a viewing of the listing that has
+// ended or an application for it that was accepted
+func (rv *Reviews) CanReview(postID, renterID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var ok bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM viewing_bookings b
+			JOIN viewing_slots s ON s.id = b.slot_id
+			WHERE b.post_id = $1 AND b.renter_id = $2 AND b.status = 'confirmed' AND s.ends_at < $3
+		) OR EXISTS (
+			SELECT 1 FROM rental_applications
+			WHERE post_id = $1 AND applicant_id = $2 AND status = 'accepted'
+		)
+	`, postID, renterID, time.Now()).Scan(&ok)
+
+	return ok, err
+}
+
+// Create stores a review of the listing's author
+func (rv *Reviews) Create(review *Review) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var id int
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO reviews (post_id, landlord_id, reviewer_id, rating, body, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, review.PostID, review.LandlordID, review.ReviewerID, review.Rating, review.Body, ReviewPublished, time.Now()).Scan(&id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, ErrAlreadyReviewed
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Get returns a single review, whatever its status
+func (rv *Reviews) Get(id int) (*Review, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return scanReview(db.QueryRowContext(ctx, reviewSelect+` WHERE r.id = $1`, id))
+}
+
+// Reply stores the landlord's reply. There is only one, so a second
+// returns ErrAlreadyReplied.
+func (rv *Reviews) Reply(id int, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE reviews SET reply = $1, replied_at = $2
+		WHERE id = $3 AND reply IS NULL
+	`, body, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAlreadyReplied
+	}
+
+	return nil
+}
+
+// ForPost returns a listing's published reviews, newest first, and their
+// summary
+func (rv *Reviews) ForPost(postID, limit, offset int) ([]*Review, *RatingSummary, error) {
+	return rv.list(`r.post_id = $1`, postID, limit, offset)
+}
+
+// ForLandlord returns the published reviews of a landlord across their
+// listings, newest first, and their summary
+func (rv *Reviews) ForLandlord(landlordID, limit, offset int) ([]*Review, *RatingSummary, error) {
+	return rv.list(`r.landlord_id = $1`, landlordID, limit, offset)
+}
+
+func (rv *Reviews) list(where string, id, limit, offset int) ([]*Review, *RatingSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var summary RatingSummary
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(ROUND(AVG(r.rating), 1), 0)::float8, COUNT(*)
+		FROM reviews r
+		WHERE `+where+` AND r.status = 'published'
+	`, id).Scan(&summary.Rating, &summary.Count)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, reviewSelect+`
+		WHERE `+where+` AND r.status = 'published'
+		ORDER BY r.created_at DESC, r.id DESC
+		LIMIT $2 OFFSET $3
+	`, id, limit, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	reviews := []*Review{}
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	return reviews, &summary, rows.Err()
+}
+
+// reviewReportColumns is the column list read by scanReviewReport
+const reviewReportColumns = `id, review_id, target, reporter_id, reported_id, reason, details, status,
+	created_at, resolved_by, resolved_at`
+
+// CreateReport files a report on a review or its reply
+func (rv *Reviews) CreateReport(report ReviewReport) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var id int
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO review_reports (review_id, target, reporter_id, reported_id, reason, details, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (review_id, reporter_id) WHERE status = 'open' DO NOTHING
+		RETURNING id
+	`, report.ReviewID, report.Target, report.ReporterID, report.ReportedID,
+		report.Reason, report.Details, ReportOpen, time.Now()).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrDuplicateReviewReport
+	}
+
+	return id, err
+}
+
+// GetReports returns review reports with the given status, oldest first
+func (rv *Reviews) GetReports(status string) ([]*ReviewReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+reviewReportColumns+` FROM review_reports
+		WHERE status = $1
+		ORDER BY created_at, id
+	`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []*ReviewReport
+	for rows.Next() {
+		report, err := scanReviewReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// GetReport returns a single review report
+func (rv *Reviews) GetReport(id int) (*ReviewReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return scanReviewReport(db.QueryRowContext(ctx,
+		`SELECT `+reviewReportColumns+` FROM review_reports WHERE id = $1`, id))
+}
+
+// ResolveReport closes a review report and records the decision in the
+// moderation log under the review's listing. Hiding a review or reply
+// closes every open report on the review; suspend deactivates the author
+// of the reported text.
+func (rv *Reviews) ResolveReport(report *ReviewReport, postID int, action, note string, moderatorID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	switch action {
+	case ActionHideReview:
+		_, err = tx.ExecContext(ctx, `UPDATE reviews SET status = $1 WHERE id = $2`, ReviewHidden, report.ReviewID)
+	case ActionHideReply:
+		_, err = tx.ExecContext(ctx, `UPDATE reviews SET reply_hidden = TRUE WHERE id = $1`, report.ReviewID)
+	case ActionSuspend:
+		_, err = tx.ExecContext(ctx, `UPDATE users SET user_active = 0, updated_at = $1 WHERE id = $2`, now, report.ReportedID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO moderation_decisions (post_id, user_id, action, note, moderator_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, postID, report.ReportedID, action, note, moderatorID, now).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	status := ReportResolved
+	if action == ActionDismiss {
+		status = ReportDismissed
+	}
+
+	if action == ActionHideReview || action == ActionHideReply {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE review_reports SET status = $1, resolved_by = $2, resolved_at = $3
+			WHERE review_id = $4 AND (id = $5 OR (status = $6 AND target = $7))
+		`, status, moderatorID, now, report.ReviewID, report.ID, ReportOpen, report.Target)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE review_reports SET status = $1, resolved_by = $2, resolved_at = $3
+			WHERE id = $4
+		`, status, moderatorID, now, report.ID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// scanReviewReport reads one row selected with reviewReportColumns
+func scanReviewReport(row rowScanner) (*ReviewReport, error) {
+	var report ReviewReport
+	var resolvedBy sql.NullInt64
+	var details sql.NullString
+	var resolvedAt sql.NullTime
+
+	err := row.Scan(&report.ID, &report.ReviewID, &report.Target, &report.ReporterID, &report.ReportedID,
+		&report.Reason, &details, &report.Status, &report.CreatedAt, &resolvedBy, &resolvedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Details = details.String
+	if resolvedBy.Valid {
+		id := int(resolvedBy.Int64)
+		report.ResolvedBy = &id
+	}
+	if resolvedAt.Valid {
+		report.ResolvedAt = &resolvedAt.Time
+	}
+
+	return &report, nil
+}
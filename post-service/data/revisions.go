@@ -0,0 +1,421 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Revision actions
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+)
+
+var (
+	// ErrNothingToRestore is returned when a revision carries no restorable state
+	ErrNothingToRestore = errors.New("revision has no snapshot to restore")
+	// ErrRestoreModerated is returned when someone other than a moderator
+	// restores a post that review or moderation took down
+	ErrRestoreModerated = errors.New("this listing was taken down by moderation and only a moderator can restore it")
+)
+
+// moderatedStatuses are set by review and moderation rather than the author
+var moderatedStatuses = map[string]bool{
+	StatusPendingReview: true,
+	StatusRejected:      true,
+	StatusHidden:        true,
+	StatusRemoved:       true,
+}
+
+// untrackedFields are bookkeeping columns left out of revision diffs. Status
+// is changed by review and moderation, not by edits.
+var untrackedFields = map[string]bool{
+	"id":        true,
+	"createdAt": true,
+	"updatedAt": true,
+	"version":   true,
+	"status":    true,
+}
+
+// FieldChange holds the old and new value of one changed field
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// Revision is one entry in a post's audit trail
+type Revision struct {
+	ID           int                    `json:"id"`
+	PostID       int                    `json:"postId"`
+	AuthorID     int                    `json:"authorId"`
+	ActorID      int                    `json:"actorId"`
+	Action       string                 `json:"action"`
+	Changes      map[string]FieldChange `json:"changes"`
+	Snapshot     *Post                  `json:"snapshot,omitempty"`
+	RestoredFrom *int                   `json:"restoredFrom,omitempty"`
+	CreatedAt    time.Time              `json:"createdAt"`
+}
+
+// GetByPostID returns a post's revisions, newest first
+func (rv *Revision) GetByPostID(postID int) ([]*Revision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, post_id, author_id, actor_id, action, changes, snapshot, restored_from, created_at
+		FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*Revision
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetOne returns a single revision of a post
+func (rv *Revision) GetOne(postID, revisionID int) (*Revision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, post_id, author_id, actor_id, action, changes, snapshot, restored_from, created_at
+		FROM post_revisions
+		WHERE post_id = $1 AND id = $2
+	`
+
+	return scanRevision(db.QueryRowContext(ctx, query, postID, revisionID))
+}
+
+// OwnerOf returns the author of a post, falling back to its revision history
+// so owners can still see the trail after the post was deleted
+func (rv *Revision) OwnerOf(postID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT author_id FROM posts WHERE id = $1
+		UNION ALL
+		(SELECT author_id FROM post_revisions WHERE post_id = $1 ORDER BY id DESC LIMIT 1)
+		LIMIT 1
+	`
+
+	var authorID int
+	err := db.QueryRowContext(ctx, query, postID).Scan(&authorID)
+	return authorID, err
+}
+
+// Restore brings a post back to the state captured by a revision. A deleted
+// post is re-created under its original ID with the status it was deleted
+// in, not the revision's, so deleting and restoring can't undo moderation.
+// Posts last seen in a moderated status are only restored for moderators.
+// screened, the screening of the revision's content, is applied like edits
+// do. The restore itself is recorded as a new revision attributed to
+// actorID.
+func (rv *Revision) Restore(postID, revisionID, actorID int, moderator bool, screened *Screened) (*PostChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	target, err := rv.GetOne(postID, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	if target.Snapshot == nil {
+		return nil, ErrNothingToRestore
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	snapshot := *target.Snapshot
+	snapshot.ID = postID
+
+	old, err := lockPost(ctx, tx, postID)
+	deleted := errors.Is(err, sql.ErrNoRows)
+	if err != nil && !deleted {
+		return nil, err
+	}
+
+	status, err := lastKnownStatus(ctx, tx, postID, old)
+	if err != nil {
+		return nil, err
+	}
+	if moderatedStatuses[status] && !moderator {
+		return nil, ErrRestoreModerated
+	}
+
+	if deleted {
+		old = nil
+		snapshot.Status = status
+		err = reinsertPost(ctx, tx, snapshot)
+	} else {
+		_, err = writePost(ctx, tx, snapshot)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := lockPost(ctx, tx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyScreening(ctx, tx, restored, screened); err != nil {
+		return nil, err
+	}
+
+	err = recordRevision(ctx, tx, RevisionRestore, old, restored, actorID, &target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordPriceChange(ctx, tx, old, restored)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordPostEvents(ctx, tx, old, restored)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostChange{Before: old, After: restored}, tx.Commit()
+}
+
+// lastKnownStatus returns the status of a post, or for a deleted one the
+// status recorded by its latest revision
+func lastKnownStatus(ctx context.Context, tx *sql.Tx, postID int, current *Post) (string, error) {
+	if current != nil {
+		return current.Status, nil
+	}
+
+	var status sql.NullString
+	err := tx.QueryRowContext(ctx, `
+		SELECT snapshot->>'status' FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, postID).Scan(&status)
+	if err != nil {
+		return "", err
+	}
+
+	if status.String == "" {
+		return StatusPublished, nil
+	}
+	return status.String, nil
+}
+
+// reinsertPost re-creates a deleted post under its original ID. Like other
+// writes, the neighborhood follows the coordinates and a single availability
+// period follows the dates.
+func reinsertPost(ctx context.Context, tx *sql.Tx, post Post) error {
+	if err := assignNeighborhood(ctx, tx, &post); err != nil {
+		return err
+	}
+
+	stmt := `
+		INSERT INTO posts (
+			id, title, price, location, neighborhood, lat, lng, radius, type,
+			image_url, additional_images, description, bedrooms, bathrooms,
+			available_from, available_to, author_id, created_at, updated_at, status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+	`
+
+	status := post.Status
+	if status == "" {
+		status = StatusPublished
+	}
+
+	_, err := tx.ExecContext(ctx, stmt,
+		post.ID,
+		post.Title,
+		post.Price,
+		post.Location,
+		post.Neighborhood,
+		post.Lat,
+		post.Lng,
+		post.Radius,
+		post.Type,
+		post.ImageURL,
+		pq.Array(post.AdditionalImages),
+		post.Description,
+		post.Bedrooms,
+		post.Bathrooms,
+		post.AvailableFrom,
+		post.AvailableTo,
+		post.AuthorID,
+		post.CreatedAt,
+		time.Now(),
+		status,
+	)
+	if err != nil {
+		return err
+	}
+
+	return syncSinglePeriod(ctx, tx, &post)
+}
+
+// recordRevision writes one audit row inside the caller's transaction.
+// before is nil for creates, after is nil for deletes.
+func recordRevision(ctx context.Context, tx *sql.Tx, action string, before, after *Post, actorID int, restoredFrom *int) error {
+	changes, err := diffPosts(before, after)
+	if err != nil {
+		return err
+	}
+
+	// An update that didn't change anything isn't worth a history entry
+	if action == RevisionUpdate && len(changes) == 0 {
+		return nil
+	}
+
+	snapshot := after
+	if snapshot == nil {
+		snapshot = before
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+		INSERT INTO post_revisions (post_id, author_id, actor_id, action, changes, snapshot, restored_from, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		snapshot.ID,
+		snapshot.AuthorID,
+		actorID,
+		action,
+		string(changesJSON),
+		string(snapshotJSON),
+		restoredFrom,
+		time.Now(),
+	)
+	return err
+}
+
+// diffPosts compares two post states field by field using their JSON names
+func diffPosts(before, after *Post) (map[string]FieldChange, error) {
+	oldFields, err := postFields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	newFields, err := postFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]FieldChange{}
+	for key := range mergeKeys(oldFields, newFields) {
+		if untrackedFields[key] {
+			continue
+		}
+		oldValue, newValue := oldFields[key], newFields[key]
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes[key] = FieldChange{Old: oldValue, New: newValue}
+		}
+	}
+
+	return changes, nil
+}
+
+// postFields flattens a post into a map keyed by JSON field name
+func postFields(post *Post) (map[string]any, error) {
+	fields := map[string]any{}
+	if post == nil {
+		return fields, nil
+	}
+
+	raw, err := json.Marshal(post)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(raw, &fields)
+	return fields, err
+}
+
+func mergeKeys(a, b map[string]any) map[string]bool {
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
+
+// scanRevision reads one post_revisions row
+func scanRevision(row rowScanner) (*Revision, error) {
+	var revision Revision
+	var changesJSON, snapshotJSON []byte
+	var restoredFrom sql.NullInt64
+
+	err := row.Scan(
+		&revision.ID,
+		&revision.PostID,
+		&revision.AuthorID,
+		&revision.ActorID,
+		&revision.Action,
+		&changesJSON,
+		&snapshotJSON,
+		&restoredFrom,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(changesJSON, &revision.Changes); err != nil {
+		return nil, err
+	}
+
+	if len(snapshotJSON) > 0 && string(snapshotJSON) != "null" {
+		var snapshot Post
+		if err := json.Unmarshal(snapshotJSON, &snapshot); err != nil {
+			return nil, err
+		}
+		revision.Snapshot = &snapshot
+	}
+
+	if restoredFrom.Valid {
+		id := int(restoredFrom.Int64)
+		revision.RestoredFrom = &id
+	}
+
+	return &revision, nil
+}
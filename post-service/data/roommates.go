@@ -0,0 +1,169 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Lifestyle answers of a roommate profile
+var (
+	SleepSchedules = map[string]bool{"early_bird": true, "flexible": true, "night_owl": true}
+	PetAnswers     = map[string]bool{"have_pets": true, "ok_with_pets": true, "no_pets": true}
+	SmokingAnswers = map[string]bool{"smoker": true, "outdoors_only": true, "non_smoker": true}
+)
+
+// RoommateProfile is a user's opt-in roommate finder profile. Only the
+// first name and last initial are shown to others.
+type RoommateProfile struct {
+	UserID        int       `json:"userId"`
+	Name          string    `json:"name"`
+	Active        bool      `json:"active"`
+	Bio           string    `json:"bio"`
+	BudgetMin     int       `json:"budgetMin"`
+	BudgetMax     int       `json:"budgetMax"`
+	Neighborhoods []string  `json:"neighborhoods"`
+	MoveInFrom    time.Time `json:"-"`
+	MoveInTo      time.Time `json:"-"`
+	MoveIn        struct {
+		From string `json:"from"` // YYYY-MM-DD
+		To   string `json:"to"`
+	} `json:"moveIn"`
+	SleepSchedule string    `json:"sleepSchedule"`
+	Cleanliness   int       `json:"cleanliness"` // 1 (relaxed) to 5 (spotless)
+	Pets          string    `json:"pets"`
+	Smoking       string    `json:"smoking"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// Roommates stores roommate finder profiles
+type Roommates struct{}
+
+const roommateSelect = `
+	SELECT r.user_id, u.first_name, u.last_name, r.active, r.bio, r.budget_min, r.budget_max,
+		r.neighborhoods, r.move_in_from, r.move_in_to, r.sleep_schedule, r.cleanliness,
+		r.pets, r.smoking, r.updated_at
+	FROM roommate_profiles r
+	JOIN users u ON u.id = r.user_id`
+
+func scanRoommate(row rowScanner) (*RoommateProfile, error) {
+	var p RoommateProfile
+	var firstName, lastName string
+
+	err := row.Scan(&p.UserID, &firstName, &lastName, &p.Active, &p.Bio, &p.BudgetMin, &p.BudgetMax,
+		pq.Array(&p.Neighborhoods), &p.MoveInFrom, &p.MoveInTo, &p.SleepSchedule, &p.Cleanliness,
+		&p.Pets, &p.Smoking, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Name = firstName
+	if lastName != "" {
+		p.Name += " " + string([]rune(lastName)[:1]) + "."
+	}
+	if p.Neighborhoods == nil {
+		p.Neighborhoods = []string{}
+	}
+	p.MoveIn.From = p.MoveInFrom.Format("2006-01-02")
+	p.MoveIn.To = p.MoveInTo.Format("2006-01-02")
+
+	return &p, nil
+}
+
+// Get returns a user's profile, active or not
+func (rm *Roommates) Get(userID int) (*RoommateProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return scanRoommate(db.QueryRowContext(ctx, roommateSelect+` WHERE r.user_id = $1`, userID))
+}
+
+// Save creates or replaces a user's profile
+func (rm *Roommates) Save(p *RoommateProfile) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO roommate_profiles (user_id, active, bio, budget_min, budget_max, neighborhoods,
+			move_in_from, move_in_to, sleep_schedule, cleanliness, pets, smoking, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $13)
+		ON CONFLICT (user_id) DO UPDATE SET
+			active = EXCLUDED.active, bio = EXCLUDED.bio,
+			budget_min = EXCLUDED.budget_min, budget_max = EXCLUDED.budget_max,
+			neighborhoods = EXCLUDED.neighborhoods,
+			move_in_from = EXCLUDED.move_in_from, move_in_to = EXCLUDED.move_in_to,
+			sleep_schedule = EXCLUDED.sleep_schedule, cleanliness = EXCLUDED.cleanliness,
+			pets = EXCLUDED.pets, smoking = EXCLUDED.smoking, updated_at = EXCLUDED.updated_at
+	`, p.UserID, p.Active, p.Bio, p.BudgetMin, p.BudgetMax, pq.Array(p.Neighborhoods),
+		p.MoveInFrom, p.MoveInTo, p.SleepSchedule, p.Cleanliness, p.Pets, p.Smoking, now)
+
+	return err
+}
+
+// Delete removes a user's profile. It returns sql.ErrNoRows when there is
+// none.
+func (rm *Roommates) Delete(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `DELETE FROM roommate_profiles WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// visibleRoommate limits profiles to those $1 may see: active, of an active
+// account other than their own, and with nobody on either side blocked.
+// Profiles whose move-in window ended are left out.
+const visibleRoommate = `
+	r.active AND r.user_id <> $1 AND u.user_active = 1 AND r.move_in_to >= CURRENT_DATE
+	AND NOT EXISTS (
+		SELECT 1 FROM user_blocks b
+		WHERE (b.blocker_id = $1 AND b.blocked_id = r.user_id)
+			OR (b.blocker_id = r.user_id AND b.blocked_id = $1)
+	)`
+
+// GetVisible returns userID's profile if viewerID may see it
+func (rm *Roommates) GetVisible(viewerID, userID int) (*RoommateProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return scanRoommate(db.QueryRowContext(ctx, roommateSelect+` WHERE r.user_id = $2 AND`+visibleRoommate, viewerID, userID))
+}
+
+// Candidates returns the profiles the user could be matched with, at most
+// limit of them, most recently updated first
+func (rm *Roommates) Candidates(userID, limit int) ([]*RoommateProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, roommateSelect+` WHERE`+visibleRoommate+`
+		ORDER BY r.updated_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []*RoommateProfile
+	for rows.Next() {
+		p, err := scanRoommate(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+
+	return profiles, rows.Err()
+}
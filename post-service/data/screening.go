@@ -0,0 +1,339 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Screening decisions made by an admin on a held post
+const (
+	DecisionApproved = "approved"
+	DecisionRejected = "rejected"
+)
+
+// minComparables is how many similar listings the price check needs before
+// it trusts their median
+const minComparables = 5
+
+// Fingerprint holds the hashes used to find reposted listings
+type Fingerprint struct {
+	PostID      int
+	AuthorID    int
+	TextHash    *uint64
+	ImageHashes []uint64
+}
+
+// ScreeningReason explains one signal that contributed to a post's score
+type ScreeningReason struct {
+	Code          string  `json:"code"`
+	Detail        string  `json:"detail"`
+	Score         float64 `json:"score"`
+	MatchedPostID int     `json:"matchedPostId,omitempty"`
+	Distance      int     `json:"distance,omitempty"`
+}
+
+// PostScreening is the outcome of the duplicate and scam checks on a post
+type PostScreening struct {
+	PostID     int               `json:"postId"`
+	Score      float64           `json:"score"`
+	Flagged    bool              `json:"flagged"`
+	Reasons    []ScreeningReason `json:"reasons"`
+	ScreenedAt time.Time         `json:"screenedAt"`
+	Decision   string            `json:"decision,omitempty"`
+	ReviewedBy *int              `json:"reviewedBy,omitempty"`
+	ReviewedAt *time.Time        `json:"reviewedAt,omitempty"`
+}
+
+// Screened is the fingerprint and screening of a post's new content. Writes
+// given one store it and hold a flagged post for review in the same
+// transaction, before the write's events are queued, so flagged content is
+// never public.
+type Screened struct {
+	Fingerprint Fingerprint
+	Result      PostScreening
+}
+
+// Screening stores fingerprints and screening results
+type Screening struct{}
+
+// Candidates returns the fingerprints of every other post that hasn't been
+// rejected, to compare a new or edited post against
+func (s *Screening) Candidates(excludePostID int) ([]*Fingerprint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT f.post_id, p.author_id, f.text_hash, f.image_hashes
+		FROM post_fingerprints f
+		JOIN posts p ON p.id = f.post_id
+		WHERE f.post_id <> $1 AND p.status <> $2
+	`
+
+	rows, err := db.QueryContext(ctx, query, excludePostID, StatusRejected)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fingerprints []*Fingerprint
+	for rows.Next() {
+		var fp Fingerprint
+		var textHash sql.NullInt64
+		var imageHashes []int64
+
+		if err := rows.Scan(&fp.PostID, &fp.AuthorID, &textHash, pq.Array(&imageHashes)); err != nil {
+			return nil, err
+		}
+
+		if textHash.Valid {
+			h := uint64(textHash.Int64)
+			fp.TextHash = &h
+		}
+		for _, h := range imageHashes {
+			fp.ImageHashes = append(fp.ImageHashes, uint64(h))
+		}
+
+		fingerprints = append(fingerprints, &fp)
+	}
+
+	return fingerprints, rows.Err()
+}
+
+// PriceBaseline returns the median price of published listings comparable
+// to post: same type and bedrooms, in the same neighborhood when there are
+// enough of them, otherwise anywhere. comps is 0 when there isn't enough
+// data to judge.
+func (s *Screening) PriceBaseline(post Post) (median float64, comps int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY price), 0), COUNT(*)
+		FROM posts
+		WHERE status = 'published' AND id <> $1 AND type = $2 AND bedrooms = $3
+			AND ($4 = '' OR neighborhood = $4)
+	`
+
+	for _, neighborhood := range []string{post.Neighborhood, ""} {
+		err = db.QueryRowContext(ctx, query, post.ID, post.Type, post.Bedrooms, neighborhood).Scan(&median, &comps)
+		if err != nil {
+			return 0, 0, err
+		}
+		if comps >= minComparables {
+			return median, comps, nil
+		}
+	}
+
+	return 0, 0, nil
+}
+
+// applyScreening stores the screening of a post just written inside the
+// caller's transaction and holds the post for review if it was flagged and
+// is public. An earlier approval still stands as long as the new content
+// doesn't look worse. post is updated to the held state.
+func applyScreening(ctx context.Context, tx *sql.Tx, post *Post, screened *Screened) error {
+	if screened == nil {
+		return nil
+	}
+
+	fp, result := screened.Fingerprint, screened.Result
+	fp.PostID, fp.AuthorID, result.PostID = post.ID, post.AuthorID, post.ID
+
+	previous, err := scanScreening(tx.QueryRowContext(ctx, `
+		SELECT post_id, score, flagged, reasons, screened_at, decision, reviewed_by, reviewed_at
+		FROM post_screenings
+		WHERE post_id = $1
+		FOR UPDATE
+	`, post.ID))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return err
+	case previous.Decision == DecisionApproved && result.Score <= previous.Score:
+		result.Decision = previous.Decision
+		result.ReviewedBy = previous.ReviewedBy
+		result.ReviewedAt = previous.ReviewedAt
+	}
+
+	if err := saveScreening(ctx, tx, fp, result); err != nil {
+		return err
+	}
+
+	if !result.Flagged || result.Decision == DecisionApproved || !IsPublicStatus(post.Status) {
+		return nil
+	}
+
+	stmt := `UPDATE posts SET status = $1 WHERE id = $2 RETURNING ` + plainPostColumns
+	held, err := scanPlainPost(tx.QueryRowContext(ctx, stmt, StatusPendingReview, post.ID))
+	if err != nil {
+		return err
+	}
+
+	*post = *held
+	return nil
+}
+
+// saveScreening stores a post's fingerprint and screening result inside the
+// caller's transaction, replacing any earlier ones
+func saveScreening(ctx context.Context, tx *sql.Tx, fp Fingerprint, result PostScreening) error {
+	var textHash *int64
+	if fp.TextHash != nil {
+		h := int64(*fp.TextHash)
+		textHash = &h
+	}
+	imageHashes := make([]int64, 0, len(fp.ImageHashes))
+	for _, h := range fp.ImageHashes {
+		imageHashes = append(imageHashes, int64(h))
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO post_fingerprints (post_id, text_hash, image_hashes, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (post_id) DO UPDATE
+		SET text_hash = EXCLUDED.text_hash, image_hashes = EXCLUDED.image_hashes, updated_at = EXCLUDED.updated_at
+	`, fp.PostID, textHash, pq.Array(imageHashes), time.Now())
+	if err != nil {
+		return err
+	}
+
+	reasons, err := json.Marshal(result.Reasons)
+	if err != nil {
+		return err
+	}
+
+	var decision *string
+	if result.Decision != "" {
+		decision = &result.Decision
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO post_screenings (post_id, score, flagged, reasons, screened_at, decision, reviewed_by, reviewed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (post_id) DO UPDATE
+		SET score = EXCLUDED.score, flagged = EXCLUDED.flagged, reasons = EXCLUDED.reasons,
+			screened_at = EXCLUDED.screened_at, decision = EXCLUDED.decision,
+			reviewed_by = EXCLUDED.reviewed_by, reviewed_at = EXCLUDED.reviewed_at
+	`, fp.PostID, result.Score, result.Flagged, string(reasons), result.ScreenedAt, decision, result.ReviewedBy, result.ReviewedAt)
+	return err
+}
+
+// Get returns the screening result of a post
+func (s *Screening) Get(postID int) (*PostScreening, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT post_id, score, flagged, reasons, screened_at, decision, reviewed_by, reviewed_at
+		FROM post_screenings
+		WHERE post_id = $1
+	`
+
+	return scanScreening(db.QueryRowContext(ctx, query, postID))
+}
+
+// GetPending returns flagged posts still held for review, oldest first
+func (s *Screening) GetPending() ([]*PostScreening, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT s.post_id, s.score, s.flagged, s.reasons, s.screened_at, s.decision, s.reviewed_by, s.reviewed_at
+		FROM post_screenings s
+		JOIN posts p ON p.id = s.post_id
+		WHERE s.flagged AND s.decision IS NULL AND p.status = $1
+		ORDER BY s.screened_at
+	`
+
+	rows, err := db.QueryContext(ctx, query, StatusPendingReview)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var screenings []*PostScreening
+	for rows.Next() {
+		screening, err := scanScreening(rows)
+		if err != nil {
+			return nil, err
+		}
+		screenings = append(screenings, screening)
+	}
+
+	return screenings, rows.Err()
+}
+
+// Review records an admin's decision on a held post and moves the post to
+// the matching status in one transaction
+func (s *Screening) Review(postID, reviewerID int, decision, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE post_screenings SET decision = $1, reviewed_by = $2, reviewed_at = $3
+		WHERE post_id = $4
+	`, decision, reviewerID, time.Now(), postID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = changePostStatus(ctx, tx, postID, status)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scanScreening reads one post_screenings row
+func scanScreening(row rowScanner) (*PostScreening, error) {
+	var screening PostScreening
+	var reasons []byte
+	var decision sql.NullString
+	var reviewedBy sql.NullInt64
+	var reviewedAt sql.NullTime
+
+	err := row.Scan(
+		&screening.PostID,
+		&screening.Score,
+		&screening.Flagged,
+		&reasons,
+		&screening.ScreenedAt,
+		&decision,
+		&reviewedBy,
+		&reviewedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(reasons, &screening.Reasons); err != nil {
+		return nil, err
+	}
+
+	screening.Decision = decision.String
+	if reviewedBy.Valid {
+		id := int(reviewedBy.Int64)
+		screening.ReviewedBy = &id
+	}
+	if reviewedAt.Valid {
+		screening.ReviewedAt = &reviewedAt.Time
+	}
+
+	return &screening, nil
+}
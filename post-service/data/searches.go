@@ -0,0 +1,407 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"post-service/event"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Alert frequencies of a saved search
+const (
+	FrequencyInstant = "instant"
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyOff     = "off"
+)
+
+// AlertFrequencies are the frequencies a saved search may have
+var AlertFrequencies = map[string]bool{
+	FrequencyInstant: true,
+	FrequencyDaily:   true,
+	FrequencyWeekly:  true,
+	FrequencyOff:     true,
+}
+
+// ErrSearchLimit is returned when a user already has MaxSavedSearches
+var ErrSearchLimit = errors.New("you have reached the maximum number of saved searches")
+
+// MaxSavedSearches caps the saved searches per user
+const MaxSavedSearches = 20
+
+// SearchCriteria are the filters of a saved search. Unset fields match
+// everything; list fields match any of their values.
+type SearchCriteria struct {
+	MinPrice      *float64 `json:"minPrice,omitempty"`
+	MaxPrice      *float64 `json:"maxPrice,omitempty"`
+	MinBedrooms   *int     `json:"minBedrooms,omitempty"`
+	MaxBedrooms   *int     `json:"maxBedrooms,omitempty"`
+	MinBathrooms  *int     `json:"minBathrooms,omitempty"`
+	Types         []string `json:"types,omitempty"`
+	Neighborhoods []string `json:"neighborhoods,omitempty"`
+	// AvailableFrom and AvailableTo (YYYY-MM-DD) are the dates wanted: one
+	// of the listing's availability periods must overlap them on a day
+	// that isn't blocked
+	AvailableFrom string `json:"availableFrom,omitempty"`
+	AvailableTo   string `json:"availableTo,omitempty"`
+	// Keywords must all appear in the title or description
+	Keywords string `json:"keywords,omitempty"`
+}
+
+// Validate checks the criteria make sense on their own
+func (c *SearchCriteria) Validate() error {
+	if c.MinPrice != nil && c.MaxPrice != nil && *c.MinPrice > *c.MaxPrice {
+		return errors.New("minPrice is above maxPrice")
+	}
+	if c.MinBedrooms != nil && c.MaxBedrooms != nil && *c.MinBedrooms > *c.MaxBedrooms {
+		return errors.New("minBedrooms is above maxBedrooms")
+	}
+
+	var from, to time.Time
+	var err error
+	if c.AvailableFrom != "" {
+		if from, err = time.Parse("2006-01-02", c.AvailableFrom); err != nil {
+			return errors.New("availableFrom must be a YYYY-MM-DD date")
+		}
+	}
+	if c.AvailableTo != "" {
+		if to, err = time.Parse("2006-01-02", c.AvailableTo); err != nil {
+			return errors.New("availableTo must be a YYYY-MM-DD date")
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		return errors.New("availableFrom is after availableTo")
+	}
+
+	if len(c.Keywords) > 200 {
+		return errors.New("keywords must be at most 200 characters")
+	}
+
+	return nil
+}
+
+// Matches reports whether a listing with the given calendar meets every
+// criterion
+func (c *SearchCriteria) Matches(post *Post, calendar *AvailabilityCalendar) bool {
+	if c.MinPrice != nil && post.Price < *c.MinPrice {
+		return false
+	}
+	if c.MaxPrice != nil && post.Price > *c.MaxPrice {
+		return false
+	}
+	if c.MinBedrooms != nil && post.Bedrooms < *c.MinBedrooms {
+		return false
+	}
+	if c.MaxBedrooms != nil && post.Bedrooms > *c.MaxBedrooms {
+		return false
+	}
+	if c.MinBathrooms != nil && post.Bathrooms < *c.MinBathrooms {
+		return false
+	}
+	if len(c.Types) > 0 && !containsFold(c.Types, post.Type) {
+		return false
+	}
+	if len(c.Neighborhoods) > 0 && !containsFold(c.Neighborhoods, post.Neighborhood) {
+		return false
+	}
+
+	if (c.AvailableFrom != "" || c.AvailableTo != "") && !calendar.Available(c.AvailableFrom, c.AvailableTo) {
+		return false
+	}
+
+	text := strings.ToLower(post.Title + " " + post.Description)
+	for _, word := range strings.Fields(strings.ToLower(c.Keywords)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// SavedSearch is a search a user saved to be alerted about new listings
+type SavedSearch struct {
+	ID               int            `json:"id"`
+	UserID           int            `json:"userId"`
+	Name             string         `json:"name"`
+	Criteria         SearchCriteria `json:"criteria"`
+	Frequency        string         `json:"frequency"`
+	UnsubscribeToken string         `json:"-"`
+	LastAlertedAt    time.Time      `json:"lastAlertedAt"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	UpdatedAt        time.Time      `json:"updatedAt"`
+}
+
+// SavedSearches stores saved searches and the listings they matched
+type SavedSearches struct{}
+
+const savedSearchColumns = `
+	id, user_id, name, criteria, frequency, unsubscribe_token,
+	last_alerted_at, created_at, updated_at`
+
+func scanSavedSearch(row rowScanner) (*SavedSearch, error) {
+	var s SavedSearch
+	var criteria []byte
+
+	err := row.Scan(&s.ID, &s.UserID, &s.Name, &criteria, &s.Frequency, &s.UnsubscribeToken,
+		&s.LastAlertedAt, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(criteria, &s.Criteria); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func querySavedSearches(ctx context.Context, query string, args ...any) ([]*SavedSearch, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var searches []*SavedSearch
+	for rows.Next() {
+		s, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, s)
+	}
+
+	return searches, rows.Err()
+}
+
+// GetByUser returns a user's saved searches, newest first
+func (s *SavedSearches) GetByUser(userID int) ([]*SavedSearch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return querySavedSearches(ctx, `
+		SELECT `+savedSearchColumns+` FROM saved_searches
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+	`, userID)
+}
+
+// GetByID returns one saved search
+func (s *SavedSearches) GetByID(id int) (*SavedSearch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return scanSavedSearch(db.QueryRowContext(ctx,
+		`SELECT `+savedSearchColumns+` FROM saved_searches WHERE id = $1`, id))
+}
+
+// GetByUnsubscribeToken returns the search an unsubscribe link points at
+func (s *SavedSearches) GetByUnsubscribeToken(token string) (*SavedSearch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return scanSavedSearch(db.QueryRowContext(ctx,
+		`SELECT `+savedSearchColumns+` FROM saved_searches WHERE unsubscribe_token = $1`, token))
+}
+
+// Insert saves a search and returns its ID. It returns ErrSearchLimit when
+// the user already has MaxSavedSearches.
+func (s *SavedSearches) Insert(search SavedSearch) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	criteria, err := json.Marshal(search.Criteria)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO saved_searches (user_id, name, criteria, frequency, unsubscribe_token)
+		SELECT $1::int, $2::text, $3::jsonb, $4::text, $5::text
+		WHERE (SELECT COUNT(*) FROM saved_searches WHERE user_id = $1) < $6
+		RETURNING id
+	`, search.UserID, search.Name, string(criteria), search.Frequency, search.UnsubscribeToken, MaxSavedSearches).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrSearchLimit
+	}
+
+	return id, err
+}
+
+// Update saves a search's name, criteria and frequency
+func (s *SavedSearches) Update(search SavedSearch) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	criteria, err := json.Marshal(search.Criteria)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		UPDATE saved_searches
+		SET name = $1, criteria = $2, frequency = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, search.Name, string(criteria), search.Frequency, search.ID)
+	return err
+}
+
+// Delete removes a saved search and its matches
+func (s *SavedSearches) Delete(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM saved_searches WHERE id = $1`, id)
+	return err
+}
+
+// Unsubscribe turns off alerts for the search with the given token and
+// returns it
+func (s *SavedSearches) Unsubscribe(token string) (*SavedSearch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return scanSavedSearch(db.QueryRowContext(ctx, `
+		UPDATE saved_searches SET frequency = 'off', updated_at = CURRENT_TIMESTAMP
+		WHERE unsubscribe_token = $1
+		RETURNING `+savedSearchColumns, token))
+}
+
+// RecordMatches evaluates a listing against every saved search with alerts
+// on, except its author's, and records the ones it matches. A listing is
+// recorded once per search however often it is offered, so redelivered
+// events and relisted posts don't alert twice. It returns how many new
+// matches were recorded.
+func (s *SavedSearches) RecordMatches(post *Post) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	searches, err := querySavedSearches(ctx, `
+		SELECT `+savedSearchColumns+` FROM saved_searches
+		WHERE frequency <> 'off' AND user_id <> $1
+	`, post.AuthorID)
+	if err != nil {
+		return 0, err
+	}
+
+	calendar, err := (&Availability{}).Get(post.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	recorded := 0
+	for _, search := range searches {
+		if !search.Criteria.Matches(post, calendar) {
+			continue
+		}
+
+		res, err := db.ExecContext(ctx, `
+			INSERT INTO saved_search_matches (search_id, post_id) VALUES ($1, $2)
+			ON CONFLICT (search_id, post_id) DO NOTHING
+		`, search.ID, post.ID)
+		if err != nil {
+			return recorded, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			recorded++
+		}
+	}
+
+	return recorded, nil
+}
+
+// Due returns the searches with matches waiting to be sent whose alert is
+// due at now: instant ones always, daily and weekly ones once a day or a
+// week has passed since their last alert
+func (s *SavedSearches) Due(now time.Time) ([]*SavedSearch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return querySavedSearches(ctx, `
+		SELECT `+savedSearchColumns+` FROM saved_searches ss
+		WHERE EXISTS (
+				SELECT 1 FROM saved_search_matches m
+				WHERE m.search_id = ss.id AND m.alerted_at IS NULL
+			)
+			AND (
+				frequency = 'instant'
+				OR (frequency = 'daily' AND last_alerted_at <= $1::timestamp - INTERVAL '1 day')
+				OR (frequency = 'weekly' AND last_alerted_at <= $1::timestamp - INTERVAL '7 days')
+			)
+		ORDER BY last_alerted_at
+	`, now)
+}
+
+// PendingMatches returns the listings a search matched that the user hasn't
+// been told about, oldest first. Listings that are no longer published are
+// included so the caller can mark them as handled.
+func (s *SavedSearches) PendingMatches(searchID int) ([]*PostWithAuthor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return queryPosts(ctx, `
+		SELECT `+postColumns+`
+		FROM saved_search_matches m
+		JOIN posts p ON p.id = m.post_id `+postAuthorJoins+`
+		WHERE m.search_id = $1 AND m.alerted_at IS NULL
+		ORDER BY m.matched_at, p.id
+	`, searchID)
+}
+
+// MarkAlerted marks the given matches as sent and, in the same transaction,
+// queues the alert for the mail pipeline when there is one. It returns false
+// without queueing anything when another worker sent them first.
+func (s *SavedSearches) MarkAlerted(searchID int, postIDs []int, alert *event.NotificationEvent) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE saved_search_matches SET alerted_at = $1
+		WHERE search_id = $2 AND post_id = ANY($3) AND alerted_at IS NULL
+	`, now, searchID, pq.Array(postIDs))
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, err
+	} else if int(n) != len(postIDs) {
+		return false, nil
+	}
+
+	if alert != nil {
+		_, err = tx.ExecContext(ctx,
+			`UPDATE saved_searches SET last_alerted_at = $1 WHERE id = $2`, now, searchID)
+		if err != nil {
+			return false, err
+		}
+
+		if err := enqueueEvent(ctx, tx, event.RoutingNotification, alert); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
@@ -0,0 +1,468 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"post-service/event"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// Viewing booking statuses
+const (
+	BookingConfirmed = "confirmed"
+	BookingCancelled = "cancelled"
+)
+
+var (
+	// ErrSlotTaken is returned when someone else holds the slot
+	ErrSlotTaken = errors.New("this viewing slot is already booked")
+	// ErrAlreadyBooked is returned when the renter already holds a viewing
+	// of the listing
+	ErrAlreadyBooked = errors.New("you already have a viewing booked for this listing")
+	// ErrSlotOverlap is returned when new slots overlap each other or
+	// existing ones
+	ErrSlotOverlap = errors.New("viewing slots can't overlap")
+	// ErrSlotBooked is returned when deleting a slot that is booked
+	ErrSlotBooked = errors.New("the slot is booked; cancel the booking first")
+	// ErrBookingClosed is returned when changing a cancelled booking
+	ErrBookingClosed = errors.New("the booking has been cancelled")
+)
+
+// ViewingSlot is a time an owner offers for viewing a listing
+type ViewingSlot struct {
+	ID        int       `json:"id"`
+	PostID    int       `json:"postId"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	Available bool      `json:"available"`
+	// BookingID is only shown to the owner
+	BookingID *int `json:"bookingId,omitempty"`
+}
+
+// ViewingBooking is a renter's booking of a slot, with what both sides
+// need to know about it
+type ViewingBooking struct {
+	ID           int         `json:"id"`
+	SlotID       int         `json:"slotId"`
+	PostID       int         `json:"postId"`
+	PostTitle    string      `json:"postTitle"`
+	PostLocation string      `json:"postLocation"`
+	Neighborhood string      `json:"neighborhood"`
+	StartsAt     time.Time   `json:"startsAt"`
+	EndsAt       time.Time   `json:"endsAt"`
+	Status       string      `json:"status"`
+	Sequence     int         `json:"-"`
+	Renter       Participant `json:"renter"`
+	Landlord     Participant `json:"landlord"`
+	CancelledBy  *int        `json:"cancelledBy,omitempty"`
+	CancelledAt  *time.Time  `json:"cancelledAt,omitempty"`
+	CreatedAt    time.Time   `json:"createdAt"`
+}
+
+// IsParticipant reports whether the user is the renter or the landlord
+func (b *ViewingBooking) IsParticipant(userID int) bool {
+	return b.Renter.ID == userID || b.Landlord.ID == userID
+}
+
+// BookingNotices builds the notifications for a booking once a change to it
+// is made, so they can be queued in the same transaction
+type BookingNotices func(*ViewingBooking) ([]event.NotificationEvent, error)
+
+// Viewings stores viewing slots and their bookings
+type Viewings struct{}
+
+// bookingSelect is the query read by scanBooking
+const bookingSelect = `
+	SELECT b.id, b.slot_id, b.post_id, p.title, COALESCE(p.location, ''), p.neighborhood,
+		s.starts_at, s.ends_at, b.status, b.sequence, b.cancelled_by, b.cancelled_at, b.created_at,
+		b.renter_id, r.first_name, r.last_name, p.author_id, l.first_name, l.last_name
+	FROM viewing_bookings b
+	JOIN viewing_slots s ON s.id = b.slot_id
+	JOIN posts p ON p.id = b.post_id
+	JOIN users r ON r.id = b.renter_id
+	JOIN users l ON l.id = p.author_id`
+
+func scanBooking(row rowScanner) (*ViewingBooking, error) {
+	var b ViewingBooking
+	var renterFirst, renterLast, landlordFirst, landlordLast string
+	var cancelledBy sql.NullInt64
+	var cancelledAt sql.NullTime
+
+	err := row.Scan(&b.ID, &b.SlotID, &b.PostID, &b.PostTitle, &b.PostLocation, &b.Neighborhood,
+		&b.StartsAt, &b.EndsAt, &b.Status, &b.Sequence, &cancelledBy, &cancelledAt, &b.CreatedAt,
+		&b.Renter.ID, &renterFirst, &renterLast, &b.Landlord.ID, &landlordFirst, &landlordLast)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Renter.Name = renterFirst + " " + renterLast
+	b.Renter.Role = "renter"
+	b.Landlord.Name = landlordFirst + " " + landlordLast
+	b.Landlord.Role = "landlord"
+	if cancelledBy.Valid {
+		id := int(cancelledBy.Int64)
+		b.CancelledBy = &id
+	}
+	if cancelledAt.Valid {
+		b.CancelledAt = &cancelledAt.Time
+	}
+
+	return &b, nil
+}
+
+// Slots returns a listing's slots that haven't ended yet, earliest first
+func (v *Viewings) Slots(postID int) ([]*ViewingSlot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT s.id, s.post_id, s.starts_at, s.ends_at, b.id
+		FROM viewing_slots s
+		LEFT JOIN viewing_bookings b ON b.slot_id = s.id AND b.status = 'confirmed'
+		WHERE s.post_id = $1 AND s.ends_at > $2
+		ORDER BY s.starts_at
+	`, postID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	slots := []*ViewingSlot{}
+	for rows.Next() {
+		var s ViewingSlot
+		var bookingID sql.NullInt64
+		if err := rows.Scan(&s.ID, &s.PostID, &s.StartsAt, &s.EndsAt, &bookingID); err != nil {
+			return nil, err
+		}
+		s.Available = !bookingID.Valid
+		if bookingID.Valid {
+			id := int(bookingID.Int64)
+			s.BookingID = &id
+		}
+		slots = append(slots, &s)
+	}
+
+	return slots, rows.Err()
+}
+
+// GetSlot returns a single slot
+func (v *Viewings) GetSlot(id int) (*ViewingSlot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var s ViewingSlot
+	var booked bool
+	err := db.QueryRowContext(ctx, `
+		SELECT s.id, s.post_id, s.starts_at, s.ends_at,
+			EXISTS (SELECT 1 FROM viewing_bookings b WHERE b.slot_id = s.id AND b.status = 'confirmed')
+		FROM viewing_slots s
+		WHERE s.id = $1
+	`, id).Scan(&s.ID, &s.PostID, &s.StartsAt, &s.EndsAt, &booked)
+	if err != nil {
+		return nil, err
+	}
+	s.Available = !booked
+
+	return &s, nil
+}
+
+// AddSlots adds slots to a listing. The post row is locked so concurrent
+// calls can't create overlapping slots.
+func (v *Viewings) AddSlots(postID int, slots []*ViewingSlot) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT id FROM posts WHERE id = $1 FOR UPDATE`, postID); err != nil {
+		return err
+	}
+
+	for _, s := range slots {
+		var overlap bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM viewing_slots
+				WHERE post_id = $1 AND starts_at < $3 AND ends_at > $2
+			)
+		`, postID, s.StartsAt, s.EndsAt).Scan(&overlap)
+		if err != nil {
+			return err
+		}
+		if overlap {
+			return ErrSlotOverlap
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO viewing_slots (post_id, starts_at, ends_at, created_at)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, postID, s.StartsAt, s.EndsAt, time.Now()).Scan(&s.ID)
+		if err != nil {
+			return err
+		}
+		s.PostID = postID
+		s.Available = true
+	}
+
+	return tx.Commit()
+}
+
+// DeleteSlot removes a slot that isn't booked
+func (v *Viewings) DeleteSlot(postID, slotID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var booked bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM viewing_bookings b WHERE b.slot_id = s.id AND b.status = 'confirmed')
+		FROM viewing_slots s
+		WHERE s.id = $1 AND s.post_id = $2
+		FOR UPDATE
+	`, slotID, postID).Scan(&booked)
+	if err != nil {
+		return err
+	}
+	if booked {
+		return ErrSlotBooked
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM viewing_slots WHERE id = $1`, slotID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Book books a slot for a renter and queues the notices in the same
+// transaction. The unique indexes on viewing_bookings turn a race for the
+// same slot into ErrSlotTaken.
+func (v *Viewings) Book(slotID, postID, renterID int, notices BookingNotices) (*ViewingBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO viewing_bookings (slot_id, post_id, renter_id, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		RETURNING id
+	`, slotID, postID, renterID, BookingConfirmed, now).Scan(&id)
+	if err != nil {
+		return nil, bookingConflict(err)
+	}
+
+	return finishBookingChange(ctx, tx, id, notices)
+}
+
+// Reschedule moves a confirmed booking to another slot of the same listing
+func (v *Viewings) Reschedule(bookingID, slotID int, notices BookingNotices) (*ViewingBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE viewing_bookings
+		SET slot_id = $1, sequence = sequence + 1, reminder_sent_at = NULL, updated_at = $2
+		WHERE id = $3 AND status = 'confirmed'
+	`, slotID, time.Now(), bookingID)
+	if err != nil {
+		return nil, bookingConflict(err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrBookingClosed
+	}
+
+	return finishBookingChange(ctx, tx, bookingID, notices)
+}
+
+// Cancel cancels a confirmed booking, which frees its slot
+func (v *Viewings) Cancel(bookingID, cancelledBy int, notices BookingNotices) (*ViewingBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE viewing_bookings
+		SET status = $1, sequence = sequence + 1, cancelled_by = $2, cancelled_at = $3, updated_at = $3
+		WHERE id = $4 AND status = 'confirmed'
+	`, BookingCancelled, cancelledBy, now, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrBookingClosed
+	}
+
+	return finishBookingChange(ctx, tx, bookingID, notices)
+}
+
+// finishBookingChange reads the changed booking, queues its notices and
+// commits
+func finishBookingChange(ctx context.Context, tx *sql.Tx, bookingID int, notices BookingNotices) (*ViewingBooking, error) {
+	booking, err := scanBooking(tx.QueryRowContext(ctx, bookingSelect+` WHERE b.id = $1`, bookingID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := queueBookingNotices(ctx, tx, booking, notices); err != nil {
+		return nil, err
+	}
+
+	return booking, tx.Commit()
+}
+
+func queueBookingNotices(ctx context.Context, tx *sql.Tx, booking *ViewingBooking, notices BookingNotices) error {
+	if notices == nil {
+		return nil
+	}
+
+	events, err := notices(booking)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if err := enqueueEvent(ctx, tx, event.RoutingNotification, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bookingConflict maps unique index violations on viewing_bookings to
+// errors callers can show
+func bookingConflict(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return err
+	}
+	if pgErr.ConstraintName == "idx_viewing_bookings_renter" {
+		return ErrAlreadyBooked
+	}
+	return ErrSlotTaken
+}
+
+// GetBooking returns a single booking
+func (v *Viewings) GetBooking(id int) (*ViewingBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return scanBooking(db.QueryRowContext(ctx, bookingSelect+` WHERE b.id = $1`, id))
+}
+
+// BookingsForUser returns the bookings the user takes part in, as renter
+// or landlord, whose slot hasn't ended, earliest first
+func (v *Viewings) BookingsForUser(userID int) ([]*ViewingBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, bookingSelect+`
+		WHERE (b.renter_id = $1 OR p.author_id = $1) AND s.ends_at > $2
+		ORDER BY s.starts_at, b.id
+	`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookings := []*ViewingBooking{}
+	for rows.Next() {
+		b, err := scanBooking(rows)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, b)
+	}
+
+	return bookings, rows.Err()
+}
+
+// SendReminders queues reminders for confirmed bookings starting within
+// the lead time that haven't had one, up to limit at a time. Rows are
+// locked with SKIP LOCKED so replicas don't remind twice.
+func (v *Viewings) SendReminders(lead time.Duration, limit int, notices BookingNotices) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	rows, err := tx.QueryContext(ctx, bookingSelect+`
+		WHERE b.status = 'confirmed' AND b.reminder_sent_at IS NULL
+			AND s.starts_at > $1 AND s.starts_at <= $2
+		ORDER BY s.starts_at
+		LIMIT $3
+		FOR UPDATE OF b SKIP LOCKED
+	`, now, now.Add(lead), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var due []*ViewingBooking
+	for rows.Next() {
+		b, err := scanBooking(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, b := range due {
+		_, err := tx.ExecContext(ctx, `UPDATE viewing_bookings SET reminder_sent_at = $1 WHERE id = $2`, now, b.ID)
+		if err != nil {
+			return 0, err
+		}
+		if err := queueBookingNotices(ctx, tx, b, notices); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(due), tx.Commit()
+}
@@ -0,0 +1,57 @@
+package event
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Consume binds a durable queue to the routing keys on the app events
+// exchange and hands every delivery to handle until the channel closes. A
+// delivery is acked when handle returns nil and requeued otherwise.
+func Consume(conn *amqp.Connection, queue string, routingKeys []string, handle func(amqp.Delivery) error) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	if err := declareAppExchange(ch); err != nil {
+		return err
+	}
+
+	q, err := ch.QueueDeclare(
+		queue, // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range routingKeys {
+		if err := ch.QueueBind(q.Name, key, ExchangeApp, false, nil); err != nil {
+			return err
+		}
+	}
+
+	if err := ch.Qos(10, 0, false); err != nil {
+		return err
+	}
+
+	messages, err := ch.Consume(q.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	for d := range messages {
+		if err := handle(d); err != nil {
+			d.Nack(false, true)
+		} else {
+			d.Ack(false)
+		}
+	}
+
+	return amqp.ErrClosed
+}
@@ -0,0 +1,144 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Emitter handles publishing events to RabbitMQ
+type Emitter struct {
+	connection *amqp.Connection
+}
+
+// PostEvent is published on post.created, post.updated, post.deleted and
+// post.status_changed. Before is null for created and After is null for
+// deleted; both hold the full post otherwise.
+type PostEvent struct {
+	Type       string    `json:"type"`
+	PostID     int       `json:"post_id"`
+	AuthorID   int       `json:"author_id"`
+	Changed    []string  `json:"changed,omitempty"` // JSON names of the fields an update changed
+	OldStatus  string    `json:"old_status,omitempty"`
+	NewStatus  string    `json:"new_status,omitempty"`
+	Before     any       `json:"before"`
+	After      any       `json:"after"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// PriceChangedEvent is published when a post's asking price changes
+type PriceChangedEvent struct {
+	PostID    int       `json:"post_id"`
+	AuthorID  int       `json:"author_id"`
+	Title     string    `json:"title"`
+	OldPrice  float64   `json:"old_price"`
+	NewPrice  float64   `json:"new_price"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// NotificationEvent is a message for one user. Email is filled in when the
+// publisher knows it so the listener can deliver it by mail.
+type NotificationEvent struct {
+	UserID  int    `json:"user_id"`
+	Email   string `json:"email,omitempty"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Type    string `json:"type"`
+
+	// Attachments are mailed along with the message, e.g. calendar invites
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Headers are added to the mail, e.g. List-Unsubscribe
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Attachment is a file attached to a notification mail
+type Attachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Data        []byte `json:"data"`
+}
+
+// ConfirmedPublisher publishes on a channel in confirm mode, so a publish
+// only succeeds once RabbitMQ has taken responsibility for the message
+type ConfirmedPublisher struct {
+	channel *amqp.Channel
+}
+
+// setup initializes the emitter by declaring the app exchange
+func (e *Emitter) setup() error {
+	channel, err := e.connection.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	return declareAppExchange(channel)
+}
+
+// Confirmed opens a channel in confirm mode. Close it when done.
+func (e *Emitter) Confirmed() (*ConfirmedPublisher, error) {
+	channel, err := e.connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := channel.Confirm(false); err != nil {
+		channel.Close()
+		return nil, err
+	}
+
+	return &ConfirmedPublisher{channel: channel}, nil
+}
+
+// Publish sends an encoded event to the app events exchange and waits for
+// the broker's ack. messageID lets consumers drop redelivered duplicates.
+func (p *ConfirmedPublisher) Publish(ctx context.Context, routingKey, messageID string, body []byte) error {
+	confirmation, err := p.channel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		ExchangeApp, // exchange
+		routingKey,  // routing key
+		false,       // mandatory
+		false,       // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			Body:         body,
+			DeliveryMode: amqp.Persistent, // Message survives broker restart
+			MessageId:    messageID,
+			Timestamp:    time.Now(),
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errors.New("message was nacked by the broker")
+	}
+
+	return nil
+}
+
+// Close closes the publisher's channel
+func (p *ConfirmedPublisher) Close() error {
+	return p.channel.Close()
+}
+
+// NewEventEmitter creates a new Emitter instance
+func NewEventEmitter(conn *amqp.Connection) (Emitter, error) {
+	emitter := Emitter{
+		connection: conn,
+	}
+
+	err := emitter.setup()
+	if err != nil {
+		return Emitter{}, err
+	}
+
+	return emitter, nil
+}
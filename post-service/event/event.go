@@ -0,0 +1,33 @@
+package event
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Exchange names
+const (
+	ExchangeApp = "app_events" // For application events (mail, notifications, etc.)
+)
+
+// Routing keys for post events
+const (
+	RoutingPostCreated       = "post.created"
+	RoutingPostUpdated       = "post.updated"
+	RoutingPostDeleted       = "post.deleted"
+	RoutingPostStatusChanged = "post.status_changed"
+	RoutingPostPriceChanged  = "post.price_changed"
+	RoutingNotification      = "notification.send"
+)
+
+// declareAppExchange declares the app events exchange
+func declareAppExchange(ch *amqp.Channel) error {
+	return ch.ExchangeDeclare(
+		ExchangeApp, // name
+		"topic",     // type
+		true,        // durable?
+		false,       // auto-deleted?
+		false,       // internal?
+		false,       // no-wait?
+		nil,         // arguments?
+	)
+}
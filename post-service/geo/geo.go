@@ -0,0 +1,133 @@
+// Package geo reads GeoJSON polygon boundaries and tests whether a point
+// falls inside them
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Position is a GeoJSON position: longitude first, then latitude
+type Position [2]float64
+
+// Ring is a closed line of positions
+type Ring []Position
+
+// Polygon is an outer ring followed by the rings of any holes in it
+type Polygon []Ring
+
+// Shape is the area of a GeoJSON Polygon or MultiPolygon
+type Shape struct {
+	Polygons []Polygon
+}
+
+// ParseGeometry reads a GeoJSON geometry object, which must be a Polygon or
+// a MultiPolygon
+func ParseGeometry(raw []byte) (*Shape, error) {
+	var geometry struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal(raw, &geometry); err != nil {
+		return nil, fmt.Errorf("invalid geometry: %v", err)
+	}
+
+	var coords [][][][]float64
+	switch geometry.Type {
+	case "Polygon":
+		var polygon [][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &polygon); err != nil {
+			return nil, fmt.Errorf("invalid Polygon coordinates: %v", err)
+		}
+		coords = [][][][]float64{polygon}
+	case "MultiPolygon":
+		if err := json.Unmarshal(geometry.Coordinates, &coords); err != nil {
+			return nil, fmt.Errorf("invalid MultiPolygon coordinates: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("geometry must be a Polygon or MultiPolygon, not %q", geometry.Type)
+	}
+
+	shape := &Shape{}
+	for _, polygon := range coords {
+		if len(polygon) == 0 {
+			return nil, errors.New("a polygon needs an outer ring")
+		}
+
+		var p Polygon
+		for _, ring := range polygon {
+			if len(ring) < 4 {
+				return nil, errors.New("a ring needs at least four positions")
+			}
+
+			r := make(Ring, 0, len(ring))
+			for _, pos := range ring {
+				if len(pos) < 2 {
+					return nil, errors.New("a position needs a longitude and a latitude")
+				}
+				if pos[0] < -180 || pos[0] > 180 || pos[1] < -90 || pos[1] > 90 {
+					return nil, fmt.Errorf("position %v is out of range", pos)
+				}
+				r = append(r, Position{pos[0], pos[1]})
+			}
+			if r[0] != r[len(r)-1] {
+				return nil, errors.New("a ring must end where it starts")
+			}
+			p = append(p, r)
+		}
+		shape.Polygons = append(shape.Polygons, p)
+	}
+
+	if len(shape.Polygons) == 0 {
+		return nil, errors.New("a MultiPolygon needs at least one polygon")
+	}
+
+	return shape, nil
+}
+
+// Contains reports whether the point lies inside the shape and outside its
+// holes
+func (s *Shape) Contains(lat, lng float64) bool {
+	for _, polygon := range s.Polygons {
+		if !polygon[0].contains(lat, lng) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if hole.contains(lat, lng) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// contains casts a ray east from the point and counts the edges it crosses;
+// an odd count means the point is inside
+func (r Ring) contains(lat, lng float64) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a[1] > lat) != (b[1] > lat) && lng < (b[0]-a[0])*(lat-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Bounds returns the smallest latitude/longitude box around the shape
+func (s *Shape) Bounds() (minLat, minLng, maxLat, maxLng float64) {
+	minLat, minLng, maxLat, maxLng = 90, 180, -90, -180
+	for _, polygon := range s.Polygons {
+		for _, pos := range polygon[0] {
+			minLng, maxLng = min(minLng, pos[0]), max(maxLng, pos[0])
+			minLat, maxLat = min(minLat, pos[1]), max(maxLat, pos[1])
+		}
+	}
+	return minLat, minLng, maxLat, maxLng
+}
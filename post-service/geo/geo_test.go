@@ -0,0 +1,128 @@
+package geo
+
+import (
+	"strings"
+	"testing"
+)
+
+// square is a closed ring from (lng0, lat0) to (lng1, lat1)
+func square(lng0, lat0, lng1, lat1 float64) Ring {
+	return Ring{{lng0, lat0}, {lng1, lat0}, {lng1, lat1}, {lng0, lat1}, {lng0, lat0}}
+}
+
+func TestRingContains(t *testing.T) {
+	// An L shape: the 0..4 square without its 2..4 x 2..4 corner
+	ell := Ring{{0, 0}, {4, 0}, {4, 2}, {2, 2}, {2, 4}, {0, 4}, {0, 0}}
+
+	tests := []struct {
+		name     string
+		ring     Ring
+		lat, lng float64
+		want     bool
+	}{
+		{name: "inside a square", ring: square(0, 0, 4, 4), lat: 2, lng: 2, want: true},
+		{name: "east of a square", ring: square(0, 0, 4, 4), lat: 2, lng: 5, want: false},
+		{name: "west of a square", ring: square(0, 0, 4, 4), lat: 2, lng: -1, want: false},
+		{name: "north of a square", ring: square(0, 0, 4, 4), lat: 5, lng: 2, want: false},
+		{name: "south of a square", ring: square(0, 0, 4, 4), lat: -1, lng: 2, want: false},
+		{name: "near a corner inside", ring: square(0, 0, 4, 4), lat: 3.99, lng: 3.99, want: true},
+		{name: "in the arm of an L", ring: ell, lat: 1, lng: 3, want: true},
+		{name: "in the notch of an L", ring: ell, lat: 3, lng: 3, want: false},
+		{name: "level with a vertex of an L", ring: ell, lat: 2, lng: 1, want: true},
+		{name: "clockwise ring", ring: Ring{{0, 0}, {0, 4}, {4, 4}, {4, 0}, {0, 0}}, lat: 1, lng: 1, want: true},
+		{
+			name: "Davis coordinates",
+			ring: square(-121.78, 38.53, -121.70, 38.58),
+			lat:  38.5449, lng: -121.7405,
+			want: true,
+		},
+		{
+			name: "outside Davis",
+			ring: square(-121.78, 38.53, -121.70, 38.58),
+			lat:  38.5816, lng: -121.4944,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ring.contains(tt.lat, tt.lng); got != tt.want {
+				t.Errorf("contains(%v, %v) = %v, want %v", tt.lat, tt.lng, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShapeContains(t *testing.T) {
+	// A 0..10 square with a 4..6 hole, and a separate 20..22 island
+	shape := &Shape{Polygons: []Polygon{
+		{square(0, 0, 10, 10), square(4, 4, 6, 6)},
+		{square(20, 20, 22, 22)},
+	}}
+
+	tests := []struct {
+		name     string
+		lat, lng float64
+		want     bool
+	}{
+		{name: "in the outer ring", lat: 2, lng: 2, want: true},
+		{name: "in the hole", lat: 5, lng: 5, want: false},
+		{name: "between the hole and the edge", lat: 5, lng: 8, want: true},
+		{name: "in the second polygon", lat: 21, lng: 21, want: true},
+		{name: "between the polygons", lat: 15, lng: 15, want: false},
+		{name: "outside everything", lat: -5, lng: -5, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shape.Contains(tt.lat, tt.lng); got != tt.want {
+				t.Errorf("Contains(%v, %v) = %v, want %v", tt.lat, tt.lng, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGeometry(t *testing.T) {
+	tests := []struct {
+		name         string
+		raw          string
+		wantPolygons int
+		wantErr      string
+	}{
+		{
+			name:         "polygon with a hole",
+			raw:          `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[4,4],[6,4],[6,6],[4,6],[4,4]]]}`,
+			wantPolygons: 1,
+		},
+		{
+			name:         "multipolygon",
+			raw:          `{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]],[[[2,2],[3,2],[3,3],[2,2]]]]}`,
+			wantPolygons: 2,
+		},
+		{name: "point", raw: `{"type":"Point","coordinates":[0,0]}`, wantErr: "must be a Polygon or MultiPolygon"},
+		{name: "open ring", raw: `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1]]]}`, wantErr: "must end where it starts"},
+		{name: "too few positions", raw: `{"type":"Polygon","coordinates":[[[0,0],[1,0],[0,0]]]}`, wantErr: "at least four positions"},
+		{name: "out of range", raw: `{"type":"Polygon","coordinates":[[[0,0],[190,0],[1,1],[0,0]]]}`, wantErr: "out of range"},
+		{name: "no rings", raw: `{"type":"Polygon","coordinates":[]}`, wantErr: "needs an outer ring"},
+		{name: "empty multipolygon", raw: `{"type":"MultiPolygon","coordinates":[]}`, wantErr: "at least one polygon"},
+		{name: "not JSON", raw: `{`, wantErr: "invalid geometry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shape, err := ParseGeometry([]byte(tt.raw))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseGeometry() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseGeometry() error = %v", err)
+			}
+			if len(shape.Polygons) != tt.wantPolygons {
+				t.Errorf("got %d polygons, want %d", len(shape.Polygons), tt.wantPolygons)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS posts (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    price DECIMAL(10, 2) NOT NULL,
+    location VARCHAR(255),
+    neighborhood VARCHAR(255) NOT NULL,
+    lat DECIMAL(10, 7) NOT NULL,
+    lng DECIMAL(10, 7) NOT NULL,
+    radius INT DEFAULT 300,
+    type VARCHAR(50) NOT NULL,
+    image_url TEXT,
+    additional_images TEXT[],
+    description TEXT,
+    bedrooms INT DEFAULT 1,
+    bathrooms INT DEFAULT 1,
+    available_from TIMESTAMP,
+    available_to TIMESTAMP,
+    author_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_posts_author_id ON posts(author_id);
+CREATE INDEX IF NOT EXISTS idx_posts_neighborhood ON posts(neighborhood);
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts(created_at DESC);
@@ -0,0 +1,6 @@
+-- Bumped on every write, used for ETag / If-Match
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+-- published, pending_review, rejected, hidden, removed
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'published';
+
+CREATE INDEX IF NOT EXISTS idx_posts_status ON posts(status);
@@ -0,0 +1,15 @@
+-- Post revisions: one row per insert / update / delete / restore of a post.
+-- No foreign key on post_id so history survives the post being deleted.
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL,
+    author_id INT NOT NULL,
+    actor_id INT NOT NULL,
+    action VARCHAR(20) NOT NULL, -- create, update, delete, restore
+    changes JSONB NOT NULL DEFAULT '{}', -- {"field": {"old": ..., "new": ...}}
+    snapshot JSONB NOT NULL, -- full post after the change (before it, for delete)
+    restored_from INT REFERENCES post_revisions(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_revisions_post_id ON post_revisions(post_id, created_at DESC);
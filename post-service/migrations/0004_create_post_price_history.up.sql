@@ -0,0 +1,10 @@
+-- Price history: one row per distinct asking price of a post. Kept after
+-- the post is deleted, like post_revisions.
+CREATE TABLE IF NOT EXISTS post_price_history (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL,
+    price DECIMAL(10, 2) NOT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_price_history_post_id ON post_price_history(post_id, changed_at);
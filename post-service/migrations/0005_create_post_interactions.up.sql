@@ -0,0 +1,12 @@
+-- Listing analytics: detail views and contact clicks, at most one row per
+-- viewer ("user:<id>" or "session:<id>") per post per kind per day
+CREATE TABLE IF NOT EXISTS post_interactions (
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    viewer_key VARCHAR(100) NOT NULL,
+    day DATE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, kind, viewer_key, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_interactions_post_day ON post_interactions(post_id, day);
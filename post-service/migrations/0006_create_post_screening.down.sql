@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS post_screenings;
+DROP TABLE IF EXISTS post_fingerprints;
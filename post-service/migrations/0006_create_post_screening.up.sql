@@ -0,0 +1,22 @@
+-- Duplicate / scam screening: perceptual hashes of a post's photos and a
+-- SimHash of its description, compared against other posts on every write
+CREATE TABLE IF NOT EXISTS post_fingerprints (
+    post_id INT PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+    text_hash BIGINT,
+    image_hashes BIGINT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Latest screening result per post; flagged posts wait for a moderator decision
+CREATE TABLE IF NOT EXISTS post_screenings (
+    post_id INT PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+    score DECIMAL(4, 2) NOT NULL,
+    flagged BOOLEAN NOT NULL,
+    reasons JSONB NOT NULL DEFAULT '[]', -- [{"code", "detail", "score", "matchedPostId", "distance"}]
+    screened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    decision VARCHAR(20), -- approved, rejected
+    reviewed_by INT REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_screenings_pending ON post_screenings(screened_at) WHERE flagged AND decision IS NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS moderation_decisions;
+DROP TABLE IF EXISTS post_reports;
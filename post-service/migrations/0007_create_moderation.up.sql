@@ -0,0 +1,31 @@
+-- User reports on listings, reviewed by moderators in the moderation queue
+CREATE TABLE IF NOT EXISTS post_reports (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    reporter_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL, -- scam, fake, offensive, duplicate, wrong_info, other
+    details TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, resolved, dismissed
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_by INT REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP
+);
+
+-- One open report per user per post
+CREATE UNIQUE INDEX IF NOT EXISTS idx_post_reports_open ON post_reports(post_id, reporter_id) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS idx_post_reports_status ON post_reports(status, created_at);
+
+-- Every moderation action taken on a listing or its author
+CREATE TABLE IF NOT EXISTS moderation_decisions (
+    id SERIAL PRIMARY KEY,
+    report_id INT REFERENCES post_reports(id) ON DELETE SET NULL,
+    post_id INT NOT NULL,
+    user_id INT NOT NULL, -- the listing's author
+    action VARCHAR(20) NOT NULL, -- dismiss, hide, unhide, remove, warn, suspend
+    note TEXT NOT NULL DEFAULT '',
+    moderator_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_decisions_post ON moderation_decisions(post_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_moderation_decisions_user ON moderation_decisions(user_id, created_at DESC);
@@ -0,0 +1,13 @@
+-- Transactional outbox: events are inserted in the same transaction as the
+-- post change and published to RabbitMQ by the relay afterwards
+CREATE TABLE IF NOT EXISTS post_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    routing_key VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_outbox_unpublished ON post_outbox(id) WHERE published_at IS NULL;
@@ -0,0 +1,25 @@
+-- Searches users saved to be told about new matching listings
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    criteria JSONB NOT NULL DEFAULT '{}', -- see data.SearchCriteria
+    frequency VARCHAR(10) NOT NULL DEFAULT 'daily', -- instant, daily, weekly, off
+    unsubscribe_token VARCHAR(64) NOT NULL UNIQUE,
+    last_alerted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- digests are sent a day or a week after this
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_searches_user ON saved_searches(user_id);
+
+-- Listings that matched a saved search; alerted_at is set once the user was told
+CREATE TABLE IF NOT EXISTS saved_search_matches (
+    search_id INT NOT NULL REFERENCES saved_searches(id) ON DELETE CASCADE,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    matched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    alerted_at TIMESTAMP,
+    PRIMARY KEY (search_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_search_matches_pending ON saved_search_matches(search_id) WHERE alerted_at IS NULL;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS user_reports;
+DROP TABLE IF EXISTS user_blocks;
+DROP TABLE IF EXISTS messaging_presence;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS conversations;
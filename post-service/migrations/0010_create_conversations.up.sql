@@ -0,0 +1,59 @@
+-- A renter's conversation with a listing's author, one per renter per listing
+CREATE TABLE IF NOT EXISTS conversations (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    renter_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    landlord_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_message_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (post_id, renter_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversations_renter ON conversations(renter_id, last_message_at DESC);
+CREATE INDEX IF NOT EXISTS idx_conversations_landlord ON conversations(landlord_id, last_message_at DESC);
+
+-- Messages in a conversation; read_at is set when the recipient reads it
+CREATE TABLE IF NOT EXISTS messages (
+    id BIGSERIAL PRIMARY KEY,
+    conversation_id INT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    sender_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_messages_unread ON messages(conversation_id, sender_id) WHERE read_at IS NULL;
+
+-- When each user last used messaging; recipients seen recently are not mailed
+CREATE TABLE IF NOT EXISTS messaging_presence (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_seen_at TIMESTAMP NOT NULL
+);
+
+-- Users who don't want messages from another user
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker_id, blocked_id)
+);
+
+-- Reports on a conversation participant, reviewed by moderators
+CREATE TABLE IF NOT EXISTS user_reports (
+    id SERIAL PRIMARY KEY,
+    conversation_id INT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    message_id BIGINT REFERENCES messages(id) ON DELETE SET NULL,
+    reporter_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reported_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL, -- spam, scam, harassment, offensive, other
+    details TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, resolved, dismissed
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_by INT REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP
+);
+
+-- One open report per user per conversation
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_reports_open ON user_reports(conversation_id, reporter_id) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS idx_user_reports_status ON user_reports(status, created_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS viewing_bookings;
+DROP TABLE IF EXISTS viewing_slots;
@@ -0,0 +1,31 @@
+-- Times an owner offers for viewing a listing
+CREATE TABLE IF NOT EXISTS viewing_slots (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_viewing_slots_post ON viewing_slots(post_id, starts_at);
+
+-- A renter's booking of a viewing slot
+CREATE TABLE IF NOT EXISTS viewing_bookings (
+    id SERIAL PRIMARY KEY,
+    slot_id INT NOT NULL REFERENCES viewing_slots(id) ON DELETE CASCADE,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    renter_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'confirmed', -- confirmed, cancelled
+    sequence INT NOT NULL DEFAULT 0, -- iCalendar SEQUENCE, bumped on every change
+    reminder_sent_at TIMESTAMP WITH TIME ZONE,
+    cancelled_by INT REFERENCES users(id) ON DELETE SET NULL,
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A slot can only be booked once, and a renter holds one viewing per listing
+CREATE UNIQUE INDEX IF NOT EXISTS idx_viewing_bookings_slot ON viewing_bookings(slot_id) WHERE status = 'confirmed';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_viewing_bookings_renter ON viewing_bookings(post_id, renter_id) WHERE status = 'confirmed';
+CREATE INDEX IF NOT EXISTS idx_viewing_bookings_renter_list ON viewing_bookings(renter_id, created_at DESC);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS application_status_history;
+DROP TABLE IF EXISTS application_documents;
+DROP TABLE IF EXISTS rental_applications;
@@ -0,0 +1,42 @@
+-- A renter's application to rent a listing
+CREATE TABLE IF NOT EXISTS rental_applications (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    applicant_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    move_in_date DATE NOT NULL,
+    occupants INT NOT NULL CHECK (occupants > 0),
+    message TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'submitted', -- submitted, under_review, accepted, rejected, withdrawn
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A renter has at most one open application per listing
+CREATE UNIQUE INDEX IF NOT EXISTS idx_rental_applications_open ON rental_applications(post_id, applicant_id) WHERE status IN ('submitted', 'under_review');
+CREATE INDEX IF NOT EXISTS idx_rental_applications_post ON rental_applications(post_id, status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_rental_applications_applicant ON rental_applications(applicant_id, created_at DESC);
+
+-- Documents uploaded with an application
+CREATE TABLE IF NOT EXISTS application_documents (
+    id SERIAL PRIMARY KEY,
+    application_id INT NOT NULL REFERENCES rental_applications(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size INT NOT NULL,
+    data BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_application_documents_application ON application_documents(application_id);
+
+-- Every status an application went through, and who moved it there
+CREATE TABLE IF NOT EXISTS application_status_history (
+    id SERIAL PRIMARY KEY,
+    application_id INT NOT NULL REFERENCES rental_applications(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL,
+    changed_by INT REFERENCES users(id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_application_status_history_application ON application_status_history(application_id, created_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS review_reports;
+DROP TABLE IF EXISTS reviews;
@@ -0,0 +1,39 @@
+-- A renter's rating and review of a landlord, left on the listing they
+-- viewed or applied for
+CREATE TABLE IF NOT EXISTS reviews (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    landlord_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reviewer_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    body TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'published', -- published, hidden
+    reply TEXT, -- the landlord's one public reply
+    reply_hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    replied_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (post_id, reviewer_id)
+);
+
+-- Covers the aggregate rating shown with every listing
+CREATE INDEX IF NOT EXISTS idx_reviews_landlord ON reviews(landlord_id, status, rating);
+CREATE INDEX IF NOT EXISTS idx_reviews_post ON reviews(post_id, status, created_at DESC);
+
+-- User reports on a review or its reply
+CREATE TABLE IF NOT EXISTS review_reports (
+    id SERIAL PRIMARY KEY,
+    review_id INT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    target VARCHAR(10) NOT NULL DEFAULT 'review', -- review, reply
+    reporter_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reported_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL, -- spam, fake, offensive, personal_info, other
+    details TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, resolved, dismissed
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_by INT REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP
+);
+
+-- One open report per user per review
+CREATE UNIQUE INDEX IF NOT EXISTS idx_review_reports_open ON review_reports(review_id, reporter_id) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS idx_review_reports_status ON review_reports(status, created_at);
@@ -0,0 +1,6 @@
+DELETE FROM moderation_decisions WHERE post_id IS NULL;
+ALTER TABLE moderation_decisions ALTER COLUMN post_id SET NOT NULL;
+DROP INDEX IF EXISTS idx_conversations_roommates;
+DELETE FROM conversations WHERE post_id IS NULL;
+ALTER TABLE conversations ALTER COLUMN post_id SET NOT NULL;
+DROP TABLE IF EXISTS roommate_profiles;
@@ -0,0 +1,30 @@
+-- Opt-in roommate finder profiles, one per user
+CREATE TABLE IF NOT EXISTS roommate_profiles (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    active BOOLEAN NOT NULL DEFAULT TRUE, -- paused profiles are hidden from matching
+    bio TEXT NOT NULL DEFAULT '',
+    budget_min INT NOT NULL CHECK (budget_min >= 0),
+    budget_max INT NOT NULL,
+    neighborhoods TEXT[] NOT NULL DEFAULT '{}', -- empty means no preference
+    move_in_from DATE NOT NULL,
+    move_in_to DATE NOT NULL,
+    sleep_schedule VARCHAR(20) NOT NULL, -- early_bird, flexible, night_owl
+    cleanliness SMALLINT NOT NULL CHECK (cleanliness BETWEEN 1 AND 5),
+    pets VARCHAR(20) NOT NULL, -- have_pets, ok_with_pets, no_pets
+    smoking VARCHAR(20) NOT NULL, -- smoker, outdoors_only, non_smoker
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (budget_max >= budget_min),
+    CHECK (move_in_to >= move_in_from)
+);
+
+CREATE INDEX IF NOT EXISTS idx_roommate_profiles_active ON roommate_profiles(updated_at DESC) WHERE active;
+
+-- Roommate conversations are between two renters and have no listing.
+-- renter_id is who started it and landlord_id the other renter.
+ALTER TABLE conversations ALTER COLUMN post_id DROP NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_roommates
+    ON conversations(LEAST(renter_id, landlord_id), GREATEST(renter_id, landlord_id)) WHERE post_id IS NULL;
+
+-- Decisions on reports about roommate conversations have no listing either
+ALTER TABLE moderation_decisions ALTER COLUMN post_id DROP NOT NULL;
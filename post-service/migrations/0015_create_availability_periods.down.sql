@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS availability_feeds;
+DROP TABLE IF EXISTS availability_blocks;
+DROP TABLE IF EXISTS availability_periods;
@@ -0,0 +1,40 @@
+-- Periods a listing can be rented in, optionally at their own price.
+-- posts.available_from/available_to hold the earliest start and latest end.
+CREATE TABLE IF NOT EXISTS availability_periods (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    starts_on DATE NOT NULL,
+    ends_on DATE NOT NULL, -- inclusive
+    price DECIMAL(10, 2), -- NULL uses the listing's price
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_on >= starts_on)
+);
+
+CREATE INDEX IF NOT EXISTS idx_availability_periods_post ON availability_periods(post_id, starts_on);
+
+-- Dates an owner blocked inside or around the periods
+CREATE TABLE IF NOT EXISTS availability_blocks (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    starts_on DATE NOT NULL,
+    ends_on DATE NOT NULL, -- inclusive
+    note TEXT NOT NULL DEFAULT '', -- only shown to the owner
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_on >= starts_on)
+);
+
+CREATE INDEX IF NOT EXISTS idx_availability_blocks_post ON availability_blocks(post_id, starts_on);
+
+-- Secret iCal feed URL of a listing's availability, one per listing
+CREATE TABLE IF NOT EXISTS availability_feeds (
+    post_id INT PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Every existing listing starts with its single period
+INSERT INTO availability_periods (post_id, starts_on, ends_on)
+SELECT id, available_from::date, GREATEST(available_from::date, COALESCE(available_to::date, available_from::date))
+FROM posts
+WHERE available_from IS NOT NULL;
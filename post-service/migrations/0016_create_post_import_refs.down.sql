@@ -0,0 +1 @@
+DROP TABLE IF EXISTS post_import_refs;
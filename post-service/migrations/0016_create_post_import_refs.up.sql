@@ -0,0 +1,8 @@
+-- An author's own reference for a listing, e.g. a unit number from their
+-- property management software, so bulk imports can update it in place
+CREATE TABLE IF NOT EXISTS post_import_refs (
+    post_id INT PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+    author_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    external_ref VARCHAR(100) NOT NULL,
+    UNIQUE (author_id, external_ref)
+);
@@ -0,0 +1,14 @@
+-- Neighborhood boundaries, loaded with `postApp neighborhoods import`.
+-- Listings with coordinates get the name of the neighborhood they fall in.
+CREATE TABLE IF NOT EXISTS neighborhoods (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(100) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    boundary JSONB NOT NULL, -- GeoJSON Polygon or MultiPolygon
+    -- Bounding box, to find the candidates for a point before testing shapes
+    min_lat DOUBLE PRECISION NOT NULL,
+    min_lng DOUBLE PRECISION NOT NULL,
+    max_lat DOUBLE PRECISION NOT NULL,
+    max_lng DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,18 @@
+-- Monthly rental market rollup by neighborhood x bedrooms x type, rebuilt by
+-- a scheduled job from post_revisions. '*' (or -1 for bedrooms) is the
+-- bucket of all values; bedrooms 4 means four or more. Prices are NULL in
+-- buckets too small to publish.
+CREATE TABLE IF NOT EXISTS market_stats (
+    month DATE NOT NULL, -- first day of the month
+    neighborhood VARCHAR(255) NOT NULL,
+    bedrooms INT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    listings INT NOT NULL, -- on the market at some point in the month
+    new_listings INT NOT NULL, -- first listed in the month
+    p25 DECIMAL(10, 2),
+    median DECIMAL(10, 2),
+    p75 DECIMAL(10, 2),
+    suppressed BOOLEAN NOT NULL DEFAULT FALSE,
+    computed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (month, neighborhood, bedrooms, type)
+);
@@ -0,0 +1,14 @@
+// Package neighborhoods embeds the neighborhood boundaries the post service
+// ships with
+package neighborhoods
+
+import "embed"
+
+// Default is the file `neighborhoods import` loads when given none. Its
+// boundaries are approximate.
+const Default = "davis.geojson"
+
+// FS holds GeoJSON FeatureCollections whose features carry a name property
+//
+//go:embed *.geojson
+var FS embed.FS
@@ -0,0 +1,219 @@
+package screening
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // register GIF decoder
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// maxImageBytes caps how much of an image is read for hashing
+	maxImageBytes = 10 << 20
+	// maxImagePixels caps the decoded size of an image. A small compressed
+	// file can claim huge dimensions, so they are checked before decoding.
+	maxImagePixels = 24 << 20
+)
+
+// AllowedHosts are the hosts remote photos are fetched from for hashing,
+// e.g. "images.example.com", or ".example.com" for all its subdomains.
+// Photos on other hosts aren't hashed. It is set once at startup.
+var AllowedHosts []string
+
+var imageClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: publicAddressOnly,
+		}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return errors.New("too many redirects")
+		}
+		if !AllowedHost(req.URL.String()) {
+			return fmt.Errorf("redirect to %s is not allowed", req.URL.Hostname())
+		}
+		return nil
+	},
+}
+
+// IsInline reports whether an image is a data URL carried in the post itself
+func IsInline(src string) bool {
+	return strings.HasPrefix(src, "data:")
+}
+
+// AllowedHost reports whether src is an http(s) URL on one of AllowedHosts
+func AllowedHost(src string) bool {
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range AllowedHosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		switch {
+		case allowed == "":
+		case strings.HasPrefix(allowed, "."):
+			if strings.HasSuffix(host, allowed) {
+				return true
+			}
+		case host == allowed:
+			return true
+		}
+	}
+	return false
+}
+
+// publicAddressOnly refuses connections to loopback, private, link-local
+// and other non-public addresses, so image URLs can't reach services on the
+// internal network. It runs on the resolved address, after DNS.
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("image host %s is not a public address", host)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598)
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// ImageHash returns the 64-bit difference hash (dHash) of an image. src is
+// either a base64 data URL as sent by the frontend or an http(s) URL on one
+// of AllowedHosts. Re-encoded, resized or slightly recoloured copies of a
+// photo produce hashes within a few bits of each other.
+func ImageHash(src string) (uint64, error) {
+	img, err := loadImage(src)
+	if err != nil {
+		return 0, err
+	}
+	return dHash(img), nil
+}
+
+func loadImage(src string) (image.Image, error) {
+	var r io.Reader
+
+	switch {
+	case IsInline(src):
+		comma := strings.Index(src, ",")
+		if comma < 0 || !strings.Contains(src[:comma], ";base64") {
+			return nil, errors.New("unsupported data URL")
+		}
+		r = base64.NewDecoder(base64.StdEncoding, strings.NewReader(src[comma+1:]))
+	case AllowedHost(src):
+		resp, err := imageClient.Get(src)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("image fetch returned status: %d", resp.StatusCode)
+		}
+		r = resp.Body
+	default:
+		return nil, errors.New("image is not inline or on an allowed host")
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r, maxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > maxImageBytes {
+		return nil, errors.New("image is too large")
+	}
+
+	return decodeImage(raw)
+}
+
+// decodeImage decodes an image after checking its dimensions against
+// maxImagePixels
+func decodeImage(raw []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > maxImagePixels/config.Height {
+		return nil, fmt.Errorf("image dimensions %dx%d are too large", config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	return img, err
+}
+
+// dHash shrinks the image to 9x8 grey cells and sets one bit per cell that
+// is brighter than its right-hand neighbour
+func dHash(img image.Image) uint64 {
+	const cols, rows = 9, 8
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+
+	// Sample large images sparsely; the hash only needs 72 averages
+	step := 1
+	if longest := max(w, h); longest > 512 {
+		step = longest / 512
+	}
+
+	var sum [rows][cols]float64
+	var count [rows][cols]int
+	for y := 0; y < h; y += step {
+		cy := y * rows / h
+		for x := 0; x < w; x += step {
+			cx := x * cols / w
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			sum[cy][cx] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			count[cy][cx]++
+		}
+	}
+
+	var grey [rows][cols]float64
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			if count[y][x] > 0 {
+				grey[y][x] = sum[y][x] / float64(count[y][x])
+			}
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols-1; x++ {
+			hash <<= 1
+			if grey[y][x] > grey[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
@@ -0,0 +1,58 @@
+package screening
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// MinFingerprintWords is the shortest description worth fingerprinting;
+// short texts share too many phrases to say anything about duplication
+const MinFingerprintWords = 20
+
+// TextFingerprint returns a 64-bit SimHash of a description built from its
+// words and word pairs. Near-identical texts differ in only a few bits.
+// ok is false when the text is too short to compare meaningfully.
+func TextFingerprint(text string) (hash uint64, ok bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) < MinFingerprintWords {
+		return 0, false
+	}
+
+	var weights [64]int
+	add := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		v := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if v&(1<<uint(i)) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+
+	for i, word := range words {
+		add(word)
+		if i > 0 {
+			add(words[i-1] + " " + word)
+		}
+	}
+
+	for i := 0; i < 64; i++ {
+		if weights[i] > 0 {
+			hash |= 1 << uint(i)
+		}
+	}
+
+	return hash, true
+}
+
+// Distance is the number of differing bits between two fingerprints
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
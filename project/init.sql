@@ -1,51 +0,0 @@
-CREATE TABLE IF NOT EXISTS users (
-    id SERIAL PRIMARY KEY,
-    google_id VARCHAR(255),
-    email VARCHAR(255) UNIQUE NOT NULL,
-    first_name VARCHAR(255),
-    last_name VARCHAR(255),
-    password VARCHAR(255),
-    user_active INT DEFAULT 1,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE IF NOT EXISTS posts (
-    id SERIAL PRIMARY KEY,
-    title VARCHAR(255) NOT NULL,
-    price DECIMAL(10, 2) NOT NULL,
-    location VARCHAR(255),
-    neighborhood VARCHAR(255) NOT NULL,
-    lat DECIMAL(10, 7) NOT NULL,
-    lng DECIMAL(10, 7) NOT NULL,
-    radius INT DEFAULT 300,
-    type VARCHAR(50) NOT NULL,
-    image_url TEXT,
-    additional_images TEXT[],
-    description TEXT,
-    bedrooms INT DEFAULT 1,
-    bathrooms INT DEFAULT 1,
-    available_from TIMESTAMP,
-    available_to TIMESTAMP,
-    author_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- Index for faster queries
-CREATE INDEX IF NOT EXISTS idx_posts_author_id ON posts(author_id);
-CREATE INDEX IF NOT EXISTS idx_posts_neighborhood ON posts(neighborhood);
-CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts(created_at DESC);
-
--- Favorites table
-CREATE TABLE IF NOT EXISTS favorites (
-    user_id     INTEGER NOT NULL,
-    post_id     INTEGER NOT NULL,
-    created_at  TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-    PRIMARY KEY (user_id, post_id),
-    CONSTRAINT fk_favorites_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-    CONSTRAINT fk_favorites_post FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
-);
-
-CREATE INDEX IF NOT EXISTS idx_favorites_user_id ON favorites(user_id);
-CREATE INDEX IF NOT EXISTS idx_favorites_post_id ON favorites(post_id);
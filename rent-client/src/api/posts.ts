@@ -45,6 +45,11 @@ const extractError = (err: unknown): ApiError => {
   return { message: String(err) };
 };
 
+// If-Match header for a write to a post; the service rejects writes without it
+const ifMatch = (postId: number, version?: number) => ({
+  'If-Match': version !== undefined ? `"post-${postId}-v${version}"` : '*',
+});
+
 /**
  * Fetch all posts/listings (RESTful GET /posts)
  */
@@ -111,7 +116,7 @@ export async function updatePost(listing: Listing, authorId: number): Promise<Po
       availableFrom: listing.availableFrom,
       availableTo: listing.availableTo,
       authorId: authorId,
-    });
+    }, { headers: ifMatch(postId, listing.version) });
     return res.data;
   } catch (err) {
     const error = extractError(err);
@@ -122,11 +127,12 @@ export async function updatePost(listing: Listing, authorId: number): Promise<Po
 /**
  * Delete a post/listing (RESTful DELETE /posts/{id})
  */
-export async function deletePost(id: string, authorId: number): Promise<PostResponse> {
+export async function deletePost(id: string, authorId: number, version?: number): Promise<PostResponse> {
   try {
     const postId = typeof id === 'number' ? id : parseInt(id);
     const res = await postsClient.delete<PostResponse>(`/posts/${postId}`, {
       data: { authorId: authorId },
+      headers: ifMatch(postId, version),
     });
     return res.data;
   } catch (err) {
@@ -117,7 +117,8 @@ export const useListingsStore = create<ListingsState>((set, get) => ({
     set({ isLoading: true, error: null });
     try {
       if (authorId) {
-        const response = await postsApi.deletePost(id, authorId);
+        const version = get().listings.find((l) => l.id === id)?.version;
+        const response = await postsApi.deletePost(id, authorId, version);
         if (!response.error) {
           set((state) => ({
             listings: state.listings.filter((l) => l.id !== id),
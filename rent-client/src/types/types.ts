@@ -18,6 +18,7 @@ export interface Listing {
   createdAt: number;
   availableFrom: number; // timestamp
   availableTo: number;   // timestamp
+  version?: number; // bumped on every write, sent back in If-Match
   author: {
     name: string;
     avatar?: string;